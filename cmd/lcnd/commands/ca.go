@@ -0,0 +1,414 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/utils"
+	"github.com/spf13/cobra"
+)
+
+const (
+	caCertFile = "ca.crt"
+	caKeyFile  = "ca.key"
+	caCRLFile  = "ca.crl"
+)
+
+var (
+	caDir        string
+	caKeyType    string
+	caDays       int
+	caNodeID     string
+	caSerial     string
+	caCommonName string
+)
+
+// caCmd represents the ca command
+var caCmd = &cobra.Command{
+	Use:   "ca",
+	Short: "Manage the certificate authority of the nodes",
+	Long:  `Manage the certificate authority of the nodes, the files are written in the layout of the ca.cert section of the config file: ca.crt and ca.key of the CA, and <nodeId>/<nodeId>.key, <nodeId>/<nodeId>.crt, <nodeId>/ca.crt and <nodeId>/ca.crl of every node`,
+}
+
+// caInitRootCmd represents the ca init-root command
+var caInitRootCmd = &cobra.Command{
+	Use:   "init-root",
+	Short: "Create the key and the self-signed certificate of the CA",
+	Long:  `Create the key and the self-signed certificate of the CA in the directory, an existing CA is never overwritten`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := initRoot(); err != nil {
+			fmt.Println("init root error:", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+// caIssueNodeCmd represents the ca issue-node command
+var caIssueNodeCmd = &cobra.Command{
+	Use:   "issue-node",
+	Short: "Issue the key and the certificate of a node",
+	Long:  `Issue the key and the certificate of a node signed by the CA, the nodeId is the common name of the certificate subject and the peers only accept the certificate from this nodeId`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := issueNode(); err != nil {
+			fmt.Println("issue node error:", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+// caInspectCmd represents the ca inspect command
+var caInspectCmd = &cobra.Command{
+	Use:   "inspect <file>",
+	Short: "Print a certificate or a revocation list",
+	Long:  `Print a certificate or a revocation list, a certificate is also verified against the CA and the revocation list of the directory if they exist`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			os.Exit(-1)
+		}
+		if err := inspect(args[0]); err != nil {
+			fmt.Println("inspect error:", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+// caRevokeCmd represents the ca revoke command
+var caRevokeCmd = &cobra.Command{
+	Use:   "revoke [certificate]",
+	Short: "Revoke a certificate issued by the CA",
+	Long:  `Revoke the certificate of the file or of the serial number, the revocation list is written to the CA directory and to every node directory, the nodes reload it on SIGHUP`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 1 {
+			cmd.Usage()
+			os.Exit(-1)
+		}
+		if err := revoke(args); err != nil {
+			fmt.Println("revoke error:", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func newCertificate(info crypto.CertInformation) (*x509.Certificate, error) {
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	cert := crypto.NewCertificate(info)
+	cert.SerialNumber = serial
+	cert.NotAfter = cert.NotBefore.AddDate(0, 0, caDays)
+	return cert, nil
+}
+
+func writeNewFile(path string, data []byte, perm os.FileMode) error {
+	if utils.FileExist(path) {
+		return fmt.Errorf("%s already exists", path)
+	}
+	return ioutil.WriteFile(path, data, perm)
+}
+
+func loadCA() (*x509.Certificate, gocrypto.Signer, error) {
+	certBytes, err := ioutil.ReadFile(filepath.Join(caDir, caCertFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	keyBytes, err := ioutil.ReadFile(filepath.Join(caDir, caKeyFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := crypto.ParseCrt(certBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := crypto.ParseSigner(keyBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !crypto.MatchSigner(cert, key) {
+		return nil, nil, errors.New("certificate of the CA doesn't match its key")
+	}
+	return cert, key, nil
+}
+
+func initRoot() error {
+	if err := os.MkdirAll(caDir, 0755); err != nil {
+		return err
+	}
+	if utils.FileExist(filepath.Join(caDir, caKeyFile)) {
+		return fmt.Errorf("%s already exists", filepath.Join(caDir, caKeyFile))
+	}
+
+	key, err := crypto.GenerateSigner(caKeyType)
+	if err != nil {
+		return err
+	}
+	cert, err := newCertificate(crypto.CertInformation{CommonName: caCommonName, IsCA: true})
+	if err != nil {
+		return err
+	}
+	certBytes, err := crypto.GenerateCertificateBytes(cert, cert, key.Public(), key)
+	if err != nil {
+		return err
+	}
+	keyBytes, err := crypto.GenerateSignerBytes(key)
+	if err != nil {
+		return err
+	}
+
+	if err := writeNewFile(filepath.Join(caDir, caKeyFile), keyBytes, 0600); err != nil {
+		return err
+	}
+	if err := writeNewFile(filepath.Join(caDir, caCertFile), certBytes, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("CA %s created in %s\n", cert.SerialNumber, caDir)
+	return nil
+}
+
+func issueNode() error {
+	if caNodeID == "" {
+		return errors.New("nodeId is empty")
+	}
+	if filepath.Base(caNodeID) != caNodeID {
+		return fmt.Errorf("invalid nodeId %s", caNodeID)
+	}
+	ca, caKey, err := loadCA()
+	if err != nil {
+		return err
+	}
+
+	nodeDir := filepath.Join(caDir, caNodeID)
+	keyPath := filepath.Join(nodeDir, caNodeID+".key")
+	if utils.FileExist(keyPath) {
+		return fmt.Errorf("%s already exists", keyPath)
+	}
+	if err := os.MkdirAll(nodeDir, 0755); err != nil {
+		return err
+	}
+
+	key, err := crypto.GenerateSigner(caKeyType)
+	if err != nil {
+		return err
+	}
+	cert, err := newCertificate(crypto.CertInformation{CommonName: caNodeID})
+	if err != nil {
+		return err
+	}
+	cert.KeyUsage = x509.KeyUsageDigitalSignature
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		cert.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	certBytes, err := crypto.GenerateCertificateBytes(cert, ca, key.Public(), caKey)
+	if err != nil {
+		return err
+	}
+	keyBytes, err := crypto.GenerateSignerBytes(key)
+	if err != nil {
+		return err
+	}
+	caBytes, err := ioutil.ReadFile(filepath.Join(caDir, caCertFile))
+	if err != nil {
+		return err
+	}
+
+	if err := writeNewFile(keyPath, keyBytes, 0600); err != nil {
+		return err
+	}
+	if err := writeNewFile(filepath.Join(nodeDir, caNodeID+".crt"), certBytes, 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(nodeDir, caCertFile), caBytes, 0644); err != nil {
+		return err
+	}
+	if crlBytes, err := ioutil.ReadFile(filepath.Join(caDir, caCRLFile)); err == nil {
+		if err := ioutil.WriteFile(filepath.Join(nodeDir, caCRLFile), crlBytes, 0644); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("node %s certificate %s issued in %s\n", caNodeID, cert.SerialNumber, nodeDir)
+	return nil
+}
+
+func keyAlgorithm(publicKey gocrypto.PublicKey) string {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", key.Curve.Params().Name)
+	}
+	return "unknown"
+}
+
+func readCRL(path string) (*x509.RevocationList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.ParseCRL(data)
+}
+
+func inspect(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if p, _ := pem.Decode(data); p == nil || p.Type != "CERTIFICATE" {
+		crl, err := crypto.ParseCRL(data)
+		if err != nil {
+			return errors.New("neither a certificate nor a revocation list")
+		}
+		fmt.Printf("revocation list %s\n", crl.Number)
+		fmt.Printf("  issuer:      %s\n", crl.Issuer)
+		fmt.Printf("  this update: %v\n", crl.ThisUpdate)
+		fmt.Printf("  next update: %v\n", crl.NextUpdate)
+		for _, entry := range crl.RevokedCertificateEntries {
+			fmt.Printf("  revoked:     %s at %v\n", entry.SerialNumber, entry.RevocationTime)
+		}
+		return nil
+	}
+
+	cert, err := crypto.ParseCrt(data)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("certificate %s\n", cert.SerialNumber)
+	fmt.Printf("  subject:     %s\n", cert.Subject)
+	fmt.Printf("  nodeId:      %s\n", cert.Subject.CommonName)
+	fmt.Printf("  issuer:      %s\n", cert.Issuer)
+	fmt.Printf("  key:         %s\n", keyAlgorithm(cert.PublicKey))
+	fmt.Printf("  CA:          %v\n", cert.IsCA)
+	fmt.Printf("  not before:  %v\n", cert.NotBefore)
+	fmt.Printf("  not after:   %v\n", cert.NotAfter)
+
+	caBytes, err := ioutil.ReadFile(filepath.Join(caDir, caCertFile))
+	if err != nil {
+		return nil
+	}
+	ca, err := crypto.ParseCrt(caBytes)
+	if err != nil {
+		return err
+	}
+	status := "valid"
+	if err := crypto.VerifyCertificate(ca, cert); err != nil {
+		status = fmt.Sprintf("not issued by %s: %s", filepath.Join(caDir, caCertFile), err)
+	} else if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		status = "expired"
+	} else if crl, err := readCRL(filepath.Join(caDir, caCRLFile)); err == nil {
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				status = fmt.Sprintf("revoked at %v", entry.RevocationTime)
+			}
+		}
+	}
+	fmt.Printf("  status:      %s\n", status)
+	return nil
+}
+
+func revoke(args []string) error {
+	ca, caKey, err := loadCA()
+	if err != nil {
+		return err
+	}
+
+	serial, ok := new(big.Int).SetString(caSerial, 10)
+	if len(args) == 1 {
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		cert, err := crypto.ParseCrt(data)
+		if err != nil {
+			return err
+		}
+		if err := crypto.VerifyCertificate(ca, cert); err != nil {
+			return fmt.Errorf("%s isn't issued by the CA: %s", args[0], err)
+		}
+		serial, ok = cert.SerialNumber, true
+	}
+	if !ok {
+		return errors.New("neither a certificate nor a serial number to revoke")
+	}
+
+	template := &x509.RevocationList{Number: big.NewInt(1)}
+	if crl, err := readCRL(filepath.Join(caDir, caCRLFile)); err == nil {
+		template.Number = new(big.Int).Add(crl.Number, big.NewInt(1))
+		template.RevokedCertificateEntries = crl.RevokedCertificateEntries
+	}
+	for _, entry := range template.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(serial) == 0 {
+			return fmt.Errorf("certificate %s is already revoked", serial)
+		}
+	}
+	template.ThisUpdate = time.Now()
+	template.NextUpdate = template.ThisUpdate.AddDate(0, 0, caDays)
+	template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{SerialNumber: serial, RevocationTime: template.ThisUpdate})
+
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca, caKey)
+	if err != nil {
+		return err
+	}
+	crlBytes := pem.EncodeToMemory(&pem.Block{Bytes: der, Type: "X509 CRL"})
+	if err := ioutil.WriteFile(filepath.Join(caDir, caCRLFile), crlBytes, 0644); err != nil {
+		return err
+	}
+
+	nodeDirs, _ := filepath.Glob(filepath.Join(caDir, "*", caCertFile))
+	for _, path := range nodeDirs {
+		if err := ioutil.WriteFile(filepath.Join(filepath.Dir(path), caCRLFile), crlBytes, 0644); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("certificate %s revoked, revocation list %s written to %d node directories, send SIGHUP to the nodes to reload it\n", serial, template.Number, len(nodeDirs))
+	return nil
+}
+
+func init() {
+	caCmd.PersistentFlags().StringVar(&caDir, "dir", "ca_certificate", "directory of the CA")
+	caCmd.PersistentFlags().IntVar(&caDays, "days", 3650, "days the certificate or the revocation list is valid")
+	caInitRootCmd.Flags().StringVar(&caKeyType, "key", "rsa", "key type, rsa or ecdsa")
+	caInitRootCmd.Flags().StringVar(&caCommonName, "name", "L0 CA", "common name of the CA")
+	caIssueNodeCmd.Flags().StringVar(&caKeyType, "key", "rsa", "key type, rsa or ecdsa")
+	caIssueNodeCmd.Flags().StringVar(&caNodeID, "id", "", "nodeId of the node, the blockchain.nodeId of its config file")
+	caRevokeCmd.Flags().StringVar(&caSerial, "serial", "", "serial number of the certificate to revoke")
+	caCmd.AddCommand(caInitRootCmd)
+	caCmd.AddCommand(caIssueNodeCmd)
+	caCmd.AddCommand(caInspectCmd)
+	caCmd.AddCommand(caRevokeCmd)
+	RootCmd.AddCommand(caCmd)
+}
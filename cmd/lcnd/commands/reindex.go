@@ -0,0 +1,50 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// reindexCmd represents the reindex command
+var reindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "Rebuild the address index of transactions",
+	Long:  `Rebuild the address index of transactions for the data directory created by an older lcnd, the node must be stopped`,
+	Run: func(cmd *cobra.Command, args []string) {
+		chainDb, l, err := openLedger()
+		if err != nil {
+			fmt.Println("open ledger error:", err)
+			os.Exit(-1)
+		}
+		defer chainDb.Close()
+		if err := l.ReindexAddressTxs(); err != nil {
+			fmt.Println("reindex error:", err)
+			os.Exit(-1)
+		}
+		fmt.Println("reindex done")
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(reindexCmd)
+}
@@ -0,0 +1,156 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/db"
+	"github.com/bocheninc/L0/config"
+	"github.com/bocheninc/L0/core/ledger"
+	"github.com/bocheninc/L0/core/params"
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapshotFile       string
+	trustedHash        string
+	trustedStorageHash string
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Export or import the state snapshot",
+	Long:  `Export or import the state snapshot, a new node bootstraps from a trusted snapshot and then syncs only the following blocks`,
+}
+
+// snapshotExportCmd represents the snapshot export command
+var snapshotExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the state snapshot at the current height",
+	Long:  `Export the state snapshot at the current height to the file, the manifest is written to the file with .manifest suffix, the node must be stopped`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := exportSnapshot(); err != nil {
+			fmt.Println("export snapshot error:", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+// snapshotImportCmd represents the snapshot import command
+var snapshotImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import the state snapshot into an empty data directory",
+	Long:  `Import the state snapshot into an empty data directory, the block hash of the manifest must equal the trusted block hash, the merge storage isn't committed by the block hash and is checked against the trusted storage hash if it is given`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := importSnapshot(); err != nil {
+			fmt.Println("import snapshot error:", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+func openLedger() (*db.BlockchainDB, *ledger.Ledger, error) {
+	cfg, err := config.New(cfgFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	// offline commands must not prune the blocks they read
+	params.Pruning = 0
+	chainDb := db.NewDB(cfg.DbConfig)
+	return chainDb, ledger.NewLedger(chainDb), nil
+}
+
+func exportSnapshot() error {
+	chainDb, l, err := openLedger()
+	if err != nil {
+		return err
+	}
+	defer chainDb.Close()
+
+	f, err := os.Create(snapshotFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	manifest, err := l.ExportSnapshot(f)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(snapshotFile+".manifest", data, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("export snapshot at height %d, block hash %s, storage hash %s\n", manifest.Height, manifest.BlockHash, manifest.StorageHash)
+	return nil
+}
+
+func importSnapshot() error {
+	data, err := ioutil.ReadFile(snapshotFile + ".manifest")
+	if err != nil {
+		return err
+	}
+	manifest := new(ledger.SnapshotManifest)
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return err
+	}
+	if !manifest.BlockHash.Equal(crypto.HexToHash(trustedHash)) {
+		return errors.New("block hash of the manifest is not the trusted one " + manifest.BlockHash.String())
+	}
+	if trustedStorageHash != "" && !manifest.StorageHash.Equal(crypto.HexToHash(trustedStorageHash)) {
+		return errors.New("storage hash of the manifest is not the trusted one " + manifest.StorageHash.String())
+	}
+
+	f, err := os.Open(snapshotFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	chainDb, l, err := openLedger()
+	if err != nil {
+		return err
+	}
+	defer chainDb.Close()
+
+	if err := l.ImportSnapshot(f, manifest); err != nil {
+		return err
+	}
+	fmt.Printf("import snapshot at height %d, block hash %s\n", manifest.Height, manifest.BlockHash)
+	return nil
+}
+
+func init() {
+	snapshotCmd.PersistentFlags().StringVar(&snapshotFile, "file", "snapshot.dat", "snapshot file")
+	snapshotImportCmd.Flags().StringVar(&trustedHash, "hash", "", "trusted block hash of the snapshot height")
+	snapshotImportCmd.Flags().StringVar(&trustedStorageHash, "storage-hash", "", "trusted merge storage hash of the snapshot")
+	snapshotCmd.AddCommand(snapshotExportCmd)
+	snapshotCmd.AddCommand(snapshotImportCmd)
+	RootCmd.AddCommand(snapshotCmd)
+}
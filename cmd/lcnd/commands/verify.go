@@ -0,0 +1,80 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/bocheninc/L0/components/db"
+	"github.com/bocheninc/L0/core/ledger"
+	"github.com/spf13/cobra"
+)
+
+var scratchDir string
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the integrity of the ledger",
+	Long:  `Verify the header links and the transactions of every block, re-execute the transactions into a scratch database and compare the balances and the contract state, the node must be stopped`,
+	Run: func(cmd *cobra.Command, args []string) {
+		report, err := verifyLedger()
+		if err != nil {
+			fmt.Println("verify error:", err)
+			os.Exit(-1)
+		}
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+		if report.Divergent {
+			fmt.Printf("ledger diverges at height %d: %s\n", report.DivergentHeight, report.Reason)
+			os.Exit(1)
+		}
+		fmt.Printf("ledger verified up to height %d\n", report.Height)
+	},
+}
+
+func verifyLedger() (*ledger.VerifyReport, error) {
+	chainDb, l, err := openLedger()
+	if err != nil {
+		return nil, err
+	}
+	defer chainDb.Close()
+
+	dir := scratchDir
+	if dir == "" {
+		if dir, err = ioutil.TempDir("", "lcnd-verify"); err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+	}
+	scratchConfig := db.DefaultConfig()
+	scratchConfig.DbPath = dir
+	scratchDb := db.OpenDB(scratchConfig)
+	defer scratchDb.Close()
+
+	return l.Verify(scratchDb)
+}
+
+func init() {
+	verifyCmd.Flags().StringVar(&scratchDir, "scratch", "", "empty directory of the scratch database (default is a temporary directory removed after verifying)")
+	RootCmd.AddCommand(verifyCmd)
+}
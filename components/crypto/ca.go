@@ -21,12 +21,15 @@ package crypto
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"math/big"
 	rd "math/rand"
@@ -60,14 +63,94 @@ func Parse(cert, key []byte) (rootCertificate *x509.Certificate, rootPrivateKey
 
 func ParseCrt(data []byte) (*x509.Certificate, error) {
 	p, _ := pem.Decode(data)
+	if p == nil {
+		return nil, errors.New("invalid pem certificate")
+	}
 	return x509.ParseCertificate(p.Bytes)
 }
 
+// ParseCRL parses the certificate revocation list in pem or der
+func ParseCRL(data []byte) (*x509.RevocationList, error) {
+	if p, _ := pem.Decode(data); p != nil {
+		data = p.Bytes
+	}
+	return x509.ParseRevocationList(data)
+}
+
 func ParseKey(data []byte) (*rsa.PrivateKey, error) {
 	p, _ := pem.Decode(data)
+	if p == nil {
+		return nil, errors.New("invalid pem private key")
+	}
 	return x509.ParsePKCS1PrivateKey(p.Bytes)
 }
 
+// ParseSigner parses the rsa or ecdsa private key in pem
+func ParseSigner(data []byte) (crypto.Signer, error) {
+	p, _ := pem.Decode(data)
+	if p == nil {
+		return nil, errors.New("invalid pem private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(p.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(p.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(p.Bytes)
+	if err != nil {
+		return nil, errors.New("private key is neither rsa nor ecdsa")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key is neither rsa nor ecdsa")
+	}
+	return signer, nil
+}
+
+// GenerateSigner generates a rsa key with 2048 bits or an ecdsa key on P-256
+func GenerateSigner(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case "rsa":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "ecdsa":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	return nil, fmt.Errorf("unknown key type %s", keyType)
+}
+
+// GenerateSignerBytes encodes the rsa or ecdsa private key in pem
+func GenerateSignerBytes(signer crypto.Signer) ([]byte, error) {
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		return GeneratePrivateKeyBytes(key)
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Bytes: der, Type: "EC PRIVATE KEY"}), nil
+	}
+	return nil, errors.New("private key is neither rsa nor ecdsa")
+}
+
+// GenerateCertificateBytes issues the certificate of the public key signed by the parent, in pem
+func GenerateCertificateBytes(certificate, parent *x509.Certificate, publicKey crypto.PublicKey, parentKey crypto.Signer) ([]byte, error) {
+	cert, err := x509.CreateCertificate(rand.Reader, certificate, parent, publicKey, parentKey)
+	if err != nil {
+		return nil, fmt.Errorf("create cert error: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Bytes: cert, Type: "CERTIFICATE"}), nil
+}
+
+// MatchSigner reports whether the certificate is issued to the private key
+func MatchSigner(certificate *x509.Certificate, signer crypto.Signer) bool {
+	publicKey, ok := signer.Public().(interface {
+		Equal(crypto.PublicKey) bool
+	})
+	return ok && publicKey.Equal(certificate.PublicKey)
+}
+
 func GenerateRootCertificateBytes(rootCertificate *x509.Certificate, rootPrivateKey *rsa.PrivateKey) ([]byte, error) {
 	cert, err := x509.CreateCertificate(rand.Reader, rootCertificate, rootCertificate, &rootPrivateKey.PublicKey, rootPrivateKey)
 	if err != nil {
@@ -97,15 +180,33 @@ func VerifyCertificate(rootCertificate, Certificate *x509.Certificate) error {
 }
 
 func SignRsa(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
+	return SignData(privateKey, data)
+}
+
+// SignData signs the sha256 of data, pkcs1v15 for rsa keys and asn1 for ecdsa keys
+func SignData(signer crypto.Signer, data []byte) ([]byte, error) {
 	hashed := sha256.Sum256(data)
-	return rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+	return signer.Sign(rand.Reader, hashed[:], crypto.SHA256)
 }
 
 func VerifySign(hashed [sha256.Size]byte, sign []byte, Certificate *x509.Certificate) error {
-	return rsa.VerifyPKCS1v15(Certificate.PublicKey.(*rsa.PublicKey), crypto.SHA256, hashed[:], sign)
+	switch publicKey := Certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], sign)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(publicKey, hashed[:], sign) {
+			return errors.New("ecdsa verification error")
+		}
+		return nil
+	}
+	return errors.New("certificate public key is neither rsa nor ecdsa")
 }
 
 func NewCertificate(info CertInformation) *x509.Certificate {
+	keyUsage := x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign
+	if info.IsCA {
+		keyUsage |= x509.KeyUsageCRLSign
+	}
 	return &x509.Certificate{
 		SerialNumber: big.NewInt(rd.Int63()),
 		Subject: pkix.Name{
@@ -122,7 +223,7 @@ func NewCertificate(info CertInformation) *x509.Certificate {
 		BasicConstraintsValid: true,
 		IsCA:           info.IsCA,
 		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		KeyUsage:       keyUsage,
 		EmailAddresses: info.EmailAddress,
 	}
 }
@@ -20,7 +20,11 @@ package crypto
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -79,10 +83,38 @@ func TestHash(t *testing.T) {
 	}
 }
 
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 7; n++ {
+		var hashs []Hash
+		for i := 0; i < n; i++ {
+			hashs = append(hashs, Sha256([]byte{byte(i)}))
+		}
+		root := GetMerkleHash(hashs)
+
+		for i := 0; i < n; i++ {
+			proof := ComputeMerkleProof(hashs, i)
+			if !VerifyMerkleProof(root, hashs[i], i, n, proof) {
+				t.Errorf("merkle proof of leaf %d in %d leafs verify failed", i, n)
+			}
+			if i^1 < n && VerifyMerkleProof(root, hashs[i], i^1, n, proof) {
+				t.Errorf("merkle proof of leaf %d in %d leafs verified at wrong index", i, n)
+			}
+			// the duplicated last leaf has no index of its own
+			if VerifyMerkleProof(root, hashs[i], n, n, proof) || VerifyMerkleProof(root, hashs[i], n, n+1, proof) {
+				t.Errorf("merkle proof of leaf %d in %d leafs verified out of range", i, n)
+			}
+		}
+	}
+}
+
 func TestLoadAndSaveECDSA(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "crypto-nodekey")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "nodekey")
+
 	priv, _ := HexToECDSA(testPrivateKey)
-	priv.SaveECDSA("nodekey")
-	priv2, _ := LoadECDSA("nodekey")
+	priv.SaveECDSA(file)
+	priv2, _ := LoadECDSA(file)
 	if !bytes.Equal(priv.SecretBytes(), priv2.SecretBytes()) {
 		t.Errorf("load and save private key error %s != %s", priv, priv2)
 	}
@@ -144,3 +176,42 @@ func BenchmarkRipemd160(b *testing.B) {
 	}
 
 }
+
+func TestSignerCertificate(t *testing.T) {
+	ca, _ := GenerateSigner("ecdsa")
+	caCert := NewCertificate(CertInformation{IsCA: true})
+	caBytes, err := GenerateCertificateBytes(caCert, caCert, ca.Public(), ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := ParseCrt(caBytes)
+
+	for _, keyType := range []string{"rsa", "ecdsa"} {
+		key, _ := GenerateSigner(keyType)
+		keyBytes, _ := GenerateSignerBytes(key)
+		parsed, err := ParseSigner(keyBytes)
+		if err != nil {
+			t.Fatalf("%s ParseSigner error %v", keyType, err)
+		}
+
+		certBytes, err := GenerateCertificateBytes(NewCertificate(CertInformation{CommonName: "node"}), root, parsed.Public(), ca)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, _ := ParseCrt(certBytes)
+		if !MatchSigner(cert, key) || MatchSigner(root, key) {
+			t.Errorf("%s MatchSigner error", keyType)
+		}
+		if err := VerifyCertificate(root, cert); err != nil {
+			t.Errorf("%s VerifyCertificate error %v", keyType, err)
+		}
+
+		sign, _ := SignData(parsed, []byte("hello"))
+		if err := VerifySign(sha256.Sum256([]byte("hello")), sign, cert); err != nil {
+			t.Errorf("%s VerifySign error %v", keyType, err)
+		}
+		if err := VerifySign(sha256.Sum256([]byte("hi")), sign, cert); err == nil {
+			t.Errorf("%s VerifySign accepted another message", keyType)
+		}
+	}
+}
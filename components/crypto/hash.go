@@ -156,6 +156,70 @@ func GetMerkleHash(data []Hash) Hash {
 	return ComputeMerkleHash(data)[0]
 }
 
+// ComputeMerkleProof returns the sibling hashes from the leaf at index up to the merkle root
+func ComputeMerkleProof(data []Hash, index int) []Hash {
+	if index < 0 || index >= len(data) {
+		return nil
+	}
+
+	proof := make([]Hash, 0)
+	for len(data) > 1 {
+		sibling := index ^ 1
+		if sibling >= len(data) {
+			sibling = index
+		}
+		proof = append(proof, data[sibling])
+
+		digests := make([]Hash, 0)
+		for i := 0; i < len(data); i += 2 {
+			j := i + 1
+			if j == len(data) {
+				j = i
+			}
+			digests = append(digests, merkleParent(data[i], data[j]))
+		}
+		data = digests
+		index /= 2
+	}
+	return proof
+}
+
+// VerifyMerkleProof reports whether the leaf at index of the count leafs and its sibling hashes compute to the
+// merkle root. the last node of a level is paired with itself, so a node equal to its sibling is only accepted
+// as the left one at the end of the level, which keeps the index unambiguous
+func VerifyMerkleProof(root, leaf Hash, index, count int, proof []Hash) bool {
+	if index < 0 || index >= count {
+		return false
+	}
+
+	h := leaf
+	for width := count; width > 1; width = (width + 1) / 2 {
+		if len(proof) == 0 {
+			return false
+		}
+		sibling := proof[0]
+		proof = proof[1:]
+		if index%2 == 0 {
+			if index == width-1 && !sibling.Equal(h) {
+				return false
+			}
+			h = merkleParent(h, sibling)
+		} else {
+			if sibling.Equal(h) {
+				return false
+			}
+			h = merkleParent(sibling, h)
+		}
+		index /= 2
+	}
+	return len(proof) == 0 && h.Equal(root)
+}
+
+func merkleParent(a, b Hash) Hash {
+	h := CalcHash(a, b)
+	return h.Reverse()
+}
+
 // Sha256 calculates and returns sha256 hash of the input data
 func Sha256(data []byte) Hash {
 	h := sha256.Sum256(data)
@@ -19,6 +19,7 @@
 package db
 
 import (
+	"bytes"
 	"fmt"
 	"sync"
 
@@ -36,7 +37,7 @@ const (
 )
 
 var (
-	deafultColumnfamilies = []string{"account", "balance", "ledger", "peer", "index", "state", "block", "storage", "scontract", "persistCacheTxs"}
+	deafultColumnfamilies = []string{"account", "balance", "ledger", "peer", "index", "state", "block", "storage", "scontract", "persistCacheTxs", "validator", "receipt", "history", "undo", "statetree"}
 	config                *Config
 	dbInstance            *BlockchainDB
 	once                  sync.Once
@@ -101,12 +102,19 @@ func NewDB(c *Config) *BlockchainDB {
 		config = c
 
 		dbInstance = &BlockchainDB{}
-		dbInstance.open()
+		dbInstance.open(c)
 	})
 	return dbInstance
 }
 
-func (blockchainDB *BlockchainDB) open() {
+// OpenDB returns a db instance apart from the one of NewDB, such as a scratch database, it must be closed after use
+func OpenDB(c *Config) *BlockchainDB {
+	blockchainDB := &BlockchainDB{}
+	blockchainDB.open(c)
+	return blockchainDB
+}
+
+func (blockchainDB *BlockchainDB) open(config *Config) {
 	opts := gorocksdb.NewDefaultOptions()
 	defer opts.Destroy()
 
@@ -197,6 +205,144 @@ func (blockchainDB *BlockchainDB) GetByPrefix(prefix []byte, resCh chan map[stri
 	}
 }
 
+// Iterate calls fn for every key/value in the given column family in key order
+func (blockchainDB *BlockchainDB) Iterate(cfName string, fn func(key, value []byte)) {
+	blockchainDB.checkIfColumnExists(cfName)
+
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	ro.SetFillCache(false)
+	it := blockchainDB.DB.NewIteratorCF(ro, blockchainDB.cfHandlers[cfName])
+	defer it.Close()
+
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		key := it.Key()
+		value := it.Value()
+		fn(utils.MinimizeSilce(key.Data()), utils.MinimizeSilce(value.Data()))
+		key.Free()
+		value.Free()
+	}
+}
+
+// IteratePrefix calls fn for every key/value with the prefix in the given column family,
+// in reverse key order if reverse is true, until fn returns false
+func (blockchainDB *BlockchainDB) IteratePrefix(cfName string, prefix []byte, reverse bool, fn func(key, value []byte) bool) {
+	blockchainDB.IteratePrefixFrom(cfName, prefix, nil, reverse, fn)
+}
+
+// IteratePrefixFrom is IteratePrefix starting from the key from, the keys before from are skipped in key order
+// and the keys not before from are skipped in reverse key order, nil from starts from the first or the last key
+func (blockchainDB *BlockchainDB) IteratePrefixFrom(cfName string, prefix, from []byte, reverse bool, fn func(key, value []byte) bool) {
+	blockchainDB.checkIfColumnExists(cfName)
+
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	ro.SetFillCache(false)
+	it := blockchainDB.DB.NewIteratorCF(ro, blockchainDB.cfHandlers[cfName])
+	defer it.Close()
+
+	next := it.Next
+	if reverse {
+		next = it.Prev
+		// seek to the first key after the prefix range, then step back
+		end := append([]byte{}, prefix...)
+		for i := len(end) - 1; i >= 0; i-- {
+			end[i]++
+			if end[i] != 0 {
+				end = end[:i+1]
+				break
+			}
+			if i == 0 {
+				end = nil
+			}
+		}
+		if from != nil && (end == nil || bytes.Compare(from, end) < 0) {
+			end = from
+		}
+		if end == nil {
+			it.SeekToLast()
+		} else if it.Seek(end); it.Valid() {
+			it.Prev()
+		} else {
+			it.SeekToLast()
+		}
+	} else if bytes.Compare(from, prefix) > 0 {
+		it.Seek(from)
+	} else {
+		it.Seek(prefix)
+	}
+
+	for ; it.ValidForPrefix(prefix); next() {
+		key := it.Key()
+		value := it.Value()
+		ok := fn(utils.MinimizeSilce(key.Data()), utils.MinimizeSilce(value.Data()))
+		key.Free()
+		value.Free()
+		if !ok {
+			break
+		}
+	}
+}
+
+// Snapshot is a consistent read-only view of the database
+type Snapshot struct {
+	db   *BlockchainDB
+	snap *gorocksdb.Snapshot
+}
+
+// NewSnapshot returns a snapshot of the current database, it must be released after use
+func (blockchainDB *BlockchainDB) NewSnapshot() *Snapshot {
+	return &Snapshot{db: blockchainDB, snap: blockchainDB.DB.NewSnapshot()}
+}
+
+// Get returns the value for the given column family and key in the snapshot
+func (snapshot *Snapshot) Get(cfName string, key []byte) ([]byte, error) {
+	snapshot.db.checkIfColumnExists(cfName)
+
+	opt := gorocksdb.NewDefaultReadOptions()
+	defer opt.Destroy()
+	opt.SetSnapshot(snapshot.snap)
+
+	slice, err := snapshot.db.DB.GetCF(opt, snapshot.db.cfHandlers[cfName], key)
+	if err != nil {
+		return nil, err
+	}
+	defer slice.Free()
+	if slice.Data() == nil {
+		return nil, nil
+	}
+	return utils.MinimizeSilce(slice.Data()), nil
+}
+
+// Iterate calls fn for every key/value of the given column family in the snapshot in key order
+func (snapshot *Snapshot) Iterate(cfName string, fn func(key, value []byte) error) error {
+	snapshot.db.checkIfColumnExists(cfName)
+
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	ro.SetFillCache(false)
+	ro.SetSnapshot(snapshot.snap)
+	it := snapshot.db.DB.NewIteratorCF(ro, snapshot.db.cfHandlers[cfName])
+	defer it.Close()
+
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		key := it.Key()
+		value := it.Value()
+		err := fn(utils.MinimizeSilce(key.Data()), utils.MinimizeSilce(value.Data()))
+		key.Free()
+		value.Free()
+		if err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// Release releases the snapshot
+func (snapshot *Snapshot) Release() {
+	snapshot.snap.Release()
+}
+
 // Put saves the key/value in the given column family
 func (blockchainDB *BlockchainDB) Put(cfName string, key []byte, value []byte) error {
 	blockchainDB.checkIfColumnExists(cfName)
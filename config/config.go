@@ -178,6 +178,13 @@ func (cfg *Config) readParamConfig() {
 	params.PublicAddress = pk
 	viper.SetDefault("blockchain.validator", true)
 	params.Validator = viper.GetBool("blockchain.validator")
+	// nodeId:publicKey, the genesis validators of the chain whatever the consensus plugin
+	params.Validators = getStringSlice("blockchain.validators", []string{})
+	params.BalanceHistory = uint32(getInt("blockchain.balanceHistory", 0))
+	params.Pruning = uint32(getInt("blockchain.pruning", 0))
+	params.NetworkID = getString("blockchain.networkId", params.NetworkID)
+	params.FeeAccount = getString("blockchain.feeAccount", "")
+	params.MinFee = int64(getInt("blockchain.minFee", 0))
 }
 
 func (cfg *Config) readLogConfig() {
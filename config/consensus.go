@@ -19,11 +19,11 @@
 package config
 
 import (
-	"github.com/bocheninc/L0/components/crypto"
-	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/consensus"
 	"github.com/bocheninc/L0/core/consensus/consenter"
 	"github.com/bocheninc/L0/core/consensus/lbft"
 	"github.com/bocheninc/L0/core/consensus/noops"
+	"github.com/bocheninc/L0/core/consensus/raft"
 )
 
 func ConsenterOptions() *consenter.Options {
@@ -31,6 +31,7 @@ func ConsenterOptions() *consenter.Options {
 	option.Plugin = getString("consensus.plugin", option.Plugin)
 	option.Noops = NoopsOptions()
 	option.Lbft = LbftOptions()
+	option.Raft = RaftOptions()
 	return option
 }
 
@@ -38,13 +39,14 @@ func NoopsOptions() *noops.Options {
 	option := noops.NewDefaultOptions()
 	option.BlockSize = getInt("consensus.noops.blockSize", option.BlockSize)
 	option.BlockInterval = getDuration("consensus.noops.blockInterval", option.BlockInterval)
+	option.ID = consensus.ReplicaID(getString("blockchain.chainId", "0"), getString("blockchain.nodeId", option.ID))
 	return option
 }
 
 func LbftOptions() *lbft.Options {
 	option := lbft.NewDefaultOptions()
 	option.Chain = getString("blockchain.chainId", option.Chain)
-	option.ID = option.Chain + ":" + utils.BytesToHex(crypto.Ripemd160([]byte(getString("blockchain.nodeId", option.ID)+option.Chain)))
+	option.ID = consensus.ReplicaID(option.Chain, getString("blockchain.nodeId", option.ID))
 	option.N = getInt("consensus.lbft.N", option.N)
 	option.Q = getInt("consensus.lbft.Q", option.Q)
 	option.K = getInt("consensus.lbft.K", option.K)
@@ -59,5 +61,23 @@ func LbftOptions() *lbft.Options {
 	option.BufferSize = getInt("consensus.lbft.bufferSize", option.BufferSize)
 	option.MaxConcurrentNumFrom = getInt("consensus.lbft.maxConcurrentNumFrom", option.MaxConcurrentNumFrom)
 	option.MaxConcurrentNumTo = getInt("consensus.lbft.maxConcurrentNumTo", option.MaxConcurrentNumTo)
+	option.PeerValidators = getStringMapStringSlice("consensus.lbft.peerValidators", option.PeerValidators)
+	return option
+}
+
+func RaftOptions() *raft.Options {
+	option := raft.NewDefaultOptions()
+	option.Chain = getString("blockchain.chainId", option.Chain)
+	option.ID = consensus.ReplicaID(option.Chain, getString("blockchain.nodeId", option.ID))
+	option.BlockSize = getInt("consensus.raft.blockSize", option.BlockSize)
+	option.BlockInterval = getDuration("consensus.raft.blockInterval", option.BlockInterval)
+	option.HeartbeatInterval = getDuration("consensus.raft.heartbeatInterval", option.HeartbeatInterval)
+	option.ElectionTimeout = getDuration("consensus.raft.electionTimeout", option.ElectionTimeout)
+	option.MaxEntries = getInt("consensus.raft.maxEntries", option.MaxEntries)
+	option.LogSize = getInt("consensus.raft.logSize", option.LogSize)
+	option.BufferSize = getInt("consensus.raft.bufferSize", option.BufferSize)
+	for _, nodeID := range getStringSlice("consensus.raft.peers", []string{}) {
+		option.Peers = append(option.Peers, consensus.ReplicaID(option.Chain, nodeID))
+	}
 	return option
 }
@@ -29,5 +29,7 @@ func JrpcConfig() *rpc.Option {
 	option.Port = getString("jrpc.port", option.Port)
 	option.User = getString("jrpc.user", option.User)
 	option.PassWord = getString("jrpc.password", option.PassWord)
+	option.MaxSubscriptions = getInt("jrpc.maxSubscriptions", option.MaxSubscriptions)
+	option.MaxClientSubscriptions = getInt("jrpc.maxClientSubscriptions", option.MaxClientSubscriptions)
 	return option
 }
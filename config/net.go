@@ -56,11 +56,16 @@ func NetConfig(nodeDir string) *p2p.Config {
 	config.KeepAliveInterval = getInt("net.keepAliveInterval", config.KeepAliveInterval)
 	config.KeepAliveTimes = getInt("net.keepAliveTimes", config.KeepAliveTimes)
 	config.MinPeers = getInt("net.minPeers", config.MinPeers)
+	config.BanScore = getInt("net.banScore", config.BanScore)
+	config.BanDuration = getInt("net.banDuration", config.BanDuration)
+	config.MaxMsgRate = getInt("net.maxMsgRate", config.MaxMsgRate)
 	config.RouteAddress = getStringSlice("net.msgnet.routeAddress", config.RouteAddress)
+	config.RequireEncryption = getbool("net.requireEncryption", config.RequireEncryption)
 
 	config.KeyPath = getString("ca.cert.keyPath", config.KeyPath)
 	config.CrtPath = getString("ca.cert.crtPath", config.CrtPath)
 	config.CAPath = getString("ca.cert.caPath", config.CAPath)
+	config.CRLPath = getString("ca.cert.crlPath", config.CRLPath)
 	config.CAEnabled = getbool("ca.enabled", config.CAEnabled)
 	config.NodeID = getString("blockchain.nodeId", config.NodeID)
 
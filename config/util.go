@@ -54,6 +54,16 @@ func getStringSlice(key string, defaultValue []string) []string {
 	return value
 }
 
+func getStringMapStringSlice(key string, defaultValue map[string][]string) map[string][]string {
+	var (
+		value map[string][]string
+	)
+	if value = viper.GetStringMapStringSlice(key); len(value) == 0 {
+		return defaultValue
+	}
+	return value
+}
+
 func getDuration(key string, defaultValue time.Duration) time.Duration {
 	var (
 		value string
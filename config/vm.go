@@ -19,6 +19,8 @@ func VMConfig(logFile, logLevel string) *vm.Config {
 	config.ExecLimitMaxStateValueSize = getInt("vm.execLimitMaxStateValueSize", config.ExecLimitMaxStateValueSize)
 	config.ExecLimitMaxStateItemCount = getInt("vm.execLimitMaxStateItemCount", config.ExecLimitMaxStateItemCount)
 	config.ExecLimitMaxStateKeyLength = getInt("vm.execLimitMaxStateKeyLength", config.ExecLimitMaxStateKeyLength)
+	config.ExecLimitMaxEventCount = getInt("vm.execLimitMaxEventCount", config.ExecLimitMaxEventCount)
+	config.ExecLimitMaxEventSize = getInt("vm.execLimitMaxEventSize", config.ExecLimitMaxEventSize)
 	config.LuaVMExeFilePath = getString("vm.luaVMExeFilePath", config.LuaVMExeFilePath)
 	config.JSVMExeFilePath = getString("vm.jsVMExeFilePath", config.JSVMExeFilePath)
 
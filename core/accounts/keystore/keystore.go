@@ -174,7 +174,7 @@ func (ks *KeyStore) SignTx(a accounts.Account, tx *types.Transaction, pass strin
 
 	genTxSender(tx, key.PrivateKey.Public())
 
-	sig, err := key.PrivateKey.Sign(tx.Hash().Bytes())
+	sig, err := key.PrivateKey.Sign(tx.SignHash().Bytes())
 	if err != nil {
 		return nil, err
 	}
@@ -20,6 +20,7 @@ package blockchain
 
 import (
 	"container/list"
+	"errors"
 	"math/big"
 	"sync"
 	"time"
@@ -36,6 +37,7 @@ import (
 // NetworkStack defines the relay interface
 type NetworkStack interface {
 	Relay(inv types.IInventory)
+	SyncBlocks()
 }
 
 var validTxPoolSize = 1000000
@@ -45,6 +47,16 @@ type Status struct {
 	Tps    int
 }
 
+// SyncStatus represents the progress of the block synchronization
+type SyncStatus struct {
+	Syncing        bool   `json:"syncing"`
+	StartingHeight uint32 `json:"startingHeight"`
+	CurrentHeight  uint32 `json:"currentHeight"`
+	HeadersHeight  uint32 `json:"headersHeight"`
+	HighestHeight  uint32 `json:"highestHeight"`
+	Peers          int    `json:"peers"`
+}
+
 // Blockchain is blockchain instance
 type Blockchain struct {
 	// global chain config
@@ -65,6 +77,16 @@ type Blockchain struct {
 	heightStatus chan *Status
 
 	orphans *list.List
+	// blocks of the branches competing with the main chain
+	tree *blockTree
+	// blocks of unknown validators are rejected instead of accepted without quorum certificate
+	requireValidators bool
+	// validator signatures received before the block is appended
+	pendingSignatures map[crypto.Hash][]crypto.Signature
+	// blocks waiting for the signatures of their quorum certificate
+	parked map[crypto.Hash]*types.Block
+	// notifies subscribers of new blocks and transactions
+	feed *feed
 	// 0 respresents sync block, 1 respresents sync done
 	synced bool
 }
@@ -104,6 +126,10 @@ func NewBlockchain(ledger *ledger.Ledger) *Blockchain {
 		heightStatus:       make(chan *Status, 100),
 		currentBlockHeader: new(types.BlockHeader),
 		orphans:            list.New(),
+		tree:               newBlockTree(),
+		pendingSignatures:  make(map[crypto.Hash][]crypto.Signature),
+		parked:             make(map[crypto.Hash]*types.Block),
+		feed:               newFeed(),
 	}
 	bc.load()
 	return bc
@@ -114,6 +140,12 @@ func (bc *Blockchain) SetBlockchainConsenter(consenter consensus.Consenter) {
 	bc.consenter = consenter
 }
 
+// RequireValidators sets whether the blocks of unknown validators are rejected, it is set for the consensus
+// plugins certifying the blocks by the validators, the blocks are accepted without quorum certificate otherwise
+func (bc *Blockchain) RequireValidators(require bool) {
+	bc.requireValidators = require
+}
+
 // SetNetworkStack sets the node of the blockchain
 func (bc *Blockchain) SetNetworkStack(pm NetworkStack) {
 	bc.pm = pm
@@ -232,6 +264,7 @@ func (bc *Blockchain) processConsensusOutput(output *consensus.OutputTxs) {
 	txs, time := bc.txValidator.GetCommittedTxs(output.Outputs)
 	//if txs != nil && len(txs) > 0 {
 	blk := bc.GenerateBlock(txs, time)
+	blk.Header.Proposer = output.Proposer
 	if blk.Height() == output.Height {
 		bc.pm.Relay(blk)
 		//bc.ProcessBlock(blk)
@@ -259,12 +292,16 @@ func (bc *Blockchain) ProcessTransaction(tx *types.Transaction) bool {
 	if bc.txValidator == nil {
 		return true
 	}
-	if bc.txValidator.getValidatorSize() < validTxPoolSize {
-		if ok := bc.txValidator.PushTxInTxPool(tx); ok {
-			return true
-		}
-	} else {
-		log.Warnf("over max txs in txpool, %d", bc.txValidator.getValidatorSize())
+	// an invalid transaction must not evict a pending one
+	if !bc.txValidator.validateTransaction(tx) {
+		return false
+	}
+	if bc.txValidator.getValidatorSize() >= validTxPoolSize && !bc.txValidator.evictTransaction(tx) {
+		log.Warnf("over max txs in txpool, %d, drop tx %s with lower fee", bc.txValidator.getValidatorSize(), tx.Hash())
+		return false
+	}
+	if ok := bc.txValidator.pushTransaction(tx); ok {
+		bc.feed.sendTx(tx)
 		return true
 	}
 	return false
@@ -274,17 +311,54 @@ func (bc *Blockchain) ProcessTransaction(tx *types.Transaction) bool {
 func (bc *Blockchain) ProcessBlock(blk *types.Block, flag bool) bool {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
+	return bc.processBlock(blk, flag)
+}
+
+func (bc *Blockchain) processBlock(blk *types.Block, flag bool) bool {
 	log.Debugf("block previoushash %s, currentblockhash %s", blk.PreviousHash(), bc.CurrentBlockHash())
 	if blk.PreviousHash() == bc.CurrentBlockHash() {
-		bc.ledger.AppendBlock(blk, flag)
+		if !flag {
+			bc.withPendingSignatures(blk)
+			if err := bc.checkQuorumCertificate(blk.Header); err != nil {
+				if errors.Is(err, ErrNoQuorumCertificate) {
+					// the signatures of the other validators may arrive after the block
+					log.Warnf("Park Block %s, height: %d, err: %v", blk.Hash(), blk.Height(), err)
+					bc.parkBlock(blk)
+					return false
+				}
+				log.Errorf("Reject Block %s, height: %d, err: %v", blk.Hash(), blk.Height(), err)
+				return false
+			}
+		}
+		if err := bc.ledger.AppendBlock(blk, flag); err != nil {
+			log.Errorf("Reject Block %s, height: %d, err: %v", blk.Hash(), blk.Height(), err)
+			return false
+		}
 		log.Infof("New Block  %s, height: %d Transaction Number: %d", blk.Hash(), blk.Height(), len(blk.Transactions))
+		bc.applyPendingSignatures(blk.Hash())
 		bc.currentBlockHeader = blk.Header
 		bc.heightStatus <- &Status{Height: blk.Height(), Tps: len(blk.Transactions) / 10}
+		bc.feed.sendBlock(blk)
 		return true
 	}
+	if !flag {
+		ok, _ := bc.processSideBlock(blk)
+		return ok
+	}
 	return false
 }
 
+// ProcessPeerBlock processes new block received from a peer, it returns an error wrapping ErrNoQuorumCertificate
+// if the block competes with the main chain without being certified by the validators
+func (bc *Blockchain) ProcessPeerBlock(blk *types.Block) (bool, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if blk.PreviousHash() == bc.CurrentBlockHash() {
+		return bc.processBlock(blk, false), nil
+	}
+	return bc.processSideBlock(blk)
+}
+
 func (bc *Blockchain) HeightStatusChan() <-chan *Status {
 	return bc.heightStatus
 }
@@ -0,0 +1,209 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/core/accounts"
+	"github.com/bocheninc/L0/core/types"
+)
+
+// ErrNoQuorumCertificate represents the block header is not signed by a quorum of validators
+var ErrNoQuorumCertificate = errors.New("block has no valid quorum certificate")
+
+// ErrNoValidators represents the validators of the block are unknown, the validators are configured by blockchain.validators
+var ErrNoValidators = errors.New("no validators configured")
+
+var (
+	// maxPendingSignatures limits the signatures kept for blocks not yet appended
+	maxPendingSignatures = 1000
+	// maxParkedBlocks limits the blocks waiting for the signatures of their quorum certificate
+	maxParkedBlocks = 100
+)
+
+// validatorSet returns the validators of the block at height
+func (bc *Blockchain) validatorSet(height uint32) (*types.ValidatorSet, error) {
+	vs, err := bc.ledger.ValidatorSet(height)
+	if err != nil {
+		return nil, err
+	}
+	if vs.Len() == 0 {
+		return nil, ErrNoValidators
+	}
+	return vs, nil
+}
+
+// IsValidator reports whether the address is the account of a validator of the block at height
+func (bc *Blockchain) IsValidator(height uint32, addr accounts.Address) bool {
+	vs, err := bc.validatorSet(height)
+	return err == nil && vs.Contains(addr)
+}
+
+// verifyQuorumCertificate checks the block header is signed by a quorum of distinct validators of its height,
+// it fails if the validators are unknown
+func (bc *Blockchain) verifyQuorumCertificate(header *types.BlockHeader) error {
+	vs, err := bc.validatorSet(header.Height)
+	if err != nil {
+		return err
+	}
+
+	signers := make(map[accounts.Address]bool)
+	for _, signer := range header.Signers() {
+		if vs.Contains(signer) {
+			signers[signer] = true
+		}
+	}
+
+	if len(signers) < vs.Quorum() {
+		return fmt.Errorf("%w, signers %d, quorum %d", ErrNoQuorumCertificate, len(signers), vs.Quorum())
+	}
+	return nil
+}
+
+// checkQuorumCertificate verifies the quorum certificate of the synced block, nothing is checked if the chain has no
+// validator set, e.g. with noops, unless the validators are required
+func (bc *Blockchain) checkQuorumCertificate(header *types.BlockHeader) error {
+	if err := bc.verifyQuorumCertificate(header); err != nil && (err != ErrNoValidators || bc.requireValidators) {
+		return err
+	}
+	return nil
+}
+
+// VerifyBlockHeader checks the header follows the previous header and is signed by a quorum of validators if the chain has them
+func (bc *Blockchain) VerifyBlockHeader(previous, header *types.BlockHeader) error {
+	if header.Height != previous.Height+1 {
+		return fmt.Errorf("block %s height %d, expected %d", header.Hash(), header.Height, previous.Height+1)
+	}
+	if !header.PreviousHash.Equal(previous.Hash()) {
+		return fmt.Errorf("block %s(%d) previous hash %s mismatch %s", header.Hash(), header.Height, header.PreviousHash, previous.Hash())
+	}
+	return bc.checkQuorumCertificate(header)
+}
+
+// VerifyBlockBody checks the transactions match the merkle hash of the header, a block without transactions has the empty hash
+func (bc *Blockchain) VerifyBlockBody(header *types.BlockHeader, txs types.Transactions) error {
+	if header.TxsMerkleHash.Equal(crypto.Hash{}) {
+		if len(txs) != 0 {
+			return fmt.Errorf("block %s(%d) has %d transactions, expected none", header.Hash(), header.Height, len(txs))
+		}
+		return nil
+	}
+	if hash := bc.merkleRootHash(txs); !hash.Equal(header.TxsMerkleHash) {
+		return fmt.Errorf("block %s(%d) transactions merkle hash %s mismatch %s", header.Hash(), header.Height, hash, header.TxsMerkleHash)
+	}
+	return nil
+}
+
+// ProcessBlockSignature stores the validator signature of the block, returns true if it is new
+func (bc *Blockchain) ProcessBlockSignature(blockHash crypto.Hash, sig crypto.Signature) bool {
+	h := crypto.Sha256(blockHash.Bytes())
+	pub, err := sig.RecoverPublicKey(h[:])
+	if pub == nil || err != nil {
+		log.Errorf("Block %s signature recover error %v", blockHash, err)
+		return false
+	}
+
+	height := bc.CurrentHeight() + 1
+	if header, err := bc.ledger.GetBlockByHash(blockHash.Bytes()); err == nil && header != nil {
+		height = header.Height
+	}
+	if signer := accounts.PublicKeyToAddress(*pub); !bc.IsValidator(height, signer) {
+		log.Warnf("Block %s signed by %s which is not a validator", blockHash, signer)
+		return false
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	added, err := bc.ledger.AppendBlockSignature(blockHash, sig)
+	if err != nil {
+		// the block may not be appended yet, keep the signature until it is
+		return bc.addPendingSignature(blockHash, sig)
+	}
+	return added
+}
+
+func (bc *Blockchain) addPendingSignature(blockHash crypto.Hash, sig crypto.Signature) bool {
+	for _, s := range bc.pendingSignatures[blockHash] {
+		if s == sig {
+			return false
+		}
+	}
+	if len(bc.pendingSignatures) >= maxPendingSignatures {
+		// the signatures of the parked blocks are kept
+		for hash := range bc.pendingSignatures {
+			if _, ok := bc.parked[hash]; !ok {
+				delete(bc.pendingSignatures, hash)
+			}
+		}
+	}
+	bc.pendingSignatures[blockHash] = append(bc.pendingSignatures[blockHash], sig)
+	// the block parked for lack of signatures is processed again with them,
+	// otherwise the signatures wait for the block to be appended
+	if blk, ok := bc.parked[blockHash]; ok {
+		delete(bc.parked, blockHash)
+		bc.processBlock(blk, false)
+	}
+	return true
+}
+
+// withPendingSignatures adds the signatures received apart from the block to its header
+func (bc *Blockchain) withPendingSignatures(blk *types.Block) {
+	for _, sig := range bc.pendingSignatures[blk.Hash()] {
+		found := false
+		for _, s := range blk.Header.Signatures {
+			if s == sig {
+				found = true
+				break
+			}
+		}
+		if !found {
+			blk.Header.Signatures = append(blk.Header.Signatures, sig)
+		}
+	}
+}
+
+// parkBlock keeps the block short of signatures until they arrive, the blocks below the current one are dropped
+func (bc *Blockchain) parkBlock(blk *types.Block) {
+	current := bc.CurrentHeight()
+	for hash, parked := range bc.parked {
+		if parked.Height() <= current || len(bc.parked) >= maxParkedBlocks {
+			delete(bc.parked, hash)
+		}
+	}
+	bc.parked[blk.Hash()] = blk
+}
+
+// applyPendingSignatures stores the signatures received before the block was appended, it is called once the block is appended
+func (bc *Blockchain) applyPendingSignatures(blockHash crypto.Hash) {
+	delete(bc.parked, blockHash)
+	sigs, ok := bc.pendingSignatures[blockHash]
+	if !ok {
+		return
+	}
+	delete(bc.pendingSignatures, blockHash)
+	for _, sig := range sigs {
+		if _, err := bc.ledger.AppendBlockSignature(blockHash, sig); err != nil {
+			log.Errorf("Block %s append signature error %v", blockHash, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/bocheninc/L0/core/params"
+)
+
+func TestParkBlock(t *testing.T) {
+	defer func(v []string) { params.Validators = v }(params.Validators)
+	bc, keys := newTestBlockchain(t)
+	defer bc.ledger.Rollback(bc.CurrentHeight())
+
+	// the block relayed before the signatures of the other validators waits for them
+	blk := newTestBlock(t, bc, bc.currentBlockHeader, 11, nil, keys[:1])
+	if bc.ProcessBlock(blk, false) {
+		t.Fatal("append block without quorum")
+	}
+	if _, ok := bc.parked[blk.Hash()]; !ok {
+		t.Fatal("block not parked")
+	}
+	h := blk.Header.SignHash()
+	for i, key := range keys[1:3] {
+		sig, _ := key.Sign(h[:])
+		if !bc.ProcessBlockSignature(blk.Hash(), *sig) {
+			t.Fatalf("signature %d rejected", i)
+		}
+	}
+	if !bc.CurrentBlockHash().Equal(blk.Hash()) {
+		t.Fatal("parked block not appended with the signatures")
+	}
+	if _, ok := bc.parked[blk.Hash()]; ok {
+		t.Error("appended block still parked")
+	}
+
+	// the signatures relayed before the block are kept until it arrives
+	blk = newTestBlock(t, bc, bc.currentBlockHeader, 12, nil, keys[:1])
+	h = blk.Header.SignHash()
+	for i, key := range keys[1:3] {
+		sig, _ := key.Sign(h[:])
+		if !bc.ProcessBlockSignature(blk.Hash(), *sig) {
+			t.Fatalf("signature %d rejected", i)
+		}
+	}
+	if len(bc.pendingSignatures[blk.Hash()]) != 2 {
+		t.Fatalf("pending signatures %d, expected 2", len(bc.pendingSignatures[blk.Hash()]))
+	}
+	if !bc.ProcessBlock(blk, false) {
+		t.Fatal("block not appended with the signatures received before it")
+	}
+	if _, ok := bc.pendingSignatures[blk.Hash()]; ok {
+		t.Error("signatures of the appended block still pending")
+	}
+
+	// blocks are not certified without validator set
+	params.Validators = nil
+	blk = newTestBlock(t, bc, bc.currentBlockHeader, 13, nil, nil)
+	bc.RequireValidators(true)
+	if bc.ProcessBlock(blk, false) {
+		t.Error("append block without validator set while the validators are required")
+	}
+	bc.RequireValidators(false)
+	if !bc.ProcessBlock(blk, false) {
+		t.Error("reject block without validator set")
+	}
+}
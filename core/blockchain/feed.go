@@ -0,0 +1,120 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockchain
+
+import (
+	"sync"
+
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/core/types"
+)
+
+// Subscription receives the blocks appended to the chain, the transactions entering the txpool and the forks observed
+type Subscription struct {
+	Blocks chan *types.Block
+	Txs    chan *types.Transaction
+	Forks  chan *ForkEvent
+	feed   *feed
+}
+
+// Unsubscribe stops the delivery and closes the channels of the subscription
+func (s *Subscription) Unsubscribe() {
+	s.feed.remove(s)
+}
+
+// feed delivers notifications to subscriptions without blocking the publisher
+type feed struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+func newFeed() *feed {
+	return &feed{subs: make(map[*Subscription]struct{})}
+}
+
+func (f *feed) subscribe(size int) *Subscription {
+	s := &Subscription{
+		Blocks: make(chan *types.Block, size),
+		Txs:    make(chan *types.Transaction, size),
+		Forks:  make(chan *ForkEvent, size),
+		feed:   f,
+	}
+	f.mu.Lock()
+	f.subs[s] = struct{}{}
+	f.mu.Unlock()
+	return s
+}
+
+func (f *feed) remove(s *Subscription) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subs[s]; ok {
+		delete(f.subs, s)
+		close(s.Blocks)
+		close(s.Txs)
+		close(s.Forks)
+	}
+}
+
+func (f *feed) sendBlock(blk *types.Block) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for s := range f.subs {
+		select {
+		case s.Blocks <- blk:
+		default:
+			log.Warnf("subscription is full, drop block %d", blk.Height())
+		}
+	}
+}
+
+func (f *feed) sendTx(tx *types.Transaction) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for s := range f.subs {
+		select {
+		case s.Txs <- tx:
+		default:
+			log.Warnf("subscription is full, drop tx %s", tx.Hash())
+		}
+	}
+}
+
+func (f *feed) sendFork(event *ForkEvent) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for s := range f.subs {
+		select {
+		case s.Forks <- event:
+		default:
+			log.Warnf("subscription is full, drop fork at height %d", event.Height)
+		}
+	}
+}
+
+// NewSubscription returns a subscription buffering size notifications which is not fed by a chain,
+// the owner sends the notifications on its channels
+func NewSubscription(size int) *Subscription {
+	return newFeed().subscribe(size)
+}
+
+// Subscribe returns a subscription buffering size blocks and transactions
+func (bc *Blockchain) Subscribe(size int) *Subscription {
+	return bc.feed.subscribe(size)
+}
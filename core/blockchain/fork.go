@@ -0,0 +1,270 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/core/ledger"
+	"github.com/bocheninc/L0/core/types"
+)
+
+// maxSideBlocks limits the blocks kept in the block tree
+var maxSideBlocks = 1024
+
+// ForkEvent describes a block competing with the main chain block at the same height, it is sent when the
+// block is observed and sent again with Reorganized if the chain is reorganized to its branch
+type ForkEvent struct {
+	Height      uint32      `json:"height"`
+	Local       crypto.Hash `json:"local"`
+	Remote      crypto.Hash `json:"remote"`
+	Reorganized bool        `json:"reorganized"`
+}
+
+// blockTree keeps the blocks of the branches competing with the main chain
+type blockTree struct {
+	blocks map[crypto.Hash]*types.Block
+}
+
+func newBlockTree() *blockTree {
+	return &blockTree{blocks: make(map[crypto.Hash]*types.Block)}
+}
+
+// add adds the block, the blocks below it are pruned once the tree is full and then the lowest ones are evicted
+func (t *blockTree) add(blk *types.Block) {
+	if len(t.blocks) >= maxSideBlocks {
+		t.prune(blk.Height())
+	}
+	for len(t.blocks) >= maxSideBlocks {
+		var lowest *types.Block
+		for _, b := range t.blocks {
+			if lowest == nil || b.Height() < lowest.Height() {
+				lowest = b
+			}
+		}
+		delete(t.blocks, lowest.Hash())
+	}
+	t.blocks[blk.Hash()] = blk
+}
+
+// prune removes the blocks below height
+func (t *blockTree) prune(height uint32) {
+	for hash, blk := range t.blocks {
+		if blk.Height() < height {
+			delete(t.blocks, hash)
+		}
+	}
+}
+
+// finality reports whether the header is signed by a quorum of validators, final blocks are never reverted,
+// the finality is unknown if the validators of the height are unknown
+func (bc *Blockchain) finality(header *types.BlockHeader) (final bool, known bool) {
+	if bc.verifyQuorumCertificate(header) == nil {
+		return true, true
+	}
+	if _, err := bc.validatorSet(header.Height); err != nil {
+		return false, false
+	}
+	return false, true
+}
+
+// processSideBlock adds the block not following the current block to the block tree, alerts when it competes
+// with a main chain block whether it is certified or not, and reorganizes the chain if its branch is certified
+// and preferred, the reorganization is alerted again. It returns the error of the quorum certificate of the
+// side block if the validators are known and did not certify it
+func (bc *Blockchain) processSideBlock(blk *types.Block) (bool, error) {
+	hash := blk.Hash()
+	if _, ok := bc.tree.blocks[hash]; ok {
+		return false, nil
+	}
+	current := bc.CurrentHeight()
+	if blk.Height() == 0 || blk.Height()+ledger.MaxRollbackBlocks <= current {
+		return false, nil
+	}
+	if local, err := bc.ledger.GetBlockHashByNumber(blk.Height()); err == nil && local.Equal(hash) {
+		return false, nil
+	}
+
+	branch, forkHeight, ok := bc.branch(blk)
+	if !ok {
+		return false, nil
+	}
+	bc.tree.add(blk)
+
+	event := &ForkEvent{Height: blk.Height(), Remote: hash}
+	if blk.Height() <= current {
+		event.Local, _ = bc.ledger.GetBlockHashByNumber(blk.Height())
+	}
+	if !event.Local.Equal(crypto.Hash{}) {
+		log.Errorf("Fork observed at height %d, local block %s, remote block %s", event.Height, event.Local, event.Remote)
+		bc.feed.sendFork(event)
+	}
+
+	// without validators the fork choice falls back to the longest branch unless they are required
+	if err := bc.checkQuorumCertificate(blk.Header); err != nil {
+		log.Warnf("Side block %s(%d) is not certified, err: %v", hash, blk.Height(), err)
+		if errors.Is(err, ErrNoQuorumCertificate) {
+			return false, err
+		}
+		return false, nil
+	}
+	if !bc.preferBranch(branch, forkHeight) || !bc.reorganize(branch, forkHeight) {
+		return false, nil
+	}
+	log.Errorf("Fork at height %d reorganized, local block %s, remote block %s", event.Height, event.Local, event.Remote)
+	bc.feed.sendFork(&ForkEvent{Height: event.Height, Local: event.Local, Remote: event.Remote, Reorganized: true})
+	return true, nil
+}
+
+// branch returns the blocks of the branch ending with blk from the fork point on the main chain
+func (bc *Blockchain) branch(blk *types.Block) ([]*types.Block, uint32, bool) {
+	branch := []*types.Block{blk}
+	for {
+		if parent, ok := bc.tree.blocks[branch[0].PreviousHash()]; ok {
+			branch = append([]*types.Block{parent}, branch...)
+			continue
+		}
+		forkHeight := branch[0].Height() - 1
+		if hash, err := bc.ledger.GetBlockHashByNumber(forkHeight); err == nil && hash.Equal(branch[0].PreviousHash()) {
+			return branch, forkHeight, true
+		}
+		return nil, 0, false
+	}
+}
+
+// preferBranch is the fork choice rule, the main chain is reverted only for a branch certified by a quorum
+// of validators and only if none of the reverted blocks is certified, e.g. a block generated locally which
+// the quorum signed a different block for. Nothing is reverted if the finality of some blocks is unknown.
+// If the finality of every block is unknown, e.g. with noops or without blockchain.validators, the longest
+// branch is preferred and the lowest hash of the last block breaks the tie, so that the nodes converge
+func (bc *Blockchain) preferBranch(branch []*types.Block, forkHeight uint32) bool {
+	current := bc.CurrentHeight()
+	if current-forkHeight > ledger.MaxRollbackBlocks {
+		return false
+	}
+	var known, unknown int
+	for h := forkHeight + 1; h <= current; h++ {
+		header, err := bc.ledger.GetBlockByNumber(h)
+		if err != nil {
+			return false
+		}
+		final, ok := bc.finality(header)
+		if final {
+			return false
+		}
+		if ok {
+			known++
+		} else {
+			unknown++
+		}
+	}
+	certified := true
+	for _, blk := range branch {
+		final, ok := bc.finality(blk.Header)
+		certified = certified && final
+		if ok {
+			known++
+		} else {
+			unknown++
+		}
+	}
+
+	switch {
+	case known == 0:
+		tip := branch[len(branch)-1]
+		if tip.Height() != current {
+			return tip.Height() > current
+		}
+		return bytes.Compare(tip.Hash().Bytes(), bc.CurrentBlockHash().Bytes()) < 0
+	case unknown > 0:
+		return false
+	default:
+		return certified
+	}
+}
+
+// reorganize rolls back the main chain to the fork point and appends the branch,
+// the main chain is restored if a block of the branch is rejected
+func (bc *Blockchain) reorganize(branch []*types.Block, forkHeight uint32) bool {
+	reverted, err := bc.ledger.Rollback(forkHeight)
+	if err != nil {
+		log.Errorf("Reorganize rollback to height %d error %v", forkHeight, err)
+		bc.resetCurrentBlock()
+		return false
+	}
+
+	applied := bc.appendBlocks(branch)
+	if applied < len(branch) {
+		log.Errorf("Reorganize reject block %s(%d), restore main chain", branch[applied].Hash(), branch[applied].Height())
+		for _, blk := range branch[applied:] {
+			delete(bc.tree.blocks, blk.Hash())
+		}
+		if _, err := bc.ledger.Rollback(forkHeight); err != nil {
+			log.Errorf("Reorganize rollback to height %d error %v", forkHeight, err)
+		}
+		bc.appendBlocks(reverted)
+		bc.resetCurrentBlock()
+		return false
+	}
+
+	for _, blk := range branch {
+		delete(bc.tree.blocks, blk.Hash())
+		bc.feed.sendBlock(blk)
+	}
+	for _, blk := range reverted {
+		bc.tree.add(blk)
+	}
+	if bc.txValidator != nil {
+		bc.txValidator.resetAccounts(reverted, branch)
+	}
+	if bc.CurrentHeight() > ledger.MaxRollbackBlocks {
+		bc.tree.prune(bc.CurrentHeight() - ledger.MaxRollbackBlocks)
+	}
+	log.Warnf("Reorganize chain at height %d, reverted %d blocks, appended %d blocks, current block %s(%d)",
+		forkHeight, len(reverted), len(branch), bc.CurrentBlockHash(), bc.CurrentHeight())
+	return true
+}
+
+// appendBlocks appends the blocks to the ledger in order and returns the number appended
+func (bc *Blockchain) appendBlocks(blocks []*types.Block) int {
+	bc.resetCurrentBlock()
+	for i, blk := range blocks {
+		if err := bc.ledger.AppendBlock(blk, false); err != nil {
+			log.Errorf("Reject Block %s, height: %d, err: %v", blk.Hash(), blk.Height(), err)
+			return i
+		}
+		bc.currentBlockHeader = blk.Header
+	}
+	return len(blocks)
+}
+
+// resetCurrentBlock reloads the current block header from the ledger
+func (bc *Blockchain) resetCurrentBlock() {
+	height, err := bc.ledger.Height()
+	if err != nil {
+		log.Errorf("GetBlockHeight error %v", err)
+		return
+	}
+	if header, err := bc.ledger.GetBlockByNumber(height); err == nil {
+		bc.currentBlockHeader = header
+	}
+}
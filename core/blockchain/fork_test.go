@@ -0,0 +1,202 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/db"
+	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/accounts"
+	"github.com/bocheninc/L0/core/coordinate"
+	"github.com/bocheninc/L0/core/ledger"
+	"github.com/bocheninc/L0/core/params"
+	"github.com/bocheninc/L0/core/types"
+)
+
+var (
+	testLedger     *ledger.Ledger
+	testLedgerOnce sync.Once
+)
+
+func newTestBlockchain(t *testing.T) (*Blockchain, []*crypto.PrivateKey) {
+	testLedgerOnce.Do(func() {
+		config := db.DefaultConfig()
+		config.DbPath = "/tmp/rocksdb-test-blockchain/"
+		os.RemoveAll(config.DbPath)
+		testLedger = ledger.NewLedger(db.NewDB(config))
+	})
+
+	var keys []*crypto.PrivateKey
+	params.Validators = nil
+	for i := 0; i < 4; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+		params.Validators = append(params.Validators, string(rune('a'+i))+":"+utils.BytesToHex(key.Public().Bytes()))
+	}
+
+	bc := NewBlockchain(testLedger)
+	bc.txValidator = NewValidator(bc.ledger)
+	return bc, keys
+}
+
+// newTestBlock returns the block after previous signed by the first signers validators, the state hash is
+// computed by appending the block locally and rolling it back
+func newTestBlock(t *testing.T, bc *Blockchain, previous *types.BlockHeader, nonce uint32, txs types.Transactions, keys []*crypto.PrivateKey) *types.Block {
+	blk := types.NewBlock(previous.Hash(), utils.CurrentTimestamp(), previous.Height+1, nonce, crypto.Hash{}, txs)
+	if previous.Hash().Equal(bc.CurrentBlockHash()) {
+		if err := bc.ledger.AppendBlock(blk, true); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bc.ledger.Rollback(previous.Height); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		blk.Header.StateHash = previous.StateHash
+	}
+	signTestBlock(blk, keys)
+	return blk
+}
+
+func signTestBlock(blk *types.Block, keys []*crypto.PrivateKey) {
+	h := blk.Header.SignHash()
+	for _, key := range keys {
+		sig, _ := key.Sign(h[:])
+		blk.Header.Signatures = append(blk.Header.Signatures, *sig)
+	}
+}
+
+func TestForkChoice(t *testing.T) {
+	defer func(v, p []string) { params.Validators, params.PublicAddress = v, p }(params.Validators, params.PublicAddress)
+	bc, keys := newTestBlockchain(t)
+	sub := bc.Subscribe(10)
+	defer sub.Unsubscribe()
+	genesis, _ := bc.ledger.GetBlockByNumber(0)
+
+	issuer, _ := crypto.GenerateKey()
+	params.PublicAddress = []string{utils.BytesToHex(accounts.PublicKeyToAddress(*issuer.Public()).Bytes())}
+	tx := types.NewTransaction(coordinate.NewChainCoordinate(params.ChainID), coordinate.NewChainCoordinate(params.ChainID),
+		types.TypeIssue, 1, accounts.PublicKeyToAddress(*issuer.Public()), accounts.Address{}, big.NewInt(100), big.NewInt(0), utils.CurrentTimestamp())
+	sig, _ := issuer.Sign(tx.SignHash().Bytes())
+	tx.WithSignature(sig)
+
+	// the block generated locally is not certified by the validators
+	local := newTestBlock(t, bc, genesis, 1, types.Transactions{tx}, nil)
+	if !bc.ProcessBlock(local, true) {
+		t.Fatal("append local block")
+	}
+	if final, known := bc.finality(local.Header); final || !known {
+		t.Errorf("local block finality %t, known %t", final, known)
+	}
+
+	// a branch certified by a quorum reverts it, the transaction is returned to the txpool
+	certified := newTestBlock(t, bc, genesis, 2, nil, keys[:3])
+	if !bc.ProcessBlock(certified, false) || !bc.CurrentBlockHash().Equal(certified.Hash()) {
+		t.Fatal("reorganize to the certified branch")
+	}
+	if _, ok := bc.txValidator.getTransactionByHash(tx.Hash()); !ok {
+		t.Error("reverted transaction not in txpool")
+	}
+	if _, ok := bc.tree.blocks[local.Hash()]; !ok {
+		t.Error("reverted block not in block tree")
+	}
+	if event := <-sub.Forks; event.Reorganized || !event.Local.Equal(local.Hash()) || !event.Remote.Equal(certified.Hash()) {
+		t.Errorf("fork event %v", event)
+	}
+	if event := <-sub.Forks; !event.Reorganized || !event.Local.Equal(local.Hash()) || !event.Remote.Equal(certified.Hash()) {
+		t.Errorf("reorganized fork event %v", event)
+	}
+
+	// the certified block is final
+	competing := newTestBlock(t, bc, genesis, 3, nil, keys[1:])
+	if bc.ProcessBlock(competing, false) || !bc.CurrentBlockHash().Equal(certified.Hash()) {
+		t.Error("reorganize the final block")
+	}
+	if event := <-sub.Forks; event.Reorganized || !event.Remote.Equal(competing.Hash()) {
+		t.Errorf("fork event %v", event)
+	}
+
+	// a side block without certificate is recorded and alerted, but never reorganizes the chain
+	uncertified := newTestBlock(t, bc, genesis, 4, nil, keys[:2])
+	if ok, err := bc.ProcessPeerBlock(uncertified); ok || !errors.Is(err, ErrNoQuorumCertificate) {
+		t.Errorf("reorganize to the uncertified block %t, err %v", ok, err)
+	}
+	if _, ok := bc.tree.blocks[uncertified.Hash()]; !ok {
+		t.Error("uncertified block not in block tree")
+	}
+	if event := <-sub.Forks; event.Reorganized || !event.Remote.Equal(uncertified.Hash()) {
+		t.Errorf("fork event %v", event)
+	}
+
+	// a longer branch doesn't win without certificate
+	next := newTestBlock(t, bc, certified.Header, 5, nil, nil)
+	if !bc.ProcessBlock(next, true) {
+		t.Fatal("append local block")
+	}
+	if bc.preferBranch([]*types.Block{competing, newTestBlock(t, bc, competing.Header, 6, nil, nil)}, 0) {
+		t.Error("prefer the branch without certificate")
+	}
+
+	// a rejected branch restores the main chain
+	branch := newTestBlock(t, bc, certified.Header, 7, nil, nil)
+	branch.Header.StateHash = crypto.Sha256([]byte("state"))
+	signTestBlock(branch, keys[:3])
+	if bc.ProcessBlock(branch, false) || !bc.CurrentBlockHash().Equal(next.Hash()) || bc.CurrentHeight() != 2 {
+		t.Error("reorganize to the rejected branch")
+	}
+	if hash, _ := bc.ledger.GetBlockHashByNumber(2); !hash.Equal(next.Hash()) {
+		t.Error("main chain not restored")
+	}
+
+	// without validators the longest branch wins and the lowest hash breaks the tie
+	params.Validators = nil
+	tie := newTestBlock(t, bc, certified.Header, 8, nil, nil)
+	if bc.preferBranch([]*types.Block{tie}, 1) != (bytes.Compare(tie.Hash().Bytes(), next.Hash().Bytes()) < 0) {
+		t.Error("tie not broken by the lowest hash")
+	}
+	longer := newTestBlock(t, bc, certified.Header, 9, nil, nil)
+	longest := newTestBlock(t, bc, longer.Header, 10, nil, nil)
+	bc.ProcessBlock(longer, false)
+	if !bc.ProcessBlock(longest, false) || !bc.CurrentBlockHash().Equal(longest.Hash()) {
+		t.Error("reorganize to the longest branch with unknown finality")
+	}
+}
+
+func TestBlockTreeLimit(t *testing.T) {
+	defer func(n int) { maxSideBlocks = n }(maxSideBlocks)
+	maxSideBlocks = 4
+
+	tree := newBlockTree()
+	for nonce := uint32(0); nonce < 10; nonce++ {
+		blk := types.NewBlock(crypto.Hash{}, 0, 10+nonce%2, nonce, crypto.Hash{}, nil)
+		tree.add(blk)
+		if len(tree.blocks) > maxSideBlocks {
+			t.Fatalf("block tree has %d blocks, limit %d", len(tree.blocks), maxSideBlocks)
+		}
+		if _, ok := tree.blocks[blk.Hash()]; !ok {
+			t.Fatalf("block %d not added", nonce)
+		}
+	}
+}
@@ -19,6 +19,7 @@
 package blockchain
 
 import (
+	"github.com/bocheninc/L0/components/crypto"
 	"github.com/bocheninc/L0/components/log"
 	"github.com/bocheninc/L0/core/consensus"
 	"github.com/bocheninc/L0/core/types"
@@ -51,3 +52,44 @@ func (bc *Blockchain) GetBlockchainInfo() *consensus.BlockchainInfo {
 		Height: height,
 	}
 }
+
+//GetValidatorSet returns the validator set of the block at height derived from the appended blocks
+func (bc *Blockchain) GetValidatorSet(height uint32) (*types.ValidatorSet, error) {
+	return bc.ledger.ValidatorSet(height)
+}
+
+//GetBlockHashByHeight returns the hash of the block appended at height
+func (bc *Blockchain) GetBlockHashByHeight(height uint32) (crypto.Hash, error) {
+	return bc.ledger.GetBlockHashByNumber(height)
+}
+
+//PutCheckpoint persists the state of the consenter under its own key
+func (bc *Blockchain) PutCheckpoint(key string, data []byte) error {
+	return bc.ledger.PutConsensusCheckpoint(key, data)
+}
+
+//GetCheckpoint returns the persisted state of the consenter under its own key
+func (bc *Blockchain) GetCheckpoint(key string) ([]byte, error) {
+	return bc.ledger.GetConsensusCheckpoint(key)
+}
+
+//StateTransfer fetches the missing blocks up to the checkpoint from peers
+func (bc *Blockchain) StateTransfer(height uint32, blockHash crypto.Hash) {
+	current, _ := bc.ledger.Height()
+	if current >= height {
+		if hash, err := bc.ledger.GetBlockHashByNumber(height); err != nil || !hash.Equal(blockHash) {
+			log.Errorf("State transfer checkpoint block %s(%d) mismatch local block %s", blockHash, height, hash)
+		}
+		return
+	}
+	log.Infof("State transfer from height %d to checkpoint block %s(%d)", current, blockHash, height)
+	bc.SyncBlocks()
+}
+
+//SyncBlocks fetches the missing blocks from peers
+func (bc *Blockchain) SyncBlocks() {
+	bc.synced = false
+	if bc.pm != nil {
+		bc.pm.SyncBlocks()
+	}
+}
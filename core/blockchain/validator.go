@@ -22,6 +22,7 @@ import (
 	"bytes"
 	"container/list"
 	"math/big"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -54,6 +55,24 @@ type Validator struct {
 	sync.Mutex
 }
 
+// txCost returns the amount and the fee which the transaction costs the sender
+func txCost(tx *types.Transaction) *big.Int {
+	cost := new(big.Int).Set(tx.Amount())
+	if tx.Fee() != nil {
+		cost.Add(cost, tx.Fee())
+	}
+	return cost
+}
+
+// feePerByte returns the fee of the transaction divided by its size
+func feePerByte(tx *types.Transaction) *big.Rat {
+	fee := big.NewInt(0)
+	if tx.Fee() != nil {
+		fee = tx.Fee()
+	}
+	return new(big.Rat).SetFrac(fee, big.NewInt(int64(len(tx.Serialize()))))
+}
+
 func newValidatorAccount(address accounts.Address, leger *ledger.Ledger) *validatorAccount {
 	amount, nonce, _ := leger.GetBalance(address)
 	return &validatorAccount{
@@ -70,12 +89,12 @@ func (va *validatorAccount) addTransaction(tx *types.Transaction) bool {
 	defer va.Unlock()
 
 	isOK := true
-	amount := (&big.Int{}).Sub(va.amount, tx.Amount())
+	amount := (&big.Int{}).Sub(va.amount, txCost(tx))
 	nonce := va.nonce
 
 	switch tx.GetType() {
 	case types.TypeMerged:
-	case types.TypeIssue:
+	case types.TypeIssue, types.TypeValidatorChange:
 		if nonce != tx.Nonce() {
 			isOK = false
 		}
@@ -196,7 +215,7 @@ func (va *validatorAccount) rollbackAndRemoveTransaction(tx *types.Transaction)
 	storeElem := va.txsMap[tx.Hash()]
 	va.txsList.Remove(storeElem)
 	delete(va.txsMap, tx.Hash())
-	va.amount = va.amount.Add(va.amount, tx.Amount())
+	va.amount = va.amount.Add(va.amount, txCost(tx))
 }
 
 func (va *validatorAccount) committedAndRemoveTransaction(tx *types.Transaction) {
@@ -211,14 +230,14 @@ func (va *validatorAccount) committedAndRemoveTransaction(tx *types.Transaction)
 		for delElem := priv; delElem != nil; delElem = priv {
 			priv = delElem.Prev()
 			ptx := priv.Value.(*types.Transaction)
-			va.amount.Add(va.amount, ptx.Amount())
+			va.amount.Add(va.amount, txCost(ptx))
 			va.txsList.Remove(priv)
 			delete(va.txsMap, ptx.Hash())
 		}
 	} else {
 		log.Warnf("[Validator] sync add: new tx, tx_hash: %v, tx_sender: %v, tx_type: %v, tx_amount: %v, tx_nonce: %v, va.amount: %v, va.nonce: %v",
 			tx.Hash().String(), tx.Sender().String(), tx.GetType(), tx.Amount(), tx.Nonce(), va.amount, va.nonce)
-		va.amount.Sub(va.amount, tx.Amount())
+		va.amount.Sub(va.amount, txCost(tx))
 		if tx.Nonce() >= va.nonce {
 			va.nonce = tx.Nonce()
 			va.nonce++
@@ -267,6 +286,90 @@ func (va *validatorAccount) iterTransaction(function func(tx *types.Transaction)
 	}
 }
 
+// pendingTransactions returns the first and the last transactions not fetched by consensus yet
+func (va *validatorAccount) pendingTransactions() (*types.Transaction, *types.Transaction) {
+	va.Lock()
+	defer va.Unlock()
+
+	elem, ok := va.txsMap[va.currTxHash]
+	if !ok {
+		elem = va.txsList.Front()
+	} else {
+		elem = elem.Next()
+	}
+	if elem == nil {
+		return nil, nil
+	}
+	return elem.Value.(*types.Transaction), va.txsList.Back().Value.(*types.Transaction)
+}
+
+// removeLastTransaction evicts the transaction if it is the last one and not fetched by consensus yet
+func (va *validatorAccount) removeLastTransaction(tx *types.Transaction) bool {
+	va.Lock()
+	defer va.Unlock()
+
+	elem := va.txsList.Back()
+	if elem == nil || elem.Value.(*types.Transaction) != tx || tx.Hash() == va.currTxHash {
+		return false
+	}
+	va.txsList.Remove(elem)
+	delete(va.txsMap, tx.Hash())
+	va.amount.Add(va.amount, txCost(tx))
+	if tx.GetType() != types.TypeMerged {
+		va.nonce = tx.Nonce()
+	}
+	return true
+}
+
+func (va *validatorAccount) removeExpiredTransactions(height, timestamp uint32) int {
+	va.Lock()
+	defer va.Unlock()
+
+	elem, ok := va.txsMap[va.currTxHash]
+	if !ok {
+		elem = va.txsList.Front()
+	} else {
+		elem = elem.Next()
+	}
+	for ; elem != nil; elem = elem.Next() {
+		if elem.Value.(*types.Transaction).Expired(height, timestamp) {
+			break
+		}
+	}
+	if elem == nil {
+		return 0
+	}
+
+	// the transactions after the expired one lose their nonce, they wait in orphans for a replacement
+	var cnt int
+	var resetNonce bool
+	var orphans types.Transactions
+	var next *list.Element
+	for ; elem != nil; elem = next {
+		next = elem.Next()
+		tx := elem.Value.(*types.Transaction)
+		va.txsList.Remove(elem)
+		delete(va.txsMap, tx.Hash())
+		va.amount.Add(va.amount, txCost(tx))
+		if !resetNonce && tx.GetType() != types.TypeMerged {
+			va.nonce = tx.Nonce()
+			resetNonce = true
+		}
+		if tx.Expired(height, timestamp) {
+			log.Debugf("[Validator] remove expired tx, tx_hash: %v, tx_sender: %v, tx_validUntil: %v, height: %v, timestamp: %v",
+				tx.Hash().String(), tx.Sender().String(), tx.ValidUntil(), height, timestamp)
+			cnt++
+		} else {
+			orphans = append(orphans, tx)
+		}
+	}
+	for i := len(orphans) - 1; i >= 0; i-- {
+		va.orphans.PushFront(orphans[i])
+	}
+
+	return cnt
+}
+
 func (va *validatorAccount) checkExceptionTransaction(tx *types.Transaction) bool {
 	va.Lock()
 	defer va.Unlock()
@@ -311,11 +414,11 @@ func (va *validatorAccount) checkExceptionTransaction(tx *types.Transaction) boo
 	if otx.Nonce() != tx.Nonce() {
 		log.Panicf("checkExceptionTransaction")
 	}
-	res := otx.Amount().Cmp(tx.Amount())
+	res := txCost(otx).Cmp(txCost(tx))
 	if res > 0 {
-		va.amount = va.amount.Add(va.amount, (&big.Int{}).Sub(otx.Amount(), tx.Amount()))
+		va.amount = va.amount.Add(va.amount, (&big.Int{}).Sub(txCost(otx), txCost(tx)))
 	} else if res < 0 {
-		amount := (&big.Int{}).Add(va.amount, (&big.Int{}).Sub(otx.Amount(), tx.Amount()))
+		amount := (&big.Int{}).Add(va.amount, (&big.Int{}).Sub(txCost(otx), txCost(tx)))
 		if amount.Sign() >= 0 {
 			va.amount.Set(amount)
 		} else {
@@ -326,7 +429,7 @@ func (va *validatorAccount) checkExceptionTransaction(tx *types.Transaction) boo
 				}
 
 				if amount.Sign() < 0 {
-					amount = amount.Add(amount, be.Value.(*types.Transaction).Amount())
+					amount = amount.Add(amount, txCost(be.Value.(*types.Transaction)))
 					va.txsList.Remove(be)
 					delete(va.txsMap, be.Value.(*types.Transaction).Hash())
 				} else {
@@ -405,6 +508,82 @@ func (vr *Validator) getValidatorSize() int {
 	return cnt
 }
 
+// nextBlock returns the height and the timestamp which the transactions are checked against for expiry
+func (vr *Validator) nextBlock() (uint32, uint32) {
+	height, _ := vr.ledger.Height()
+	return height + 1, uint32(time.Now().Unix())
+}
+
+func (vr *Validator) removeExpiredTransactions() {
+	height, timestamp := vr.nextBlock()
+
+	vr.Lock()
+	defer vr.Unlock()
+	var cnt int
+	for _, senderAccount := range vr.accounts {
+		cnt += senderAccount.removeExpiredTransactions(height, timestamp)
+	}
+	if cnt > 0 {
+		log.Infof("[Validator] removed %d expired transactions, height: %d, timestamp: %d", cnt, height, timestamp)
+	}
+}
+
+type pricedAccount struct {
+	address string
+	account *validatorAccount
+	price   *big.Rat
+}
+
+// sortAccountsByFee returns the accounts with pending transactions ordered by the fee per byte of their next transaction
+func (vr *Validator) sortAccountsByFee() []*pricedAccount {
+	var pricedAccounts []*pricedAccount
+	for address, account := range vr.accounts {
+		if next, _ := account.pendingTransactions(); next != nil {
+			pricedAccounts = append(pricedAccounts, &pricedAccount{address: address, account: account, price: feePerByte(next)})
+		}
+	}
+	sort.Slice(pricedAccounts, func(i, j int) bool {
+		if res := pricedAccounts[i].price.Cmp(pricedAccounts[j].price); res != 0 {
+			return res > 0
+		}
+		return pricedAccounts[i].address < pricedAccounts[j].address
+	})
+	return pricedAccounts
+}
+
+// evictTransaction makes room in the full txpool for the transaction by evicting the pending transaction with
+// the lowest fee per byte, it fails if there is no cheaper one
+func (vr *Validator) evictTransaction(tx *types.Transaction) bool {
+	price := feePerByte(tx)
+	sender := tx.Sender().String()
+
+	vr.Lock()
+	defer vr.Unlock()
+	var (
+		cheapest      *validatorAccount
+		cheapestTx    *types.Transaction
+		cheapestPrice *big.Rat
+	)
+	for address, account := range vr.accounts {
+		// evicting the last transaction of the sender leaves no room for its next one
+		if address == sender {
+			continue
+		}
+		if _, last := account.pendingTransactions(); last != nil {
+			if lastPrice := feePerByte(last); cheapestPrice == nil || lastPrice.Cmp(cheapestPrice) < 0 {
+				cheapest, cheapestTx, cheapestPrice = account, last, lastPrice
+			}
+		}
+	}
+
+	if cheapest == nil || cheapestPrice.Cmp(price) >= 0 || !cheapest.removeLastTransaction(cheapestTx) {
+		return false
+	}
+	log.Debugf("[Validator] evict tx, tx_hash: %s, fee_per_byte: %v, for tx_hash: %s, fee_per_byte: %v",
+		cheapestTx.Hash().String(), cheapestPrice, tx.Hash().String(), price)
+	return true
+}
+
 func (vr *Validator) checkIssueTransaction(tx *types.Transaction) bool {
 	address := tx.Sender()
 	addressHex := utils.BytesToHex(address.Bytes())
@@ -476,7 +655,22 @@ func (vr *Validator) checkTransaction(tx *types.Transaction) bool {
 			log.Errorf("[Validator] add: valid issue tx public key fail, tx: %v", tx.Hash().String())
 			isOK = false
 		}
+	case types.TypeValidatorChange:
+		if strings.Compare(tx.FromChain(), tx.ToChain()) != 0 || tx.Amount().Sign() != 0 {
+			log.Errorf("[Validator] add: fail[should fromchain == tochain and amount == 0], Tx-hash: %v, tx_type: %v, tx_fchain: %v, tx_tchain: %v",
+				tx.Hash().String(), tx.GetType(), tx.FromChain(), tx.ToChain())
+			isOK = false
+		}
+
+		if _, err := types.ValidatorChangeOf(tx); err != nil {
+			log.Errorf("[Validator] add: invalid validator change, tx: %v, err: %v", tx.Hash().String(), err)
+			isOK = false
+		}
 
+		if ok := vr.checkIssueTransaction(tx); !ok {
+			log.Errorf("[Validator] add: valid validator change tx public key fail, tx: %v", tx.Hash().String())
+			isOK = false
+		}
 	}
 
 	return isOK
@@ -560,6 +754,11 @@ func (vr *Validator) fetchAccount(address accounts.Address) *validatorAccount {
 }
 
 func (vr *Validator) PushTxInTxPool(tx *types.Transaction) bool {
+	return vr.validateTransaction(tx) && vr.pushTransaction(tx)
+}
+
+// validateTransaction checks the signature, fee, expiry and chains of the transaction before it enters the txpool
+func (vr *Validator) validateTransaction(tx *types.Transaction) bool {
 	if vr.isValid == false {
 		return false
 	}
@@ -570,18 +769,27 @@ func (vr *Validator) PushTxInTxPool(tx *types.Transaction) bool {
 		return false
 	}
 
-	ok := vr.checkTransaction(tx)
-	if ok {
+	if tx.GetType() != types.TypeMerged && (tx.Fee() == nil || tx.Fee().Cmp(big.NewInt(params.MinFee)) < 0) {
+		log.Debugf("[Validator] fee too low, tx_hash: %s, tx_fee: %v, min_fee: %d", tx.Hash().String(), tx.Fee(), params.MinFee)
+		return false
+	}
 
-		senderAccount := vr.fetchSenderAccount(address)
-		otxs := senderAccount.processOrphan()
-		for _, otx := range otxs {
-			senderAccount.addTransaction(otx)
-		}
-		ok = senderAccount.addTransaction(tx)
+	if height, timestamp := vr.nextBlock(); tx.Expired(height, timestamp) {
+		log.Debugf("[Validator] expired tx, tx_hash: %s, tx_validUntil: %d, height: %d, timestamp: %d", tx.Hash().String(), tx.ValidUntil(), height, timestamp)
+		return false
 	}
 
-	return ok
+	return vr.checkTransaction(tx)
+}
+
+// pushTransaction adds the validated transaction to the account of its sender
+func (vr *Validator) pushTransaction(tx *types.Transaction) bool {
+	senderAccount := vr.fetchSenderAccount(tx.Sender())
+	otxs := senderAccount.processOrphan()
+	for _, otx := range otxs {
+		senderAccount.addTransaction(otx)
+	}
+	return senderAccount.addTransaction(tx)
 }
 
 func (vr *Validator) VerifyTxsInTxPool(txs types.Transactions, primary bool) bool {
@@ -617,6 +825,7 @@ func (vr *Validator) FetchGroupingTxsInTxPool(groupingNum, maxSizeInGrouping int
 	groupingMap := make(map[string]map[int]*chainIdx, groupingNum+1)
 
 	t1 := time.Now()
+	vr.removeExpiredTransactions()
 
 	iterFunc := func(tx *types.Transaction) bool {
 		_, ok := groupingMap[tx.ToChain()]
@@ -651,9 +860,9 @@ func (vr *Validator) FetchGroupingTxsInTxPool(groupingNum, maxSizeInGrouping int
 	}
 
 	vr.Lock()
-	for sender, senderAccount := range vr.accounts {
-		log.Debugf("[Validator] senderAccout: %s, txsCnt: %d", sender, senderAccount.getAccountTransactionSize())
-		senderAccount.iterTransaction(iterFunc)
+	for _, sender := range vr.sortAccountsByFee() {
+		log.Debugf("[Validator] senderAccout: %s, txsCnt: %d, fee_per_byte: %v", sender.address, sender.account.getAccountTransactionSize(), sender.price)
+		sender.account.iterTransaction(iterFunc)
 		if txsCnt > maxSizeInGrouping*groupingNum {
 			break
 		}
@@ -687,20 +896,39 @@ func (vr *Validator) GetCommittedTxs(groupingTxs []*consensus.CommittedTxs) (typ
 	var oChainTxs types.Transactions
 	var blockTime uint32
 
+	for _, txs := range groupingTxs {
+		if txs.Skip {
+			blockTime = txs.Time
+			break
+		}
+		// without the skip group the block time is the latest time of the batches, all agreed by consensus
+		if txs.Time > blockTime {
+			blockTime = txs.Time
+		}
+	}
+	// expiry is checked against the block time agreed by consensus, so that all nodes drop the same transactions
+	height, _ := vr.nextBlock()
+
 	log.Debugf("[Validator] receiveTxsLen: %d", len(groupingTxs))
 	for _, txs := range groupingTxs {
 		log.Println("isLocal", txs.IsLocalChain, "TxsSeqNo:", txs.SeqNo, "TxsSkip:", txs.Skip, "TxsTime", txs.Time, "TxsSize:", len(txs.Transactions))
 		if txs.Skip {
-			blockTime = txs.Time
 			totalTxs = txs.Transactions
 			continue
-		} else if txs.IsLocalChain {
-			groupTxs = append(groupTxs, txs.Transactions...)
-		} else {
-			oChainTxs = append(oChainTxs, txs.Transactions...)
 		}
 
-		committedTxs = append(committedTxs, txs.Transactions...)
+		for _, tx := range txs.Transactions {
+			if tx.Expired(height, blockTime) {
+				log.Warnf("[Validator] drop expired tx, tx_hash: %s, tx_validUntil: %d, height: %d, block_time: %d", tx.Hash().String(), tx.ValidUntil(), height, blockTime)
+				continue
+			}
+			if txs.IsLocalChain {
+				groupTxs = append(groupTxs, tx)
+			} else {
+				oChainTxs = append(oChainTxs, tx)
+			}
+			committedTxs = append(committedTxs, tx)
+		}
 	}
 
 	vr.RemoveTxsInTxPool(totalTxs, groupTxs, oChainTxs)
@@ -742,6 +970,52 @@ func (vr *Validator) RemoveTxsInTxPool(totalTxs, groupTxs, oChainTxs types.Trans
 		time.Since(t1), totalTxsLen, groupTxsLen, vr.getValidatorSize())
 }
 
+//resetAccounts reloads the accounts touched by the reverted and the applied blocks from the ledger after the chain
+//is reorganized, the reverted transactions not in the applied blocks and the pending transactions of the accounts
+//are validated and pushed into the txpool again
+func (vr *Validator) resetAccounts(reverted, applied []*types.Block) {
+	addresses := make(map[string]bool)
+	appliedTxs := make(map[crypto.Hash]bool)
+	for _, blk := range applied {
+		for _, tx := range blk.Transactions {
+			appliedTxs[tx.Hash()] = true
+			addresses[tx.Sender().String()] = true
+			addresses[tx.Recipient().String()] = true
+		}
+	}
+	var txs types.Transactions
+	for _, blk := range reverted {
+		for _, tx := range blk.Transactions {
+			addresses[tx.Sender().String()] = true
+			addresses[tx.Recipient().String()] = true
+			if !appliedTxs[tx.Hash()] {
+				txs = append(txs, tx)
+			}
+		}
+	}
+
+	vr.Lock()
+	for address := range addresses {
+		if account, ok := vr.accounts[address]; ok {
+			account.Lock()
+			for elem := account.txsList.Front(); elem != nil; elem = elem.Next() {
+				txs = append(txs, elem.Value.(*types.Transaction))
+			}
+			account.Unlock()
+			delete(vr.accounts, address)
+		}
+	}
+	vr.Unlock()
+
+	var pushed int
+	for _, tx := range txs {
+		if !appliedTxs[tx.Hash()] && vr.PushTxInTxPool(tx) {
+			pushed++
+		}
+	}
+	log.Infof("[Validator] reset %d accounts, pushed back %d of %d transactions", len(addresses), pushed, len(txs))
+}
+
 //RollBackAccount roll back sender account balance
 func (vr *Validator) RollBackAccount(tx *types.Transaction) {
 	senderAccont := vr.fetchAccount(tx.Sender())
@@ -759,6 +1033,15 @@ func (vr *Validator) RollBackAccount(tx *types.Transaction) {
 	}
 }
 
+//AddBalance adds the amount to the account balance, e.g. the fees collected by the account
+func (vr *Validator) AddBalance(addr accounts.Address, amount *big.Int) {
+	if account := vr.fetchAccount(addr); account != nil {
+		account.Lock()
+		account.amount.Add(account.amount, amount)
+		account.Unlock()
+	}
+}
+
 func (vr *Validator) UpdateAccount(tx *types.Transaction) {
 	senderAccount := vr.fetchAccount(tx.Sender())
 	if senderAccount != nil {
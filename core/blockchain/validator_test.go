@@ -0,0 +1,99 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/accounts"
+	"github.com/bocheninc/L0/core/consensus"
+	"github.com/bocheninc/L0/core/coordinate"
+	"github.com/bocheninc/L0/core/params"
+	"github.com/bocheninc/L0/core/types"
+)
+
+func TestCommittedTxsExpiry(t *testing.T) {
+	defer func(v []string) { params.Validators = v }(params.Validators)
+	bc, _ := newTestBlockchain(t)
+
+	expired := types.NewTransaction(nil, []byte{1}, types.TypeAcrossChain, 1, accounts.Address{}, accounts.Address{}, big.NewInt(1), big.NewInt(1), 0)
+	expired.WithValidUntil(types.ValidUntilTimeThreshold + 100)
+	valid := types.NewTransaction(nil, []byte{1}, types.TypeAcrossChain, 2, accounts.Address{}, accounts.Address{}, big.NewInt(1), big.NewInt(1), 0)
+	valid.WithValidUntil(types.ValidUntilTimeThreshold + 300)
+
+	// without the skip group the block time is the latest time of the batches
+	txs, blockTime := bc.txValidator.GetCommittedTxs([]*consensus.CommittedTxs{
+		{Time: types.ValidUntilTimeThreshold + 100, Transactions: types.Transactions{valid}},
+		{Time: types.ValidUntilTimeThreshold + 200, Transactions: types.Transactions{expired}},
+	})
+	if blockTime != types.ValidUntilTimeThreshold+200 {
+		t.Errorf("block time %d", blockTime)
+	}
+	if len(txs) != 1 || !txs[0].Hash().Equal(valid.Hash()) {
+		t.Errorf("committed txs %v", txs)
+	}
+}
+
+func TestProcessTransactionEviction(t *testing.T) {
+	defer func(v, p []string, size int) {
+		params.Validators, params.PublicAddress, validTxPoolSize = v, p, size
+	}(params.Validators, params.PublicAddress, validTxPoolSize)
+	bc, _ := newTestBlockchain(t)
+	validTxPoolSize = 1
+
+	var issuers []*crypto.PrivateKey
+	params.PublicAddress = nil
+	for i := 0; i < 2; i++ {
+		key, _ := crypto.GenerateKey()
+		issuers = append(issuers, key)
+		params.PublicAddress = append(params.PublicAddress, utils.BytesToHex(accounts.PublicKeyToAddress(*key.Public()).Bytes()))
+	}
+	newTx := func(key *crypto.PrivateKey, fee int64, signer *crypto.PrivateKey) *types.Transaction {
+		sender := accounts.PublicKeyToAddress(*key.Public())
+		tx := types.NewTransaction(coordinate.NewChainCoordinate(params.ChainID), coordinate.NewChainCoordinate(params.ChainID),
+			types.TypeIssue, 1, sender, accounts.Address{}, big.NewInt(100), big.NewInt(fee), utils.CurrentTimestamp())
+		sig, _ := signer.Sign(tx.SignHash().Bytes())
+		tx.WithSignature(sig)
+		return tx
+	}
+
+	cheap := newTx(issuers[0], 1, issuers[0])
+	if !bc.ProcessTransaction(cheap) {
+		t.Fatal("push cheap tx")
+	}
+
+	// a forged transaction does not evict the pending one
+	if bc.ProcessTransaction(newTx(issuers[1], 100, issuers[0])) {
+		t.Error("push forged tx")
+	}
+	if _, ok := bc.txValidator.getTransactionByHash(cheap.Hash()); !ok {
+		t.Error("cheap tx evicted by forged tx")
+	}
+
+	// a valid transaction with a higher fee does
+	if !bc.ProcessTransaction(newTx(issuers[1], 100, issuers[1])) {
+		t.Error("push valid tx")
+	}
+	if _, ok := bc.txValidator.getTransactionByHash(cheap.Hash()); ok {
+		t.Error("cheap tx not evicted")
+	}
+}
@@ -18,7 +18,13 @@
 
 package consensus
 
-import "github.com/bocheninc/L0/core/types"
+import (
+	"strings"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/types"
+)
 
 //BroadcastConsensus Define consensus data for broadcast
 type BroadcastConsensus struct {
@@ -37,8 +43,9 @@ type CommittedTxs struct {
 
 // OutputTxs Consensus output object
 type OutputTxs struct {
-	Outputs []*CommittedTxs
-	Height  uint32
+	Outputs  []*CommittedTxs
+	Height   uint32
+	Proposer string
 }
 
 // Consenter Interface for plugin consenser
@@ -63,9 +70,33 @@ type BlockchainInfo struct {
 	Height    uint32
 }
 
+// IStateTransfer Interface for checkpoint persistence and state transfer
+type IStateTransfer interface {
+	GetBlockHashByHeight(height uint32) (crypto.Hash, error)
+	PutCheckpoint(key string, data []byte) error
+	GetCheckpoint(key string) ([]byte, error)
+	StateTransfer(height uint32, blockHash crypto.Hash)
+	SyncBlocks()
+}
+
 // IStack Interface for other function for plugin consenser
 type IStack interface {
 	VerifyTxsInConsensus(txs []*types.Transaction, primary bool) bool
 	GetBlockchainInfo() *BlockchainInfo
+	GetValidatorSet(height uint32) (*types.ValidatorSet, error)
 	ITxPool
+	IStateTransfer
+}
+
+// ReplicaID returns the consensus identity of the node in the chain
+func ReplicaID(chain, nodeID string) string {
+	return chain + ":" + utils.BytesToHex(crypto.Ripemd160([]byte(nodeID+chain)))
+}
+
+// ReplicaChain returns the chain of the consensus identity
+func ReplicaChain(replicaID string) string {
+	if i := strings.LastIndex(replicaID, ":"); i >= 0 {
+		return replicaID[:i]
+	}
+	return ""
 }
@@ -25,6 +25,7 @@ import (
 	"github.com/bocheninc/L0/core/consensus"
 	"github.com/bocheninc/L0/core/consensus/lbft"
 	"github.com/bocheninc/L0/core/consensus/noops"
+	"github.com/bocheninc/L0/core/consensus/raft"
 )
 
 // NewConsenter Create consenter of plugin
@@ -32,6 +33,8 @@ func NewConsenter(option *Options, stack consensus.IStack) (consenter consensus.
 	plugin := strings.ToLower(option.Plugin)
 	if plugin == "lbft" {
 		consenter = lbft.NewLbft(option.Lbft, stack)
+	} else if plugin == "raft" {
+		consenter = raft.NewRaft(option.Raft, stack)
 	} else {
 		if plugin != "noops" {
 			log.Warnf("Unspport consenter of plugin %s, use default plugin noops", plugin)
@@ -50,6 +53,7 @@ func NewDefaultOptions() *Options {
 		Plugin: "noops",
 		Noops:  noops.NewDefaultOptions(),
 		Lbft:   lbft.NewDefaultOptions(),
+		Raft:   raft.NewDefaultOptions(),
 	}
 	return options
 }
@@ -58,5 +62,6 @@ func NewDefaultOptions() *Options {
 type Options struct {
 	Noops  *noops.Options
 	Lbft   *lbft.Options
+	Raft   *raft.Options
 	Plugin string
 }
@@ -19,6 +19,9 @@
 package helper
 
 import (
+	"errors"
+
+	"github.com/bocheninc/L0/components/crypto"
 	"github.com/bocheninc/L0/core/consensus"
 	"github.com/bocheninc/L0/core/types"
 )
@@ -30,6 +33,9 @@ func NewStack() *Stack {
 
 // Stack Implenment consensus.IStack
 type Stack struct {
+	// Validators the validator set of every height
+	Validators  *types.ValidatorSet
+	checkpoints map[string][]byte
 }
 
 // GetBlockchainInfo Implenment consensus.IStack
@@ -37,6 +43,14 @@ func (stack *Stack) GetBlockchainInfo() *consensus.BlockchainInfo {
 	return &consensus.BlockchainInfo{}
 }
 
+// GetValidatorSet Implenment consensus.IStack
+func (stack *Stack) GetValidatorSet(height uint32) (*types.ValidatorSet, error) {
+	if stack.Validators == nil {
+		return types.NewValidatorSet(), nil
+	}
+	return stack.Validators.Copy(), nil
+}
+
 // VerifyTxsInConsensus Implenment consensus.IStack
 func (stack *Stack) VerifyTxsInConsensus(txs []*types.Transaction, primary bool) bool {
 	return true
@@ -46,3 +60,30 @@ func (stack *Stack) VerifyTxsInConsensus(txs []*types.Transaction, primary bool)
 func (stack *Stack) FetchGroupingTxsInTxPool(groupingNum, maxSizeInGrouping int) []types.Transactions {
 	return nil
 }
+
+// GetBlockHashByHeight Implenment consensus.IStack
+func (stack *Stack) GetBlockHashByHeight(height uint32) (crypto.Hash, error) {
+	return crypto.Hash{}, errors.New("not found block")
+}
+
+// PutCheckpoint Implenment consensus.IStack
+func (stack *Stack) PutCheckpoint(key string, data []byte) error {
+	if stack.checkpoints == nil {
+		stack.checkpoints = make(map[string][]byte)
+	}
+	stack.checkpoints[key] = data
+	return nil
+}
+
+// GetCheckpoint Implenment consensus.IStack
+func (stack *Stack) GetCheckpoint(key string) ([]byte, error) {
+	return stack.checkpoints[key], nil
+}
+
+// StateTransfer Implenment consensus.IStack
+func (stack *Stack) StateTransfer(height uint32, blockHash crypto.Hash) {
+}
+
+// SyncBlocks Implenment consensus.IStack
+func (stack *Stack) SyncBlocks() {
+}
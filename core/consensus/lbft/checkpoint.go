@@ -0,0 +1,249 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package lbft
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/components/utils/vote"
+)
+
+//checkpointKey the key of the stable checkpoint persisted by lbft
+const checkpointKey = "lbft"
+
+//loadCheckpoint restore the persisted stable checkpoint
+func (lbft *Lbft) loadCheckpoint() {
+	data, err := lbft.stack.GetCheckpoint(checkpointKey)
+	if err != nil || len(data) == 0 {
+		return
+	}
+	sc := &StableCheckpoint{}
+	if err := deserialize(data, sc); err != nil || sc.Checkpoint == nil {
+		log.Errorf("Replica %s load stable checkpoint error %v", lbft.options.ID, err)
+		return
+	}
+	lbft.stableCheckpoint = sc
+	if cp := sc.Checkpoint; cp.SeqNo > lbft.lastSeqNo {
+		lbft.lastSeqNo = cp.SeqNo
+		lbft.execSeqNo = cp.SeqNo
+		lbft.verifySeqNo = cp.SeqNo
+	}
+	log.Infof("Replica %s load stable checkpoint %d (height %d, block %s)", lbft.options.ID, sc.Checkpoint.SeqNo, sc.Checkpoint.Height, sc.Checkpoint.BlockHash)
+}
+
+//addPendingCheckpoint checkpoint every K blocks, it is sent after the block appended
+func (lbft *Lbft) addPendingCheckpoint(seqNo uint64, height uint32) {
+	if lbft.options.K <= 0 || height%uint32(lbft.options.K) != 0 {
+		return
+	}
+	if len(lbft.pendingCheckpoints) >= lbft.options.K {
+		lbft.pendingCheckpoints = lbft.pendingCheckpoints[1:]
+	}
+	lbft.pendingCheckpoints = append(lbft.pendingCheckpoints, &Checkpoint{
+		ReplicaID: lbft.options.ID,
+		Chain:     lbft.options.Chain,
+		SeqNo:     seqNo,
+		Height:    height,
+	})
+}
+
+//sendCheckpoints broadcast the pending checkpoints whose block is appended
+func (lbft *Lbft) sendCheckpoints() {
+	var pending []*Checkpoint
+	for _, cp := range lbft.pendingCheckpoints {
+		blockHash, err := lbft.stack.GetBlockHashByHeight(cp.Height)
+		if err != nil {
+			pending = append(pending, cp)
+			continue
+		}
+		cp.BlockHash = blockHash.String()
+		log.Debugf("Replica %s send checkpoint %d (height %d, block %s)", lbft.options.ID, cp.SeqNo, cp.Height, cp.BlockHash)
+		msg := &Message{Type: MESSAGECHECKPOINT, Payload: serialize(cp)}
+		lbft.broadcast(lbft.options.Chain, msg)
+		lbft.recvConsensusMsgChan <- msg
+	}
+	lbft.pendingCheckpoints = pending
+}
+
+func (lbft *Lbft) recvCheckpoint(cp *Checkpoint, msg *Message) {
+	if lbft.stableCheckpoint != nil && cp.SeqNo <= lbft.stableCheckpoint.Checkpoint.SeqNo {
+		return
+	}
+
+	v, ok := lbft.voteCheckpoint[cp.SeqNo]
+	if !ok {
+		v = vote.NewVote()
+		lbft.voteCheckpoint[cp.SeqNo] = v
+		lbft.checkpointProofs[cp.SeqNo] = make(map[string]*Message)
+	}
+	v.Add(cp.ReplicaID, cp)
+	if _, ok := lbft.checkpointProofs[cp.SeqNo][cp.ReplicaID]; !ok {
+		lbft.checkpointProofs[cp.SeqNo][cp.ReplicaID] = msg
+	}
+	log.Debugf("Replica %s received checkpoint message from %s for seqNo %d, vote %d", lbft.options.ID, cp.ReplicaID, cp.SeqNo, v.Size())
+
+	if quorum := v.VoterByTicket(cp); quorum >= lbft.intersectionQuorum() {
+		var proofs []*Message
+		for replicaID, proof := range lbft.checkpointProofs[cp.SeqNo] {
+			if _, ticket := v.VoterByVoter(replicaID); ticket != nil && bytes.Equal(ticket.Serialize(), cp.Serialize()) {
+				proofs = append(proofs, proof)
+			}
+		}
+		lbft.updateStableCheckpoint(&StableCheckpoint{Checkpoint: cp, Proofs: proofs})
+	}
+}
+
+func (lbft *Lbft) updateStableCheckpoint(sc *StableCheckpoint) {
+	lbft.stableCheckpoint = sc
+	for seqNo := range lbft.voteCheckpoint {
+		if seqNo <= sc.Checkpoint.SeqNo {
+			delete(lbft.voteCheckpoint, seqNo)
+			delete(lbft.checkpointProofs, seqNo)
+		}
+	}
+	if err := lbft.stack.PutCheckpoint(checkpointKey, serialize(sc)); err != nil {
+		log.Errorf("Replica %s persist stable checkpoint %d error %v", lbft.options.ID, sc.Checkpoint.SeqNo, err)
+	}
+	log.Infof("Replica %s stable checkpoint %d (height %d, block %s)", lbft.options.ID, sc.Checkpoint.SeqNo, sc.Checkpoint.Height, sc.Checkpoint.BlockHash)
+}
+
+func (lbft *Lbft) recvFetchCheckpoint(fc *FetchCheckpoint) {
+	sc := lbft.stableCheckpoint
+	if sc == nil || sc.Checkpoint.SeqNo <= fc.SeqNo {
+		log.Debugf("Replica %s received fetch checkpoint message from %s : ignore seqNo %d", lbft.options.ID, fc.ReplicaID, fc.SeqNo)
+		return
+	}
+	log.Infof("Replica %s received fetch checkpoint message from %s : broadcast stable checkpoint %d", lbft.options.ID, fc.ReplicaID, sc.Checkpoint.SeqNo)
+	lbft.broadcast(lbft.options.Chain, &Message{Type: MESSAGESTABLECHECKPOINT, Payload: serialize(&StableCheckpoint{
+		ReplicaID:  lbft.options.ID,
+		Checkpoint: sc.Checkpoint,
+		Proofs:     sc.Proofs,
+	})})
+}
+
+func (lbft *Lbft) recvStableCheckpoint(sc *StableCheckpoint) {
+	cp := sc.Checkpoint
+	if cp == nil || cp.Chain != lbft.options.Chain {
+		log.Errorf("Replica %s received stable checkpoint message from %s : ignore illegal checkpoint", lbft.options.ID, sc.ReplicaID)
+		return
+	}
+	if lbft.stableCheckpoint != nil && cp.SeqNo <= lbft.stableCheckpoint.Checkpoint.SeqNo {
+		return
+	}
+	if !lbft.hasValidatorKeys() {
+		log.Errorf("Replica %s received stable checkpoint message from %s : ignore without validator keys", lbft.options.ID, sc.ReplicaID)
+		return
+	}
+	if err := lbft.verifyStableCheckpoint(sc); err != nil {
+		log.Errorf("Replica %s received stable checkpoint message from %s : %v", lbft.options.ID, sc.ReplicaID, err)
+		return
+	}
+	lbft.updateStableCheckpoint(&StableCheckpoint{Checkpoint: cp, Proofs: sc.Proofs})
+	if cp.SeqNo > lbft.execSeqNum() {
+		lbft.stateTransfer(cp)
+	}
+}
+
+//verifyStableCheckpoint checks the checkpoint is signed by 2f+1 distinct replicas of the validator set
+func (lbft *Lbft) verifyStableCheckpoint(sc *StableCheckpoint) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("illegal proof %v", r)
+		}
+	}()
+
+	lbft.rwValidators.RLock()
+	validators := make(map[string]*crypto.PublicKey, len(lbft.validators))
+	for id, pub := range lbft.validators {
+		validators[id] = pub
+	}
+	lbft.rwValidators.RUnlock()
+	if len(validators) == 0 {
+		return errors.New("no validator keys")
+	}
+	quorum := (len(validators)*2-1)/3 + 1
+	if q := lbft.intersectionQuorum(); q > quorum {
+		quorum = q
+	}
+
+	replicas := make(map[string]bool)
+	for _, proof := range sc.Proofs {
+		if proof == nil || proof.Type != MESSAGECHECKPOINT || len(proof.Signature) != crypto.SignatureSize {
+			continue
+		}
+		pub, ok := validators[proof.ReplicaID]
+		if !ok {
+			continue
+		}
+		var sig crypto.Signature
+		copy(sig[:], proof.Signature)
+		if h := proof.signHash(); !sig.Verify(h[:], pub) {
+			continue
+		}
+		if cp := proof.GetCheckpoint(); cp.ReplicaID == proof.ReplicaID && bytes.Equal(cp.Serialize(), sc.Checkpoint.Serialize()) {
+			replicas[cp.ReplicaID] = true
+		}
+	}
+	if len(replicas) < quorum {
+		return fmt.Errorf("checkpoint %d signed by %d replicas, quorum %d", sc.Checkpoint.SeqNo, len(replicas), quorum)
+	}
+	return nil
+}
+
+//fetchCheckpoint ask the stable checkpoint when fallen behind
+func (lbft *Lbft) fetchCheckpoint() {
+	now := lbft.options.Clock.Now()
+	if now.Sub(lbft.fetchCheckpointTime) < lbft.options.ViewChange {
+		return
+	}
+	lbft.fetchCheckpointTime = now
+	log.Warnf("Replica %s fetch checkpoint after %d", lbft.options.ID, lbft.execSeqNum())
+	fc := &FetchCheckpoint{
+		ReplicaID: lbft.options.ID,
+		Chain:     lbft.options.Chain,
+		SeqNo:     lbft.execSeqNum(),
+	}
+	lbft.broadcast(lbft.options.Chain, &Message{Type: MESSAGEFETCHCHECKPOINT, Payload: serialize(fc)})
+}
+
+//stateTransfer skip to the stable checkpoint and fetch the missing blocks
+func (lbft *Lbft) stateTransfer(cp *Checkpoint) {
+	log.Warnf("Replica %s state transfer from %d to checkpoint %d (height %d, block %s)", lbft.options.ID, lbft.execSeqNum(), cp.SeqNo, cp.Height, cp.BlockHash)
+	lbft.updateLastSeqNo(cp.SeqNo)
+	lbft.updateVerifySeqNo(cp.SeqNo)
+	if cp.Height > lbft.lastHeightNum() {
+		lbft.updateLastHeightNum(cp.Height)
+	}
+	lbft.stack.StateTransfer(cp.Height, crypto.HexToHash(cp.BlockHash))
+
+	lbft.rwCommittedRequestBatch.Lock()
+	defer lbft.rwCommittedRequestBatch.Unlock()
+	for seqNo := range lbft.committedRequestBatch {
+		if seqNo <= cp.SeqNo {
+			delete(lbft.committedRequestBatch, seqNo)
+		}
+	}
+	atomic.StoreUint64(&lbft.execSeqNo, cp.SeqNo)
+	lbft.checkpoint()
+}
@@ -19,10 +19,12 @@
 package lbft
 
 import (
+	"sync"
 	"time"
 
 	"github.com/bocheninc/L0/components/log"
 	"github.com/bocheninc/L0/components/utils/vote"
+	"github.com/bocheninc/L0/core/consensus"
 )
 
 func newLbftCore(name string, lbft *Lbft) *lbftCore {
@@ -35,12 +37,12 @@ func newLbftCore(name string, lbft *Lbft) *lbftCore {
 		commitVote:      vote.NewVote(),
 		prePrepareAsync: lbft.prePrepareAsync,
 		commitAsync:     lbft.commitAsync,
-		firstTime:       time.Now(),
+		firstTime:       lbft.options.Clock.Now(),
 	}
-	lbftCore.clsTimeoutTimer = time.NewTimer(2 * lbft.options.BlockTimeout)
+	lbftCore.clsTimeoutTimer = lbft.options.Clock.NewTimer(2 * lbft.options.BlockTimeout)
 	go func() {
 		select {
-		case <-lbftCore.clsTimeoutTimer.C:
+		case <-lbftCore.clsTimeoutTimer.Chan():
 			lbft.removeInstance(name)
 			close(lbftCore.msgChan)
 		case <-lbftCore.exit:
@@ -55,11 +57,13 @@ type lbftCore struct {
 	msgChan         chan *Message
 	prepareVote     *vote.Vote
 	commitVote      *vote.Vote
-	clsTimeoutTimer *time.Timer
+	clsTimeoutTimer consensus.Timer
 
 	prePrepareAsync *asyncSeqNo
 	commitAsync     *asyncSeqNo
 
+	// rwState guards the state below, the messages of the instance are handled by several goroutines
+	rwState          sync.RWMutex
 	isPassPrePrepare bool
 	isPassPrepare    bool
 	isPassCommit     bool
@@ -89,24 +93,27 @@ func (instance *lbftCore) recvMessage(msg *Message) {
 }
 
 func (instance *lbftCore) start() {
+	instance.rwState.Lock()
+	defer instance.rwState.Unlock()
 	if instance.isRunnig {
 		log.Warnf("Replica %s core consenter %s alreay started", instance.lbft.options.ID, instance.name)
 		return
 	}
-	if time.Since(instance.firstTime) > instance.lbft.options.BlockTimeout {
+	elapsed := instance.lbft.options.Clock.Now().Sub(instance.firstTime)
+	if elapsed > instance.lbft.options.BlockTimeout {
 		log.Warnf("Replica %s core consenter %s delay too long", instance.lbft.options.ID, instance.name)
 		return
 	}
 	instance.isRunnig = true
 	instance.clsTimeoutTimer.Stop()
-	timeoutTimer := time.NewTimer(instance.lbft.options.BlockTimeout - time.Since(instance.firstTime))
+	timeoutTimer := instance.lbft.options.Clock.NewTimer(instance.lbft.options.BlockTimeout - elapsed)
 	go func() {
 		for {
 			select {
-			case <-timeoutTimer.C:
-				if !instance.isPassCommit {
-					if instance.seqNo > instance.lbft.lastSeqNum() {
-						log.Debugf("Replica %s send view change for consensus %s : timeout (%d > %d)", instance.lbft.options.ID, instance.name, instance.seqNo, instance.lbft.lastSeqNum())
+			case <-timeoutTimer.Chan():
+				if seqNo, isPassCommit := instance.status(); !isPassCommit {
+					if seqNo > instance.lbft.lastSeqNum() {
+						log.Debugf("Replica %s send view change for consensus %s : timeout (%d > %d)", instance.lbft.options.ID, instance.name, seqNo, instance.lbft.lastSeqNum())
 						//if instance.lbft.options.AutoVote {
 						instance.lbft.sendViewChange(nil)
 						//}
@@ -114,16 +121,17 @@ func (instance *lbftCore) start() {
 				}
 			case <-instance.exit:
 				close(instance.msgChan)
-				if !instance.isPassCommit {
-					if instance.seqNo > instance.lbft.verifySeqNum() {
-						log.Errorf("Replica %s failed to verify for consensus %s :  wrong verifySeqNo (%d <= %d),  previous verify failed ", instance.lbft.options.ID, instance.name, instance.seqNo, instance.lbft.verifySeqNum())
+				seqNo, isPassCommit := instance.status()
+				if !isPassCommit {
+					if seqNo > instance.lbft.verifySeqNum() {
+						log.Errorf("Replica %s failed to verify for consensus %s :  wrong verifySeqNo (%d <= %d),  previous verify failed ", instance.lbft.options.ID, instance.name, seqNo, instance.lbft.verifySeqNum())
 					}
-					if instance.seqNo > instance.lbft.lastSeqNum() {
-						log.Warnf("Replica %s is failed for consensus %s (%d<=%d)", instance.lbft.options.ID, instance.name, instance.seqNo, instance.lbft.lastSeqNum())
+					if seqNo > instance.lbft.lastSeqNum() {
+						log.Warnf("Replica %s is failed for consensus %s (%d<=%d)", instance.lbft.options.ID, instance.name, seqNo, instance.lbft.lastSeqNum())
 					}
 				}
-				instance.prePrepareAsync.notify(instance.seqNo)
-				instance.commitAsync.notify(instance.seqNo)
+				instance.prePrepareAsync.notify(seqNo)
+				instance.commitAsync.notify(seqNo)
 				//instance.deltaTime[4] = time.Since(instance.startTime)
 				//log.Infof("lbft_core_cost_time(%s)  deltatime(%s,%s,%s,%s) txs(%d)", instance.name, instance.deltaTime[1], instance.deltaTime[2], instance.deltaTime[3], instance.deltaTime[4], len(instance.requestBatch.Requests))
 				log.Debugf("Replica %s core consenter %s stopped", instance.lbft.options.ID, instance.name)
@@ -146,6 +154,8 @@ func (instance *lbftCore) start() {
 }
 
 func (instance *lbftCore) stop() {
+	instance.rwState.Lock()
+	defer instance.rwState.Unlock()
 	if !instance.isRunnig {
 		log.Warnf("Replica %s core consenter %s alreay stopped", instance.lbft.options.ID, instance.name)
 		return
@@ -154,34 +164,50 @@ func (instance *lbftCore) stop() {
 	close(instance.exit)
 }
 
+func (instance *lbftCore) running() bool {
+	instance.rwState.RLock()
+	defer instance.rwState.RUnlock()
+	return instance.isRunnig
+}
+
+func (instance *lbftCore) status() (uint64, bool) {
+	instance.rwState.RLock()
+	defer instance.rwState.RUnlock()
+	return instance.seqNo, instance.isPassCommit
+}
+
 func (instance *lbftCore) isCross() bool {
+	instance.rwState.RLock()
+	defer instance.rwState.RUnlock()
 	return instance.fromChain != instance.toChain
 }
 
 func (instance *lbftCore) handleRequestBatch(seqNo uint64, requestBatch *RequestBatch) {
+	fromChain, toChain := instance.lbft.options.Chain, instance.lbft.options.Chain
+	if requestBatch.ID != EMPTYBLOCK {
+		fromChain = requestBatch.fromChain()
+		toChain = requestBatch.toChain()
+	}
+	instance.rwState.Lock()
 	instance.seqNo = seqNo
+	instance.fromChain = fromChain
+	instance.toChain = toChain
+	instance.rwState.Unlock()
 	instance.start()
-	if requestBatch.ID == EMPTYBLOCK {
-		instance.fromChain = instance.lbft.options.Chain
-		instance.toChain = instance.lbft.options.Chain
-	} else {
-		instance.fromChain = requestBatch.fromChain()
-		instance.toChain = requestBatch.toChain()
-	}
 	var verfiy bool
-	instance.prePrepareAsync.wait(instance.seqNo, func() {
-		log.Debugf("Replica %s handle requestBatch for consensus %s : seqNo %d (async preprepare)", instance.lbft.options.ID, instance.name, instance.seqNo)
-		instance.waitForVerify()
-		if requestBatch.ID != EMPTYBLOCK && requestBatch.Index == 0 && instance.fromChain == instance.lbft.options.Chain {
+	instance.prePrepareAsync.wait(seqNo, func() {
+		log.Debugf("Replica %s handle requestBatch for consensus %s : seqNo %d (async preprepare)", instance.lbft.options.ID, instance.name, seqNo)
+		instance.waitForVerify(seqNo)
+		if requestBatch.ID != EMPTYBLOCK && requestBatch.Index == 0 && fromChain == instance.lbft.options.Chain {
 			t := time.Now()
 			pass := instance.lbft.stack.VerifyTxsInConsensus(instance.lbft.toTxs(requestBatch), true)
-			log.Debugf("Replica %s VerifyTxsInConsensus elapsed %s for consensus %s(%d)", instance.lbft.options.ID, time.Now().Sub(t), instance.name, instance.seqNo)
+			log.Debugf("Replica %s VerifyTxsInConsensus elapsed %s for consensus %s(%d)", instance.lbft.options.ID, time.Now().Sub(t), instance.name, seqNo)
 			_ = pass
 
 		}
-		if instance.fromChain != instance.toChain && instance.fromChain == instance.lbft.options.Chain {
-			log.Infof("Replica %s broadcast requestBatch message to %s  for consensus %s (%d transactions)", instance.lbft.options.ID, instance.toChain, instance.name, len(requestBatch.Requests))
-			instance.lbft.broadcast(instance.toChain, &Message{Type: MESSAGEREQUESTBATCH, Payload: serialize(requestBatch)})
+		if fromChain != toChain && fromChain == instance.lbft.options.Chain {
+			log.Infof("Replica %s broadcast requestBatch message to %s  for consensus %s (%d transactions)", instance.lbft.options.ID, toChain, instance.name, len(requestBatch.Requests))
+			instance.lbft.broadcast(toChain, &Message{Type: MESSAGEREQUESTBATCH, Payload: serialize(requestBatch)})
 		}
 
 		instance.lbft.incrVerifySeqNum()
@@ -189,17 +215,17 @@ func (instance *lbftCore) handleRequestBatch(seqNo uint64, requestBatch *Request
 	})
 
 	if !verfiy {
-		log.Errorf("Replica %s for consensus %s failed to verify %d", instance.lbft.options.ID, instance.name, instance.seqNo)
+		log.Errorf("Replica %s for consensus %s failed to verify %d", instance.lbft.options.ID, instance.name, seqNo)
 	}
 
-	log.Infof("Replica %s received requestBatch message for consensus %s (%d transactions) (seqNo %d)", instance.lbft.options.ID, instance.name, len(requestBatch.Requests), instance.seqNo)
+	log.Infof("Replica %s received requestBatch message for consensus %s (%d transactions) (seqNo %d)", instance.lbft.options.ID, instance.name, len(requestBatch.Requests), seqNo)
 
 	prePrepare := &PrePrepare{
 		Name:      instance.name,
 		PrimaryID: instance.lbft.options.ID,
 		Chain:     instance.lbft.options.Chain,
 		ReplicaID: instance.lbft.options.ID,
-		SeqNo:     instance.seqNo,
+		SeqNo:     seqNo,
 		// Digest:    hash(requestBatch),
 		// Quorum:    uint64(instance.lbft.intersectionQuorum()),
 		Requests: requestBatch,
@@ -214,10 +240,6 @@ func (instance *lbftCore) handlePrePrepare(preprep *PrePrepare) {
 	if preprep == nil {
 		return
 	}
-	if instance.isPassPrePrepare {
-		log.Errorf("Replica %s received prePrepare message from %s for consensus %s : alreay exist ", instance.lbft.options.ID, preprep.ReplicaID, instance.name)
-		return
-	}
 
 	requestBatch := preprep.Requests
 	var fromChain, toChain string
@@ -228,10 +250,18 @@ func (instance *lbftCore) handlePrePrepare(preprep *PrePrepare) {
 		fromChain = requestBatch.fromChain()
 		toChain = requestBatch.toChain()
 	}
+	seqNo := preprep.SeqNo
 
+	instance.rwState.Lock()
+	if instance.isPassPrePrepare {
+		instance.rwState.Unlock()
+		log.Errorf("Replica %s received prePrepare message from %s for consensus %s : alreay exist ", instance.lbft.options.ID, preprep.ReplicaID, instance.name)
+		return
+	}
 	instance.fromChain = fromChain
 	instance.toChain = toChain
-	instance.seqNo = preprep.SeqNo
+	instance.seqNo = seqNo
+	instance.rwState.Unlock()
 
 	if !instance.lbft.isPrimary() {
 		if !instance.lbft.isValid(requestBatch, fromChain == instance.lbft.options.Chain) {
@@ -239,14 +269,14 @@ func (instance *lbftCore) handlePrePrepare(preprep *PrePrepare) {
 			return
 		}
 		var verify bool
-		instance.prePrepareAsync.wait(instance.seqNo, func() {
-			log.Debugf("Replica %s handle preprepare for consensus %s : seqNo %d (async preprepare)", instance.lbft.options.ID, instance.name, instance.seqNo)
-			instance.waitForVerify()
-			if requestBatch.ID != EMPTYBLOCK && requestBatch.Index == 0 && instance.lbft.options.Chain == fromChain && instance.seqNo > instance.lbft.seqNum() {
+		instance.prePrepareAsync.wait(seqNo, func() {
+			log.Debugf("Replica %s handle preprepare for consensus %s : seqNo %d (async preprepare)", instance.lbft.options.ID, instance.name, seqNo)
+			instance.waitForVerify(seqNo)
+			if requestBatch.ID != EMPTYBLOCK && requestBatch.Index == 0 && instance.lbft.options.Chain == fromChain && seqNo > instance.lbft.seqNum() {
 				//instance.lbft.stack.Removes(instance.lbft.toTxs(requestBatch))
 				t := time.Now()
 				pass := instance.lbft.stack.VerifyTxsInConsensus(instance.lbft.toTxs(requestBatch), false)
-				log.Debugf("Replica %s VerifyTxsInConsensus elapsed %s for consensus %s(%d)", instance.lbft.options.ID, time.Now().Sub(t), instance.name, instance.seqNo)
+				log.Debugf("Replica %s VerifyTxsInConsensus elapsed %s for consensus %s(%d)", instance.lbft.options.ID, time.Now().Sub(t), instance.name, seqNo)
 				if !pass {
 					log.Errorf("Replica %s received prePrepare message from %s for consensus %s : different digest", instance.lbft.options.ID, preprep.ReplicaID, instance.name)
 					return
@@ -256,11 +286,11 @@ func (instance *lbftCore) handlePrePrepare(preprep *PrePrepare) {
 			verify = true
 		})
 		if !verify {
-			log.Errorf("Replica %s for consensus %s failed to verify %d", instance.lbft.options.ID, instance.name, instance.seqNo)
+			log.Errorf("Replica %s for consensus %s failed to verify %d", instance.lbft.options.ID, instance.name, seqNo)
 			return
 		}
 	} else if requestBatch.ID != EMPTYBLOCK {
-		if instance.toChain == instance.fromChain {
+		if toChain == fromChain {
 			instance.lbft.resetEmptyBlockTimer()
 		} else {
 			log.Debugf("Replica %s start cross chain empty block", instance.lbft.options.ID)
@@ -270,22 +300,25 @@ func (instance *lbftCore) handlePrePrepare(preprep *PrePrepare) {
 
 	log.Infof("Replica %s received prePrepare message from %s for consensus %s (%d transactions)", instance.lbft.options.ID, preprep.ReplicaID, instance.name, len(requestBatch.Requests))
 
+	digest := hash(requestBatch)
+	instance.rwState.Lock()
 	instance.requestBatch = requestBatch
 	// instance.fromChain = fromChain
 	// instance.toChain = toChain
 	//instance.seqNo = preprep.SeqNo
-	instance.digest = hash(instance.requestBatch)
+	instance.digest = digest
 	instance.isPassPrePrepare = true
+	instance.rwState.Unlock()
 	prepare := &Prepare{
 		Name:      instance.name,
-		PrimaryID: instance.lbft.primaryID,
+		PrimaryID: instance.lbft.primary(),
 		Chain:     instance.lbft.options.Chain,
 		ReplicaID: instance.lbft.options.ID,
-		SeqNo:     instance.seqNo,
-		Digest:    instance.digest,
+		SeqNo:     seqNo,
+		Digest:    digest,
 		Quorum:    uint64(instance.lbft.intersectionQuorum()),
 	}
-	log.Infof("Replica %s send prepare message for consensus %s (%d transactions)", instance.lbft.options.ID, instance.name, len(instance.requestBatch.Requests))
+	log.Infof("Replica %s send prepare message for consensus %s (%d transactions)", instance.lbft.options.ID, instance.name, len(requestBatch.Requests))
 	instance.handlePrepare(prepare)
 	instance.broadcast(&Message{Type: MESSAGEPREPARE, Payload: serialize(prepare)})
 }
@@ -294,20 +327,30 @@ func (instance *lbftCore) handlePrepare(prepare *Prepare) {
 	if prepare == nil {
 		return
 	}
+	if commit := instance.votePrepare(prepare); commit != nil {
+		instance.handleCommit(commit)
+		instance.broadcast(&Message{Type: MESSAGECOMMIT, Payload: serialize(commit)})
+	}
+}
+
+//votePrepare add the prepare vote, it returns the commit message once prepared
+func (instance *lbftCore) votePrepare(prepare *Prepare) *Commit {
+	instance.rwState.Lock()
+	defer instance.rwState.Unlock()
 	if instance.isPassPrePrepare {
 		if prepare.Chain != instance.fromChain && prepare.Chain != instance.toChain {
 			log.Errorf("Replica %s received prepare message from %s for consensus %s: illegal prepare", instance.lbft.options.ID, prepare.ReplicaID, instance.name)
-			return
+			return nil
 		}
 
 		if prepare.Chain == instance.lbft.options.Chain && prepare.SeqNo != instance.seqNo {
 			log.Errorf("Replica %s received prepare message from %s for consensus %s : different seqNo (%d == %d) ", instance.lbft.options.ID, prepare.ReplicaID, instance.name, instance.seqNo, prepare.SeqNo)
-			return
+			return nil
 		}
 
 		if prepare.Digest != instance.digest {
 			log.Errorf("Replica %s received prepare message from %s for consensus %s : different digest (%s == %s)", instance.lbft.options.ID, prepare.ReplicaID, instance.name, instance.digest, prepare.Digest)
-			return
+			return nil
 		}
 	}
 
@@ -316,7 +359,7 @@ func (instance *lbftCore) handlePrepare(prepare *Prepare) {
 	if instance.isPassPrepare == false && instance.maybePreparePass() {
 		commit := &Commit{
 			Name:      instance.name,
-			PrimaryID: instance.lbft.primaryID,
+			PrimaryID: instance.lbft.primary(),
 			Chain:     instance.lbft.options.Chain,
 			ReplicaID: instance.lbft.options.ID,
 			SeqNo:     instance.seqNo,
@@ -324,29 +367,47 @@ func (instance *lbftCore) handlePrepare(prepare *Prepare) {
 			Quorum:    uint64(instance.lbft.intersectionQuorum()),
 		}
 		log.Infof("Replica %s send commit message for consensus %s (%d transactions)", instance.lbft.options.ID, instance.name, len(instance.requestBatch.Requests))
-		instance.handleCommit(commit)
-		instance.broadcast(&Message{Type: MESSAGECOMMIT, Payload: serialize(commit)})
+		return commit
 	}
+	return nil
 }
 
 func (instance *lbftCore) handleCommit(commit *Commit) {
 	if commit == nil {
 		return
 	}
+	if ctt := instance.voteCommit(commit); ctt != nil {
+		go func(instance *lbftCore) {
+			if instance.running() {
+				instance.commitAsync.wait(ctt.SeqNo, func() {
+					log.Infof("Replica %s succeed to commit for consensus %s (%d transactions)", instance.lbft.options.ID, instance.name, len(ctt.RequestBatch.Requests))
+					//instance.lbft.lbftCoreCommittedChan <- ctt
+					instance.lbft.recvConsensusMsgChan <- &Message{Type: MESSAGECOMMITTED, Payload: serialize(ctt)}
+					instance.lbft.broadcast(instance.lbft.options.Chain, &Message{Type: MESSAGECOMMITTED, Payload: serialize(ctt)})
+				})
+			}
+		}(instance)
+	}
+}
+
+//voteCommit add the commit vote, it returns the committed message once committed
+func (instance *lbftCore) voteCommit(commit *Commit) *Committed {
+	instance.rwState.Lock()
+	defer instance.rwState.Unlock()
 	if instance.isPassPrePrepare {
 		if commit.Chain != instance.fromChain && commit.Chain != instance.toChain {
 			log.Errorf("Replica %s received commit message from %s for consensus %s: illegal commit", instance.lbft.options.ID, commit.ReplicaID, instance.name)
-			return
+			return nil
 		}
 
 		if commit.Chain == instance.lbft.options.Chain && commit.SeqNo != instance.seqNo {
 			log.Errorf("Replica %s received prepare message from %s for consensus %s : different seqNo (%d == %d) ", instance.lbft.options.ID, commit.ReplicaID, instance.name, instance.seqNo, commit.SeqNo)
-			return
+			return nil
 		}
 
 		if commit.Digest != instance.digest {
 			log.Errorf("Replica %s received prepare message from %s for consensus %s : different digest ", instance.lbft.options.ID, commit.ReplicaID, instance.name)
-			return
+			return nil
 		}
 	}
 
@@ -354,24 +415,15 @@ func (instance *lbftCore) handleCommit(commit *Commit) {
 	log.Infof("Replica %s received commit message from %s for consensus %s, voted %d", instance.lbft.options.ID, commit.ReplicaID, commit.Name, instance.commitVote.Size())
 
 	if instance.isPassCommit == false && instance.maybeCommitPass() {
-		go func(instance *lbftCore) {
-			if instance.isRunnig {
-				instance.commitAsync.wait(instance.seqNo, func() {
-					log.Infof("Replica %s succeed to commit for consensus %s (%d transactions)", instance.lbft.options.ID, instance.name, len(instance.requestBatch.Requests))
-					ctt := &Committed{
-						Name:         instance.name,
-						Chain:        instance.lbft.options.Chain,
-						ReplicaID:    instance.lbft.options.ID,
-						SeqNo:        instance.seqNo,
-						RequestBatch: instance.requestBatch,
-					}
-					//instance.lbft.lbftCoreCommittedChan <- ctt
-					instance.lbft.recvConsensusMsgChan <- &Message{Type: MESSAGECOMMITTED, Payload: serialize(ctt)}
-					instance.lbft.broadcast(instance.lbft.options.Chain, &Message{Type: MESSAGECOMMITTED, Payload: serialize(ctt)})
-				})
-			}
-		}(instance)
+		return &Committed{
+			Name:         instance.name,
+			Chain:        instance.lbft.options.Chain,
+			ReplicaID:    instance.lbft.options.ID,
+			SeqNo:        instance.seqNo,
+			RequestBatch: instance.requestBatch,
+		}
 	}
+	return nil
 }
 
 func (instance *lbftCore) maybePreparePass() bool {
@@ -491,23 +543,27 @@ func (instance *lbftCore) maybeCommitPass() bool {
 }
 
 func (instance *lbftCore) broadcast(msg *Message) {
-	instance.lbft.broadcast(instance.fromChain, msg)
-	if instance.fromChain != instance.toChain {
-		instance.lbft.broadcast(instance.toChain, msg)
+	instance.rwState.RLock()
+	fromChain, toChain := instance.fromChain, instance.toChain
+	instance.rwState.RUnlock()
+	instance.lbft.broadcast(fromChain, msg)
+	if fromChain != toChain {
+		instance.lbft.broadcast(toChain, msg)
 	}
 }
 
-func (instance *lbftCore) waitForVerify() {
-	if instance.seqNo <= instance.lbft.verifySeqNum()+1 {
+func (instance *lbftCore) waitForVerify(seqNo uint64) {
+	if seqNo <= instance.lbft.verifySeqNum()+1 {
 		return
 	}
-	ticker := time.NewTicker(time.Second)
 	for {
+		timer := instance.lbft.options.Clock.NewTimer(time.Second)
 		select {
 		case <-instance.exit:
+			timer.Stop()
 			return
-		case <-ticker.C:
-			if instance.seqNo <= instance.lbft.verifySeqNum()+1 {
+		case <-timer.Chan():
+			if seqNo <= instance.lbft.verifySeqNum()+1 {
 				return
 			}
 		}
@@ -21,12 +21,11 @@ package lbft
 import (
 	"testing"
 	"time"
-
-	"github.com/bocheninc/L0/core/consensus/helper"
 )
 
 func TestLbftCore(t *testing.T) {
-	lbftCore := newLbftCore("key", NewLbft(NewDefaultOptions(), helper.NewStack()))
+	stack, replicas := newTestReplicas()
+	lbftCore := newLbftCore("key", NewLbft(replicas[0], stack))
 	time.Sleep(time.Second)
 	lbftCore.stop()
 }
@@ -21,6 +21,8 @@ package lbft
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"sync"
@@ -29,6 +31,7 @@ import (
 
 	"sort"
 
+	"github.com/bocheninc/L0/components/crypto"
 	"github.com/bocheninc/L0/components/log"
 	"github.com/bocheninc/L0/components/utils/vote"
 	"github.com/bocheninc/L0/core/consensus"
@@ -44,7 +47,7 @@ const EMPTYBLOCK = 1136160000
 //NewLbft Create lbft consenter
 func NewLbft(options *Options, stack consensus.IStack) *Lbft {
 	lbft := &Lbft{
-		priority: time.Now().UnixNano(),
+		priority: options.Clock.Now().UnixNano(),
 		options:  options,
 		stack:    stack,
 		committedRequestBatch: make(map[uint64]*RequestBatch),
@@ -52,6 +55,8 @@ func NewLbft(options *Options, stack consensus.IStack) *Lbft {
 		lbftCores:             make(map[string]*lbftCore),
 		voteViewChange:        vote.NewVote(),
 		voteCommitted:         make(map[string]*vote.Vote),
+		voteCheckpoint:        make(map[uint64]*vote.Vote),
+		checkpointProofs:      make(map[uint64]map[string]*Message),
 
 		committedRequestBatchChan: make(chan *committedRequestBatch, options.BufferSize),
 		recvConsensusMsgChan:      make(chan *Message, options.BufferSize),
@@ -69,6 +74,14 @@ func NewLbft(options *Options, stack consensus.IStack) *Lbft {
 		lbft.options.ViewChangePeriod = 1000 * lbft.options.BlockInterval
 	}
 
+	lbft.loadValidators()
+	if !lbft.hasValidatorKeys() {
+		log.Panic("blockchain.validators should be configured to authenticate the consensus messages")
+	}
+	if err := lbft.loadPeerValidators(); err != nil {
+		log.Panicf("lbft.peerValidators is illegal, %v", err)
+	}
+
 	if lbft.options.N < 4 {
 		log.Panicf("lbft.N should is greater 3, %d", lbft.options.N)
 	}
@@ -81,17 +94,18 @@ func NewLbft(options *Options, stack consensus.IStack) *Lbft {
 
 	lbft.lastHeight = lbft.stack.GetBlockchainInfo().Height
 	lbft.lastSeqNo = lbft.stack.GetBlockchainInfo().LastSeqNo
-	lbft.blockTimer = time.NewTimer(lbft.options.BlockInterval)
+	lbft.loadCheckpoint()
+	lbft.blockTimer = lbft.options.Clock.NewTimer(lbft.options.BlockInterval)
 	lbft.blockTimer.Stop()
-	lbft.emptyBlockTimer = time.NewTimer(lbft.options.BlockInterval)
+	lbft.emptyBlockTimer = lbft.options.Clock.NewTimer(lbft.options.BlockInterval)
 	lbft.emptyBlockTimer.Stop()
-	lbft.viewChangeTimer = time.NewTimer(lbft.options.ViewChange)
+	lbft.viewChangeTimer = lbft.options.Clock.NewTimer(lbft.options.ViewChange)
 	lbft.viewChangeTimer.Stop()
-	lbft.resendViewChangeTimer = time.NewTimer(lbft.options.ResendViewChange)
+	lbft.resendViewChangeTimer = lbft.options.Clock.NewTimer(lbft.options.ResendViewChange)
 	lbft.resendViewChangeTimer.Stop()
-	lbft.viewChangePeriodTimer = time.NewTimer(lbft.options.BlockInterval)
+	lbft.viewChangePeriodTimer = lbft.options.Clock.NewTimer(lbft.options.BlockInterval)
 	lbft.viewChangePeriodTimer.Stop()
-	lbft.nullRequestTimer = time.NewTimer(lbft.options.NullRequest)
+	lbft.nullRequestTimer = lbft.options.Clock.NewTimer(lbft.options.NullRequest)
 	lbft.nullRequestTimer.Stop()
 	return lbft
 }
@@ -99,6 +113,7 @@ func NewLbft(options *Options, stack consensus.IStack) *Lbft {
 //Lbft Define lbft consenter
 type Lbft struct {
 	priority        int64
+	rwPrimary       sync.RWMutex
 	lastPrimaryID   string
 	primaryID       string
 	lastHeight      uint32
@@ -123,12 +138,23 @@ type Lbft struct {
 	voteViewChange          *vote.Vote
 	voteCommitted           map[string]*vote.Vote
 
-	blockTimer            *time.Timer
-	viewChangeTimer       *time.Timer
-	resendViewChangeTimer *time.Timer
-	viewChangePeriodTimer *time.Timer
-	nullRequestTimer      *time.Timer
-	emptyBlockTimer       *time.Timer
+	stableCheckpoint    *StableCheckpoint
+	pendingCheckpoints  []*Checkpoint
+	voteCheckpoint      map[uint64]*vote.Vote
+	checkpointProofs    map[uint64]map[string]*Message
+	fetchCheckpointTime time.Time
+
+	rwValidators     sync.RWMutex
+	validators       map[string]*crypto.PublicKey
+	validatorsHeight uint32
+	peerValidators   map[string]*crypto.PublicKey
+
+	blockTimer            consensus.Timer
+	viewChangeTimer       consensus.Timer
+	resendViewChangeTimer consensus.Timer
+	viewChangePeriodTimer consensus.Timer
+	nullRequestTimer      consensus.Timer
+	emptyBlockTimer       consensus.Timer
 	emptyBlockTimerStart  bool
 
 	committedBlock            []*committedRequestBatch
@@ -156,9 +182,7 @@ func (lbft *Lbft) incrExecSeqNum() uint64 {
 }
 
 func (lbft *Lbft) updateExecSeqNo(seqNo uint64) {
-	if lbft.execSeqNo == 0 {
-		lbft.execSeqNo = seqNo
-	}
+	atomic.CompareAndSwapUint64(&lbft.execSeqNo, 0, seqNo)
 }
 
 func (lbft *Lbft) updateLastHeightNum(h uint32) {
@@ -220,18 +244,16 @@ func (lbft *Lbft) Start() {
 		return
 	}
 	lbft.exit = make(chan struct{})
+	lbft.waitGroup.Add(3)
 	go func() {
-		lbft.waitGroup.Add(1)
 		defer lbft.waitGroup.Done()
 		lbft.handleCommittedRequestBatch()
 	}()
 	go func() {
-		lbft.waitGroup.Add(1)
 		defer lbft.waitGroup.Done()
 		lbft.handleTransaction()
 	}()
 	go func() {
-		lbft.waitGroup.Add(1)
 		defer lbft.waitGroup.Done()
 		lbft.handleConsensusMsg()
 	}()
@@ -262,6 +284,8 @@ func (lbft *Lbft) Stop() {
 
 // Quorum num of quorum
 func (lbft *Lbft) Quorum() int {
+	lbft.rwValidators.RLock()
+	defer lbft.rwValidators.RUnlock()
 	return lbft.options.Q
 }
 
@@ -272,6 +296,10 @@ func (lbft *Lbft) RecvConsensus(payload []byte) {
 		log.Errorf("Replica %s receive consensus message : unkown %v", lbft.options.ID, err)
 		return
 	}
+	if err := lbft.verify(msg); err != nil {
+		log.Errorf("Replica %s receive consensus message from %s : %v", lbft.options.ID, msg.ReplicaID, err)
+		return
+	}
 	if pprep := msg.GetPrePrepare(); pprep != nil {
 		log.Debugf("Replica %s core consenter %s received preprepare message from %s --- p2p", lbft.options.ID, pprep.Name, pprep.ReplicaID)
 	} else if prep := msg.GetPrepare(); prep != nil {
@@ -298,6 +326,8 @@ func (lbft *Lbft) ChangeBlockSize(size int) {
 }
 
 func (lbft *Lbft) intersectionQuorum() int {
+	lbft.rwValidators.RLock()
+	defer lbft.rwValidators.RUnlock()
 	return lbft.options.Q
 }
 
@@ -352,9 +382,13 @@ func (lbft *Lbft) writeBlock() {
 		}
 	}
 	height = lbft.committedBlock[0].requestBatch.Height
-	log.Infof("Replica %s write block %v (%d transactions), height: %d", lbft.options.ID, seqNos, cnt, height)
-	lbft.committedTxsChan <- &consensus.OutputTxs{Outputs: cts, Height: height}
+	proposer := lbft.committedBlock[0].requestBatch.Proposer
+	log.Infof("Replica %s write block %v (%d transactions), height: %d, proposer: %s", lbft.options.ID, seqNos, cnt, height, proposer)
+	lbft.committedTxsChan <- &consensus.OutputTxs{Outputs: cts, Height: height, Proposer: proposer}
 	lbft.committedBlock = nil
+	lbft.sendCheckpoints()
+	lbft.addPendingCheckpoint(seqNos[len(seqNos)-1], height)
+	lbft.loadValidators()
 }
 
 func (lbft *Lbft) handleTransaction() {
@@ -362,12 +396,12 @@ func (lbft *Lbft) handleTransaction() {
 		select {
 		case <-lbft.exit:
 			return
-		case <-lbft.viewChangeTimer.C:
+		case <-lbft.viewChangeTimer.Chan():
 			log.Debugf("Replica %s view change timeout", lbft.options.ID)
 			lbft.voteViewChange.Clear()
-		case <-lbft.resendViewChangeTimer.C:
+		case <-lbft.resendViewChangeTimer.Chan():
 			lbft.votedCnt++
-			if lbft.lastPrimaryID != "" && lbft.votedCnt > lbft.options.K {
+			if lbft.lastPrimary() != "" && lbft.votedCnt > lbft.options.K {
 				lbft.voteViewChange.IterVoter(func(voter string, ticket vote.ITicket) {
 					tvc := ticket.(*ViewChange)
 					log.Infof("Replica %s received view change message from %s for voter %s , lastSeqNo %d", lbft.options.ID, tvc.ReplicaID, tvc.PrimaryID, tvc.SeqNo)
@@ -378,32 +412,31 @@ func (lbft *Lbft) handleTransaction() {
 			var vc *ViewChange
 			lbft.voteViewChange.IterVoter(func(voter string, ticket vote.ITicket) {
 				tvc := ticket.(*ViewChange)
-				if tvc.PrimaryID != lbft.lastPrimaryID && tvc.SeqNo == lbft.lastSeqNum() && bytes.Equal(tvc.OptHash, lbft.options.Hash()) {
-					if vc == nil {
-						vc = tvc
-					} else if tvc.Priority < vc.Priority {
+				if tvc.PrimaryID != lbft.lastPrimary() && tvc.SeqNo == lbft.lastSeqNum() && bytes.Equal(tvc.OptHash, lbft.optionsHash()) {
+					// the replicas started at the same time break the tie of priority by id
+					if vc == nil || tvc.Priority < vc.Priority || tvc.Priority == vc.Priority && tvc.PrimaryID < vc.PrimaryID {
 						vc = tvc
 					}
 				}
 			})
 			lbft.voteViewChange.Clear()
-			t1 := time.Now()
+			t1 := lbft.options.Clock.Now()
 			t2 := t1.Truncate(time.Second)
-			time.Sleep(time.Second - t1.Sub(t2))
+			lbft.sleep(time.Second - t1.Sub(t2))
 			lbft.sendViewChange(vc)
-		case <-lbft.viewChangePeriodTimer.C:
+		case <-lbft.viewChangePeriodTimer.Chan():
 			log.Debugf("Replica %s view change period", lbft.options.ID)
 			lbft.sendViewChange(nil)
-		case <-lbft.nullRequestTimer.C:
+		case <-lbft.nullRequestTimer.Chan():
 			lbft.nullRequestHandler()
-		case <-lbft.emptyBlockTimer.C:
+		case <-lbft.emptyBlockTimer.Chan():
 			if lbft.isPrimary() {
-				requestBath := &RequestBatch{Time: uint32(time.Now().Unix()), ID: EMPTYBLOCK, Height: lbft.incrHeightNum()}
+				requestBath := &RequestBatch{Time: uint32(lbft.options.Clock.Now().Unix()), ID: EMPTYBLOCK, Height: lbft.incrHeightNum(), Proposer: lbft.options.ID}
 				lbft.handleRequestBatch(requestBath)
 			}
 			lbft.emptyBlockTimerStart = false
 			log.Debugf("Replica %s stop empty block", lbft.options.ID)
-		case <-lbft.blockTimer.C:
+		case <-lbft.blockTimer.Chan():
 			lbft.maybeSendViewChange()
 			lbft.submitRequestBatches()
 			lbft.resetBlockTimer()
@@ -418,7 +451,7 @@ func (lbft *Lbft) submitRequestBatches() {
 	}
 	txss := lbft.stack.FetchGroupingTxsInTxPool(lbft.options.MaxConcurrentNumFrom, lbft.options.BlockSize)
 	log.Debug("lbft block size: ", lbft.options.BlockSize)
-	id := time.Now().UnixNano()
+	id := lbft.options.Clock.Now().UnixNano()
 	height := uint32(0)
 	requestBatchList := make([]*RequestBatch, 0, len(txss))
 	for index, txs := range txss {
@@ -437,7 +470,7 @@ func (lbft *Lbft) submitRequestBatches() {
 					nano = req.Time()
 				}
 			}
-			requestBath := &RequestBatch{Time: nano, Requests: reqs, ID: id, Index: uint32(index), Height: height}
+			requestBath := &RequestBatch{Time: nano, Requests: reqs, ID: id, Index: uint32(index), Height: height, Proposer: lbft.options.ID}
 			log.Debugf("Replica %s generate requestBatch %s : timestamp %d, transations %d, height %d", lbft.options.ID, hash(requestBath), requestBath.Time, len(requestBath.Requests), requestBath.Height)
 			requestBatchList = append(requestBatchList, requestBath)
 		}
@@ -452,6 +485,11 @@ func (lbft *Lbft) submitRequestBatches() {
 	}
 }
 
+//sleep waits for the duration on the clock of the options
+func (lbft *Lbft) sleep(d time.Duration) {
+	<-lbft.options.Clock.NewTimer(d).Chan()
+}
+
 func (lbft *Lbft) resetViewChangePeriodTimer() {
 	lbft.viewChangePeriodTimer.Stop()
 	if lbft.hasPrimary() && lbft.options.ViewChangePeriod > 0*time.Second {
@@ -461,14 +499,14 @@ func (lbft *Lbft) resetViewChangePeriodTimer() {
 
 func (lbft *Lbft) resetBlockTimer() {
 	lbft.blockTimer.Stop()
-	t1 := time.Now()
+	t1 := lbft.options.Clock.Now()
 	t2 := t1.Truncate(lbft.options.BlockInterval)
 	lbft.blockTimer.Reset(lbft.options.BlockInterval - t1.Sub(t2))
 }
 
 func (lbft *Lbft) resetEmptyBlockTimer() {
 	lbft.emptyBlockTimer.Stop()
-	t1 := time.Now()
+	t1 := lbft.options.Clock.Now()
 	t2 := t1.Truncate(lbft.options.BlockInterval)
 	lbft.emptyBlockTimer.Reset(2*lbft.options.BlockInterval - t1.Sub(t2))
 	lbft.emptyBlockTimerStart = true
@@ -480,15 +518,27 @@ func (lbft *Lbft) softResetEmptyBlockTimer() {
 		return
 	}
 	lbft.emptyBlockTimer.Stop()
-	t1 := time.Now()
+	t1 := lbft.options.Clock.Now()
 	t2 := t1.Truncate(lbft.options.BlockInterval)
 	lbft.emptyBlockTimer.Reset(2*lbft.options.BlockInterval - t1.Sub(t2))
 	lbft.emptyBlockTimerStart = true
 	log.Debugf("Replica %s start empty block", lbft.options.ID)
 }
 
+func (lbft *Lbft) primary() string {
+	lbft.rwPrimary.RLock()
+	defer lbft.rwPrimary.RUnlock()
+	return lbft.primaryID
+}
+
+func (lbft *Lbft) lastPrimary() string {
+	lbft.rwPrimary.RLock()
+	defer lbft.rwPrimary.RUnlock()
+	return lbft.lastPrimaryID
+}
+
 func (lbft *Lbft) hasPrimary() bool {
-	return lbft.primaryID != ""
+	return lbft.primary() != ""
 }
 
 func (lbft *Lbft) maybeSendViewChange() {
@@ -500,7 +550,7 @@ func (lbft *Lbft) maybeSendViewChange() {
 }
 
 func (lbft *Lbft) isPrimary() bool {
-	return lbft.options.ID == lbft.primaryID
+	return lbft.options.ID == lbft.primary()
 }
 
 func (lbft *Lbft) handleConsensusMsg() {
@@ -526,11 +576,11 @@ func (lbft *Lbft) handleConsensusMsg() {
 				if preprepare := msg.GetPrePrepare(); preprepare != nil {
 					log.Debugf("Replica %s core consenter %s received preprepare message from %s --- lbft", lbft.options.ID, preprepare.Name, preprepare.ReplicaID)
 					if !lbft.hasPrimary() {
-						log.Errorf("Replica %s received prePrepare message from %s for consensus %s : ignore diff primayID (%s==%s)", lbft.options.ID, preprepare.ReplicaID, preprepare.Name, preprepare.PrimaryID, lbft.primaryID)
+						log.Errorf("Replica %s received prePrepare message from %s for consensus %s : ignore diff primayID (%s==%s)", lbft.options.ID, preprepare.ReplicaID, preprepare.Name, preprepare.PrimaryID, lbft.primary())
 					} else if preprepare.Chain != lbft.options.Chain || preprepare.ReplicaID != preprepare.PrimaryID {
 						log.Errorf("Replica %s received prePrepare message from %s for consensus %s : ignore illegal preprepare (%s==%s) ", lbft.options.ID, preprepare.ReplicaID, preprepare.Name, preprepare.Chain, lbft.options.Chain)
-					} else if preprepare.ReplicaID != lbft.primaryID {
-						log.Errorf("Replica %s received prePrepare message from %s for consensus %s :  ignore not from primayID (%s==%s)", lbft.options.ID, preprepare.ReplicaID, preprepare.Name, preprepare.ReplicaID, lbft.primaryID)
+					} else if preprepare.ReplicaID != lbft.primary() {
+						log.Errorf("Replica %s received prePrepare message from %s for consensus %s :  ignore not from primayID (%s==%s)", lbft.options.ID, preprepare.ReplicaID, preprepare.Name, preprepare.ReplicaID, lbft.primary())
 					} else if preprepare.SeqNo <= lbft.lastSeqNum() {
 						log.Debugf("Replica %s received prePrepare message from %s for consensus %s : ignore delay seqNo (%d > %d)", lbft.options.ID, preprepare.ReplicaID, preprepare.Name, preprepare.SeqNo, lbft.lastSeqNum())
 					} else {
@@ -541,9 +591,9 @@ func (lbft *Lbft) handleConsensusMsg() {
 				if prepare := msg.GetPrepare(); prepare != nil {
 					log.Debugf("Replica %s core consenter %s received prepare message from %s --- lbft", lbft.options.ID, prepare.Name, prepare.ReplicaID)
 					if !lbft.hasPrimary() {
-						log.Errorf("Replica %s received prepare message from %s for consensus %s : ignore diff primayID (%s==%s)", lbft.options.ID, prepare.ReplicaID, prepare.Name, prepare.PrimaryID, lbft.primaryID)
-					} else if prepare.Chain == lbft.options.Chain && prepare.PrimaryID != lbft.primaryID {
-						log.Errorf("Replica %s received prepare message from %s for consensus %s : ignore diff primayID (%s==%s)", lbft.options.ID, prepare.ReplicaID, prepare.Name, prepare.PrimaryID, lbft.primaryID)
+						log.Errorf("Replica %s received prepare message from %s for consensus %s : ignore diff primayID (%s==%s)", lbft.options.ID, prepare.ReplicaID, prepare.Name, prepare.PrimaryID, lbft.primary())
+					} else if prepare.Chain == lbft.options.Chain && prepare.PrimaryID != lbft.primary() {
+						log.Errorf("Replica %s received prepare message from %s for consensus %s : ignore diff primayID (%s==%s)", lbft.options.ID, prepare.ReplicaID, prepare.Name, prepare.PrimaryID, lbft.primary())
 					} else if prepare.Chain == lbft.options.Chain && prepare.SeqNo <= lbft.lastSeqNum() {
 						log.Debugf("Replica %s received prepare message from %s for consensus %s : ingore delay sepNo (%d > %d)", lbft.options.ID, prepare.ReplicaID, prepare.Name, prepare.SeqNo, lbft.lastSeqNum())
 					} else {
@@ -598,6 +648,26 @@ func (lbft *Lbft) handleConsensusMsg() {
 						}
 					}
 				}
+			case MESSAGECHECKPOINT:
+				if checkpoint := msg.GetCheckpoint(); checkpoint != nil {
+					if checkpoint.Chain != lbft.options.Chain {
+						log.Errorf("Replica %s received checkpoint message from %s : ignore diff chain  (%s==%s)", lbft.options.ID, checkpoint.ReplicaID, checkpoint.Chain, lbft.options.Chain)
+					} else {
+						lbft.recvCheckpoint(checkpoint, msg)
+					}
+				}
+			case MESSAGEFETCHCHECKPOINT:
+				if fetchCheckpoint := msg.GetFetchCheckpoint(); fetchCheckpoint != nil {
+					if fetchCheckpoint.Chain != lbft.options.Chain {
+						log.Errorf("Replica %s received fetch checkpoint message from %s : ignore diff chain  (%s==%s)", lbft.options.ID, fetchCheckpoint.ReplicaID, fetchCheckpoint.Chain, lbft.options.Chain)
+					} else {
+						lbft.recvFetchCheckpoint(fetchCheckpoint)
+					}
+				}
+			case MESSAGESTABLECHECKPOINT:
+				if stableCheckpoint := msg.GetStableCheckpoint(); stableCheckpoint != nil {
+					lbft.recvStableCheckpoint(stableCheckpoint)
+				}
 			case MESSAGEVIEWCHANGE:
 				if vc := msg.GetViewChange(); vc != nil {
 					if vc.Chain != lbft.options.Chain {
@@ -612,11 +682,11 @@ func (lbft *Lbft) handleConsensusMsg() {
 						log.Errorf("Replica %s received null request from %s : ignore diff chain (%s==%s) ", lbft.options.ID, np.ReplicaID, np.Chain, lbft.options.Chain)
 						return
 					}
-					if !bytes.Equal(np.OptHash, lbft.options.Hash()) {
+					if !bytes.Equal(np.OptHash, lbft.optionsHash()) {
 						log.Errorf("Replica %s received null request from %s : diff lbft options ", lbft.options.ID, np.ReplicaID)
 					} else {
-						if lbft.lastPrimaryID == "" && np.PrimaryID == np.ReplicaID {
-							log.Infof("Replica %s view change : vote new PrimaryID %s (%s), null request", lbft.options.ID, np.PrimaryID, lbft.primaryID)
+						if lbft.lastPrimary() == "" && np.PrimaryID == np.ReplicaID {
+							log.Infof("Replica %s view change : vote new PrimaryID %s (%s), null request", lbft.options.ID, np.PrimaryID, lbft.primary())
 							lbft.newView(&ViewChange{PrimaryID: np.PrimaryID, SeqNo: np.SeqNo, Height: np.Height, OptHash: np.OptHash})
 						}
 					}
@@ -639,10 +709,10 @@ func (lbft *Lbft) nullRequestHandler() {
 		nullRequest := &NullRequest{
 			ReplicaID: lbft.options.ID,
 			Chain:     lbft.options.Chain,
-			PrimaryID: lbft.primaryID,
+			PrimaryID: lbft.primary(),
 			SeqNo:     lbft.lastSeqNum(),
 			Height:    lbft.lastHeightNum(),
-			OptHash:   lbft.options.Hash(),
+			OptHash:   lbft.optionsHash(),
 		}
 		lbft.broadcast(lbft.options.Chain, &Message{Type: MESSAGENULLREQUEST, Payload: serialize(nullRequest)})
 		lbft.nullRequestTimerStart()
@@ -681,7 +751,7 @@ func (lbft *Lbft) sendViewChange(vc *ViewChange) {
 		if vc.PrimaryID == lbft.options.ID {
 			vc.SeqNo = lbft.lastSeqNum()
 			vc.Height = lbft.lastHeightNum()
-			vc.OptHash = lbft.options.Hash()
+			vc.OptHash = lbft.optionsHash()
 		}
 	} else {
 		vc = &ViewChange{
@@ -691,7 +761,7 @@ func (lbft *Lbft) sendViewChange(vc *ViewChange) {
 			PrimaryID: lbft.options.ID,
 			SeqNo:     lbft.lastSeqNum(),
 			Height:    lbft.lastHeightNum(),
-			OptHash:   lbft.options.Hash(),
+			OptHash:   lbft.optionsHash(),
 		}
 	}
 	lbft.recvViewChange(vc)
@@ -705,8 +775,10 @@ func (lbft *Lbft) recvViewChange(vc *ViewChange) {
 		return
 	}
 
-	if lbft.options.ID != vc.ReplicaID && vc.ReplicaID == lbft.primaryID && vc.PrimaryID == lbft.primaryID {
+	if primaryID := lbft.primary(); lbft.options.ID != vc.ReplicaID && vc.ReplicaID == primaryID && vc.PrimaryID == primaryID {
+		lbft.rwPrimary.Lock()
 		lbft.primaryID = ""
+		lbft.rwPrimary.Unlock()
 		lbft.sendViewChange(nil)
 	}
 
@@ -729,10 +801,12 @@ func (lbft *Lbft) recvViewChange(vc *ViewChange) {
 	if cnt == 1 {
 		lbft.viewChangeTimer.Reset(lbft.options.ViewChange)
 	} else if cnt == lbft.intersectionQuorum() {
+		lbft.rwPrimary.Lock()
 		if lbft.primaryID != "" {
 			lbft.lastPrimaryID = lbft.primaryID
 			lbft.primaryID = ""
 		}
+		lbft.rwPrimary.Unlock()
 		//lbft.blockTimer.Stop()
 		lbft.iterInstance(func(key string, instance *lbftCore) {
 			//if !instance.isPassCommit {
@@ -760,22 +834,25 @@ func (lbft *Lbft) recvViewChange(vc *ViewChange) {
 func (lbft *Lbft) newView(vc *ViewChange) {
 	lbft.resendViewChangeTimer.Stop()
 	lbft.voteViewChange.Clear()
+	lbft.rwPrimary.Lock()
 	if lbft.primaryID == vc.PrimaryID {
+		lbft.rwPrimary.Unlock()
 		return
 	}
 	lbft.primaryID = vc.PrimaryID
 	lbft.lastPrimaryID = lbft.primaryID
+	lbft.rwPrimary.Unlock()
 	if lbft.isPrimary() {
-		lbft.priority = time.Now().UnixNano()
+		lbft.priority = lbft.options.Clock.Now().UnixNano()
 		lbft.blockTimer.Stop()
 	}
-	lbft.lastHeight = vc.Height
-	lbft.height = vc.Height
-	lbft.lastSeqNo = vc.SeqNo
-	lbft.seqNo = vc.SeqNo
+	atomic.StoreUint32(&lbft.lastHeight, vc.Height)
+	atomic.StoreUint32(&lbft.height, vc.Height)
+	atomic.StoreUint64(&lbft.lastSeqNo, vc.SeqNo)
+	atomic.StoreUint64(&lbft.seqNo, vc.SeqNo)
 	lbft.votedCnt = 0
-	log.Infof("Replica %s view change : vote new PrimaryID %s (%d %d)", lbft.options.ID, vc.PrimaryID, lbft.lastSeqNo, lbft.lastHeight)
-	lbft.verifySeqNo = vc.SeqNo
+	log.Infof("Replica %s view change : vote new PrimaryID %s (%d %d)", lbft.options.ID, vc.PrimaryID, vc.SeqNo, vc.Height)
+	atomic.StoreUint64(&lbft.verifySeqNo, vc.SeqNo)
 	//lbft.updateExecSeqNo(vc.SeqNo)
 	lbft.iterInstance(func(key string, instance *lbftCore) {
 		//if !instance.isPassCommit {
@@ -785,15 +862,17 @@ func (lbft *Lbft) newView(vc *ViewChange) {
 		// 	log.Debugf("Replica %s alreay commmit for consensus %s, view change", lbft.options.ID, instance.name)
 		// }
 	})
+	lbft.rwlbftCores.Lock()
 	lbft.prePrepareAsync = newAsyncSeqNo(vc.SeqNo)
 	lbft.commitAsync = newAsyncSeqNo(vc.SeqNo)
+	lbft.rwlbftCores.Unlock()
 	lbft.resetViewChangePeriodTimer()
 	lbft.nullRequestTimerStart()
 	lbft.concurrentCntTo = 0
 	if lbft.isPrimary() {
-		lbft.handleRequestBatch(&RequestBatch{Time: uint32(time.Now().Unix()), ID: EMPTYBLOCK, Height: lbft.incrHeightNum()})
+		lbft.handleRequestBatch(&RequestBatch{Time: uint32(lbft.options.Clock.Now().Unix()), ID: EMPTYBLOCK, Height: lbft.incrHeightNum(), Proposer: lbft.options.ID})
 		for len(lbft.committedTxsChan) > 0 {
-			time.Sleep(lbft.options.BlockTimeout)
+			lbft.sleep(lbft.options.BlockTimeout)
 		}
 		//lbft.resetEmptyBlockTimer()
 	}
@@ -915,7 +994,14 @@ func (lbft *Lbft) checkpoint() {
 		for seqNo, reqBatch := range lbft.committedRequestBatch {
 			log.Infof("Replica %s seqNo %d : %s", lbft.options.ID, seqNo, reqBatch.key())
 		}
-		log.Panicf("Replica %s fallen behind over %d", lbft.options.ID, lbft.options.K)
+		if !lbft.hasValidatorKeys() {
+			// stable checkpoints can not be verified without the keys of the replicas
+			log.Errorf("Replica %s fallen behind over %d without validator keys, sync blocks", lbft.options.ID, lbft.options.K)
+			lbft.stack.SyncBlocks()
+			return
+		}
+		log.Warnf("Replica %s fallen behind over %d", lbft.options.ID, lbft.options.K)
+		lbft.fetchCheckpoint()
 	}
 }
 
@@ -1016,12 +1102,56 @@ func (lbft *Lbft) hasInstance(key string) bool {
 
 func (lbft *Lbft) broadcast(to string, msg *Message) {
 	//log.Debugf("Replica %s send broadcast consensus message %s(%s) from %s to %s", lbft.options.ID, msg.info(), hash(msg), lbft.options.Chain, to)
+	lbft.sign(msg)
 	lbft.broadcastChan <- &consensus.BroadcastConsensus{
 		To:      to,
 		Payload: msg.Serialize(),
 	}
 }
 
+func (lbft *Lbft) sign(msg *Message) {
+	msg.ReplicaID = lbft.options.ID
+	if lbft.options.PrivateKey == nil {
+		return
+	}
+	h := msg.signHash()
+	sig, err := lbft.options.PrivateKey.Sign(h[:])
+	if err != nil {
+		log.Errorf("Replica %s sign consensus message error %v", lbft.options.ID, err)
+		return
+	}
+	msg.Signature = sig.Bytes()
+}
+
+func (lbft *Lbft) verify(msg *Message) (err error) {
+	if !lbft.hasValidatorKeys() {
+		return errors.New("no validator keys")
+	}
+	pub, ok := lbft.validator(msg)
+	if !ok {
+		return fmt.Errorf("unknown replica %s", msg.ReplicaID)
+	}
+	if len(msg.Signature) != crypto.SignatureSize {
+		return errors.New("unsigned message")
+	}
+	var sig crypto.Signature
+	copy(sig[:], msg.Signature)
+	h := msg.signHash()
+	if !sig.Verify(h[:], pub) {
+		return errors.New("illegal signature")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("illegal payload %v", r)
+		}
+	}()
+	if replicaID := msg.replicaID(); replicaID != msg.ReplicaID {
+		return fmt.Errorf("replica %s mismatch signer", replicaID)
+	}
+	return nil
+}
+
 func (lbft *Lbft) isValid(requestBatch *RequestBatch, from bool) bool {
 	if from {
 		if requestBatch.ID == EMPTYBLOCK && len(requestBatch.Requests) == 0 {
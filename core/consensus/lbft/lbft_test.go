@@ -22,11 +22,38 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/consensus"
 	"github.com/bocheninc/L0/core/consensus/helper"
+	"github.com/bocheninc/L0/core/types"
 )
 
+// newTestReplicas returns the options of N replicas with keys and the stack of their validator set
+func newTestReplicas() (*helper.Stack, []*Options) {
+	return newTestChainReplicas(NewDefaultOptions().Chain)
+}
+
+// newTestChainReplicas returns the options of N replicas of the chain with keys and the stack of their validator set
+func newTestChainReplicas(chain string) (*helper.Stack, []*Options) {
+	stack := helper.NewStack()
+	stack.Validators = types.NewValidatorSet()
+	var replicas []*Options
+	for i := 0; i < NewDefaultOptions().N; i++ {
+		options := NewDefaultOptions()
+		options.Chain = chain
+		nodeID := string('a' + rune(i))
+		options.ID = consensus.ReplicaID(options.Chain, nodeID)
+		options.PrivateKey, _ = crypto.GenerateKey()
+		stack.Validators.Add(nodeID, options.PrivateKey.Public().Bytes())
+		replicas = append(replicas, options)
+	}
+	return stack, replicas
+}
+
 func TestLbft(t *testing.T) {
-	lbft := NewLbft(NewDefaultOptions(), helper.NewStack())
+	stack, replicas := newTestReplicas()
+	lbft := NewLbft(replicas[0], stack)
 	lbft.Start()
 	time.Sleep(time.Second)
 	lbft.Stop()
@@ -34,3 +61,238 @@ func TestLbft(t *testing.T) {
 	_ = lbft
 
 }
+
+func TestMessageSignature(t *testing.T) {
+	other, _ := crypto.GenerateKey()
+
+	stack, replicas := newTestReplicas()
+	receiver := NewLbft(replicas[0], stack)
+	sender := &Lbft{options: replicas[1]}
+
+	newMsg := func(replicaID string) *Message {
+		return &Message{Type: MESSAGEPREPARE, Payload: serialize(&Prepare{Name: "test", ReplicaID: replicaID, SeqNo: 1})}
+	}
+
+	msg := newMsg(sender.options.ID)
+	if err := receiver.verify(msg); err == nil {
+		t.Error("unsigned message accepted")
+	}
+
+	sender.sign(msg)
+	if err := receiver.verify(msg); err != nil {
+		t.Errorf("signed message rejected, %v", err)
+	}
+
+	msg.Payload = serialize(&Prepare{Name: "test", ReplicaID: sender.options.ID, SeqNo: 2})
+	if err := receiver.verify(msg); err == nil {
+		t.Error("tampered message accepted")
+	}
+
+	msg = newMsg(replicas[2].ID)
+	sender.sign(msg)
+	if err := receiver.verify(msg); err == nil {
+		t.Error("impersonated replica accepted")
+	}
+
+	sender.options.PrivateKey = other
+	msg = newMsg(sender.options.ID)
+	sender.sign(msg)
+	if err := receiver.verify(msg); err == nil {
+		t.Error("mis-signed message accepted")
+	}
+}
+
+func TestCrossChainMessages(t *testing.T) {
+	_, fromReplicas := newTestChainReplicas("0")
+	stack, toReplicas := newTestChainReplicas("1")
+	toReplicas[0].PeerValidators = map[string][]string{"0": nil}
+	for i, options := range fromReplicas[:3] {
+		nodeID := string('a' + rune(i))
+		toReplicas[0].PeerValidators["0"] = append(toReplicas[0].PeerValidators["0"], nodeID+":"+utils.BytesToHex(options.PrivateKey.Public().Bytes()))
+	}
+	receiver := NewLbft(toReplicas[0], stack)
+
+	accepted := func(sender *Options, msg *Message) bool {
+		(&Lbft{options: sender}).sign(msg)
+		receiver.RecvConsensus(msg.Serialize())
+		select {
+		case <-receiver.recvConsensusMsgChan:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// the primary of the sender chain sends the request batch, its replicas the prepares and commits
+	sender := fromReplicas[1]
+	if !accepted(sender, &Message{Type: MESSAGEREQUESTBATCH, Payload: serialize(&RequestBatch{ID: 1, Index: 1, Proposer: sender.ID})}) {
+		t.Error("request batch of the peer chain rejected")
+	}
+	if !accepted(sender, &Message{Type: MESSAGEPREPARE, Payload: serialize(&Prepare{Name: "test", Chain: "0", ReplicaID: sender.ID, SeqNo: 1})}) {
+		t.Error("prepare of the peer chain rejected")
+	}
+	if !accepted(sender, &Message{Type: MESSAGECOMMIT, Payload: serialize(&Commit{Name: "test", Chain: "0", ReplicaID: sender.ID, SeqNo: 1})}) {
+		t.Error("commit of the peer chain rejected")
+	}
+
+	if accepted(sender, &Message{Type: MESSAGEVIEWCHANGE, Payload: serialize(&ViewChange{ReplicaID: sender.ID})}) {
+		t.Error("view change of the peer chain accepted")
+	}
+	if accepted(fromReplicas[3], &Message{Type: MESSAGEPREPARE, Payload: serialize(&Prepare{Name: "test", Chain: "0", ReplicaID: fromReplicas[3].ID, SeqNo: 1})}) {
+		t.Error("prepare of an unknown replica of the peer chain accepted")
+	}
+	forged := &Options{ID: sender.ID, PrivateKey: fromReplicas[3].PrivateKey}
+	if accepted(forged, &Message{Type: MESSAGECOMMIT, Payload: serialize(&Commit{Name: "test", Chain: "0", ReplicaID: sender.ID, SeqNo: 1})}) {
+		t.Error("mis-signed commit of the peer chain accepted")
+	}
+}
+
+func TestStableCheckpoint(t *testing.T) {
+	stack, replicaOptions := newTestReplicas()
+	var replicas []*Lbft
+	for _, opts := range replicaOptions {
+		replicas = append(replicas, &Lbft{options: opts})
+	}
+	options := replicaOptions[0]
+	lbft := NewLbft(options, stack)
+
+	var proofs []*Message
+	for _, replica := range replicas[:options.Q] {
+		cp := &Checkpoint{ReplicaID: replica.options.ID, Chain: options.Chain, SeqNo: 40, Height: 20, BlockHash: crypto.Sha256([]byte("block")).String()}
+		msg := &Message{Type: MESSAGECHECKPOINT, Payload: serialize(cp)}
+		replica.sign(msg)
+		lbft.recvCheckpoint(cp, msg)
+		proofs = append(proofs, msg)
+	}
+	if lbft.stableCheckpoint == nil || lbft.stableCheckpoint.Checkpoint.SeqNo != 40 {
+		t.Fatal("stable checkpoint not reached by quorum")
+	}
+
+	if restarted := NewLbft(options, stack); restarted.stableCheckpoint == nil || restarted.execSeqNum() != 40 {
+		t.Error("stable checkpoint not restored")
+	}
+
+	sc := &StableCheckpoint{Checkpoint: &Checkpoint{Chain: options.Chain, SeqNo: 60, Height: 30, BlockHash: crypto.Sha256([]byte("block")).String()}, Proofs: proofs}
+	if err := lbft.verifyStableCheckpoint(sc); err == nil {
+		t.Error("stable checkpoint with mismatch proofs accepted")
+	}
+	lbft.recvStableCheckpoint(sc)
+	if lbft.execSeqNum() == 60 {
+		t.Error("state transfer to illegal checkpoint")
+	}
+
+	lagging := NewLbft(options, &helper.Stack{Validators: stack.Validators})
+	lagging.recvStableCheckpoint(&StableCheckpoint{Checkpoint: lbft.stableCheckpoint.Checkpoint, Proofs: proofs[:options.Q-1]})
+	if lagging.execSeqNum() == 40 {
+		t.Error("state transfer to checkpoint without quorum")
+	}
+	lagging.recvStableCheckpoint(&StableCheckpoint{Checkpoint: lbft.stableCheckpoint.Checkpoint, Proofs: proofs})
+	if lagging.execSeqNum() != 40 || lagging.lastHeightNum() != 20 {
+		t.Errorf("state transfer error, seqNo %d, height %d", lagging.execSeqNum(), lagging.lastHeightNum())
+	}
+
+	var duplicated []*Message
+	for range proofs {
+		duplicated = append(duplicated, proofs[0])
+	}
+	if err := lbft.verifyStableCheckpoint(&StableCheckpoint{Checkpoint: lbft.stableCheckpoint.Checkpoint, Proofs: duplicated}); err == nil {
+		t.Error("stable checkpoint signed by one replica accepted")
+	}
+
+}
+
+func TestValidatorKeysRequired(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("lbft started without validator keys")
+		}
+	}()
+	NewLbft(NewDefaultOptions(), helper.NewStack())
+}
+
+type heightStack struct {
+	*helper.Stack
+	height uint32
+}
+
+func (stack *heightStack) GetBlockchainInfo() *consensus.BlockchainInfo {
+	return &consensus.BlockchainInfo{Height: stack.height}
+}
+
+func TestValidatorChange(t *testing.T) {
+	validators, replicas := newTestReplicas()
+	stack := &heightStack{Stack: validators, height: 3}
+	lbft := NewLbft(replicas[0], stack)
+
+	key, _ := crypto.GenerateKey()
+	validators.Validators.Add("e", key.Public().Bytes())
+	lbft.loadValidators()
+	if lbft.options.N != 4 || lbft.Quorum() != 3 {
+		t.Errorf("validator change applied before its block appended, N %d, Q %d", lbft.options.N, lbft.Quorum())
+	}
+	stack.height = 4
+	lbft.loadValidators()
+	if lbft.options.N != 5 || lbft.Quorum() != 4 {
+		t.Errorf("validator change not applied after its block appended, N %d, Q %d", lbft.options.N, lbft.Quorum())
+	}
+
+	other, _ := crypto.GenerateKey()
+	validators.Validators.Add("f", other.Public().Bytes())
+	stack.height = 5
+	sender := &Lbft{options: &Options{ID: consensus.ReplicaID(replicas[0].Chain, "f"), PrivateKey: other}}
+	msg := &Message{Type: MESSAGEPREPARE, Payload: serialize(&Prepare{Name: "test", ReplicaID: sender.options.ID, SeqNo: 1})}
+	sender.sign(msg)
+	if err := lbft.verify(msg); err != nil {
+		t.Errorf("message of the validator appended rejected, %v", err)
+	}
+}
+
+type syncStack struct {
+	*helper.Stack
+	synced bool
+}
+
+func (stack *syncStack) SyncBlocks() {
+	stack.synced = true
+}
+
+func TestFallenBehindWithoutValidatorKeys(t *testing.T) {
+	stack := &syncStack{Stack: helper.NewStack()}
+	validators, replicas := newTestReplicas()
+	stack.Validators = validators.Validators
+	options := replicas[0]
+	lbft := NewLbft(options, stack)
+	lbft.validators = map[string]*crypto.PublicKey{}
+
+	lbft.committedRequestBatch[1] = &RequestBatch{}
+	lbft.committedRequestBatch[uint64(2*options.K)] = &RequestBatch{}
+	lbft.checkpoint()
+	if !stack.synced {
+		t.Error("blocks not synced when fallen behind without validator keys")
+	}
+}
+
+func TestValidatorChangeDuringViewChange(t *testing.T) {
+	validators, replicas := newTestReplicas()
+	stack := &heightStack{Stack: validators, height: 3}
+	lbft := NewLbft(replicas[0], stack)
+
+	key, _ := crypto.GenerateKey()
+	validators.Validators.Add("e", key.Public().Bytes())
+	stack.height = 4
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lbft.loadValidators()
+	}()
+	lbft.sendViewChange(nil)
+	<-done
+
+	msg := &Message{}
+	if err := msg.Deserialize((<-lbft.BroadcastConsensusChannel()).Payload); err != nil {
+		t.Fatal(err)
+	}
+	if vc := msg.GetViewChange(); vc == nil || len(vc.OptHash) == 0 {
+		t.Errorf("view change message %v", msg)
+	}
+}
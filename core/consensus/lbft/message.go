@@ -21,6 +21,7 @@ package lbft
 import (
 	"strings"
 
+	"github.com/bocheninc/L0/components/crypto"
 	"github.com/bocheninc/L0/core/types"
 )
 
@@ -68,6 +69,7 @@ type RequestBatch struct {
 	ID       int64
 	Index    uint32
 	Height   uint32
+	Proposer string
 }
 
 //fromChain from
@@ -189,19 +191,45 @@ type NullRequest struct {
 	OptHash   []byte `protobuf:"varint,6,opt,name=optHash" json:"optHash,omitempty"`
 }
 
+//Checkpoint Define struct
+type Checkpoint struct {
+	ReplicaID string `protobuf:"bytes,1,opt,name=replicaID" json:"replicaID,omitempty"`
+	Chain     string `protobuf:"bytes,2,opt,name=chain" json:"chain,omitempty"`
+	SeqNo     uint64 `protobuf:"varint,3,opt,name=seqNo" json:"seqNo,omitempty"`
+	Height    uint32 `protobuf:"varint,4,opt,name=height" json:"height,omitempty"`
+	BlockHash string `protobuf:"bytes,5,opt,name=blockHash" json:"blockHash,omitempty"`
+}
+
+//FetchCheckpoint Define struct
+type FetchCheckpoint struct {
+	ReplicaID string `protobuf:"bytes,1,opt,name=replicaID" json:"replicaID,omitempty"`
+	Chain     string `protobuf:"bytes,2,opt,name=chain" json:"chain,omitempty"`
+	SeqNo     uint64 `protobuf:"varint,3,opt,name=seqNo" json:"seqNo,omitempty"`
+}
+
+//StableCheckpoint Define struct, checkpoint with the signed checkpoint messages of a quorum
+type StableCheckpoint struct {
+	ReplicaID  string      `protobuf:"bytes,1,opt,name=replicaID" json:"replicaID,omitempty"`
+	Checkpoint *Checkpoint `protobuf:"bytes,2,opt,name=checkpoint" json:"checkpoint,omitempty"`
+	Proofs     []*Message  `protobuf:"bytes,3,rep,name=proofs" json:"proofs,omitempty"`
+}
+
 //MessageType
 type MessageType uint32
 
 const (
-	MESSAGEUNDEFINED      MessageType = 0
-	MESSAGEREQUESTBATCH   MessageType = 1
-	MESSAGEPREPREPARE     MessageType = 2
-	MESSAGEPREPARE        MessageType = 3
-	MESSAGECOMMIT         MessageType = 4
-	MESSAGECOMMITTED      MessageType = 5
-	MESSAGEFETCHCOMMITTED MessageType = 6
-	MESSAGEVIEWCHANGE     MessageType = 11
-	MESSAGENULLREQUEST    MessageType = 12
+	MESSAGEUNDEFINED        MessageType = 0
+	MESSAGEREQUESTBATCH     MessageType = 1
+	MESSAGEPREPREPARE       MessageType = 2
+	MESSAGEPREPARE          MessageType = 3
+	MESSAGECOMMIT           MessageType = 4
+	MESSAGECOMMITTED        MessageType = 5
+	MESSAGEFETCHCOMMITTED   MessageType = 6
+	MESSAGECHECKPOINT       MessageType = 7
+	MESSAGEFETCHCHECKPOINT  MessageType = 8
+	MESSAGESTABLECHECKPOINT MessageType = 9
+	MESSAGEVIEWCHANGE       MessageType = 11
+	MESSAGENULLREQUEST      MessageType = 12
 )
 
 //Message Define lbft message struct
@@ -213,10 +241,49 @@ type Message struct {
 	//	*Commit
 	//	*Committed
 	//	*FetchCommitted
+	//	*Checkpoint
+	//	*FetchCheckpoint
+	//	*StableCheckpoint
 	//	*Viewchange
 	//	*NullReqest
 	Type    MessageType
 	Payload []byte `protobuf_oneof:"payload"`
+
+	// ReplicaID and Signature authenticate the sender of the message
+	ReplicaID string
+	Signature []byte
+}
+
+//signHash hash of the message signed by the sender
+func (m *Message) signHash() crypto.Hash {
+	return crypto.Sha256(serialize(&Message{Type: m.Type, Payload: m.Payload, ReplicaID: m.ReplicaID}))
+}
+
+//replicaID sender replica claimed by the payload
+func (m *Message) replicaID() string {
+	switch m.Type {
+	case MESSAGEPREPREPARE:
+		return m.GetPrePrepare().ReplicaID
+	case MESSAGEPREPARE:
+		return m.GetPrepare().ReplicaID
+	case MESSAGECOMMIT:
+		return m.GetCommit().ReplicaID
+	case MESSAGECOMMITTED:
+		return m.GetCommitted().ReplicaID
+	case MESSAGEFETCHCOMMITTED:
+		return m.GetFetchCommitted().ReplicaID
+	case MESSAGEVIEWCHANGE:
+		return m.GetViewChange().ReplicaID
+	case MESSAGECHECKPOINT:
+		return m.GetCheckpoint().ReplicaID
+	case MESSAGEFETCHCHECKPOINT:
+		return m.GetFetchCheckpoint().ReplicaID
+	case MESSAGESTABLECHECKPOINT:
+		return m.GetStableCheckpoint().ReplicaID
+	case MESSAGENULLREQUEST:
+		return m.GetNullRequest().ReplicaID
+	}
+	return m.ReplicaID
 }
 
 //GetRequestBatch
@@ -291,6 +358,42 @@ func (m *Message) GetFetchCommitted() *FetchCommitted {
 	return nil
 }
 
+//GetCheckpoint
+func (m *Message) GetCheckpoint() *Checkpoint {
+	if m.Type == MESSAGECHECKPOINT {
+		x := &Checkpoint{}
+		if err := deserialize(m.Payload, x); err != nil {
+			panic(err)
+		}
+		return x
+	}
+	return nil
+}
+
+//GetFetchCheckpoint
+func (m *Message) GetFetchCheckpoint() *FetchCheckpoint {
+	if m.Type == MESSAGEFETCHCHECKPOINT {
+		x := &FetchCheckpoint{}
+		if err := deserialize(m.Payload, x); err != nil {
+			panic(err)
+		}
+		return x
+	}
+	return nil
+}
+
+//GetStableCheckpoint
+func (m *Message) GetStableCheckpoint() *StableCheckpoint {
+	if m.Type == MESSAGESTABLECHECKPOINT {
+		x := &StableCheckpoint{}
+		if err := deserialize(m.Payload, x); err != nil {
+			panic(err)
+		}
+		return x
+	}
+	return nil
+}
+
 //GetViewchange
 func (m *Message) GetViewChange() *ViewChange {
 	if m.Type == MESSAGEVIEWCHANGE {
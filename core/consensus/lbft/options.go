@@ -19,7 +19,9 @@
 package lbft
 
 import "time"
+import "github.com/bocheninc/L0/components/crypto"
 import "github.com/bocheninc/L0/components/utils"
+import "github.com/bocheninc/L0/core/consensus"
 
 //NewDefaultOptions Create nbft options with default value
 func NewDefaultOptions() *Options {
@@ -40,6 +42,7 @@ func NewDefaultOptions() *Options {
 	options.BufferSize = 100
 	options.MaxConcurrentNumFrom = 1
 	options.MaxConcurrentNumTo = 1
+	options.Clock = consensus.SystemClock()
 	return options
 }
 
@@ -63,6 +66,14 @@ type Options struct {
 	BufferSize           int
 	MaxConcurrentNumFrom int
 	MaxConcurrentNumTo   int
+
+	// PrivateKey signs the messages of the replica
+	PrivateKey *crypto.PrivateKey
+	// PeerValidators are the nodeId:publicKey of the replicas of the other chains by chain, they verify
+	// the messages of the cross chain consensus, the validators of the chain are loaded from the ledger
+	PeerValidators map[string][]string
+	// Clock drives the timers of the replica
+	Clock consensus.Clock
 }
 
 func (this *Options) Hash() []byte {
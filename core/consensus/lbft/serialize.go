@@ -79,6 +79,15 @@ func (fc *FetchCommitted) Serialize() []byte {
 	return serialize(fc)
 }
 
+//Serialize Serialize
+func (msg *Checkpoint) Serialize() []byte {
+	payload := serialize(msg)
+	m := &Checkpoint{}
+	deserialize(payload, m)
+	m.ReplicaID = ""
+	return serialize(m)
+}
+
 //Serialize Serialize
 func (msg *ViewChange) Serialize() []byte {
 	payload := serialize(msg)
@@ -0,0 +1,320 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package lbft
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/core/consensus"
+	"github.com/bocheninc/L0/core/consensus/simulator"
+	"github.com/bocheninc/L0/core/types"
+)
+
+func newSimulation(seed int64, n int) (*simulator.Network, map[string]*crypto.PrivateKey) {
+	simOptions := simulator.NewDefaultOptions()
+	simOptions.Seed = seed
+	simOptions.Validators = types.NewValidatorSet()
+	net := simulator.NewNetwork(simOptions)
+
+	ids := make([]string, 0, n)
+	keys := make(map[string]*crypto.PrivateKey)
+	for i := 0; i < n; i++ {
+		nodeID := string('a' + rune(i))
+		id := consensus.ReplicaID(simOptions.Chain, nodeID)
+		// the keys and so the signatures are the same with the seed
+		key := crypto.ToECDSA(crypto.Sha256([]byte(fmt.Sprintf("%d:%s", seed, nodeID))).Bytes())
+		ids = append(ids, id)
+		keys[id] = key
+		simOptions.Validators.Add(nodeID, key.Public().Bytes())
+	}
+	for _, id := range ids {
+		net.AddNode(id, func(id string, stack consensus.IStack) consensus.Consenter {
+			options := NewDefaultOptions()
+			options.Chain = simOptions.Chain
+			options.ID = id
+			options.N = n
+			options.Q = (2*n-1)/3 + 1
+			options.BlockSize = 10
+			options.BlockInterval = 200 * time.Millisecond
+			options.BlockTimeout = 100 * time.Millisecond
+			options.BlockDelay = 200 * time.Millisecond
+			options.ViewChange = time.Second
+			options.ResendViewChange = time.Second
+			options.NullRequest = time.Second
+			options.PrivateKey = keys[id]
+			options.Clock = net.ConsenterClock()
+			return NewLbft(options, stack)
+		})
+	}
+	return net, keys
+}
+
+// resign sign the message again as replicaID with the key
+func resign(msg *Message, replicaID string, key *crypto.PrivateKey) []byte {
+	msg.ReplicaID = replicaID
+	h := msg.signHash()
+	sig, err := key.Sign(h[:])
+	if err != nil {
+		panic(err)
+	}
+	msg.Signature = sig.Bytes()
+	return msg.Serialize()
+}
+
+func TestSimulationCommit(t *testing.T) {
+	net, _ := newSimulation(1, 4)
+	net.Start()
+	defer net.Stop()
+
+	net.Pool().Submit(30)
+	if err := net.WaitCommitted(20 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSimulationReplay(t *testing.T) {
+	run := func() ([]string, []crypto.Hash) {
+		net, _ := newSimulation(7, 4)
+		net.Pool().Submit(30)
+		net.Start()
+		defer net.Stop()
+		if err := net.WaitCommitted(20 * time.Second); err != nil {
+			t.Fatal(err)
+		}
+		// the network runs on when the trace is taken, so the trace of a run is a prefix of the other
+		trace := net.Trace()
+		var blocks []crypto.Hash
+		stack := net.Nodes()[0].Stack
+		for height := uint32(1); height <= stack.Height(); height++ {
+			blocks = append(blocks, stack.Block(height).Hash)
+		}
+		return trace, blocks
+	}
+
+	trace1, blocks1 := run()
+	trace2, blocks2 := run()
+	if len(trace1) == 0 || len(blocks1) == 0 {
+		t.Fatal("nothing committed")
+	}
+	for i := 0; i < len(trace1) && i < len(trace2); i++ {
+		if trace1[i] != trace2[i] {
+			t.Fatalf("message %d differs with the same seed, %s != %s", i, trace1[i], trace2[i])
+		}
+	}
+	for i := 0; i < len(blocks1) && i < len(blocks2); i++ {
+		if blocks1[i] != blocks2[i] {
+			t.Fatalf("block %d differs with the same seed", i+1)
+		}
+	}
+}
+
+func TestSimulationCrashPrimary(t *testing.T) {
+	net, _ := newSimulation(2, 4)
+	net.Start()
+	defer net.Stop()
+
+	net.Pool().Submit(10)
+	if err := net.WaitCommitted(20 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	nodes := net.Honest()
+	primary := nodes[0].Stack.Block(nodes[0].Stack.Height()).Proposer
+	net.Run([]simulator.Step{
+		{Do: func(net *simulator.Network) { net.Crash(primary) }},
+		{After: 100 * time.Millisecond, Do: func(net *simulator.Network) { net.Pool().Submit(10) }},
+	})
+	if err := net.WaitCommitted(30 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	nodes = net.Honest()
+	if proposer := nodes[0].Stack.Block(nodes[0].Stack.Height()).Proposer; proposer == primary {
+		t.Errorf("block proposed by crashed primary %s", proposer)
+	}
+	if err := net.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSimulationPartition(t *testing.T) {
+	net, _ := newSimulation(3, 4)
+	net.Start()
+	defer net.Stop()
+
+	nodes := net.Nodes()
+	net.Run([]simulator.Step{
+		{Do: func(net *simulator.Network) {
+			net.Partition([]string{nodes[0].ID, nodes[1].ID}, []string{nodes[2].ID, nodes[3].ID})
+			net.Pool().Submit(10)
+		}},
+		{After: 3 * time.Second, Do: func(net *simulator.Network) {
+			for _, node := range nodes {
+				if node.Stack.Height() != 0 {
+					t.Errorf("node %s written block without quorum", node.ID)
+				}
+			}
+			net.Heal()
+		}},
+	})
+	if err := net.WaitCommitted(30 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSimulationByzantine(t *testing.T) {
+	net, _ := newSimulation(4, 4)
+	nodes := net.Nodes()
+	net.SetByzantine(nodes[3].ID, func(to string, payload []byte) []byte {
+		msg := &Message{}
+		if err := msg.Deserialize(payload); err != nil {
+			return payload
+		}
+		// tamper the payload after signed
+		msg.Payload = append([]byte{}, msg.Payload...)
+		if len(msg.Payload) > 0 {
+			msg.Payload[len(msg.Payload)-1] ^= 0xff
+		}
+		return msg.Serialize()
+	})
+	net.Start()
+	defer net.Stop()
+
+	net.Pool().Submit(30)
+	if err := net.WaitCommitted(30 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSimulationEquivocation(t *testing.T) {
+	net, keys := newSimulation(5, 4)
+	nodes := net.Nodes()
+	byzantine := nodes[3].ID
+	var equivocated int32
+	// every other replica receives a different view change, proposal and votes
+	net.SetByzantine(byzantine, func(to string, payload []byte) []byte {
+		msg := &Message{}
+		if err := msg.Deserialize(payload); err != nil {
+			return payload
+		}
+		if to == nodes[0].ID || to == nodes[2].ID {
+			return payload
+		}
+		switch msg.Type {
+		case MESSAGEVIEWCHANGE:
+			vc := msg.GetViewChange()
+			vc.PrimaryID = byzantine
+			msg.Payload = serialize(vc)
+		case MESSAGEPREPREPARE:
+			preprep := msg.GetPrePrepare()
+			if n := len(preprep.Requests.Requests); n > 1 {
+				preprep.Requests.Requests = preprep.Requests.Requests[:n-1]
+			}
+			msg.Payload = serialize(preprep)
+		case MESSAGEPREPARE:
+			prepare := msg.GetPrepare()
+			prepare.Digest = hash(&Message{Payload: []byte(prepare.Digest + to)})
+			msg.Payload = serialize(prepare)
+		case MESSAGECOMMIT:
+			commit := msg.GetCommit()
+			commit.Digest = hash(&Message{Payload: []byte(commit.Digest + to)})
+			msg.Payload = serialize(commit)
+		default:
+			return payload
+		}
+		atomic.AddInt32(&equivocated, 1)
+		return resign(msg, byzantine, keys[byzantine])
+	})
+	net.Start()
+	defer net.Stop()
+
+	net.Pool().Submit(30)
+	if err := net.WaitCommitted(30 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&equivocated) == 0 {
+		t.Error("no message equivocated")
+	}
+}
+
+func TestSimulationForgedVotes(t *testing.T) {
+	net, keys := newSimulation(6, 4)
+	nodes := net.Nodes()
+	byzantine := nodes[3].ID
+	var forged int32
+	// claim the view changes and votes of another replica, either with the byzantine key
+	// on the claimed id or signed as the byzantine replica with the claimed id in the payload
+	net.SetByzantine(byzantine, func(to string, payload []byte) []byte {
+		msg := &Message{}
+		if err := msg.Deserialize(payload); err != nil {
+			return payload
+		}
+		victim := nodes[0].ID
+		if victim == to {
+			victim = nodes[1].ID
+		}
+		switch msg.Type {
+		case MESSAGEVIEWCHANGE:
+			vc := msg.GetViewChange()
+			vc.ReplicaID = victim
+			msg.Payload = serialize(vc)
+		case MESSAGEPREPARE:
+			prepare := msg.GetPrepare()
+			prepare.ReplicaID = victim
+			msg.Payload = serialize(prepare)
+		case MESSAGECOMMIT:
+			commit := msg.GetCommit()
+			commit.ReplicaID = victim
+			msg.Payload = serialize(commit)
+		default:
+			return payload
+		}
+		if atomic.AddInt32(&forged, 1)%2 == 0 {
+			return resign(msg, victim, keys[byzantine])
+		}
+		return resign(msg, byzantine, keys[byzantine])
+	})
+	net.Start()
+	defer net.Stop()
+
+	net.Pool().Submit(30)
+	if err := net.WaitCommitted(30 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&forged) == 0 {
+		t.Error("no vote forged")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package lbft
+
+import (
+	"fmt"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/core/consensus"
+	"github.com/bocheninc/L0/core/types"
+)
+
+//loadValidators switch the validators and quorum to the validator set of the ledger for the block
+//after the appended height, validator changes take effect only when their blocks are appended
+func (lbft *Lbft) loadValidators() {
+	height := lbft.stack.GetBlockchainInfo().Height
+
+	lbft.rwValidators.Lock()
+	defer lbft.rwValidators.Unlock()
+	if lbft.validators != nil && lbft.validatorsHeight == height {
+		return
+	}
+	vs, err := lbft.stack.GetValidatorSet(height + 1)
+	if err != nil {
+		log.Errorf("Replica %s load validator set at height %d error %v", lbft.options.ID, height+1, err)
+		return
+	}
+	validators := make(map[string]*crypto.PublicKey, vs.Len())
+	for _, nodeID := range vs.IDs() {
+		pub, _ := vs.PublicKey(nodeID)
+		validators[consensus.ReplicaID(lbft.options.Chain, nodeID)] = crypto.ToECDSAPub(pub)
+	}
+	lbft.validators = validators
+	lbft.validatorsHeight = height
+	if n := vs.Len(); n > 0 && (n != lbft.options.N || vs.Quorum() != lbft.options.Q) {
+		lbft.options.N = n
+		lbft.options.Q = vs.Quorum()
+		log.Infof("Replica %s load validator set at height %d, N %d, Q %d", lbft.options.ID, height+1, lbft.options.N, lbft.options.Q)
+	}
+}
+
+//loadPeerValidators loads the public keys of the replicas of the other chains
+func (lbft *Lbft) loadPeerValidators() error {
+	peerValidators := make(map[string]*crypto.PublicKey)
+	for chain, validators := range lbft.options.PeerValidators {
+		if chain == lbft.options.Chain {
+			return fmt.Errorf("chain %s of the replica is not a peer chain", chain)
+		}
+		vs, err := types.ParseValidatorSet(validators)
+		if err != nil {
+			return err
+		}
+		for _, nodeID := range vs.IDs() {
+			pub, _ := vs.PublicKey(nodeID)
+			peerValidators[consensus.ReplicaID(chain, nodeID)] = crypto.ToECDSAPub(pub)
+		}
+	}
+	lbft.peerValidators = peerValidators
+	return nil
+}
+
+//validator returns the public key of the sender by the chain of the replica, the validator set of the chain
+//or the peer validators for the request batches, prepares and commits of the cross chain consensus
+func (lbft *Lbft) validator(msg *Message) (*crypto.PublicKey, bool) {
+	if consensus.ReplicaChain(msg.ReplicaID) != lbft.options.Chain {
+		switch msg.Type {
+		case MESSAGEREQUESTBATCH, MESSAGEPREPARE, MESSAGECOMMIT:
+			pub, ok := lbft.peerValidators[msg.ReplicaID]
+			return pub, ok
+		}
+		return nil, false
+	}
+	return lbft.chainValidator(msg.ReplicaID)
+}
+
+//chainValidator returns the public key of the replica in the validator set,
+//the set is reloaded once for an unknown replica in case of new appended blocks
+func (lbft *Lbft) chainValidator(replicaID string) (*crypto.PublicKey, bool) {
+	lbft.rwValidators.RLock()
+	pub, ok := lbft.validators[replicaID]
+	lbft.rwValidators.RUnlock()
+	if ok {
+		return pub, true
+	}
+	lbft.loadValidators()
+	lbft.rwValidators.RLock()
+	defer lbft.rwValidators.RUnlock()
+	pub, ok = lbft.validators[replicaID]
+	return pub, ok
+}
+
+//hasValidatorKeys reports whether the public keys of the replicas are loaded
+func (lbft *Lbft) hasValidatorKeys() bool {
+	lbft.rwValidators.RLock()
+	defer lbft.rwValidators.RUnlock()
+	return len(lbft.validators) > 0
+}
+
+//optionsHash returns the hash of the options, N and Q are switched by loadValidators
+func (lbft *Lbft) optionsHash() []byte {
+	lbft.rwValidators.RLock()
+	defer lbft.rwValidators.RUnlock()
+	return lbft.options.Hash()
+}
@@ -102,7 +102,7 @@ func (noops *Noops) processBlock() {
 	outputs := []*consensus.CommittedTxs{}
 	outputs = append(outputs, &consensus.CommittedTxs{Skip: false, Time: uint32(time.Now().Unix()), Transactions: txs, SeqNo: noops.seqNo})
 	noops.height++
-	noops.committedTxsChan <- &consensus.OutputTxs{Outputs: outputs, Height: noops.height}
+	noops.committedTxsChan <- &consensus.OutputTxs{Outputs: outputs, Height: noops.height, Proposer: noops.options.ID}
 
 	noops.blockTimer = time.NewTimer(noops.options.BlockInterval)
 }
@@ -25,6 +25,7 @@ import (
 // NewDefaultOptions Create noops options with default
 func NewDefaultOptions() *Options {
 	options := &Options{}
+	options.ID = "0"
 	options.BlockSize = 100
 	options.BlockInterval = 10 * time.Second
 
@@ -36,6 +37,7 @@ func NewDefaultOptions() *Options {
 
 // Options Define noops options
 type Options struct {
+	ID            string
 	BlockSize     int
 	BlockInterval time.Duration
 
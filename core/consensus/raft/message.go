@@ -0,0 +1,121 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package raft
+
+import (
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/types"
+)
+
+// MessageType the type of raft message
+type MessageType uint32
+
+// raft message types
+const (
+	MESSAGEREQUESTVOTE MessageType = iota
+	MESSAGEVOTE
+	MESSAGEAPPENDENTRIES
+	MESSAGEAPPENDRESPONSE
+	MESSAGEINSTALLSNAPSHOT
+)
+
+// Message the envelope of raft messages, To is empty for all the peers, Signature is signed by From
+type Message struct {
+	Type      MessageType
+	From      string
+	To        string
+	Payload   []byte
+	Signature []byte
+}
+
+// signHash hash of the message signed by the sender
+func (msg *Message) signHash() crypto.Hash {
+	return crypto.Sha256(utils.Serialize(&Message{Type: msg.Type, From: msg.From, To: msg.To, Payload: msg.Payload}))
+}
+
+// Serialize Serialize
+func (msg *Message) Serialize() []byte {
+	return utils.Serialize(msg)
+}
+
+// Deserialize Deserialize
+func (msg *Message) Deserialize(payload []byte) error {
+	return utils.Deserialize(payload, msg)
+}
+
+// Group transactions committed together
+type Group struct {
+	Transactions []*types.Transaction
+}
+
+// Entry the log entry of raft, an entry is written as the block at height Index
+type Entry struct {
+	Term     uint64
+	Index    uint32
+	Time     uint32
+	Proposer string
+	Groups   []*Group
+}
+
+// RequestVote sent by the candidate to gather votes
+type RequestVote struct {
+	Term      uint64
+	LastIndex uint32
+	LastTerm  uint64
+}
+
+// Vote the reply of RequestVote
+type Vote struct {
+	Term    uint64
+	Granted bool
+}
+
+// AppendEntries sent by the leader to replicate entries, also used as heartbeat
+type AppendEntries struct {
+	Term      uint64
+	PrevIndex uint32
+	PrevTerm  uint64
+	Entries   []*Entry
+	Commit    uint32
+}
+
+// AppendResponse the reply of AppendEntries and InstallSnapshot, Index is the matched index on success
+// and the hint of the next index on failure
+type AppendResponse struct {
+	Term    uint64
+	Success bool
+	Index   uint32
+}
+
+// InstallSnapshot sent by the leader to the follower whose next entry is discarded,
+// the follower fetches the blocks up to Index by state transfer
+type InstallSnapshot struct {
+	Term      uint64
+	Index     uint32
+	IndexTerm uint64
+	BlockHash string
+}
+
+// hardState the state persisted before replying
+type hardState struct {
+	Term     uint64
+	VotedFor string
+	Entries  []*Entry
+}
@@ -0,0 +1,60 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package raft
+
+import (
+	"time"
+
+	"github.com/bocheninc/L0/components/crypto"
+)
+
+// NewDefaultOptions Create raft options with default value
+func NewDefaultOptions() *Options {
+	options := &Options{}
+	options.Chain = "0"
+	options.ID = "0"
+	options.BlockSize = 2000
+	options.BlockInterval = 2 * time.Second
+	options.HeartbeatInterval = 200 * time.Millisecond
+	options.ElectionTimeout = time.Second
+	options.MaxEntries = 16
+	options.LogSize = 100
+	options.BufferSize = 100
+	return options
+}
+
+// Options Define raft options
+type Options struct {
+	Chain string
+	ID    string
+	// Peers replica ids of all the nodes in the cluster
+	Peers             []string
+	BlockSize         int
+	BlockInterval     time.Duration
+	HeartbeatInterval time.Duration
+	// ElectionTimeout the follower starts election after a random timeout between ElectionTimeout and 2*ElectionTimeout
+	ElectionTimeout time.Duration
+	// MaxEntries the maximum entries sent in one append message
+	MaxEntries int
+	// LogSize the number of applied entries kept for lagging followers
+	LogSize    int
+	BufferSize int
+	// PrivateKey signs the messages of the replica, the peers verify them with the validator set
+	PrivateKey *crypto.PrivateKey
+}
@@ -0,0 +1,600 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package raft
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/consensus"
+	"github.com/bocheninc/L0/core/types"
+)
+
+// hardStateKey the key of the hard state persisted by raft
+const hardStateKey = "raft"
+
+// role of the replica
+const (
+	follower = iota
+	candidate
+	leader
+)
+
+// NewRaft Create raft consenter
+func NewRaft(options *Options, stack consensus.IStack) *Raft {
+	raft := &Raft{
+		options:          options,
+		stack:            stack,
+		peers:            make(map[string]bool),
+		votes:            make(map[string]bool),
+		nextIndex:        make(map[string]uint32),
+		matchIndex:       make(map[string]uint32),
+		recvChan:         make(chan *Message, options.BufferSize),
+		committedTxsChan: make(chan *consensus.OutputTxs, options.BufferSize),
+		broadcastChan:    make(chan *consensus.BroadcastConsensus, options.BufferSize),
+		exit:             make(chan struct{}),
+	}
+	for _, peer := range options.Peers {
+		raft.peers[peer] = true
+	}
+	raft.peers[options.ID] = true
+
+	h := fnv.New64()
+	h.Write([]byte(options.ID))
+	raft.rand = rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(h.Sum64())))
+
+	raft.loadValidators()
+	if !raft.hasValidatorKeys() {
+		log.Panicf("Replica %s blockchain.validators should be configured to authenticate the consensus messages", options.ID)
+	}
+
+	height := stack.GetBlockchainInfo().Height
+	raft.entries = []*Entry{{Index: height}}
+	raft.commitIndex = height
+	raft.lastApplied = height
+	raft.load()
+	return raft
+}
+
+// Raft Define raft consenter
+type Raft struct {
+	options *Options
+	stack   consensus.IStack
+	peers   map[string]bool
+
+	rwValidators     sync.RWMutex
+	validators       map[string]*crypto.PublicKey
+	validatorsHeight uint32
+
+	role     int
+	term     uint64
+	votedFor string
+	leader   string
+	votes    map[string]bool
+
+	// entries[0] is the last discarded entry, only Index and Term are valid
+	entries     []*Entry
+	commitIndex uint32
+	lastApplied uint32
+	nextIndex   map[string]uint32
+	matchIndex  map[string]uint32
+
+	rand             *rand.Rand
+	electionTimer    *time.Timer
+	recvChan         chan *Message
+	committedTxsChan chan *consensus.OutputTxs
+	broadcastChan    chan *consensus.BroadcastConsensus
+	running          int32
+	exit             chan struct{}
+}
+
+func (raft *Raft) String() string {
+	bytes, _ := json.Marshal(raft.options)
+	return string(bytes)
+}
+
+// IsRunning raft consenter serverice already started
+func (raft *Raft) IsRunning() bool {
+	return atomic.LoadInt32(&raft.running) == 1
+}
+
+// Start Start consenter serverice of raft
+func (raft *Raft) Start() {
+	if !atomic.CompareAndSwapInt32(&raft.running, 0, 1) {
+		return
+	}
+	log.Infof("Replica %s start raft, term %d, last index %d, peers %d", raft.options.ID, raft.term, raft.lastIndex(), len(raft.peers))
+	raft.electionTimer = time.NewTimer(raft.electionTimeout())
+	heartbeatTicker := time.NewTicker(raft.options.HeartbeatInterval)
+	defer heartbeatTicker.Stop()
+	blockTicker := time.NewTicker(raft.options.BlockInterval)
+	defer blockTicker.Stop()
+	for {
+		select {
+		case <-raft.exit:
+			raft.electionTimer.Stop()
+			return
+		case msg := <-raft.recvChan:
+			raft.handleMessage(msg)
+		case <-raft.electionTimer.C:
+			if raft.role != leader {
+				raft.startElection()
+			}
+			raft.resetElectionTimer()
+		case <-heartbeatTicker.C:
+			if raft.role == leader {
+				raft.broadcastAppendEntries()
+			}
+		case <-blockTicker.C:
+			if raft.role == leader {
+				raft.propose()
+			}
+		}
+	}
+}
+
+// Stop Stop consenter serverice of raft
+func (raft *Raft) Stop() {
+	if atomic.SwapInt32(&raft.running, 2) != 2 {
+		close(raft.exit)
+	}
+}
+
+// Quorum num of quorum
+func (raft *Raft) Quorum() int {
+	return len(raft.peers)/2 + 1
+}
+
+// RecvConsensus Receive consensus data
+func (raft *Raft) RecvConsensus(payload []byte) {
+	msg := &Message{}
+	if err := msg.Deserialize(payload); err != nil {
+		log.Errorf("Replica %s receive illegal consensus message, %v", raft.options.ID, err)
+		return
+	}
+	if msg.From == raft.options.ID || !raft.peers[msg.From] || (msg.To != "" && msg.To != raft.options.ID) {
+		return
+	}
+	if err := raft.verify(msg); err != nil {
+		log.Errorf("Replica %s receive illegal consensus message %d from %s, %v", raft.options.ID, msg.Type, msg.From, err)
+		return
+	}
+	select {
+	case raft.recvChan <- msg:
+	case <-raft.exit:
+	}
+}
+
+// BroadcastConsensusChannel Broadcast consensus data
+func (raft *Raft) BroadcastConsensusChannel() <-chan *consensus.BroadcastConsensus {
+	return raft.broadcastChan
+}
+
+// CommittedTxsChannel Commit block data
+func (raft *Raft) CommittedTxsChannel() <-chan *consensus.OutputTxs {
+	return raft.committedTxsChan
+}
+
+// ChangeBlockSize change the maximum transactions of block
+func (raft *Raft) ChangeBlockSize(size int) {
+	raft.options.BlockSize = size
+}
+
+func (raft *Raft) electionTimeout() time.Duration {
+	return raft.options.ElectionTimeout + time.Duration(raft.rand.Int63n(int64(raft.options.ElectionTimeout)))
+}
+
+func (raft *Raft) resetElectionTimer() {
+	if !raft.electionTimer.Stop() {
+		select {
+		case <-raft.electionTimer.C:
+		default:
+		}
+	}
+	raft.electionTimer.Reset(raft.electionTimeout())
+}
+
+func (raft *Raft) lastIndex() uint32 {
+	return raft.entries[len(raft.entries)-1].Index
+}
+
+func (raft *Raft) lastTerm() uint64 {
+	return raft.entries[len(raft.entries)-1].Term
+}
+
+func (raft *Raft) baseIndex() uint32 {
+	return raft.entries[0].Index
+}
+
+func (raft *Raft) entry(index uint32) *Entry {
+	if index < raft.baseIndex() || index > raft.lastIndex() {
+		return nil
+	}
+	return raft.entries[index-raft.baseIndex()]
+}
+
+func (raft *Raft) send(to string, typ MessageType, payload interface{}) {
+	msg := &Message{Type: typ, From: raft.options.ID, To: to, Payload: utils.Serialize(payload)}
+	raft.sign(msg)
+	raft.broadcastChan <- &consensus.BroadcastConsensus{To: raft.options.Chain, Payload: msg.Serialize()}
+}
+
+func (raft *Raft) handleMessage(msg *Message) {
+	var err error
+	switch msg.Type {
+	case MESSAGEREQUESTVOTE:
+		rv := &RequestVote{}
+		if err = utils.Deserialize(msg.Payload, rv); err == nil {
+			raft.recvRequestVote(msg.From, rv)
+		}
+	case MESSAGEVOTE:
+		v := &Vote{}
+		if err = utils.Deserialize(msg.Payload, v); err == nil {
+			raft.recvVote(msg.From, v)
+		}
+	case MESSAGEAPPENDENTRIES:
+		ae := &AppendEntries{}
+		if err = utils.Deserialize(msg.Payload, ae); err == nil {
+			raft.recvAppendEntries(msg.From, ae)
+		}
+	case MESSAGEAPPENDRESPONSE:
+		ar := &AppendResponse{}
+		if err = utils.Deserialize(msg.Payload, ar); err == nil {
+			raft.recvAppendResponse(msg.From, ar)
+		}
+	case MESSAGEINSTALLSNAPSHOT:
+		is := &InstallSnapshot{}
+		if err = utils.Deserialize(msg.Payload, is); err == nil {
+			raft.recvInstallSnapshot(msg.From, is)
+		}
+	default:
+		log.Errorf("Replica %s receive unsupport consensus message type %d", raft.options.ID, msg.Type)
+	}
+	if err != nil {
+		log.Errorf("Replica %s receive illegal consensus message %d from %s, %v", raft.options.ID, msg.Type, msg.From, err)
+	}
+}
+
+func (raft *Raft) becomeFollower(term uint64, leader string) {
+	if term > raft.term {
+		raft.term = term
+		raft.votedFor = ""
+		raft.persist()
+	}
+	if raft.role != follower || raft.leader != leader {
+		log.Infof("Replica %s become follower at term %d, leader %s", raft.options.ID, raft.term, leader)
+	}
+	raft.role = follower
+	raft.leader = leader
+}
+
+func (raft *Raft) startElection() {
+	raft.term++
+	raft.role = candidate
+	raft.leader = ""
+	raft.votedFor = raft.options.ID
+	raft.votes = map[string]bool{raft.options.ID: true}
+	raft.persist()
+	log.Infof("Replica %s start election at term %d", raft.options.ID, raft.term)
+	if len(raft.votes) >= raft.Quorum() {
+		raft.becomeLeader()
+		return
+	}
+	raft.send("", MESSAGEREQUESTVOTE, &RequestVote{Term: raft.term, LastIndex: raft.lastIndex(), LastTerm: raft.lastTerm()})
+}
+
+func (raft *Raft) recvRequestVote(from string, rv *RequestVote) {
+	if rv.Term > raft.term {
+		raft.becomeFollower(rv.Term, "")
+	}
+	upToDate := rv.LastTerm > raft.lastTerm() || (rv.LastTerm == raft.lastTerm() && rv.LastIndex >= raft.lastIndex())
+	granted := rv.Term == raft.term && (raft.votedFor == "" || raft.votedFor == from) && upToDate
+	if granted {
+		raft.votedFor = from
+		raft.persist()
+		raft.resetElectionTimer()
+	}
+	log.Debugf("Replica %s vote %t for %s at term %d", raft.options.ID, granted, from, raft.term)
+	raft.send(from, MESSAGEVOTE, &Vote{Term: raft.term, Granted: granted})
+}
+
+func (raft *Raft) recvVote(from string, v *Vote) {
+	if v.Term > raft.term {
+		raft.becomeFollower(v.Term, "")
+		return
+	}
+	if raft.role != candidate || v.Term != raft.term || !v.Granted {
+		return
+	}
+	raft.votes[from] = true
+	if len(raft.votes) >= raft.Quorum() {
+		raft.becomeLeader()
+	}
+}
+
+func (raft *Raft) becomeLeader() {
+	raft.role = leader
+	raft.leader = raft.options.ID
+	for peer := range raft.peers {
+		raft.nextIndex[peer] = raft.lastIndex() + 1
+		raft.matchIndex[peer] = 0
+	}
+	log.Infof("Replica %s become leader at term %d, last index %d", raft.options.ID, raft.term, raft.lastIndex())
+	if raft.lastIndex() > raft.commitIndex {
+		// entries of the previous terms are committed with an entry of the current term
+		raft.appendEntry(&Entry{Time: uint32(time.Now().Unix())})
+	}
+	raft.broadcastAppendEntries()
+}
+
+func (raft *Raft) propose() {
+	if raft.lastIndex() > raft.commitIndex {
+		return
+	}
+	txss := raft.stack.FetchGroupingTxsInTxPool(1, raft.options.BlockSize)
+	if len(txss) < 2 || len(txss[0]) == 0 {
+		return
+	}
+	if !raft.stack.VerifyTxsInConsensus(txss[0], true) {
+		return
+	}
+	entry := &Entry{Time: uint32(time.Now().Unix())}
+	for _, txs := range txss[1:] {
+		if len(txs) > 0 {
+			entry.Groups = append(entry.Groups, &Group{Transactions: txs})
+		}
+	}
+	raft.appendEntry(entry)
+	raft.broadcastAppendEntries()
+}
+
+func (raft *Raft) appendEntry(entry *Entry) {
+	entry.Term = raft.term
+	entry.Index = raft.lastIndex() + 1
+	entry.Proposer = raft.options.ID
+	raft.entries = append(raft.entries, entry)
+	raft.matchIndex[raft.options.ID] = entry.Index
+	raft.persist()
+	log.Debugf("Replica %s append entry %d at term %d", raft.options.ID, entry.Index, entry.Term)
+	raft.advanceCommitIndex()
+}
+
+func (raft *Raft) broadcastAppendEntries() {
+	for peer := range raft.peers {
+		if peer != raft.options.ID {
+			raft.sendAppendEntries(peer)
+		}
+	}
+}
+
+func (raft *Raft) sendAppendEntries(peer string) {
+	next := raft.nextIndex[peer]
+	if next <= raft.baseIndex() {
+		raft.sendInstallSnapshot(peer)
+		return
+	}
+	prev := raft.entry(next - 1)
+	ae := &AppendEntries{Term: raft.term, PrevIndex: prev.Index, PrevTerm: prev.Term, Commit: raft.commitIndex}
+	for index := next; index <= raft.lastIndex() && len(ae.Entries) < raft.options.MaxEntries; index++ {
+		ae.Entries = append(ae.Entries, raft.entry(index))
+	}
+	raft.send(peer, MESSAGEAPPENDENTRIES, ae)
+}
+
+func (raft *Raft) sendInstallSnapshot(peer string) {
+	base := raft.entries[0]
+	hash, err := raft.stack.GetBlockHashByHeight(base.Index)
+	if err != nil {
+		log.Warnf("Replica %s get block %d for snapshot error %v", raft.options.ID, base.Index, err)
+		return
+	}
+	raft.send(peer, MESSAGEINSTALLSNAPSHOT, &InstallSnapshot{Term: raft.term, Index: base.Index, IndexTerm: base.Term, BlockHash: hash.String()})
+}
+
+func (raft *Raft) recvAppendEntries(from string, ae *AppendEntries) {
+	if ae.Term < raft.term {
+		raft.send(from, MESSAGEAPPENDRESPONSE, &AppendResponse{Term: raft.term})
+		return
+	}
+	raft.becomeFollower(ae.Term, from)
+	raft.resetElectionTimer()
+
+	if ae.PrevIndex > raft.lastIndex() {
+		raft.send(from, MESSAGEAPPENDRESPONSE, &AppendResponse{Term: raft.term, Index: raft.lastIndex() + 1})
+		return
+	}
+	if prev := raft.entry(ae.PrevIndex); prev != nil && prev.Term != ae.PrevTerm && ae.PrevIndex > raft.baseIndex() {
+		raft.send(from, MESSAGEAPPENDRESPONSE, &AppendResponse{Term: raft.term, Index: raft.commitIndex + 1})
+		return
+	}
+
+	changed := false
+	for _, entry := range ae.Entries {
+		if entry.Index < raft.baseIndex() {
+			continue
+		}
+		if entry.Index == raft.baseIndex() {
+			raft.entries[0].Term = entry.Term
+			continue
+		}
+		if e := raft.entry(entry.Index); e != nil {
+			if e.Term == entry.Term {
+				continue
+			}
+			raft.entries = raft.entries[:entry.Index-raft.baseIndex()]
+		}
+		raft.entries = append(raft.entries, entry)
+		changed = true
+	}
+	if changed {
+		raft.persist()
+	}
+
+	match := ae.PrevIndex + uint32(len(ae.Entries))
+	if match < raft.baseIndex() {
+		match = raft.baseIndex()
+	}
+	if commit := ae.Commit; commit > raft.commitIndex {
+		if commit > match {
+			commit = match
+		}
+		if commit > raft.commitIndex {
+			raft.commitIndex = commit
+			raft.apply()
+		}
+	}
+	raft.send(from, MESSAGEAPPENDRESPONSE, &AppendResponse{Term: raft.term, Success: true, Index: match})
+}
+
+func (raft *Raft) recvInstallSnapshot(from string, is *InstallSnapshot) {
+	if is.Term < raft.term {
+		raft.send(from, MESSAGEAPPENDRESPONSE, &AppendResponse{Term: raft.term})
+		return
+	}
+	raft.becomeFollower(is.Term, from)
+	raft.resetElectionTimer()
+
+	if is.Index > raft.commitIndex {
+		log.Infof("Replica %s install snapshot %d (block %s) from %s", raft.options.ID, is.Index, is.BlockHash, from)
+		raft.stack.StateTransfer(is.Index, crypto.HexToHash(is.BlockHash))
+		raft.entries = []*Entry{{Index: is.Index, Term: is.IndexTerm}}
+		raft.commitIndex = is.Index
+		raft.lastApplied = is.Index
+		raft.persist()
+	}
+	raft.send(from, MESSAGEAPPENDRESPONSE, &AppendResponse{Term: raft.term, Success: true, Index: is.Index})
+}
+
+func (raft *Raft) recvAppendResponse(from string, ar *AppendResponse) {
+	if ar.Term > raft.term {
+		raft.becomeFollower(ar.Term, "")
+		return
+	}
+	if raft.role != leader || ar.Term != raft.term {
+		return
+	}
+	if ar.Success {
+		if ar.Index > raft.matchIndex[from] {
+			raft.matchIndex[from] = ar.Index
+		}
+		raft.nextIndex[from] = raft.matchIndex[from] + 1
+		raft.advanceCommitIndex()
+		if raft.nextIndex[from] <= raft.lastIndex() {
+			raft.sendAppendEntries(from)
+		}
+		return
+	}
+	next := raft.nextIndex[from] - 1
+	if ar.Index > 0 && ar.Index < next {
+		next = ar.Index
+	}
+	if next <= raft.matchIndex[from] {
+		next = raft.matchIndex[from] + 1
+	}
+	raft.nextIndex[from] = next
+	raft.sendAppendEntries(from)
+}
+
+func (raft *Raft) advanceCommitIndex() {
+	for index := raft.lastIndex(); index > raft.commitIndex; index-- {
+		if raft.entry(index).Term != raft.term {
+			break
+		}
+		cnt := 0
+		for peer := range raft.peers {
+			if raft.matchIndex[peer] >= index {
+				cnt++
+			}
+		}
+		if cnt >= raft.Quorum() {
+			raft.commitIndex = index
+			raft.apply()
+			break
+		}
+	}
+}
+
+func (raft *Raft) apply() {
+	for raft.lastApplied < raft.commitIndex {
+		raft.lastApplied++
+		entry := raft.entry(raft.lastApplied)
+		var txs []*types.Transaction
+		for _, group := range entry.Groups {
+			txs = append(txs, group.Transactions...)
+		}
+		outputs := []*consensus.CommittedTxs{{Skip: true, IsLocalChain: true, Time: entry.Time, Transactions: txs, SeqNo: uint64(entry.Index)}}
+		for _, group := range entry.Groups {
+			outputs = append(outputs, &consensus.CommittedTxs{IsLocalChain: true, Time: entry.Time, Transactions: group.Transactions, SeqNo: uint64(entry.Index)})
+		}
+		log.Infof("Replica %s write block %d (%d transactions), term %d, proposer %s", raft.options.ID, entry.Index, len(txs), entry.Term, entry.Proposer)
+		raft.committedTxsChan <- &consensus.OutputTxs{Outputs: outputs, Height: entry.Index, Proposer: entry.Proposer}
+	}
+	raft.compact()
+	raft.loadValidators()
+}
+
+// compact discard the applied entries beyond LogSize
+func (raft *Raft) compact() {
+	if discard := int(raft.lastApplied-raft.baseIndex()) - raft.options.LogSize; discard > 0 {
+		raft.entries = append([]*Entry{{Index: raft.entries[discard].Index, Term: raft.entries[discard].Term}}, raft.entries[discard+1:]...)
+	}
+}
+
+// persist save the term, vote and unapplied entries before replying
+func (raft *Raft) persist() {
+	hs := &hardState{Term: raft.term, VotedFor: raft.votedFor}
+	for _, entry := range raft.entries {
+		if entry.Index >= raft.lastApplied {
+			hs.Entries = append(hs.Entries, entry)
+		}
+	}
+	if err := raft.stack.PutCheckpoint(hardStateKey, utils.Serialize(hs)); err != nil {
+		log.Errorf("Replica %s persist state error %v", raft.options.ID, err)
+	}
+}
+
+// load restore the persisted state, the entries written to the blockchain are discarded
+func (raft *Raft) load() {
+	data, err := raft.stack.GetCheckpoint(hardStateKey)
+	if err != nil || len(data) == 0 {
+		return
+	}
+	hs := &hardState{}
+	if err := utils.Deserialize(data, hs); err != nil {
+		log.Errorf("Replica %s load state error %v", raft.options.ID, err)
+		return
+	}
+	raft.term = hs.Term
+	raft.votedFor = hs.VotedFor
+	for _, entry := range hs.Entries {
+		if entry.Index == raft.baseIndex() {
+			raft.entries[0].Term = entry.Term
+		} else if entry.Index == raft.lastIndex()+1 {
+			raft.entries = append(raft.entries, entry)
+		}
+	}
+	log.Infof("Replica %s load state, term %d, vote %s, last index %d", raft.options.ID, raft.term, raft.votedFor, raft.lastIndex())
+}
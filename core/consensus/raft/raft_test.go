@@ -0,0 +1,330 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package raft
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/core/accounts"
+	"github.com/bocheninc/L0/core/consensus"
+	"github.com/bocheninc/L0/core/consensus/helper"
+	"github.com/bocheninc/L0/core/types"
+)
+
+type testPool struct {
+	sync.Mutex
+	txs []*types.Transaction
+}
+
+func (pool *testPool) add(n int) {
+	pool.Lock()
+	defer pool.Unlock()
+	for i := 0; i < n; i++ {
+		nonce := uint32(len(pool.txs) + i)
+		pool.txs = append(pool.txs, types.NewTransaction(nil, nil, types.TypeAtomic, nonce, accounts.Address{}, accounts.Address{}, big.NewInt(1), big.NewInt(0), uint32(time.Now().UnixNano())))
+	}
+}
+
+type testStack struct {
+	*helper.Stack
+	pool *testPool
+
+	sync.Mutex
+	height   uint32
+	outputs  []*consensus.OutputTxs
+	transfer uint32
+}
+
+func (stack *testStack) GetBlockchainInfo() *consensus.BlockchainInfo {
+	stack.Lock()
+	defer stack.Unlock()
+	return &consensus.BlockchainInfo{Height: stack.height}
+}
+
+func (stack *testStack) FetchGroupingTxsInTxPool(groupingNum, maxSizeInGrouping int) []types.Transactions {
+	stack.pool.Lock()
+	defer stack.pool.Unlock()
+	txs := stack.pool.txs
+	stack.pool.txs = nil
+	return []types.Transactions{txs, txs}
+}
+
+func (stack *testStack) GetBlockHashByHeight(height uint32) (crypto.Hash, error) {
+	return crypto.Sha256([]byte{byte(height)}), nil
+}
+
+func (stack *testStack) StateTransfer(height uint32, blockHash crypto.Hash) {
+	stack.Lock()
+	defer stack.Unlock()
+	stack.transfer = height
+	stack.height = height
+}
+
+func (stack *testStack) run(output <-chan *consensus.OutputTxs) {
+	for o := range output {
+		stack.Lock()
+		if o.Height == stack.height+1 {
+			stack.height = o.Height
+			stack.outputs = append(stack.outputs, o)
+		}
+		stack.Unlock()
+	}
+}
+
+func (stack *testStack) txs() int {
+	stack.Lock()
+	defer stack.Unlock()
+	cnt := 0
+	for _, o := range stack.outputs {
+		cnt += len(o.Outputs[0].Transactions)
+	}
+	return cnt
+}
+
+type testNetwork struct {
+	sync.RWMutex
+	pool     *testPool
+	options  []*Options
+	stacks   []*testStack
+	replicas []*Raft
+	down     map[string]bool
+}
+
+func newTestNetwork(n int, logSize int) *testNetwork {
+	net := &testNetwork{pool: &testPool{}, down: make(map[string]bool)}
+	validators := types.NewValidatorSet()
+	var peers []string
+	var keys []*crypto.PrivateKey
+	for i := 0; i < n; i++ {
+		nodeID := string('a' + rune(i))
+		key, _ := crypto.GenerateKey()
+		validators.Add(nodeID, key.Public().Bytes())
+		peers = append(peers, consensus.ReplicaID("0", nodeID))
+		keys = append(keys, key)
+	}
+	for i := 0; i < n; i++ {
+		options := NewDefaultOptions()
+		options.ID = peers[i]
+		options.Peers = peers
+		options.PrivateKey = keys[i]
+		options.BlockInterval = 20 * time.Millisecond
+		options.HeartbeatInterval = 20 * time.Millisecond
+		options.ElectionTimeout = 100 * time.Millisecond
+		options.LogSize = logSize
+		net.options = append(net.options, options)
+		net.stacks = append(net.stacks, &testStack{Stack: &helper.Stack{Validators: validators}, pool: net.pool})
+		net.replicas = append(net.replicas, nil)
+		net.start(i)
+	}
+	return net
+}
+
+func (net *testNetwork) start(i int) {
+	replica := NewRaft(net.options[i], net.stacks[i])
+	net.Lock()
+	net.replicas[i] = replica
+	net.down[replica.options.ID] = false
+	net.Unlock()
+	go replica.Start()
+	go net.stacks[i].run(replica.CommittedTxsChannel())
+	go func() {
+		for msg := range replica.BroadcastConsensusChannel() {
+			net.RLock()
+			if !net.down[replica.options.ID] {
+				for _, r := range net.replicas {
+					if r != replica && !net.down[r.options.ID] {
+						r.RecvConsensus(msg.Payload)
+					}
+				}
+			}
+			net.RUnlock()
+		}
+	}()
+}
+
+func (net *testNetwork) crash(i int) {
+	net.Lock()
+	net.down[net.replicas[i].options.ID] = true
+	net.Unlock()
+	net.replicas[i].Stop()
+}
+
+func (net *testNetwork) partition(i int, down bool) {
+	net.Lock()
+	net.down[net.replicas[i].options.ID] = down
+	net.Unlock()
+}
+
+func (net *testNetwork) stop() {
+	for _, replica := range net.replicas {
+		replica.Stop()
+	}
+}
+
+// leader returns the proposer of the last block written by replica i
+func (net *testNetwork) leader(i int) int {
+	stack := net.stacks[i]
+	stack.Lock()
+	proposer := stack.outputs[len(stack.outputs)-1].Proposer
+	stack.Unlock()
+	for j, options := range net.options {
+		if options.ID == proposer {
+			return j
+		}
+	}
+	return -1
+}
+
+func waitFor(t *testing.T, desc string, cond func() bool) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timeout waiting for %s", desc)
+}
+
+func (net *testNetwork) checkConsistent(t *testing.T) {
+	var blocks []*consensus.OutputTxs
+	for i, stack := range net.stacks {
+		stack.Lock()
+		for j, o := range stack.outputs {
+			if j >= len(blocks) {
+				blocks = append(blocks, o)
+			} else if o.Proposer != blocks[j].Proposer || len(o.Outputs[0].Transactions) != len(blocks[j].Outputs[0].Transactions) {
+				t.Errorf("replica %d block %d mismatch", i, o.Height)
+			}
+		}
+		stack.Unlock()
+	}
+}
+
+func TestRaftReplication(t *testing.T) {
+	net := newTestNetwork(3, 100)
+	defer net.stop()
+
+	net.pool.add(10)
+	waitFor(t, "replication", func() bool {
+		for _, stack := range net.stacks {
+			if stack.txs() != 10 {
+				return false
+			}
+		}
+		return true
+	})
+	net.checkConsistent(t)
+	if q := net.replicas[0].Quorum(); q != 2 {
+		t.Errorf("quorum %d", q)
+	}
+}
+
+func TestRaftLeaderCrash(t *testing.T) {
+	net := newTestNetwork(3, 100)
+	defer net.stop()
+
+	net.pool.add(5)
+	waitFor(t, "first block", func() bool { return net.stacks[0].txs() == 5 })
+	crashed := net.leader(0)
+	net.crash(crashed)
+
+	alive := (crashed + 1) % 3
+	net.pool.add(5)
+	waitFor(t, "block of new leader", func() bool { return net.stacks[alive].txs() == 10 })
+	if net.leader(alive) == crashed {
+		t.Error("block written by crashed leader")
+	}
+
+	net.start(crashed)
+	waitFor(t, "recovery of crashed replica", func() bool { return net.stacks[crashed].txs() == 10 })
+	net.checkConsistent(t)
+}
+
+func TestRaftInstallSnapshot(t *testing.T) {
+	net := newTestNetwork(3, 1)
+	defer net.stop()
+
+	net.pool.add(1)
+	waitFor(t, "first block", func() bool { return net.stacks[0].txs() == 1 })
+	lagging := (net.leader(0) + 1) % 3
+	net.partition(lagging, true)
+	for i := 2; i <= 4; i++ {
+		net.pool.add(1)
+		other := (lagging + 1) % 3
+		waitFor(t, "block without lagging replica", func() bool { return net.stacks[other].txs() == i })
+	}
+
+	net.partition(lagging, false)
+	stack := net.stacks[lagging]
+	waitFor(t, "snapshot", func() bool {
+		stack.Lock()
+		defer stack.Unlock()
+		return stack.transfer >= 3
+	})
+}
+
+func TestRaftAuthenticate(t *testing.T) {
+	validators := types.NewValidatorSet()
+	var replicas []*Options
+	for _, nodeID := range []string{"a", "b"} {
+		options := NewDefaultOptions()
+		options.ID = consensus.ReplicaID(options.Chain, nodeID)
+		options.PrivateKey, _ = crypto.GenerateKey()
+		validators.Add(nodeID, options.PrivateKey.Public().Bytes())
+		replicas = append(replicas, options)
+	}
+	replicas[0].Peers = []string{replicas[1].ID}
+	receiver := NewRaft(replicas[0], &helper.Stack{Validators: validators})
+	sender := NewRaft(replicas[1], &helper.Stack{Validators: validators})
+
+	newMsg := func() *Message {
+		return &Message{Type: MESSAGEVOTE, From: replicas[1].ID, To: replicas[0].ID, Payload: []byte{1}}
+	}
+	msg := newMsg()
+	sender.sign(msg)
+	if err := receiver.verify(msg); err != nil {
+		t.Errorf("verify signed message error %v", err)
+	}
+	if err := receiver.verify(newMsg()); err == nil {
+		t.Error("unsigned message accepted")
+	}
+	forged := newMsg()
+	forged.From = replicas[0].ID
+	sender.sign(forged)
+	forged.From = replicas[1].ID
+	if err := receiver.verify(forged); err == nil {
+		t.Error("message signed by other replica accepted")
+	}
+	unknown := newMsg()
+	unknown.From = consensus.ReplicaID("0", "c")
+	sender.sign(unknown)
+	if err := receiver.verify(unknown); err == nil {
+		t.Error("message of unknown replica accepted")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("raft started without validator keys")
+		}
+	}()
+	NewRaft(NewDefaultOptions(), helper.NewStack())
+}
@@ -0,0 +1,105 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package raft
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/core/consensus"
+)
+
+// loadValidators load the public keys of the replicas from the validator set of the block after the appended height
+func (raft *Raft) loadValidators() {
+	height := raft.stack.GetBlockchainInfo().Height
+
+	raft.rwValidators.Lock()
+	defer raft.rwValidators.Unlock()
+	if raft.validators != nil && raft.validatorsHeight == height {
+		return
+	}
+	vs, err := raft.stack.GetValidatorSet(height + 1)
+	if err != nil {
+		log.Errorf("Replica %s load validator set at height %d error %v", raft.options.ID, height+1, err)
+		return
+	}
+	validators := make(map[string]*crypto.PublicKey, vs.Len())
+	for _, nodeID := range vs.IDs() {
+		pub, _ := vs.PublicKey(nodeID)
+		validators[consensus.ReplicaID(raft.options.Chain, nodeID)] = crypto.ToECDSAPub(pub)
+	}
+	raft.validators = validators
+	raft.validatorsHeight = height
+}
+
+// validator returns the public key of the replica in the validator set,
+// the set is reloaded once for an unknown replica in case of new appended blocks
+func (raft *Raft) validator(replicaID string) (*crypto.PublicKey, bool) {
+	raft.rwValidators.RLock()
+	pub, ok := raft.validators[replicaID]
+	raft.rwValidators.RUnlock()
+	if ok {
+		return pub, true
+	}
+	raft.loadValidators()
+	raft.rwValidators.RLock()
+	defer raft.rwValidators.RUnlock()
+	pub, ok = raft.validators[replicaID]
+	return pub, ok
+}
+
+// hasValidatorKeys reports whether the public keys of the replicas are loaded
+func (raft *Raft) hasValidatorKeys() bool {
+	raft.rwValidators.RLock()
+	defer raft.rwValidators.RUnlock()
+	return len(raft.validators) > 0
+}
+
+func (raft *Raft) sign(msg *Message) {
+	if raft.options.PrivateKey == nil {
+		return
+	}
+	h := msg.signHash()
+	sig, err := raft.options.PrivateKey.Sign(h[:])
+	if err != nil {
+		log.Errorf("Replica %s sign consensus message error %v", raft.options.ID, err)
+		return
+	}
+	msg.Signature = sig.Bytes()
+}
+
+// verify checks the message is signed by the key of From in the validator set
+func (raft *Raft) verify(msg *Message) error {
+	pub, ok := raft.validator(msg.From)
+	if !ok {
+		return fmt.Errorf("unknown replica %s", msg.From)
+	}
+	if len(msg.Signature) != crypto.SignatureSize {
+		return errors.New("unsigned message")
+	}
+	var sig crypto.Signature
+	copy(sig[:], msg.Signature)
+	h := msg.signHash()
+	if !sig.Verify(h[:], pub) {
+		return errors.New("illegal signature")
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package simulator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bocheninc/L0/core/consensus"
+)
+
+// clock is the consensus.Clock of the consenters, its timers are events on the virtual clock
+type clock struct {
+	net   *Network
+	epoch time.Time
+}
+
+// clockEpoch the time of the consenter clocks at the virtual time 0, the same over the runs
+var clockEpoch = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ConsenterClock returns the clock of the consenters on the virtual time of the network,
+// their timeouts are ordered with the deliveries and the steps
+func (net *Network) ConsenterClock() consensus.Clock {
+	return &clock{net: net, epoch: clockEpoch}
+}
+
+func (c *clock) Now() time.Time {
+	return c.epoch.Add(c.net.Clock())
+}
+
+func (c *clock) NewTimer(d time.Duration) consensus.Timer {
+	t := &timer{clock: c, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// timer fires when the virtual clock reaches the due time of its last reset
+type timer struct {
+	sync.Mutex
+	clock  *clock
+	c      chan time.Time
+	seq    uint64
+	active bool
+}
+
+func (t *timer) Chan() <-chan time.Time {
+	return t.c
+}
+
+func (t *timer) Stop() bool {
+	t.Lock()
+	defer t.Unlock()
+	active := t.active
+	t.active = false
+	t.seq++
+	return active
+}
+
+func (t *timer) Reset(d time.Duration) bool {
+	t.Lock()
+	active := t.active
+	t.active = true
+	t.seq++
+	seq := t.seq
+	t.Unlock()
+
+	t.clock.net.Lock()
+	t.clock.net.schedule(d, func() {
+		t.fire(seq)
+	})
+	t.clock.net.Unlock()
+	return active
+}
+
+func (t *timer) fire(seq uint64) {
+	t.Lock()
+	if !t.active || t.seq != seq {
+		t.Unlock()
+		return
+	}
+	t.active = false
+	t.Unlock()
+	select {
+	case t.c <- t.clock.Now():
+	default:
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package simulator
+
+import (
+	"bytes"
+	"runtime"
+)
+
+// busyStates are the states of the goroutines which run or are about to run, the others are
+// blocked on channels, locks or sleeps and only an event or another goroutine wakes them up
+var busyStates = map[string]bool{
+	"runnable":  true,
+	"running":   true,
+	"syscall":   true,
+	"copystack": true,
+	"preempted": true,
+}
+
+// idleDetector tells whether the goroutines of the process but the caller are all blocked,
+// the consenters have handled the events delivered to them then
+type idleDetector struct {
+	buf []byte
+}
+
+func (d *idleDetector) idle() bool {
+	if d.buf == nil {
+		d.buf = make([]byte, 64*1024)
+	}
+	n := runtime.Stack(d.buf, true)
+	for n == len(d.buf) {
+		d.buf = make([]byte, 2*len(d.buf))
+		n = runtime.Stack(d.buf, true)
+	}
+
+	// the trace of the caller comes first, the others follow after an empty line
+	traces := bytes.Split(d.buf[:n], []byte("\n\n"))
+	for _, trace := range traces[1:] {
+		// goroutine 12 [chan receive, 2 minutes]:
+		start, end := bytes.IndexByte(trace, '['), bytes.IndexByte(trace, ']')
+		if start < 0 || end < start {
+			continue
+		}
+		state := trace[start+1 : end]
+		if i := bytes.IndexByte(state, ','); i >= 0 {
+			state = state[:i]
+		}
+		if busyStates[string(state)] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,489 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package simulator runs several consenters in process over a simulated network.
+// The delay and drop of every message are drawn from the random source of its link,
+// which is seeded by Options.Seed. Deliveries, fault steps and the timeouts of the
+// consenters over ConsenterClock are events on a virtual clock, they run one by one in
+// the order of their virtual time and then of scheduling. The virtual clock stands still
+// while the consenters handle an event and jumps to the next event once every goroutine
+// is blocked, so the consenters which read the time and the timers only from ConsenterClock
+// replay the same decisions and messages with the same seed. The transactions submitted and
+// the steps run by the test goroutine while the network runs take the virtual time they come at.
+package simulator
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/core/consensus"
+	"github.com/bocheninc/L0/core/types"
+)
+
+// NewDefaultOptions Create simulator options with default value
+func NewDefaultOptions() *Options {
+	return &Options{
+		Chain:    "00",
+		Seed:     1,
+		MinDelay: time.Millisecond,
+		MaxDelay: 10 * time.Millisecond,
+	}
+}
+
+// Options Define simulator options
+type Options struct {
+	Chain    string
+	Seed     int64
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// DropRate the probability that a message is lost
+	DropRate float64
+	// Validators the validator set of the chain returned by the stacks
+	Validators *types.ValidatorSet
+}
+
+// NewConsenter create the consenter of the node over the stack
+type NewConsenter func(id string, stack consensus.IStack) consensus.Consenter
+
+// Byzantine rewrite the message sent to the node, the message is dropped if nil is returned
+type Byzantine func(to string, payload []byte) []byte
+
+// Node the simulated node
+type Node struct {
+	ID        string
+	Consenter consensus.Consenter
+	Stack     *Stack
+
+	newConsenter NewConsenter
+	crashed      bool
+	group        int
+	byzantine    Byzantine
+}
+
+// Step the fault injected After the previous step
+type Step struct {
+	After time.Duration
+	Do    func(net *Network)
+}
+
+// NewNetwork Create simulated network
+func NewNetwork(options *Options) *Network {
+	return &Network{
+		options: options,
+		pool:    newPool(options.Chain),
+		links:   make(map[string]*rand.Rand),
+		wakeup:  make(chan struct{}, 1),
+	}
+}
+
+// Network Define simulated network
+type Network struct {
+	sync.RWMutex
+	options *Options
+	pool    *Pool
+	nodes   []*Node
+	links   map[string]*rand.Rand
+
+	clock  time.Duration
+	seq    uint64
+	queue  eventQueue
+	wakeup chan struct{}
+	quit   chan struct{}
+	trace  []string
+	outbox []*outgoing
+}
+
+// outgoing a message broadcast by a node while the consenters handle an event
+type outgoing struct {
+	from    *Node
+	payload []byte
+}
+
+// idlePoll the wall time between the checks whether the consenters are idle
+const idlePoll = 20 * time.Microsecond
+
+// Pool returns the transaction pool shared by the nodes
+func (net *Network) Pool() *Pool {
+	return net.pool
+}
+
+// AddNode add a node, the consenter is started with Start
+func (net *Network) AddNode(id string, newConsenter NewConsenter) *Node {
+	node := &Node{ID: id, newConsenter: newConsenter, Stack: &Stack{net: net, pool: net.pool, checkpoints: make(map[string][]byte)}}
+	net.Lock()
+	net.nodes = append(net.nodes, node)
+	net.Unlock()
+	return node
+}
+
+// Nodes returns all the nodes
+func (net *Network) Nodes() []*Node {
+	net.RLock()
+	defer net.RUnlock()
+	return append([]*Node{}, net.nodes...)
+}
+
+// Node returns the node of id
+func (net *Network) Node(id string) *Node {
+	net.RLock()
+	defer net.RUnlock()
+	for _, node := range net.nodes {
+		if node.ID == id {
+			return node
+		}
+	}
+	return nil
+}
+
+// Start start the consenters of all the nodes and the virtual clock
+func (net *Network) Start() {
+	net.Lock()
+	if net.quit == nil {
+		net.quit = make(chan struct{})
+		go net.dispatch(net.quit)
+	}
+	net.Unlock()
+	for _, node := range net.Nodes() {
+		net.start(node)
+	}
+}
+
+// Stop stop the consenters of all the alive nodes and the virtual clock
+func (net *Network) Stop() {
+	for _, node := range net.Nodes() {
+		net.Crash(node.ID)
+	}
+	net.Lock()
+	if net.quit != nil {
+		close(net.quit)
+		net.quit = nil
+	}
+	net.Unlock()
+}
+
+// Clock returns the virtual time of the network
+func (net *Network) Clock() time.Duration {
+	net.RLock()
+	defer net.RUnlock()
+	return net.now()
+}
+
+// now the virtual time, it is the time of the last event run
+func (net *Network) now() time.Duration {
+	return net.clock
+}
+
+// Trace returns the messages delivered so far with their virtual time, the same seed replays the same trace
+func (net *Network) Trace() []string {
+	net.RLock()
+	defer net.RUnlock()
+	return append([]string{}, net.trace...)
+}
+
+// schedule add the event due after the span of virtual time, the lock must be held
+func (net *Network) schedule(after time.Duration, do func()) {
+	net.seq++
+	heap.Push(&net.queue, &event{at: net.now() + after, seq: net.seq, do: do})
+	select {
+	case net.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch run the events in order, every event waits until the consenters handled the previous ones,
+// the clock is set to the time of every event it runs
+func (net *Network) dispatch(quit chan struct{}) {
+	detector := &idleDetector{}
+	for {
+		for !detector.idle() {
+			select {
+			case <-quit:
+				return
+			default:
+			}
+			time.Sleep(idlePoll)
+		}
+
+		net.Lock()
+		net.flush()
+		var next *event
+		if len(net.queue) > 0 {
+			next = heap.Pop(&net.queue).(*event)
+			if next.at > net.clock {
+				net.clock = next.at
+			}
+		}
+		net.Unlock()
+
+		if next == nil {
+			select {
+			case <-net.wakeup:
+			case <-quit:
+				return
+			}
+			continue
+		}
+		next.do()
+	}
+}
+
+func (net *Network) start(node *Node) {
+	c := node.newConsenter(node.ID, node.Stack)
+	net.Lock()
+	node.Consenter = c
+	node.crashed = false
+	net.Unlock()
+	go c.Start()
+	go func() {
+		for output := range c.CommittedTxsChannel() {
+			if net.alive(node, c) {
+				node.Stack.write(output)
+			}
+		}
+	}()
+	go func() {
+		for msg := range c.BroadcastConsensusChannel() {
+			if net.alive(node, c) {
+				net.broadcast(node, msg.Payload)
+			}
+		}
+	}()
+}
+
+func (net *Network) alive(node *Node, c consensus.Consenter) bool {
+	net.RLock()
+	defer net.RUnlock()
+	return !node.crashed && node.Consenter == c
+}
+
+func (net *Network) link(from, to string) *rand.Rand {
+	key := from + "->" + to
+	r, ok := net.links[key]
+	if !ok {
+		h := fnv.New64()
+		h.Write([]byte(key))
+		r = rand.New(rand.NewSource(net.options.Seed ^ int64(h.Sum64())))
+		net.links[key] = r
+	}
+	return r
+}
+
+// broadcast hold the message until the consenters are idle, the goroutines of a consenter may send
+// concurrently, so the order they come in is not replayed
+func (net *Network) broadcast(from *Node, payload []byte) {
+	net.Lock()
+	defer net.Unlock()
+	net.outbox = append(net.outbox, &outgoing{from: from, payload: payload})
+	select {
+	case net.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// flush send the messages held in the order of sender and payload, the lock must be held
+func (net *Network) flush() {
+	outbox := net.outbox
+	net.outbox = nil
+	sort.SliceStable(outbox, func(i, j int) bool {
+		if outbox[i].from.ID != outbox[j].from.ID {
+			return outbox[i].from.ID < outbox[j].from.ID
+		}
+		return bytes.Compare(outbox[i].payload, outbox[j].payload) < 0
+	})
+	for _, msg := range outbox {
+		net.send(msg.from, msg.payload)
+	}
+}
+
+// send schedule the delivery of the message to every other node, the lock must be held
+func (net *Network) send(from *Node, payload []byte) {
+	for _, to := range net.nodes {
+		if to == from {
+			continue
+		}
+		r := net.link(from.ID, to.ID)
+		drop := r.Float64() < net.options.DropRate
+		delay := net.options.MinDelay
+		if span := net.options.MaxDelay - net.options.MinDelay; span > 0 {
+			delay += time.Duration(r.Int63n(int64(span)))
+		}
+		data := payload
+		if from.byzantine != nil {
+			data = from.byzantine(to.ID, payload)
+		}
+		if drop || data == nil {
+			continue
+		}
+		to := to
+		net.schedule(delay, func() {
+			net.deliver(from, to, data)
+		})
+	}
+}
+
+func (net *Network) deliver(from, to *Node, payload []byte) {
+	net.Lock()
+	c := to.Consenter
+	connected := !from.crashed && !to.crashed && from.group == to.group
+	if connected {
+		net.trace = append(net.trace, fmt.Sprintf("%v %s->%s %s", net.clock, from.ID, to.ID, crypto.Sha256(payload)))
+	}
+	net.Unlock()
+	if connected {
+		c.RecvConsensus(payload)
+	}
+}
+
+// Crash stop the consenter of the node and disconnect it
+func (net *Network) Crash(id string) {
+	node := net.Node(id)
+	net.Lock()
+	if node.crashed {
+		net.Unlock()
+		return
+	}
+	node.crashed = true
+	net.Unlock()
+	log.Infof("Simulator crash node %s", id)
+	node.Consenter.Stop()
+}
+
+// Restart start a new consenter of the crashed node over its stack
+func (net *Network) Restart(id string) {
+	node := net.Node(id)
+	log.Infof("Simulator restart node %s", id)
+	net.start(node)
+}
+
+// Partition split the nodes into the groups, nodes of different groups are disconnected
+func (net *Network) Partition(groups ...[]string) {
+	net.Lock()
+	defer net.Unlock()
+	for _, node := range net.nodes {
+		node.group = 0
+	}
+	for i, group := range groups {
+		for _, id := range group {
+			for _, node := range net.nodes {
+				if node.ID == id {
+					node.group = i + 1
+				}
+			}
+		}
+	}
+	log.Infof("Simulator partition %v", groups)
+}
+
+// Heal reconnect all the nodes
+func (net *Network) Heal() {
+	net.Partition()
+}
+
+// SetByzantine rewrite the messages sent by the node
+func (net *Network) SetByzantine(id string, byzantine Byzantine) {
+	node := net.Node(id)
+	net.Lock()
+	node.byzantine = byzantine
+	net.Unlock()
+}
+
+// Run execute the steps in order on the virtual clock, the network must be started
+func (net *Network) Run(steps []Step) {
+	for _, step := range steps {
+		step := step
+		done := make(chan struct{})
+		net.Lock()
+		net.schedule(step.After, func() {
+			step.Do(net)
+			close(done)
+		})
+		net.Unlock()
+		<-done
+	}
+}
+
+// Honest returns the alive nodes without byzantine behavior
+func (net *Network) Honest() []*Node {
+	net.RLock()
+	defer net.RUnlock()
+	var nodes []*Node
+	for _, node := range net.nodes {
+		if !node.crashed && node.byzantine == nil {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// WaitCommitted wait until the pool is empty and the honest nodes written the same height
+func (net *Network) WaitCommitted(timeout time.Duration) error {
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if net.pool.Pending() > 0 {
+			continue
+		}
+		nodes := net.Honest()
+		height := nodes[0].Stack.Height()
+		synced := true
+		for _, node := range nodes[1:] {
+			if node.Stack.Height() != height {
+				synced = false
+				break
+			}
+		}
+		if synced {
+			return nil
+		}
+	}
+	var heights []string
+	for _, node := range net.Honest() {
+		heights = append(heights, fmt.Sprintf("%s:%d", node.ID, node.Stack.Height()))
+	}
+	return fmt.Errorf("timeout, seed %d, %d transactions pending, heights %v", net.options.Seed, net.pool.Pending(), heights)
+}
+
+// CheckSafety check that the honest nodes never written different blocks at the same height
+func (net *Network) CheckSafety() error {
+	nodes := net.Honest()
+	for _, node := range nodes {
+		node.Stack.Lock()
+		conflicts := node.Stack.Conflicts
+		node.Stack.Unlock()
+		if len(conflicts) > 0 {
+			return fmt.Errorf("seed %d, node %s written conflict block at height %d", net.options.Seed, node.ID, conflicts[0].Height)
+		}
+	}
+	for _, node := range nodes {
+		for height := uint32(1); height <= node.Stack.Height(); height++ {
+			block := node.Stack.Block(height)
+			for _, other := range nodes {
+				if b := other.Stack.Block(height); b != nil && b.Hash != block.Hash {
+					return fmt.Errorf("seed %d, node %s and %s written different blocks at height %d", net.options.Seed, node.ID, other.ID, height)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package simulator
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/core/consensus"
+	"github.com/bocheninc/L0/core/consensus/raft"
+	"github.com/bocheninc/L0/core/types"
+)
+
+func TestLinkSeed(t *testing.T) {
+	a, b := NewNetwork(NewDefaultOptions()), NewNetwork(NewDefaultOptions())
+	for i := 0; i < 10; i++ {
+		if x, y := a.link("a", "b").Int63(), b.link("a", "b").Int63(); x != y {
+			t.Fatalf("link decisions differ with the same seed, %d != %d", x, y)
+		}
+	}
+	if a.link("a", "b").Int63() == a.link("b", "a").Int63() {
+		t.Error("links share the random source")
+	}
+}
+
+func TestEventOrder(t *testing.T) {
+	net := NewNetwork(NewDefaultOptions())
+	net.Start()
+	defer net.Stop()
+
+	var order []int
+	done := make(chan struct{})
+	net.Lock()
+	for i, after := range []time.Duration{30, 10, 20, 10} {
+		i := i
+		net.schedule(after*time.Millisecond, func() { order = append(order, i) })
+	}
+	net.schedule(40*time.Millisecond, func() { close(done) })
+	net.Unlock()
+	<-done
+
+	if want := []int{1, 3, 2, 0}; fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("events run in order %v, want %v", order, want)
+	}
+	if clock := net.Clock(); clock < 40*time.Millisecond {
+		t.Errorf("clock is %v, want at least 40ms", clock)
+	}
+}
+
+func TestRaft(t *testing.T) {
+	options := NewDefaultOptions()
+	options.DropRate = 0.05
+	options.Validators = types.NewValidatorSet()
+	net := NewNetwork(options)
+	var peers []string
+	keys := make(map[string]*crypto.PrivateKey)
+	for _, nodeID := range []string{"a", "b", "c"} {
+		id := consensus.ReplicaID(options.Chain, nodeID)
+		key, _ := crypto.GenerateKey()
+		peers = append(peers, id)
+		keys[id] = key
+		options.Validators.Add(nodeID, key.Public().Bytes())
+	}
+	for _, id := range peers {
+		net.AddNode(id, func(id string, stack consensus.IStack) consensus.Consenter {
+			options := raft.NewDefaultOptions()
+			options.Chain = net.options.Chain
+			options.ID = id
+			options.Peers = peers
+			options.PrivateKey = keys[id]
+			options.BlockInterval = 20 * time.Millisecond
+			options.HeartbeatInterval = 20 * time.Millisecond
+			options.ElectionTimeout = 100 * time.Millisecond
+			return raft.NewRaft(options, stack)
+		})
+	}
+	net.Start()
+	defer net.Stop()
+
+	net.Pool().Submit(10)
+	if err := net.WaitCommitted(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	net.Run([]Step{
+		{Do: func(net *Network) { net.Crash(net.Honest()[0].ID) }},
+		{After: 50 * time.Millisecond, Do: func(net *Network) { net.Pool().Submit(10) }},
+	})
+	if err := net.WaitCommitted(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package simulator
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/core/accounts"
+	"github.com/bocheninc/L0/core/consensus"
+	"github.com/bocheninc/L0/core/coordinate"
+	"github.com/bocheninc/L0/core/types"
+)
+
+// Pool the transaction pool shared by all the nodes of the network
+type Pool struct {
+	sync.Mutex
+	chain     coordinate.ChainCoordinate
+	nonce     uint32
+	pending   []*types.Transaction
+	committed map[crypto.Hash]bool
+}
+
+func newPool(chain string) *Pool {
+	return &Pool{
+		chain:     coordinate.HexToChainCoordinate(chain),
+		committed: make(map[crypto.Hash]bool),
+	}
+}
+
+// Submit add n transactions of the local chain
+func (pool *Pool) Submit(n int) {
+	pool.Lock()
+	defer pool.Unlock()
+	for i := 0; i < n; i++ {
+		pool.nonce++
+		tx := types.NewTransaction(pool.chain, pool.chain, types.TypeAtomic, pool.nonce, accounts.Address{}, accounts.Address{}, big.NewInt(1), big.NewInt(0), pool.nonce)
+		pool.pending = append(pool.pending, tx)
+	}
+}
+
+// Pending returns the number of the transactions not committed
+func (pool *Pool) Pending() int {
+	pool.Lock()
+	defer pool.Unlock()
+	return len(pool.pending)
+}
+
+func (pool *Pool) fetch(size int) types.Transactions {
+	pool.Lock()
+	defer pool.Unlock()
+	if len(pool.pending) > size {
+		return append(types.Transactions{}, pool.pending[:size]...)
+	}
+	return append(types.Transactions{}, pool.pending...)
+}
+
+func (pool *Pool) commit(txs []*types.Transaction) {
+	pool.Lock()
+	defer pool.Unlock()
+	for _, tx := range txs {
+		pool.committed[tx.Hash()] = true
+	}
+	pending := pool.pending[:0]
+	for _, tx := range pool.pending {
+		if !pool.committed[tx.Hash()] {
+			pending = append(pending, tx)
+		}
+	}
+	pool.pending = pending
+}
+
+// Block the block written by the consenter
+type Block struct {
+	Height   uint32
+	Proposer string
+	Hash     crypto.Hash
+	Txs      []*types.Transaction
+}
+
+func newBlock(prev crypto.Hash, output *consensus.OutputTxs) *Block {
+	block := &Block{Height: output.Height, Proposer: output.Proposer}
+	buf := bytes.NewBuffer(prev.Bytes())
+	for _, ct := range output.Outputs {
+		if ct.Skip {
+			continue
+		}
+		for _, tx := range ct.Transactions {
+			block.Txs = append(block.Txs, tx)
+			buf.Write(tx.Hash().Bytes())
+		}
+	}
+	fmt.Fprintf(buf, "%d%s", block.Height, block.Proposer)
+	block.Hash = crypto.Sha256(buf.Bytes())
+	return block
+}
+
+// Stack the fake consensus.IStack of a node, it writes the committed outputs as blocks
+type Stack struct {
+	sync.Mutex
+	net         *Network
+	pool        *Pool
+	blocks      []*Block
+	checkpoints map[string][]byte
+	// Conflicts the blocks committed at a written height with different content
+	Conflicts []*Block
+	// Transfers the heights requested by state transfer
+	Transfers []uint32
+}
+
+// Height returns the height of the last written block
+func (stack *Stack) Height() uint32 {
+	stack.Lock()
+	defer stack.Unlock()
+	return uint32(len(stack.blocks))
+}
+
+// Block returns the written block at height
+func (stack *Stack) Block(height uint32) *Block {
+	stack.Lock()
+	defer stack.Unlock()
+	if height == 0 || int(height) > len(stack.blocks) {
+		return nil
+	}
+	return stack.blocks[height-1]
+}
+
+func (stack *Stack) write(output *consensus.OutputTxs) {
+	stack.Lock()
+	defer stack.Unlock()
+	height := uint32(len(stack.blocks))
+	if output.Height > height+1 {
+		return
+	}
+	var prev crypto.Hash
+	if output.Height > 1 {
+		prev = stack.blocks[output.Height-2].Hash
+	}
+	block := newBlock(prev, output)
+	if output.Height <= height {
+		if stack.blocks[output.Height-1].Hash != block.Hash {
+			stack.Conflicts = append(stack.Conflicts, block)
+		}
+		return
+	}
+	stack.blocks = append(stack.blocks, block)
+	stack.pool.commit(block.Txs)
+}
+
+// GetBlockchainInfo Implenment consensus.IStack
+func (stack *Stack) GetBlockchainInfo() *consensus.BlockchainInfo {
+	return &consensus.BlockchainInfo{Height: stack.Height()}
+}
+
+// GetValidatorSet Implenment consensus.IStack
+func (stack *Stack) GetValidatorSet(height uint32) (*types.ValidatorSet, error) {
+	if stack.net.options.Validators == nil {
+		return types.NewValidatorSet(), nil
+	}
+	return stack.net.options.Validators.Copy(), nil
+}
+
+// VerifyTxsInConsensus Implenment consensus.IStack
+func (stack *Stack) VerifyTxsInConsensus(txs []*types.Transaction, primary bool) bool {
+	return true
+}
+
+// FetchGroupingTxsInTxPool Implenment consensus.IStack
+func (stack *Stack) FetchGroupingTxsInTxPool(groupingNum, maxSizeInGrouping int) []types.Transactions {
+	txs := stack.pool.fetch(maxSizeInGrouping)
+	if len(txs) == 0 {
+		return nil
+	}
+	return []types.Transactions{txs, txs}
+}
+
+// GetBlockHashByHeight Implenment consensus.IStack
+func (stack *Stack) GetBlockHashByHeight(height uint32) (crypto.Hash, error) {
+	if block := stack.Block(height); block != nil {
+		return block.Hash, nil
+	}
+	return crypto.Hash{}, fmt.Errorf("not found block %d", height)
+}
+
+// PutCheckpoint Implenment consensus.IStack
+func (stack *Stack) PutCheckpoint(key string, data []byte) error {
+	stack.Lock()
+	defer stack.Unlock()
+	stack.checkpoints[key] = data
+	return nil
+}
+
+// GetCheckpoint Implenment consensus.IStack
+func (stack *Stack) GetCheckpoint(key string) ([]byte, error) {
+	stack.Lock()
+	defer stack.Unlock()
+	return stack.checkpoints[key], nil
+}
+
+// StateTransfer Implenment consensus.IStack, the blocks are copied from the node which has the block
+func (stack *Stack) StateTransfer(height uint32, blockHash crypto.Hash) {
+	stack.Lock()
+	stack.Transfers = append(stack.Transfers, height)
+	stack.Unlock()
+	for _, node := range stack.net.Nodes() {
+		if node.Stack == stack {
+			continue
+		}
+		if block := node.Stack.Block(height); block != nil && block.Hash == blockHash {
+			for h := stack.Height() + 1; h <= height; h++ {
+				b := node.Stack.Block(h)
+				stack.Lock()
+				stack.blocks = append(stack.blocks, b)
+				stack.Unlock()
+				stack.pool.commit(b.Txs)
+			}
+			return
+		}
+	}
+}
+
+// SyncBlocks Implenment consensus.IStack, the blocks are copied from the highest node
+func (stack *Stack) SyncBlocks() {
+	var highest *Stack
+	for _, node := range stack.net.Nodes() {
+		if highest == nil || node.Stack.Height() > highest.Height() {
+			highest = node.Stack
+		}
+	}
+	if height := highest.Height(); highest != stack && height > stack.Height() {
+		stack.StateTransfer(height, highest.Block(height).Hash)
+	}
+}
@@ -19,22 +19,33 @@
 package block_storage
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
 
 	"github.com/bocheninc/L0/components/crypto"
 	"github.com/bocheninc/L0/components/db"
 	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/accounts"
 	"github.com/bocheninc/L0/core/types"
 )
 
 const (
-	heightKey string = "blockLastHeight"
+	heightKey       string = "blockLastHeight"
+	prunedHeightKey string = "blockPrunedHeight"
+	baseHeightKey   string = "blockBaseHeight"
 )
 
+// ErrPruned is returned when the transactions of the block have been pruned
+var ErrPruned = errors.New("pruned, transactions of the block are not kept by the node")
+
 // Blockchain represents block
 type Blockchain struct {
 	dbHandler         *db.BlockchainDB
 	txPrefix          []byte
+	txBlockPrefix     []byte
+	txAddressPrefix   []byte
 	columnFamily      string
 	indexColumnFamily string
 }
@@ -44,6 +55,8 @@ func NewBlockchain(db *db.BlockchainDB) *Blockchain {
 	return &Blockchain{
 		dbHandler:         db,
 		txPrefix:          []byte("tx_"),
+		txBlockPrefix:     []byte("tb_"),
+		txAddressPrefix:   []byte("ta_"),
 		columnFamily:      "block",
 		indexColumnFamily: "index",
 	}
@@ -72,6 +85,9 @@ func (blockchain *Blockchain) GetBlockByHash(blockHash []byte) (*types.BlockHead
 
 //GetTransactionHashList get transaction hash list by block height
 func (blockchain *Blockchain) GetTransactionHashList(blockHeight uint32) ([]byte, error) {
+	if prunedHeight, ok := blockchain.GetPrunedHeight(); ok && blockHeight <= prunedHeight {
+		return nil, ErrPruned
+	}
 	txHashsBytes, err := blockchain.dbHandler.Get(blockchain.indexColumnFamily, prependKeyPrefix(blockchain.txPrefix, utils.Uint32ToBytes(blockHeight)))
 	if err != nil {
 		return nil, err
@@ -135,6 +151,11 @@ func (blockchain *Blockchain) GetTransactionByTxHash(txHash []byte) (*types.Tran
 	}
 
 	if len(txBytes) == 0 {
+		if height, err := blockchain.GetBlockHeightByTxHash(txHash); err == nil {
+			if prunedHeight, ok := blockchain.GetPrunedHeight(); ok && height <= prunedHeight {
+				return nil, ErrPruned
+			}
+		}
 		return nil, errors.New("not found transaction by txHash")
 	}
 
@@ -146,6 +167,24 @@ func (blockchain *Blockchain) GetTransactionByTxHash(txHash []byte) (*types.Tran
 	return tx, nil
 }
 
+// GetBlockHeightByTxHash gets the height of the block which contains the transaction
+func (blockchain *Blockchain) GetBlockHeightByTxHash(txHash []byte) (uint32, error) {
+	heightBytes, err := blockchain.dbHandler.Get(blockchain.indexColumnFamily, prependKeyPrefix(blockchain.txBlockPrefix, txHash))
+	if err != nil {
+		return 0, err
+	}
+
+	if len(heightBytes) == 0 {
+		return 0, errors.New("not found block by txHash")
+	}
+	return utils.BytesToUint32(heightBytes), nil
+}
+
+// UpdateBlockHeader rewrites the stored header of the block
+func (blockchain *Blockchain) UpdateBlockHeader(header *types.BlockHeader) error {
+	return blockchain.dbHandler.Put(blockchain.columnFamily, header.Hash().Bytes(), header.Serialize())
+}
+
 // GetBlockchainHeight gets blockchain height
 func (blockchain *Blockchain) GetBlockchainHeight() (uint32, error) {
 	heightBytes, _ := blockchain.dbHandler.Get(blockchain.indexColumnFamily, []byte(heightKey))
@@ -156,6 +195,127 @@ func (blockchain *Blockchain) GetBlockchainHeight() (uint32, error) {
 	return height, nil
 }
 
+// GetPrunedHeight returns the height up to which transactions are pruned, false if nothing is pruned
+func (blockchain *Blockchain) GetPrunedHeight() (uint32, bool) {
+	heightBytes, _ := blockchain.dbHandler.Get(blockchain.indexColumnFamily, []byte(prunedHeightKey))
+	if len(heightBytes) == 0 {
+		return 0, false
+	}
+	return utils.BytesToUint32(heightBytes), true
+}
+
+// GetBaseHeight returns the lowest height whose header is kept, it is above 0 if the node is bootstrapped from a snapshot
+func (blockchain *Blockchain) GetBaseHeight() uint32 {
+	heightBytes, _ := blockchain.dbHandler.Get(blockchain.indexColumnFamily, []byte(baseHeightKey))
+	if len(heightBytes) == 0 {
+		return 0
+	}
+	return utils.BytesToUint32(heightBytes)
+}
+
+// SnapshotHeaders returns the entries of the headers from height base to the last height in the snapshot,
+// a node importing them starts from the last height with transactions of all blocks pruned
+func (blockchain *Blockchain) SnapshotHeaders(snapshot *db.Snapshot, base uint32) (uint32, []*db.WriteBatch, error) {
+	var writeBatchs []*db.WriteBatch
+	heightBytes, err := snapshot.Get(blockchain.indexColumnFamily, []byte(heightKey))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(heightBytes) == 0 {
+		return 0, nil, errors.New("failed to get the height")
+	}
+	height := utils.BytesToUint32(heightBytes)
+	if base > height {
+		base = height
+	}
+
+	for h := base; h <= height; h++ {
+		blockHeightBytes := utils.Uint32ToBytes(h)
+		blockHashBytes, err := snapshot.Get(blockchain.indexColumnFamily, blockHeightBytes)
+		if err != nil {
+			return 0, nil, err
+		}
+		headerBytes, err := snapshot.Get(blockchain.columnFamily, blockHashBytes)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(blockHashBytes) == 0 || len(headerBytes) == 0 {
+			return 0, nil, errors.New("not found block")
+		}
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(blockchain.columnFamily, db.OperationPut, blockHashBytes, headerBytes))           // block hash => block
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(blockchain.indexColumnFamily, db.OperationPut, blockHeightBytes, blockHashBytes)) // height => block hash
+	}
+	writeBatchs = append(writeBatchs, db.NewWriteBatch(blockchain.indexColumnFamily, db.OperationPut, []byte(heightKey), heightBytes))                   // update block height
+	writeBatchs = append(writeBatchs, db.NewWriteBatch(blockchain.indexColumnFamily, db.OperationPut, []byte(prunedHeightKey), heightBytes))             // transactions are not in snapshot
+	writeBatchs = append(writeBatchs, db.NewWriteBatch(blockchain.indexColumnFamily, db.OperationPut, []byte(baseHeightKey), utils.Uint32ToBytes(base))) // headers below are not in snapshot
+
+	return height, writeBatchs, nil
+}
+
+// CheckSnapshotIndex checks that the index entries of a snapshot are the ones written by SnapshotHeaders
+// for the headers of hashs, which are the chain from height base to height
+func CheckSnapshotIndex(entries map[string][]byte, base, height uint32, hashs map[uint32][]byte) error {
+	for key, value := range entries {
+		switch key {
+		case heightKey, prunedHeightKey:
+			if len(value) != 4 || utils.BytesToUint32(value) != height {
+				return fmt.Errorf("snapshot index %s mismatch the height %d", key, height)
+			}
+		case baseHeightKey:
+			if len(value) != 4 || utils.BytesToUint32(value) != base {
+				return fmt.Errorf("snapshot index %s mismatch the height %d", key, base)
+			}
+		default:
+			if len(key) != 4 {
+				return fmt.Errorf("unexpected snapshot index %x", key)
+			}
+			if hash, ok := hashs[utils.BytesToUint32([]byte(key))]; !ok || !bytes.Equal(hash, value) {
+				return fmt.Errorf("snapshot index of height %d mismatch the headers", utils.BytesToUint32([]byte(key)))
+			}
+		}
+	}
+	if len(entries) != len(hashs)+3 {
+		return errors.New("snapshot index mismatch the headers")
+	}
+	return nil
+}
+
+// PruneBlock deletes the transaction bodies, the transaction list and the address index of the block, the header is kept
+func (blockchain *Blockchain) PruneBlock(blockHeight uint32) ([]*db.WriteBatch, error) {
+	var writeBatchs []*db.WriteBatch
+	blockHeightBytes := utils.Uint32ToBytes(blockHeight)
+
+	txHashsBytes, err := blockchain.dbHandler.Get(blockchain.indexColumnFamily, prependKeyPrefix(blockchain.txPrefix, blockHeightBytes))
+	if err != nil {
+		return nil, err
+	}
+	txHashs := []crypto.Hash{}
+	if len(txHashsBytes) > 0 {
+		utils.Deserialize(txHashsBytes, &txHashs)
+	}
+
+	for i, txHash := range txHashs {
+		txBytes, err := blockchain.dbHandler.Get(blockchain.columnFamily, txHash.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if len(txBytes) > 0 {
+			tx := new(types.Transaction)
+			if err := tx.Deserialize(txBytes); err != nil {
+				return nil, err
+			}
+			for _, key := range blockchain.addressIndexKeys(blockHeight, i, tx) {
+				writeBatchs = append(writeBatchs, db.NewWriteBatch(blockchain.indexColumnFamily, db.OperationDelete, key, nil)) // prefix + address + blockheight + tx index => tx hash
+			}
+		}
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(blockchain.columnFamily, db.OperationDelete, txHash.Bytes(), nil)) // tx hash => tx detail
+	}
+	writeBatchs = append(writeBatchs, db.NewWriteBatch(blockchain.indexColumnFamily, db.OperationDelete, prependKeyPrefix(blockchain.txPrefix, blockHeightBytes), nil)) // prefix + blockheight  => all tx hash
+	writeBatchs = append(writeBatchs, db.NewWriteBatch(blockchain.indexColumnFamily, db.OperationPut, []byte(prunedHeightKey), blockHeightBytes))                       // update pruned height
+
+	return writeBatchs, nil
+}
+
 // AppendBlock appends a block
 func (blockchain *Blockchain) AppendBlock(block *types.Block) []*db.WriteBatch {
 	blockHashBytes := block.Hash().Bytes()
@@ -174,10 +334,12 @@ func (blockchain *Blockchain) AppendBlock(block *types.Block) []*db.WriteBatch {
 	//storage  tx hash
 	for _, tx := range block.Transactions {
 		txHashs = append(txHashs, tx.Hash())
-		writeBatchs = append(writeBatchs, db.NewWriteBatch(blockchain.columnFamily, db.OperationPut, tx.Hash().Bytes(), tx.Serialize())) // tx hash => tx detail
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(blockchain.columnFamily, db.OperationPut, tx.Hash().Bytes(), tx.Serialize()))                                                    // tx hash => tx detail
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(blockchain.indexColumnFamily, db.OperationPut, prependKeyPrefix(blockchain.txBlockPrefix, tx.Hash().Bytes()), blockHeightBytes)) // prefix + tx hash => block height
 
 	}
 	writeBatchs = append(writeBatchs, db.NewWriteBatch(blockchain.indexColumnFamily, db.OperationPut, prependKeyPrefix(blockchain.txPrefix, blockHeightBytes), utils.Serialize(txHashs))) // prefix + blockheight  => all tx hash
+	writeBatchs = append(writeBatchs, blockchain.AddressIndex(block.Height(), block.Transactions)...)                                                                                      // prefix + address + blockheight + tx index => tx hash
 
 	return writeBatchs
 }
@@ -203,6 +365,73 @@ func (blockchain *Blockchain) GetBlockHashByNumber(blockNum uint32) ([]byte, err
 	return blockHashBytes, nil
 }
 
+// AddressIndex returns the index of the transactions in the block by sender and recipient
+func (blockchain *Blockchain) AddressIndex(blockHeight uint32, txs types.Transactions) []*db.WriteBatch {
+	var writeBatchs []*db.WriteBatch
+	for i, tx := range txs {
+		for _, key := range blockchain.addressIndexKeys(blockHeight, i, tx) {
+			writeBatchs = append(writeBatchs, db.NewWriteBatch(blockchain.indexColumnFamily, db.OperationPut, key, tx.Hash().Bytes()))
+		}
+	}
+	return writeBatchs
+}
+
+// TxPosition the position of the transaction in the chain, the cursor of the address index
+type TxPosition struct {
+	Height uint32 `json:"height"`
+	Index  uint32 `json:"index"`
+}
+
+func (position *TxPosition) bytes() []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint32(buf, position.Height)
+	binary.BigEndian.PutUint32(buf[4:], position.Index)
+	return buf
+}
+
+// addressIndexKeys returns the address index keys of the i-th transaction in the block
+func (blockchain *Blockchain) addressIndexKeys(blockHeight uint32, i int, tx *types.Transaction) [][]byte {
+	position := (&TxPosition{Height: blockHeight, Index: uint32(i)}).bytes()
+
+	addrs := []accounts.Address{tx.Sender()}
+	if !tx.Recipient().Equal(tx.Sender()) {
+		addrs = append(addrs, tx.Recipient())
+	}
+	var keys [][]byte
+	for _, addr := range addrs {
+		keys = append(keys, prependKeyPrefix(prependKeyPrefix(blockchain.txAddressPrefix, addr.Bytes()), position))
+	}
+	return keys
+}
+
+// GetTxHashsByAddress returns the hashs of transactions sent or received by the address before the position, newest first,
+// and the position of the last returned transaction as the cursor of the next page, nil if there are no more transactions
+func (blockchain *Blockchain) GetTxHashsByAddress(addr accounts.Address, before *TxPosition, limit uint32) ([]crypto.Hash, *TxPosition) {
+	var (
+		txHashs []crypto.Hash
+		next    *TxPosition
+		last    []byte
+	)
+	if limit == 0 {
+		return txHashs, nil
+	}
+	prefix := prependKeyPrefix(blockchain.txAddressPrefix, addr.Bytes())
+	var from []byte
+	if before != nil {
+		from = prependKeyPrefix(prefix, before.bytes())
+	}
+	blockchain.dbHandler.IteratePrefixFrom(blockchain.indexColumnFamily, prefix, from, true, func(key, value []byte) bool {
+		if uint32(len(txHashs)) == limit {
+			next = &TxPosition{Height: binary.BigEndian.Uint32(last), Index: binary.BigEndian.Uint32(last[4:])}
+			return false
+		}
+		txHashs = append(txHashs, crypto.NewHash(value))
+		last = key[len(prefix):]
+		return true
+	})
+	return txHashs, next
+}
+
 func (blockchain *Blockchain) getTransactionsByHashList(txHashs []crypto.Hash, transactionType uint32) (types.Transactions, error) {
 	var (
 		txs types.Transactions
@@ -44,6 +44,7 @@ type ISmartConstract interface {
 	GetBalances(addr string) (*big.Int, error)
 	CurrentBlockHeight() uint32
 	AddTransfer(fromAddr, toAddr string, amount *big.Int, txType uint32)
+	AddEvent(name string, data []byte)
 	SmartContractFailed()
 	SmartContractCommitted()
 }
@@ -61,6 +62,7 @@ type SmartConstract struct {
 	committed        bool
 	currentTx        *types.Transaction
 	smartContractTxs types.Transactions
+	events           []*types.Event
 }
 
 // NewSmartConstract returns a new State
@@ -100,6 +102,7 @@ func (sctx *SmartConstract) ExecTransaction(tx *types.Transaction, scAddr string
 	sctx.currentTx = tx
 	sctx.scAddr = scAddr
 	sctx.smartContractTxs = make(types.Transactions, 0)
+	sctx.events = nil
 }
 
 // GetState get value
@@ -177,6 +180,13 @@ func (sctx *SmartConstract) AddTransfer(fromAddr, toAddr string, amount *big.Int
 	sctx.smartContractTxs = append(sctx.smartContractTxs, tx)
 }
 
+// AddEvent add event emitted by the contract
+func (sctx *SmartConstract) AddEvent(name string, data []byte) {
+	event := &types.Event{TxHash: sctx.currentTx.Hash(), Name: name, Data: data}
+	event.ContractAddr.SetBytes([]byte(sctx.scAddr))
+	sctx.events = append(sctx.events, event)
+}
+
 // InProgress
 func (sctx *SmartConstract) InProgress() bool {
 	return true
@@ -191,6 +201,15 @@ func (sctx *SmartConstract) FinishContractTransaction() (types.Transactions, err
 	return sctx.smartContractTxs, nil
 }
 
+// Events returns events emitted by the committed contract transaction
+func (sctx *SmartConstract) Events() []*types.Event {
+	if !sctx.committed {
+		return nil
+	}
+
+	return sctx.events
+}
+
 // AddChangesForPersistence put cache data into db
 func (sctx *SmartConstract) AddChangesForPersistence(writeBatch []*db.WriteBatch) ([]*db.WriteBatch, error) {
 	updateContractStateDelta := sctx.stateExtra.getUpdatedContractStateDelta()
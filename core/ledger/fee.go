@@ -0,0 +1,105 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package ledger
+
+import (
+	"math/big"
+
+	"github.com/bocheninc/L0/components/db"
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/core/accounts"
+	"github.com/bocheninc/L0/core/ledger/state"
+	"github.com/bocheninc/L0/core/params"
+)
+
+//feeCredit is a fee collected by the recipient in the block being appended
+type feeCredit struct {
+	recipient accounts.Address
+	amount    *big.Int
+}
+
+//loadFeeAccount loads the fee account of the chain stored with the genesis block, the configured one only takes
+//effect when the genesis block is generated
+func (ledger *Ledger) loadFeeAccount() {
+	ledger.feeAccount = nil
+	if data, err := ledger.dbHandler.Get("index", []byte(feeAccountKey)); err == nil && len(data) == accounts.AddressLength {
+		addr := accounts.NewAddress(data)
+		ledger.feeAccount = &addr
+	}
+	if params.FeeAccount != "" && (ledger.feeAccount == nil || !ledger.feeAccount.Equal(accounts.HexToAddress(params.FeeAccount))) {
+		log.Warnf("blockchain.feeAccount %s is ignored, it is not the fee account of the chain", params.FeeAccount)
+	}
+}
+
+//feeRecipients returns the accounts which receive the transaction fees, the fee account of the chain if it is set
+//or else the validators of the block being appended, the fees are burnt if it is empty
+func (ledger *Ledger) feeRecipients() ([]accounts.Address, error) {
+	if ledger.feeAccount != nil {
+		return []accounts.Address{*ledger.feeAccount}, nil
+	}
+	height, err := ledger.Height()
+	if err != nil {
+		return nil, err
+	}
+	vs, err := ledger.ValidatorSet(height + 1)
+	if err != nil {
+		return nil, err
+	}
+	return vs.Addresses(), nil
+}
+
+//collectFees credits the fees of the committed transactions evenly to the fee recipients, the remainder goes to the first one
+func (ledger *Ledger) collectFees(writeBatchs []*db.WriteBatch, fees *big.Int) ([]*db.WriteBatch, error) {
+	recipients, err := ledger.feeRecipients()
+	if err != nil {
+		return nil, err
+	}
+	if fees.Sign() <= 0 || len(recipients) == 0 {
+		return writeBatchs, nil
+	}
+
+	share, remainder := new(big.Int).DivMod(fees, big.NewInt(int64(len(recipients))), new(big.Int))
+	for i, recipient := range recipients {
+		amount := new(big.Int).Set(share)
+		if i == 0 {
+			amount.Add(amount, remainder)
+		}
+		if amount.Sign() == 0 {
+			continue
+		}
+		feeWriteBatchs, err := ledger.state.UpdateBalance(recipient, state.NewBalance(amount, 0), big.NewInt(0), state.OperationPlus)
+		if err != nil {
+			return nil, err
+		}
+		writeBatchs = append(writeBatchs, feeWriteBatchs...)
+		ledger.feeCredits = append(ledger.feeCredits, &feeCredit{recipient, amount})
+	}
+	return writeBatchs, nil
+}
+
+//creditFees adds the fees collected by the block to the balances of the txpool, it is called once the block is written
+//as the txpool would otherwise accept transactions paid by fees which are never committed
+func (ledger *Ledger) creditFees() {
+	if ledger.Validator != nil {
+		for _, c := range ledger.feeCredits {
+			ledger.Validator.AddBalance(c.recipient, c.amount)
+		}
+	}
+	ledger.feeCredits = nil
+}
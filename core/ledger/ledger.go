@@ -21,6 +21,9 @@ package ledger
 import (
 	"fmt"
 	"math/big"
+	"sort"
+	"strings"
+	"sync"
 
 	"bytes"
 
@@ -41,35 +44,72 @@ import (
 	"github.com/bocheninc/L0/vm"
 )
 
+const (
+	checkpointKey         = "consensusCheckpoint"
+	formatKey             = "ledgerFormat"
+	feeAccountKey         = "feeAccount"
+	validatorColumnFamily = "validator"
+	// ledgerFormat is the version of the stored data, the format 1 encodes the valid until of the transactions and
+	// binds the network id into their signatures, the ledgers of the former format need a fresh chain
+	ledgerFormat uint32 = 1
+)
+
 var (
 	ledgerInstance *Ledger
+	// maxCachedValidatorSets limits the validator sets cached by height
+	maxCachedValidatorSets = 128
 )
 
 type ValidatorHandler interface {
 	UpdateAccount(tx *types.Transaction)
 	RollBackAccount(tx *types.Transaction)
+	AddBalance(addr accounts.Address, amount *big.Int)
 }
 
 // Ledger represents the ledger in blockchain
 type Ledger struct {
+	dbHandler *db.BlockchainDB
 	block     *block_storage.Blockchain
 	state     *state.State
 	storage   *merge.Storage
 	contract  *contract.SmartConstract
+	receipts  *blockReceipts
+	pruneCh   chan struct{}
 	Validator ValidatorHandler
+	// validators caches the validator changes and sets, it is reset when the blocks change
+	validators *validatorCache
+	// feeAccount is the fee account of the chain stored with the genesis block, nil if the fees go to the validators
+	feeAccount *accounts.Address
+	// feeCredits are the fees collected by the block being appended, credited to the txpool once it is written
+	feeCredits []*feeCredit
+}
+
+type validatorChangeRecord struct {
+	hash   crypto.Hash
+	change *types.ValidatorChange
+}
+
+//validatorCache keeps the validator changes of the ledger in the order they apply and the validator sets built from them
+type validatorCache struct {
+	sync.Mutex
+	loaded  bool
+	genesis string
+	changes []*validatorChangeRecord
+	sets    map[uint32]*types.ValidatorSet
+}
+
+func (c *validatorCache) reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.loaded = false
 }
 
 // NewLedger returns the ledger instance
 func NewLedger(db *db.BlockchainDB) *Ledger {
 	if ledgerInstance == nil {
-		ledgerInstance = &Ledger{
-			block:   block_storage.NewBlockchain(db),
-			state:   state.NewState(db),
-			storage: merge.NewStorage(db),
-		}
-		_, err := ledgerInstance.Height()
-		if err != nil {
-			ledgerInstance.init()
+		ledgerInstance = newLedger(db)
+		if params.Pruning > 0 {
+			ledgerInstance.startPruning(params.Pruning)
 		}
 	}
 
@@ -77,6 +117,29 @@ func NewLedger(db *db.BlockchainDB) *Ledger {
 	return ledgerInstance
 }
 
+func newLedger(db *db.BlockchainDB) *Ledger {
+	ledger := &Ledger{
+		dbHandler:  db,
+		block:      block_storage.NewBlockchain(db),
+		state:      state.NewState(db),
+		storage:    merge.NewStorage(db),
+		validators: &validatorCache{},
+	}
+	_, err := ledger.Height()
+	if err != nil {
+		ledger.init()
+	} else if err := ledger.checkFormat(); err != nil {
+		panic(err)
+	}
+	params.GenesisHash = ledger.GetGenesisBlock().Hash().Bytes()
+	ledger.loadFeeAccount()
+	if err := ledger.loadStateTree(); err != nil {
+		panic(err)
+	}
+	ledger.contract = contract.NewSmartConstract(db, ledger)
+	return ledger
+}
+
 // VerifyChain verifys the blockchain data
 func (ledger *Ledger) VerifyChain() {
 	height, err := ledger.Height()
@@ -84,7 +147,8 @@ func (ledger *Ledger) VerifyChain() {
 		panic(err)
 	}
 	currentBlockHeader, err := ledger.block.GetBlockByNumber(height)
-	for i := height; i >= 1; i-- {
+	base := ledger.block.GetBaseHeight()
+	for i := height; i >= 1 && i > base; i-- {
 		previousBlockHeader, err := ledger.block.GetBlockByNumber(i - 1) // storage
 		if previousBlockHeader != nil && err != nil {
 
@@ -115,33 +179,62 @@ func (ledger *Ledger) AppendBlock(block *types.Block, flag bool) error {
 		err           error
 		txWriteBatchs []*db.WriteBatch
 		txs           types.Transactions
+		committed     bool
 	)
 
 	t := time.Now()
 	bh, _ := ledger.Height()
 	ledger.contract.StartConstract(bh)
+	//the balances and the contract state of a block failing to be written must not leak into the next one
+	defer func() {
+		if !committed {
+			ledger.state.ClearTmpBalance()
+			ledger.contract.StopContract(bh)
+			ledger.feeCredits = nil
+		}
+	}()
 
 	txWriteBatchs, block.Transactions, err = ledger.executeTransaction(block.Transactions, flag)
 	if err != nil {
 		return err
 	}
 
+	txWriteBatchs = append(txWriteBatchs, ledger.validatorChanges(block)...)
+	stateHash, stateTreeWriteBatchs := ledger.stateHash(txWriteBatchs)
+	if !flag && !block.Header.StateHash.Equal(stateHash) {
+		log.Errorf("block %d state hash %s, local state hash %s", block.Height(), block.Header.StateHash, stateHash)
+		return ErrStateHashMismatch
+	}
+
 	block.Header.TxsMerkleHash = merkleRootHash(block.Transactions)
+	block.Header.StateHash = stateHash
 	writeBatchs := ledger.block.AppendBlock(block)
 	writeBatchs = append(writeBatchs, txWriteBatchs...)
+	writeBatchs = append(writeBatchs, stateTreeWriteBatchs...)
+	writeBatchs = append(writeBatchs, ledger.receipts.writeBatchs(block.Height())...)
+	historyWriteBatchs, err := ledger.state.HistoryWriteBatchs(block.Height(), params.BalanceHistory)
+	if err != nil {
+		return err
+	}
+	writeBatchs = append(writeBatchs, historyWriteBatchs...)
+	undoWriteBatchs, err := ledger.undoWriteBatchs(block.Height(), writeBatchs)
+	if err != nil {
+		return err
+	}
+	writeBatchs = append(writeBatchs, undoWriteBatchs...)
 
 	if err := ledger.state.AtomicWrite(writeBatchs); err != nil {
-		return nil
+		return err
 	}
+	committed = true
+	ledger.creditFees()
+	ledger.validators.reset()
 	delay := time.Since(t)
 	ledger.contract.StopContract(bh)
+	ledger.notifyPruning()
 	log.Infoln("append block delay :", delay, " transactions : ", len(block.Transactions))
 
-	for _, tx := range block.Transactions {
-		if (tx.GetType() == types.TypeMerged && !ledger.checkCoordinate(tx)) || tx.GetType() == types.TypeAcrossChain {
-			txs = append(txs, tx)
-		}
-	}
+	txs = ledger.mergeTransactions(block.Transactions)
 	if err := ledger.storage.ClassifiedTransaction(txs); err != nil {
 		return err
 	}
@@ -223,11 +316,193 @@ func (ledger *Ledger) GetTxByTxHash(txHashBytes []byte) (*types.Transaction, err
 	return ledger.block.GetTransactionByTxHash(txHashBytes)
 }
 
+//GetBlockHeightByTxHash returns the height of the block which contains the transaction
+func (ledger *Ledger) GetBlockHeightByTxHash(txHash crypto.Hash) (uint32, error) {
+	return ledger.block.GetBlockHeightByTxHash(txHash.Bytes())
+}
+
+//GetTxsByAddress returns transactions sent or received by the address before the position, newest first,
+//and the cursor of the next page, pruned transactions are skipped
+func (ledger *Ledger) GetTxsByAddress(addr accounts.Address, before *block_storage.TxPosition, limit uint32) (types.Transactions, *block_storage.TxPosition, error) {
+	txs := make(types.Transactions, 0)
+	txHashs, next := ledger.block.GetTxHashsByAddress(addr, before, limit)
+	for _, txHash := range txHashs {
+		tx, err := ledger.block.GetTransactionByTxHash(txHash.Bytes())
+		if err == ErrPruned {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, next, nil
+}
+
+//ReindexAddressTxs rebuilds the address index of transactions for all blocks
+func (ledger *Ledger) ReindexAddressTxs() error {
+	height, err := ledger.Height()
+	if err != nil {
+		return err
+	}
+	from := uint32(1)
+	if prunedHeight, ok := ledger.block.GetPrunedHeight(); ok {
+		from = prunedHeight + 1
+	}
+	for i := from; i <= height; i++ {
+		txs, err := ledger.block.GetTransactionsByNumber(i, uint32(100))
+		if err != nil {
+			return err
+		}
+		if err := ledger.dbHandler.AtomicWrite(ledger.block.AddressIndex(i, txs)); err != nil {
+			return err
+		}
+		if i%10000 == 0 {
+			log.Infof("reindex address txs, height: %d/%d", i, height)
+		}
+	}
+	return nil
+}
+
+//GetValidatorChanges returns the validator changes by transaction hash
+func (ledger *Ledger) GetValidatorChanges() (map[crypto.Hash]*types.ValidatorChange, error) {
+	changes := make(map[crypto.Hash]*types.ValidatorChange)
+	var err error
+	ledger.dbHandler.Iterate(validatorColumnFamily, func(key, value []byte) {
+		vc := new(types.ValidatorChange)
+		if e := vc.Deserialize(value); e != nil {
+			err = e
+			return
+		}
+		changes[crypto.NewHash(key)] = vc
+	})
+	return changes, err
+}
+
+//ValidatorSet returns the validators of the block at height, the genesis validators with the validator changes taking effect up to height,
+//the sets are cached until the blocks change
+func (ledger *Ledger) ValidatorSet(height uint32) (*types.ValidatorSet, error) {
+	c := ledger.validators
+	c.Lock()
+	defer c.Unlock()
+	if genesis := strings.Join(params.Validators, ","); !c.loaded || c.genesis != genesis {
+		changes, err := ledger.GetValidatorChanges()
+		if err != nil {
+			return nil, err
+		}
+		c.changes = make([]*validatorChangeRecord, 0, len(changes))
+		for hash, change := range changes {
+			c.changes = append(c.changes, &validatorChangeRecord{hash: hash, change: change})
+		}
+		sort.Slice(c.changes, func(i, j int) bool {
+			if c.changes[i].change.Height != c.changes[j].change.Height {
+				return c.changes[i].change.Height < c.changes[j].change.Height
+			}
+			return bytes.Compare(c.changes[i].hash.Bytes(), c.changes[j].hash.Bytes()) < 0
+		})
+		c.loaded, c.genesis, c.sets = true, genesis, make(map[uint32]*types.ValidatorSet)
+	}
+	if vs, ok := c.sets[height]; ok {
+		return vs.Copy(), nil
+	}
+
+	vs, err := types.GenesisValidatorSet()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range c.changes {
+		if record.change.Height > height {
+			break
+		}
+		if err := vs.Apply(record.change.NodeID, record.change); err != nil {
+			log.Warnf("ignore validator change %s at height %d, err %v", record.hash, record.change.Height, err)
+		}
+	}
+	if len(c.sets) >= maxCachedValidatorSets {
+		c.sets = make(map[uint32]*types.ValidatorSet)
+	}
+	c.sets[height] = vs
+	return vs.Copy(), nil
+}
+
+//mergeTransactions returns the transactions kept in the merge storage until they are merged
+func (ledger *Ledger) mergeTransactions(txs types.Transactions) types.Transactions {
+	var mergeTxs types.Transactions
+	for _, tx := range txs {
+		if (tx.GetType() == types.TypeMerged && !ledger.checkCoordinate(tx)) || tx.GetType() == types.TypeAcrossChain {
+			mergeTxs = append(mergeTxs, tx)
+		}
+	}
+	return mergeTxs
+}
+
+//validatorChanges records the validator changes of the block which take effect after it
+func (ledger *Ledger) validatorChanges(block *types.Block) []*db.WriteBatch {
+	var writeBatchs []*db.WriteBatch
+	for _, tx := range block.Transactions {
+		if tx.GetType() != types.TypeValidatorChange {
+			continue
+		}
+		vc, err := types.ValidatorChangeOf(tx)
+		if err != nil || vc.Height <= block.Height() {
+			log.Errorf("ignore validator change tx %s at height %d, height %v, err %v", tx.Hash(), block.Height(), vc, err)
+			continue
+		}
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(validatorColumnFamily, db.OperationPut, tx.Hash().Bytes(), vc.Serialize()))
+	}
+	return writeBatchs
+}
+
+//PutConsensusCheckpoint persists the state of the consenter, each consenter uses its own key
+func (ledger *Ledger) PutConsensusCheckpoint(key string, data []byte) error {
+	return ledger.dbHandler.Put("index", []byte(checkpointKey+"."+key), data)
+}
+
+//GetConsensusCheckpoint returns the state of the consenter persisted under key
+func (ledger *Ledger) GetConsensusCheckpoint(key string) ([]byte, error) {
+	return ledger.dbHandler.Get("index", []byte(checkpointKey+"."+key))
+}
+
+//AppendBlockSignature appends the validator signature to the stored block header, returns false if it already exists
+func (ledger *Ledger) AppendBlockSignature(blockHash crypto.Hash, sig crypto.Signature) (bool, error) {
+	header, err := ledger.block.GetBlockByHash(blockHash.Bytes())
+	if err != nil {
+		return false, err
+	}
+
+	for _, s := range header.Signatures {
+		if s == sig {
+			return false, nil
+		}
+	}
+	header.Signatures = append(header.Signatures, sig)
+
+	if err := ledger.block.UpdateBlockHeader(header); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // GetBalance returns balance by account
 func (ledger *Ledger) GetBalance(addr accounts.Address) (*big.Int, uint32, error) {
 	return ledger.state.GetBalance(addr)
 }
 
+//GetBalanceAt returns the balance and nonce of the account at the end of the block height
+func (ledger *Ledger) GetBalanceAt(addr accounts.Address, height uint32) (*big.Int, uint32, error) {
+	currentHeight, err := ledger.Height()
+	if err != nil {
+		return nil, 0, err
+	}
+	if height > currentHeight {
+		return nil, 0, fmt.Errorf("exceeds the max height %d", currentHeight)
+	}
+	if params.BalanceHistory > 0 && currentHeight > params.BalanceHistory && height < currentHeight-params.BalanceHistory {
+		return nil, 0, state.ErrHistoryNotFound
+	}
+	return ledger.state.GetBalanceAt(addr, height)
+}
+
 //GetMergedTransaction returns merged transaction within a specified period of time
 func (ledger *Ledger) GetMergedTransaction(duration uint32) (types.Transactions, error) {
 
@@ -275,20 +550,42 @@ func (ledger *Ledger) QueryContract(tx *types.Transaction) ([]byte, error) {
 	return result, nil
 }
 
-// init generates the genesis block
+// init generates the genesis block, it commits the network id, the chain id, the genesis validators and the fee
+// account in place of the transactions, so the networks differing in any of them have different genesis blocks
 func (ledger *Ledger) init() error {
 	blockHeader := new(types.BlockHeader)
 	blockHeader.TimeStamp = uint32(0)
 	blockHeader.Nonce = uint32(100)
 	blockHeader.Height = 0
+	var feeAccount []byte
+	if params.FeeAccount != "" {
+		feeAccount = accounts.HexToAddress(params.FeeAccount).Bytes()
+	}
+	blockHeader.TxsMerkleHash = crypto.Sha256([]byte(params.NetworkID + "|" + params.ChainID.String() + "|" + strings.Join(params.Validators, ",") + "|" + utils.BytesToHex(feeAccount)))
 
 	genesisBlock := new(types.Block)
 	genesisBlock.Header = blockHeader
 	writeBatchs := ledger.block.AppendBlock(genesisBlock)
+	writeBatchs = append(writeBatchs, db.NewWriteBatch("index", db.OperationPut, []byte(formatKey), utils.Uint32ToBytes(ledgerFormat)))
+	if feeAccount != nil {
+		writeBatchs = append(writeBatchs, db.NewWriteBatch("index", db.OperationPut, []byte(feeAccountKey), feeAccount))
+	}
 
 	return ledger.state.AtomicWrite(writeBatchs)
 }
 
+//checkFormat checks the ledger is stored in the current format, the ledgers of a former format can't be upgraded
+func (ledger *Ledger) checkFormat() error {
+	format, err := ledger.dbHandler.Get("index", []byte(formatKey))
+	if err != nil {
+		return err
+	}
+	if len(format) != 4 || utils.BytesToUint32(format) != ledgerFormat {
+		return fmt.Errorf("ledger format %x mismatch %d, the chain must be started in a new data directory", format, ledgerFormat)
+	}
+	return nil
+}
+
 func (ledger *Ledger) executeTransaction(Txs types.Transactions, flag bool) ([]*db.WriteBatch, types.Transactions, error) {
 
 	var (
@@ -297,7 +594,13 @@ func (ledger *Ledger) executeTransaction(Txs types.Transactions, flag bool) ([]*
 		syncContractGenTxs                                types.Transactions
 	)
 
+	ledger.receipts = newBlockReceipts()
+	ledger.feeCredits = nil
+	ledger.state.TakeFees()
+	fees := new(big.Int)
 	for _, tx := range Txs {
+		//fees of the batches committed so far
+		fees.Add(fees, ledger.state.TakeFees())
 		//execute contract transaction
 		if tx.GetType() == types.TypeJSContractInit || tx.GetType() == types.TypeLuaContractInit || tx.GetType() == types.TypeContractInvoke {
 			//execute transfer
@@ -313,9 +616,18 @@ func (ledger *Ledger) executeTransaction(Txs types.Transactions, flag bool) ([]*
 					ledger.Validator.RollBackAccount(tx)
 				}
 				log.Errorf("execute Contract Tx hash: %s ,err: %v", tx.Hash(), err)
+				ledger.receipts.fail(tx, err)
+				//the batch is dropped, so is its fee
+				ledger.state.TakeFees()
 				continue
 			}
 
+			receipt := ledger.receipts.get(tx)
+			for _, v := range txs {
+				receipt.ContractTxs = append(receipt.ContractTxs, v.Hash())
+			}
+			receipt.Events = ledger.contract.Events()
+
 			if len(txs) != 0 && !flag {
 				syncContractGenTxs = append(syncContractGenTxs, txs...)
 			}
@@ -359,6 +671,11 @@ func (ledger *Ledger) executeTransaction(Txs types.Transactions, flag bool) ([]*
 		}
 	}
 
+	writeBatchs, err = ledger.collectFees(writeBatchs, fees.Add(fees, ledger.state.TakeFees()))
+	if err != nil {
+		return nil, nil, err
+	}
+
 	writeBatchs, err = ledger.contract.AddChangesForPersistence(writeBatchs)
 	if err != nil {
 		return nil, nil, err
@@ -369,6 +686,7 @@ func (ledger *Ledger) executeTransaction(Txs types.Transactions, flag bool) ([]*
 
 func (ledger *Ledger) commitedTranaction(tx *types.Transaction, writeBatchs []*db.WriteBatch) ([]*db.WriteBatch, error) {
 	var err error
+	ledger.receipts.get(tx)
 	switch tx.GetType() {
 	case types.TypeIssue:
 		if writeBatchs, err = ledger.executeIssueTx(writeBatchs, tx); err != nil {
@@ -395,6 +713,10 @@ func (ledger *Ledger) commitedTranaction(tx *types.Transaction, writeBatchs []*d
 		if writeBatchs, err = ledger.executeDistriTx(writeBatchs, tx); err != nil {
 			return nil, err
 		}
+	case types.TypeValidatorChange:
+		if writeBatchs, err = ledger.executeAtomicTx(writeBatchs, tx); err != nil {
+			return nil, err
+		}
 	}
 
 	return writeBatchs, err
@@ -417,6 +739,7 @@ func (ledger *Ledger) executeAtomicTx(writeBatchs []*db.WriteBatch, tx *types.Tr
 	if err != nil {
 		if err == state.ErrNegativeBalance {
 			log.Errorf("execute atomic transaction: %s, err:%s\n", tx.Hash().String(), err)
+			ledger.receipts.fail(tx, err)
 			return writeBatchs, nil
 		}
 		return writeBatchs, err
@@ -434,6 +757,7 @@ func (ledger *Ledger) executeACrossChainTx(writeBatchs []*db.WriteBatch, tx *typ
 		if err != nil {
 			if err == state.ErrNegativeBalance {
 				log.Errorf("execute acrosschain transaction: %s, err:%s\n", tx.Hash().String(), err)
+				ledger.receipts.fail(tx, err)
 				return writeBatchs, nil
 			}
 			return writeBatchs, err
@@ -444,6 +768,7 @@ func (ledger *Ledger) executeACrossChainTx(writeBatchs []*db.WriteBatch, tx *typ
 		if err != nil {
 			if err == state.ErrNegativeBalance {
 				log.Errorf("execute acrosschain transaction: %s, err:%s\n", tx.Hash().String(), err)
+				ledger.receipts.fail(tx, err)
 				return writeBatchs, nil
 			}
 			return writeBatchs, err
@@ -463,6 +788,7 @@ func (ledger *Ledger) executeMergedTx(writeBatchs []*db.WriteBatch, tx *types.Tr
 		if err != nil {
 			if err == state.ErrNegativeBalance {
 				log.Errorf("execute merged transaction: %s, err:%s\n", tx.Hash().String(), err)
+				ledger.receipts.fail(tx, err)
 				return writeBatchs, nil
 			}
 			return writeBatchs, err
@@ -482,6 +808,7 @@ func (ledger *Ledger) executeDistriTx(writeBatchs []*db.WriteBatch, tx *types.Tr
 		if err != nil {
 			if err == state.ErrNegativeBalance {
 				log.Errorf("execute distri transaction: %s, err:%s\n", tx.Hash().String(), err)
+				ledger.receipts.fail(tx, err)
 				return writeBatchs, nil
 			}
 			return writeBatchs, err
@@ -500,6 +827,7 @@ func (ledger *Ledger) executeBackfrontTx(writeBatchs []*db.WriteBatch, tx *types
 		if err != nil {
 			if err == state.ErrNegativeBalance {
 				log.Errorf("execute backfront transaction: %s, err:%s\n", tx.Hash().String(), err)
+				ledger.receipts.fail(tx, err)
 				return writeBatchs, nil
 			}
 			return writeBatchs, err
@@ -19,6 +19,9 @@
 package ledger
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"io"
 	"math/big"
 	"os"
 	"testing"
@@ -28,7 +31,9 @@ import (
 	"github.com/bocheninc/L0/components/utils"
 	"github.com/bocheninc/L0/core/accounts"
 	"github.com/bocheninc/L0/core/coordinate"
+	"github.com/bocheninc/L0/core/ledger/contract"
 	"github.com/bocheninc/L0/core/params"
+	"github.com/bocheninc/L0/core/ledger/state"
 	"github.com/bocheninc/L0/core/types"
 )
 
@@ -309,6 +314,665 @@ func TestExecuteDistributTx(t *testing.T) {
 	t.Log(li.GetBalance(distributReciepent))
 }
 
+func TestStateHash(t *testing.T) {
+	// the earlier tests write the state without the state tree
+	if err := li.rebuildStateTree(); err != nil {
+		t.Fatal(err)
+	}
+	key := append([]byte("bl_"), issueReciepent.Bytes()...)
+	put := db.NewWriteBatch("balance", db.OperationPut, key, []byte("state"))
+	del := db.NewWriteBatch("balance", db.OperationDelete, key, nil)
+	other := db.NewWriteBatch("block", db.OperationPut, key, []byte("block"))
+	stateHash := func(writeBatchs []*db.WriteBatch) crypto.Hash {
+		h, _ := li.stateHash(writeBatchs)
+		return h
+	}
+
+	current := stateHash(nil)
+	utils.AssertEquals(t, stateHash([]*db.WriteBatch{other}), current)
+	utils.AssertNotEquals(t, stateHash([]*db.WriteBatch{put}), current)
+	utils.AssertEquals(t, stateHash([]*db.WriteBatch{put, del}), stateHash([]*db.WriteBatch{del}))
+
+	previous, _ := li.dbHandler.Get("balance", key)
+	root, treeWriteBatchs := li.stateHash([]*db.WriteBatch{put})
+	if err := li.dbHandler.AtomicWrite(append([]*db.WriteBatch{put}, treeWriteBatchs...)); err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEquals(t, stateHash(nil), root)
+	if err := li.rebuildStateTree(); err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEquals(t, stateHash(nil), root)
+
+	restore := db.NewWriteBatch("balance", db.OperationPut, key, previous)
+	if len(previous) == 0 {
+		restore = del
+	}
+	_, treeWriteBatchs = li.stateHash([]*db.WriteBatch{restore})
+	if err := li.dbHandler.AtomicWrite(append([]*db.WriteBatch{restore}, treeWriteBatchs...)); err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEquals(t, stateHash(nil), current)
+}
+
+func TestReceipt(t *testing.T) {
+	params.ChainID = []byte{byte(0)}
+
+	keypair, _ := crypto.GenerateKey()
+	addr := accounts.PublicKeyToAddress(*keypair.Public())
+	issueTx := types.NewTransaction(coordinate.NewChainCoordinate([]byte{byte(0)}),
+		coordinate.NewChainCoordinate([]byte{byte(0)}),
+		types.TypeIssue,
+		uint32(1),
+		addr,
+		atmoicReciepent,
+		issueAmount,
+		fee,
+		utils.CurrentTimestamp())
+	signature, _ := keypair.Sign(issueTx.Hash().Bytes())
+	issueTx.WithSignature(signature)
+
+	poorKeypair, _ := crypto.GenerateKey()
+	atmoicTx := types.NewTransaction(coordinate.NewChainCoordinate([]byte{byte(0)}),
+		coordinate.NewChainCoordinate([]byte{byte(0)}),
+		types.TypeAtomic,
+		uint32(1),
+		accounts.PublicKeyToAddress(*poorKeypair.Public()),
+		atmoicReciepent,
+		Amount,
+		big.NewInt(1),
+		utils.CurrentTimestamp())
+	signature, _ = poorKeypair.Sign(atmoicTx.Hash().Bytes())
+	atmoicTx.WithSignature(signature)
+
+	if _, _, err := li.executeTransaction(types.Transactions{issueTx, atmoicTx}, false); err != nil {
+		t.Fatal(err)
+	}
+	li.state.ClearTmpBalance()
+	if err := li.state.AtomicWrite(li.receipts.writeBatchs(10)); err != nil {
+		t.Fatal(err)
+	}
+
+	receipt, err := li.GetReceipt(issueTx.Hash())
+	if err != nil || receipt.Status != types.ReceiptSuccessful || receipt.BlockHeight != 10 {
+		t.Errorf("issue tx receipt %v, err %v", receipt, err)
+	}
+	receipt, err = li.GetReceipt(atmoicTx.Hash())
+	if err != nil || receipt.Status != types.ReceiptFailed || receipt.Error == "" || receipt.Fee.Sign() != 0 {
+		t.Errorf("atomic tx receipt %v, err %v", receipt, err)
+	}
+	if _, err := li.GetReceipt(crypto.Sha256([]byte("unknown"))); err != ErrReceiptNotFound {
+		t.Errorf("unknown tx receipt err %v", err)
+	}
+}
+
+func TestGetTxsByAddress(t *testing.T) {
+	keypair, _ := crypto.GenerateKey()
+	addr := accounts.PublicKeyToAddress(*keypair.Public())
+
+	var (
+		writeBatchs []*db.WriteBatch
+		txs         types.Transactions
+	)
+	for i := 0; i < 3; i++ {
+		tx := types.NewTransaction(coordinate.NewChainCoordinate([]byte{byte(0)}),
+			coordinate.NewChainCoordinate([]byte{byte(0)}),
+			types.TypeAtomic,
+			uint32(i),
+			addr,
+			atmoicReciepent,
+			Amount,
+			fee,
+			utils.CurrentTimestamp())
+		txs = append(txs, tx)
+		writeBatchs = append(writeBatchs, db.NewWriteBatch("block", db.OperationPut, tx.Hash().Bytes(), tx.Serialize()))
+		writeBatchs = append(writeBatchs, li.block.AddressIndex(uint32(100+i), types.Transactions{tx})...)
+	}
+	if err := li.dbHandler.AtomicWrite(writeBatchs); err != nil {
+		t.Fatal(err)
+	}
+
+	page, next, err := li.GetTxsByAddress(addr, nil, 2)
+	if err != nil || len(page) != 2 || page[0].Hash() != txs[2].Hash() || page[1].Hash() != txs[1].Hash() {
+		t.Errorf("first page %v, err %v", page, err)
+	}
+	if next == nil || next.Height != 101 || next.Index != 0 {
+		t.Fatalf("cursor of first page %v", next)
+	}
+	page, next, err = li.GetTxsByAddress(addr, next, 2)
+	if err != nil || len(page) != 1 || page[0].Hash() != txs[0].Hash() || next != nil {
+		t.Errorf("second page %v, next %v, err %v", page, next, err)
+	}
+}
+
+func TestGetBalanceAt(t *testing.T) {
+	keypair, _ := crypto.GenerateKey()
+	issuer := accounts.PublicKeyToAddress(*keypair.Public())
+	holder := accounts.HexToAddress("0xa532277be213f56221b6140998c03d860a60e1f8")
+
+	li.state.ClearTmpBalance()
+	for i, height := range []uint32{1000, 1002, 1004} {
+		issueTx := types.NewTransaction(coordinate.NewChainCoordinate([]byte{byte(0)}),
+			coordinate.NewChainCoordinate([]byte{byte(0)}),
+			types.TypeIssue,
+			uint32(i+1),
+			issuer,
+			holder,
+			issueAmount,
+			fee,
+			utils.CurrentTimestamp())
+		signature, _ := keypair.Sign(issueTx.Hash().Bytes())
+		issueTx.WithSignature(signature)
+
+		writeBatchs, _, err := li.executeTransaction(types.Transactions{issueTx}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		historyWriteBatchs, err := li.state.HistoryWriteBatchs(height, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := li.state.AtomicWrite(append(writeBatchs, historyWriteBatchs...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for height, expect := range map[uint32]int64{1002: 200, 1003: 200, 1004: 300} {
+		amount, _, err := li.state.GetBalanceAt(holder, height)
+		if err != nil || amount.Int64() != expect {
+			t.Errorf("balance at %d is %v, expect %d, err %v", height, amount, expect, err)
+		}
+	}
+	// history before 1002 is pruned with retention 2
+	if amount, _, _ := li.state.GetBalanceAt(holder, 1001); amount.Sign() != 0 {
+		t.Errorf("balance at 1001 is not pruned, %v", amount)
+	}
+	if _, _, err := li.state.GetBalanceAt(holder, 10); err != state.ErrHistoryNotFound {
+		t.Errorf("balance before history err %v", err)
+	}
+
+	// the account funded without history, e.g. by a snapshot import, keeps its balance before the first change
+	funded := accounts.HexToAddress("0xb532277be213f56221b6140998c03d860a60e1f8")
+	writeBatchs, err := li.state.UpdateBalance(funded, state.NewBalance(big.NewInt(500), 0), big.NewInt(0), state.OperationPlus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := li.state.AtomicWrite(writeBatchs); err != nil {
+		t.Fatal(err)
+	}
+	li.state.ClearTmpBalance()
+	issueTx := types.NewTransaction(coordinate.NewChainCoordinate([]byte{byte(0)}),
+		coordinate.NewChainCoordinate([]byte{byte(0)}),
+		types.TypeIssue,
+		uint32(4),
+		issuer,
+		funded,
+		issueAmount,
+		fee,
+		utils.CurrentTimestamp())
+	signature, _ := keypair.Sign(issueTx.Hash().Bytes())
+	issueTx.WithSignature(signature)
+	writeBatchs, _, err = li.executeTransaction(types.Transactions{issueTx}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	historyWriteBatchs, err := li.state.HistoryWriteBatchs(1010, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := li.state.AtomicWrite(append(writeBatchs, historyWriteBatchs...)); err != nil {
+		t.Fatal(err)
+	}
+	for height, expect := range map[uint32]int64{1000: 500, 1005: 500, 1009: 500, 1010: 600} {
+		amount, _, err := li.state.GetBalanceAt(funded, height)
+		if err != nil || amount.Int64() != expect {
+			t.Errorf("funded balance at %d is %v, expect %d, err %v", height, amount, expect, err)
+		}
+	}
+}
+
+func TestValidatorSet(t *testing.T) {
+	defer func(v []string) { params.Validators = v }(params.Validators)
+	params.Validators = nil
+	for _, id := range []string{"a", "b", "c", "d"} {
+		key, _ := crypto.GenerateKey()
+		params.Validators = append(params.Validators, id+":"+utils.BytesToHex(key.Public().Bytes()))
+	}
+
+	key, _ := crypto.GenerateKey()
+	changes := []*types.ValidatorChange{
+		{Op: types.ValidatorAdd, NodeID: "e", PublicKey: key.Public().Bytes(), Height: 1000},
+		{Op: types.ValidatorRemove, NodeID: "a", Height: 1001},
+	}
+	var writeBatchs, cleanup []*db.WriteBatch
+	for i, change := range changes {
+		hash := crypto.Sha256([]byte{byte(i)})
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(validatorColumnFamily, db.OperationPut, hash.Bytes(), change.Serialize()))
+		cleanup = append(cleanup, db.NewWriteBatch(validatorColumnFamily, db.OperationDelete, hash.Bytes(), nil))
+	}
+	if err := li.dbHandler.AtomicWrite(writeBatchs); err != nil {
+		t.Fatal(err)
+	}
+	defer li.dbHandler.AtomicWrite(cleanup)
+
+	for height, expect := range map[uint32][]string{999: {"a", "b", "c", "d"}, 1000: {"a", "b", "c", "d", "e"}, 1001: {"b", "c", "d", "e"}} {
+		vs, err := li.ValidatorSet(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		utils.AssertEquals(t, vs.IDs(), expect)
+	}
+}
+
+func TestCollectFees(t *testing.T) {
+	keypair, _ := crypto.GenerateKey()
+	issuer := accounts.PublicKeyToAddress(*keypair.Public())
+	holder := accounts.HexToAddress("0xa632277be213f56221b6140998c03d860a60e1f8")
+	defer func(v []string) { params.Validators = v }(params.Validators)
+	params.Validators = nil
+	var validators []accounts.Address
+	for _, id := range []string{"a", "b"} {
+		key, _ := crypto.GenerateKey()
+		params.Validators = append(params.Validators, id+":"+utils.BytesToHex(key.Public().Bytes()))
+		validators = append(validators, accounts.PublicKeyToAddress(*key.Public()))
+	}
+
+	li.state.ClearTmpBalance()
+	issueTx := types.NewTransaction(coordinate.NewChainCoordinate([]byte{byte(0)}),
+		coordinate.NewChainCoordinate([]byte{byte(0)}),
+		types.TypeIssue,
+		uint32(1),
+		issuer,
+		holder,
+		issueAmount,
+		big.NewInt(5),
+		utils.CurrentTimestamp())
+	signature, _ := keypair.Sign(issueTx.SignHash().Bytes())
+	issueTx.WithSignature(signature)
+
+	writeBatchs, _, err := li.executeTransaction(types.Transactions{issueTx}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := li.state.AtomicWrite(writeBatchs); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expect := range []int64{3, 2} {
+		if amount, _, _ := li.GetBalance(validators[i]); amount.Int64() != expect {
+			t.Errorf("validator %d collects fee %v, expect %d", i, amount, expect)
+		}
+	}
+
+	// the txpool balances are credited only once the block is written
+	pool := &feeRecorder{credits: make(map[accounts.Address]int64)}
+	defer func() { li.Validator = nil }()
+	li.Validator = pool
+	height, _ := li.Height()
+	previous, _ := li.GetBlockByNumber(height)
+	feeTx := func(nonce uint32) *types.Transaction {
+		tx := types.NewTransaction(coordinate.NewChainCoordinate([]byte{byte(0)}),
+			coordinate.NewChainCoordinate([]byte{byte(0)}),
+			types.TypeIssue,
+			nonce,
+			issuer,
+			holder,
+			issueAmount,
+			big.NewInt(5),
+			utils.CurrentTimestamp())
+		signature, _ := keypair.Sign(tx.SignHash().Bytes())
+		tx.WithSignature(signature)
+		return tx
+	}
+	block := types.NewBlock(previous.Hash(), utils.CurrentTimestamp(), height+1, 100, crypto.Hash{}, types.Transactions{feeTx(2)})
+	if err := li.AppendBlock(block, false); err != ErrStateHashMismatch {
+		t.Fatalf("append block of a wrong state hash err %v", err)
+	}
+	if len(pool.credits) != 0 {
+		t.Errorf("txpool credited %v by a rejected block", pool.credits)
+	}
+	block = types.NewBlock(previous.Hash(), utils.CurrentTimestamp(), height+1, 100, crypto.Hash{}, types.Transactions{feeTx(3)})
+	if err := li.AppendBlock(block, true); err != nil {
+		t.Fatal(err)
+	}
+	for i, expect := range []int64{3, 2} {
+		if credit := pool.credits[validators[i]]; credit != expect {
+			t.Errorf("txpool credits validator %d fee %d, expect %d", i, credit, expect)
+		}
+	}
+
+	// the fee account of the chain takes the fees from the validators
+	feeAccount := accounts.HexToAddress("0xa932277be213f56221b6140998c03d860a60e1f8")
+	defer func() { li.feeAccount = nil }()
+	li.feeAccount = &feeAccount
+	if recipients, err := li.feeRecipients(); err != nil || len(recipients) != 1 || !recipients[0].Equal(feeAccount) {
+		t.Errorf("fee recipients %v, err %v", recipients, err)
+	}
+}
+
+type feeRecorder struct {
+	credits map[accounts.Address]int64
+}
+
+func (r *feeRecorder) UpdateAccount(tx *types.Transaction)   {}
+func (r *feeRecorder) RollBackAccount(tx *types.Transaction) {}
+func (r *feeRecorder) AddBalance(addr accounts.Address, amount *big.Int) {
+	r.credits[addr] += amount.Int64()
+}
+
+func TestPrune(t *testing.T) {
+	tx := types.NewTransaction(coordinate.NewChainCoordinate([]byte{byte(0)}),
+		coordinate.NewChainCoordinate([]byte{byte(0)}),
+		types.TypeAtomic,
+		uint32(1),
+		issueReciepent,
+		atmoicReciepent,
+		Amount,
+		fee,
+		utils.CurrentTimestamp())
+	block := types.NewBlock(li.GetGenesisBlock().Hash(), utils.CurrentTimestamp(), 1, 100, crypto.Hash{}, types.Transactions{tx})
+	if err := li.dbHandler.AtomicWrite(li.block.AppendBlock(block)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := li.GetTxByTxHash(tx.Hash().Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := li.prune(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := li.GetTxByTxHash(tx.Hash().Bytes()); err != ErrPruned {
+		t.Errorf("get pruned tx err %v", err)
+	}
+	if _, err := li.GetTransactionHashList(1); err != ErrPruned {
+		t.Errorf("get pruned tx list err %v", err)
+	}
+	if _, err := li.GetBlockByNumber(1); err != nil {
+		t.Errorf("get pruned block header err %v", err)
+	}
+	txHashs, _ := li.block.GetTxHashsByAddress(atmoicReciepent, nil, 1000)
+	for _, txHash := range txHashs {
+		if txHash.Equal(tx.Hash()) {
+			t.Error("address index of pruned tx is kept")
+		}
+	}
+	if _, _, err := li.GetTxsByAddress(atmoicReciepent, nil, 1000); err != nil {
+		t.Errorf("get txs by address after pruned err %v", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	// the earlier tests write the state without the state tree
+	if err := li.rebuildStateTree(); err != nil {
+		t.Fatal(err)
+	}
+	height, _ := li.Height()
+	previous, _ := li.GetBlockByNumber(height)
+	block := types.NewBlock(previous.Hash(), utils.CurrentTimestamp(), height+1, 100, crypto.Hash{}, nil)
+	block.Header.StateHash, _ = li.stateHash(nil)
+	if err := li.dbHandler.AtomicWrite(li.block.AppendBlock(block)); err != nil {
+		t.Fatal(err)
+	}
+	// a transaction waiting to be merged
+	acrossTx := types.NewTransaction(coordinate.NewChainCoordinate([]byte{byte(0)}),
+		coordinate.NewChainCoordinate([]byte{byte(1)}),
+		types.TypeAcrossChain,
+		uint32(1),
+		issueReciepent,
+		acrossReciepent,
+		Amount,
+		fee,
+		utils.CurrentTimestamp())
+	if err := li.storage.ClassifiedTransaction(types.Transactions{acrossTx}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	manifest, err := li.ExportSnapshot(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Height != height+1 || !manifest.BlockHash.Equal(block.Hash()) {
+		t.Errorf("snapshot manifest %v", manifest)
+	}
+	if err := verifySnapshot(bytes.NewReader(buf.Bytes()), manifest); err != nil {
+		t.Error(err)
+	}
+
+	data := append([]byte{}, buf.Bytes()...)
+	data[len(data)-1]++
+	if err := verifySnapshot(bytes.NewReader(data), manifest); err == nil {
+		t.Error("verify tampered snapshot")
+	}
+	if err := li.ImportSnapshot(bytes.NewReader(buf.Bytes()), manifest); err == nil {
+		t.Error("import snapshot into non-empty ledger")
+	}
+
+	// the snapshot imported into an empty ledger sets its height once the state is written
+	emptyConfig := db.DefaultConfig()
+	emptyConfig.DbPath = "/tmp/rocksdb-test-snapshot-import/"
+	os.RemoveAll(emptyConfig.DbPath)
+	defer os.RemoveAll(emptyConfig.DbPath)
+	emptyDb := db.OpenDB(emptyConfig)
+	defer emptyDb.Close()
+	empty := newLedger(emptyDb)
+	if err := empty.ImportSnapshot(bytes.NewReader(buf.Bytes()), manifest); err != nil {
+		t.Fatal(err)
+	}
+	if height, _ := empty.Height(); height != manifest.Height {
+		t.Errorf("imported ledger height %d, expected %d", height, manifest.Height)
+	}
+	if stateHash, _ := empty.stateHash(nil); !stateHash.Equal(manifest.StateHash) {
+		t.Errorf("imported state hash %s, expected %s", stateHash, manifest.StateHash)
+	}
+	key := utils.Uint32ToBytes(acrossTx.CreateTime())
+	if expected, _ := li.dbHandler.Get(mergeColumnFamily, key); len(expected) == 0 {
+		t.Error("merge storage not written")
+	} else if value, _ := empty.dbHandler.Get(mergeColumnFamily, key); !bytes.Equal(value, expected) {
+		t.Error("merge storage not imported")
+	}
+
+	// the snapshot is rebuilt with the entries changed and a matching manifest
+	var entries []*snapshotEntry
+	readSnapshot(bytes.NewReader(buf.Bytes()), func(entry *snapshotEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	rebuild := func(change func([]*snapshotEntry) []*snapshotEntry) ([]byte, *SnapshotManifest) {
+		data := new(bytes.Buffer)
+		hasher, storageHasher := sha256.New(), sha256.New()
+		changed := change(append([]*snapshotEntry{}, entries...))
+		for _, entry := range changed {
+			writeSnapshotEntry(io.MultiWriter(data, hasher), entry)
+			if entry.ColumnFamily == mergeColumnFamily {
+				writeSnapshotEntry(storageHasher, entry)
+			}
+		}
+		m := *manifest
+		m.Entries = uint64(len(changed))
+		m.DataHash = crypto.NewHash(hasher.Sum(nil))
+		m.StorageHash = crypto.NewHash(storageHasher.Sum(nil))
+		return data.Bytes(), &m
+	}
+	if data, m := rebuild(func(entries []*snapshotEntry) []*snapshotEntry { return entries }); verifySnapshot(bytes.NewReader(data), m) != nil {
+		t.Fatal("verify rebuilt snapshot")
+	}
+	untrusted := *manifest
+	untrusted.StorageHash = crypto.Hash{}
+	if verifySnapshot(bytes.NewReader(buf.Bytes()), &untrusted) == nil {
+		t.Error("verify snapshot with untrusted merge storage")
+	}
+	forged := types.NewBlockHeader(crypto.Hash{}, 0, 5, 0, crypto.Hash{})
+	for name, change := range map[string]func([]*snapshotEntry) []*snapshotEntry{
+		"extra index": func(entries []*snapshotEntry) []*snapshotEntry {
+			return append(entries, &snapshotEntry{"index", []byte("tx_xxxx"), []byte{1}})
+		},
+		"unlinked header": func(entries []*snapshotEntry) []*snapshotEntry {
+			return append(entries, &snapshotEntry{"block", forged.Hash().Bytes(), forged.Serialize()})
+		},
+		"uncommitted validator": func(entries []*snapshotEntry) []*snapshotEntry {
+			vc := &types.ValidatorChange{NodeID: "x", Height: 1}
+			return append(entries, &snapshotEntry{validatorColumnFamily, []byte("x"), vc.Serialize()})
+		},
+		"malformed merge storage": func(entries []*snapshotEntry) []*snapshotEntry {
+			return append(entries, &snapshotEntry{mergeColumnFamily, []byte("x"), []byte("x")})
+		},
+		"unlisted merge transactions": func(entries []*snapshotEntry) []*snapshotEntry {
+			return append(entries, &snapshotEntry{mergeColumnFamily, utils.Uint32ToBytes(1), utils.Serialize(types.Transactions{})})
+		},
+	} {
+		if data, m := rebuild(change); verifySnapshot(bytes.NewReader(data), m) == nil {
+			t.Errorf("verify snapshot with %s", name)
+		}
+	}
+	if _, err := readSnapshot(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff}), func(entry *snapshotEntry) error { return nil }); err == nil {
+		t.Error("read oversized snapshot entry")
+	}
+}
+
+func TestRollback(t *testing.T) {
+	// the earlier tests write the state without the state tree
+	if err := li.rebuildStateTree(); err != nil {
+		t.Fatal(err)
+	}
+	height, _ := li.Height()
+	previous, _ := li.GetBlockByNumber(height)
+	senderBalance, _, _ := li.GetBalance(issueReciepent)
+	recipientBalance, _, _ := li.GetBalance(atmoicReciepent)
+	stateHash, _ := li.stateHash(nil)
+
+	tx := types.NewTransaction(coordinate.NewChainCoordinate([]byte{byte(0)}),
+		coordinate.NewChainCoordinate([]byte{byte(0)}),
+		types.TypeAtomic,
+		uint32(2),
+		issueReciepent,
+		atmoicReciepent,
+		Amount,
+		fee,
+		utils.CurrentTimestamp())
+	block := types.NewBlock(previous.Hash(), utils.CurrentTimestamp(), height+1, 100, crypto.Hash{}, types.Transactions{tx})
+	if err := li.AppendBlock(block, true); err != nil {
+		t.Fatal(err)
+	}
+	if balance, _, _ := li.GetBalance(atmoicReciepent); balance.Cmp(recipientBalance) == 0 {
+		t.Fatal("block not applied")
+	}
+
+	if _, err := li.Rollback(0); err != ErrRollbackTooDeep {
+		t.Errorf("rollback blocks without undo records err %v", err)
+	}
+	blocks, err := li.Rollback(height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || !blocks[0].Hash().Equal(block.Hash()) || len(blocks[0].Transactions) != 1 {
+		t.Errorf("rollback blocks %v", blocks)
+	}
+	if h, _ := li.Height(); h != height {
+		t.Errorf("height %d after rollback, expected %d", h, height)
+	}
+	if balance, _, _ := li.GetBalance(issueReciepent); balance.Cmp(senderBalance) != 0 {
+		t.Errorf("sender balance %v after rollback, expected %v", balance, senderBalance)
+	}
+	if balance, _, _ := li.GetBalance(atmoicReciepent); balance.Cmp(recipientBalance) != 0 {
+		t.Errorf("recipient balance %v after rollback, expected %v", balance, recipientBalance)
+	}
+	if h, _ := li.stateHash(nil); !h.Equal(stateHash) {
+		t.Error("state hash changed after rollback")
+	}
+	if _, err := li.GetTxByTxHash(tx.Hash().Bytes()); err == nil {
+		t.Error("transaction kept after rollback")
+	}
+
+	if err := li.AppendBlock(blocks[0], false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRollbackWindow(t *testing.T) {
+	config := db.DefaultConfig()
+	config.DbPath = "/tmp/rocksdb-test-rollback-window/"
+	os.RemoveAll(config.DbPath)
+	defer os.RemoveAll(config.DbPath)
+	chainDb := db.OpenDB(config)
+	defer chainDb.Close()
+	l := newLedger(chainDb)
+	l.contract = contract.NewSmartConstract(chainDb, l)
+
+	appendBlocks := func(n int) {
+		for i := 0; i < n; i++ {
+			height, _ := l.Height()
+			previous, _ := l.GetBlockByNumber(height)
+			block := types.NewBlock(previous.Hash(), utils.CurrentTimestamp(), height+1, uint32(i), crypto.Hash{}, nil)
+			if err := l.AppendBlock(block, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	appendBlocks(2 * MaxRollbackBlocks)
+
+	// each reorganization rolls back MaxRollbackBlocks-1 blocks and appends a shorter branch
+	for i := 0; i < 2; i++ {
+		height, _ := l.Height()
+		if _, err := l.Rollback(height - MaxRollbackBlocks + 1); err != nil {
+			t.Fatalf("reorganization %d: %v", i, err)
+		}
+		appendBlocks(1)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	localConfig := db.DefaultConfig()
+	localConfig.DbPath = "/tmp/rocksdb-test-verify-local/"
+	scratchConfig := db.DefaultConfig()
+	scratchConfig.DbPath = "/tmp/rocksdb-test-verify-scratch/"
+	defer os.RemoveAll(localConfig.DbPath)
+	defer os.RemoveAll(scratchConfig.DbPath)
+
+	localDb := db.OpenDB(localConfig)
+	defer localDb.Close()
+	local := newLedger(localDb)
+
+	issueTxKeypair, _ := crypto.GenerateKey()
+	issueTx := types.NewTransaction(coordinate.NewChainCoordinate([]byte{byte(0)}),
+		coordinate.NewChainCoordinate([]byte{byte(0)}),
+		types.TypeIssue,
+		uint32(1),
+		accounts.PublicKeyToAddress(*issueTxKeypair.Public()),
+		issueReciepent,
+		issueAmount,
+		fee,
+		utils.CurrentTimestamp())
+	signature, _ := issueTxKeypair.Sign(issueTx.SignHash().Bytes())
+	issueTx.WithSignature(signature)
+	block := types.NewBlock(local.GetGenesisBlock().Hash(), utils.CurrentTimestamp(), 1, 100, crypto.Hash{}, types.Transactions{issueTx})
+	if err := local.AppendBlock(block, true); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func() *VerifyReport {
+		os.RemoveAll(scratchConfig.DbPath)
+		scratchDb := db.OpenDB(scratchConfig)
+		defer scratchDb.Close()
+		report, err := local.Verify(scratchDb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	if report := verify(); report.Divergent || report.Verified != 1 {
+		t.Errorf("verify report %v", report)
+	}
+
+	if err := localDb.Put("balance", []byte("bl_tampered"), []byte("tampered")); err != nil {
+		t.Fatal(err)
+	}
+	if report := verify(); !report.Divergent || report.DivergentHeight != 1 {
+		t.Errorf("verify tampered ledger report %v", report)
+	}
+}
+
 func TestExecuteBackfrontTx(t *testing.T) {
 	params.ChainID = []byte{byte(1)}
 
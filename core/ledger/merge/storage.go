@@ -19,7 +19,9 @@
 package merge
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"sort"
 
 	"sync"
@@ -82,6 +84,60 @@ func (storage *Storage) ClassifiedTransaction(txs types.Transactions) error {
 	return nil
 }
 
+// RemoveTransactions removes the transactions not merged yet, e.g. of the blocks rolled back
+func (storage *Storage) RemoveTransactions(txs types.Transactions) error {
+	if len(txs) == 0 {
+		return nil
+	}
+	storage.Lock()
+	defer storage.Unlock()
+
+	removed := make(map[crypto.Hash]bool)
+	for _, tx := range txs {
+		removed[tx.Hash()] = true
+	}
+	filter := func(txs types.Transactions) types.Transactions {
+		var kept types.Transactions
+		for _, tx := range txs {
+			if !removed[tx.Hash()] {
+				kept = append(kept, tx)
+			}
+		}
+		return kept
+	}
+
+	for time, txs := range storage.m {
+		if kept := filter(txs); len(kept) > 0 {
+			storage.m[time] = kept
+		} else {
+			delete(storage.m, time)
+		}
+	}
+
+	array, err := storage.getTxTime()
+	if err != nil {
+		return err
+	}
+	var times utils.Times
+	for _, time := range array {
+		txs, err := storage.getTxByTime(time)
+		if err != nil {
+			return err
+		}
+		if kept := filter(txs); len(kept) == 0 {
+			err = storage.deleteTxByTime(time)
+		} else {
+			times = append(times, time)
+			err = storage.dbHandler.Put(storage.columnFamily, utils.Uint32ToBytes(time), utils.Serialize(kept))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	storage.timeArray = times
+	return storage.putTxTime(times)
+}
+
 // GetMergedTransaction returns to be merged transactions
 func (storage *Storage) GetMergedTransaction(delay uint32) (types.Transactions, error) {
 	storage.Lock()
@@ -208,3 +264,42 @@ func (storage *Storage) deleteTxByTime(time uint32) error {
 	}
 	return nil
 }
+
+// CheckSnapshotStorage checks the merge storage entries of a snapshot are well formed, the transactions waiting
+// to be merged are listed by their creation time and the merged transactions by their hash
+func CheckSnapshotStorage(entries map[string][]byte) error {
+	times := make(map[uint32]bool)
+	if value, ok := entries[timeKey]; ok {
+		array := utils.BytesToUint32Arrary(value)
+		if !bytes.Equal(utils.Uint32ArrayToBytes(array), value) {
+			return errors.New("snapshot storage time list is malformed")
+		}
+		for _, time := range array {
+			times[time] = true
+		}
+	}
+	for key, value := range entries {
+		switch {
+		case key == timeKey:
+		case len(key) == 4:
+			time := utils.BytesToUint32([]byte(key))
+			txs := make(types.Transactions, 0)
+			if err := utils.Deserialize(value, &txs); err != nil || !times[time] {
+				return fmt.Errorf("snapshot storage transactions at %d are not listed or malformed, err %v", time, err)
+			}
+			for _, tx := range txs {
+				if tx.CreateTime() != time {
+					return fmt.Errorf("snapshot storage transaction %s is not created at %d", tx.Hash(), time)
+				}
+			}
+		case len(key) == crypto.HashSize:
+			txHashs := make([]crypto.Hash, 0)
+			if err := utils.Deserialize(value, &txHashs); err != nil {
+				return fmt.Errorf("snapshot storage merged transaction %x is malformed, err %v", key, err)
+			}
+		default:
+			return fmt.Errorf("unexpected snapshot storage %x", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package ledger
+
+import (
+	"github.com/bocheninc/L0/components/db"
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/core/ledger/block_storage"
+)
+
+const (
+	// minPruningBlocks is the least number of recent blocks kept, consensus state transfer relies on them
+	minPruningBlocks = 128
+	// pruneBatchBlocks is the number of blocks pruned in one write
+	pruneBatchBlocks = 100
+)
+
+// ErrPruned is returned when the requested transactions have been pruned
+var ErrPruned = block_storage.ErrPruned
+
+// startPruning prunes transactions of blocks older than the last keep blocks in background
+func (ledger *Ledger) startPruning(keep uint32) {
+	if keep < minPruningBlocks {
+		log.Warnf("pruning keeps %d blocks at least, %d is too small", minPruningBlocks, keep)
+		keep = minPruningBlocks
+	}
+	ledger.pruneCh = make(chan struct{}, 1)
+	go func() {
+		for range ledger.pruneCh {
+			if err := ledger.prune(keep); err != nil {
+				log.Errorf("prune blocks error %v", err)
+			}
+		}
+	}()
+	ledger.notifyPruning()
+}
+
+func (ledger *Ledger) notifyPruning() {
+	if ledger.pruneCh == nil {
+		return
+	}
+	select {
+	case ledger.pruneCh <- struct{}{}:
+	default:
+	}
+}
+
+// prune deletes transaction bodies of the blocks up to height - keep in batches
+func (ledger *Ledger) prune(keep uint32) error {
+	height, err := ledger.Height()
+	if err != nil || height <= keep {
+		return err
+	}
+	target := height - keep
+
+	from := uint32(1)
+	if prunedHeight, ok := ledger.block.GetPrunedHeight(); ok {
+		from = prunedHeight + 1
+	}
+
+	var writeBatchs []*db.WriteBatch
+	for h := from; h <= target; h++ {
+		wbs, err := ledger.block.PruneBlock(h)
+		if err != nil {
+			return err
+		}
+		writeBatchs = append(writeBatchs, wbs...)
+		if h == target || (h-from+1)%pruneBatchBlocks == 0 {
+			if err := ledger.dbHandler.AtomicWrite(writeBatchs); err != nil {
+				return err
+			}
+			writeBatchs = nil
+			log.Debugf("pruned transactions of blocks up to height %d", h)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package ledger
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/db"
+	"github.com/bocheninc/L0/core/accounts"
+	"github.com/bocheninc/L0/core/coordinate"
+	"github.com/bocheninc/L0/core/params"
+	"github.com/bocheninc/L0/core/types"
+)
+
+const receiptColumnFamily = "receipt"
+
+// ErrReceiptNotFound is returned when the transaction has no receipt
+var ErrReceiptNotFound = errors.New("receipt not found")
+
+// blockReceipts collects the receipts of the transactions executed in a block
+type blockReceipts struct {
+	receipts []*types.Receipt
+	index    map[crypto.Hash]*types.Receipt
+}
+
+func newBlockReceipts() *blockReceipts {
+	return &blockReceipts{index: make(map[crypto.Hash]*types.Receipt)}
+}
+
+// get returns the receipt of the transaction, it is created as successful if not exist
+func (br *blockReceipts) get(tx *types.Transaction) *types.Receipt {
+	hash := tx.Hash()
+	if receipt, ok := br.index[hash]; ok {
+		return receipt
+	}
+	fee := big.NewInt(0)
+	if tx.Fee() != nil && bytes.Equal(coordinate.HexToChainCoordinate(tx.FromChain()).Bytes(), params.ChainID) {
+		fee = tx.Fee()
+	}
+	receipt := types.NewReceipt(hash, 0, fee)
+	br.receipts = append(br.receipts, receipt)
+	br.index[hash] = receipt
+	return receipt
+}
+
+func (br *blockReceipts) fail(tx *types.Transaction, err error) {
+	if br != nil {
+		br.get(tx).Fail(err)
+	}
+}
+
+func (br *blockReceipts) writeBatchs(height uint32) []*db.WriteBatch {
+	var writeBatchs []*db.WriteBatch
+	for _, receipt := range br.receipts {
+		receipt.BlockHeight = height
+		for _, event := range receipt.Events {
+			event.BlockHeight = height
+		}
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(receiptColumnFamily, db.OperationPut, receipt.TxHash.Bytes(), receipt.Serialize()))
+	}
+	return writeBatchs
+}
+
+// GetReceipt returns the receipt of the transaction
+func (ledger *Ledger) GetReceipt(txHash crypto.Hash) (*types.Receipt, error) {
+	data, err := ledger.dbHandler.Get(receiptColumnFamily, txHash.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrReceiptNotFound
+	}
+	receipt := new(types.Receipt)
+	if err := receipt.Deserialize(data); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// GetEvents returns the contract events emitted in blocks from height from to height to,
+// filtered by the contract address and the event name unless they are empty
+func (ledger *Ledger) GetEvents(contractAddr accounts.Address, name string, from, to uint32) ([]*types.Event, error) {
+	events := make([]*types.Event, 0)
+	for height := from; height <= to; height++ {
+		txHashs, err := ledger.GetTransactionHashList(height)
+		if err != nil {
+			return nil, err
+		}
+		for _, txHash := range txHashs {
+			receipt, err := ledger.GetReceipt(txHash)
+			if err == ErrReceiptNotFound {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			for _, event := range receipt.Events {
+				if !contractAddr.Equal(accounts.Address{}) && !contractAddr.Equal(event.ContractAddr) {
+					continue
+				}
+				if name != "" && name != event.Name {
+					continue
+				}
+				events = append(events, event)
+			}
+		}
+		if height == to {
+			break
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,137 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package ledger
+
+import (
+	"errors"
+
+	"github.com/bocheninc/L0/components/db"
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/types"
+)
+
+const (
+	// undoColumnFamily keeps the previous values of the keys written by the latest blocks
+	undoColumnFamily = "undo"
+	// MaxRollbackBlocks is the number of latest blocks which can be rolled back
+	MaxRollbackBlocks = 64
+)
+
+// ErrRollbackTooDeep is returned when the blocks to roll back are beyond the kept undo records
+var ErrRollbackTooDeep = errors.New("rollback beyond the kept undo records")
+
+// undoEntry is the value of the key before the block was appended, Exists is false if the key was absent
+type undoEntry struct {
+	ColumnFamily string
+	Key          []byte
+	Value        []byte
+	Exists       bool
+}
+
+// undoWriteBatchs returns the undo record of the writes of the block, the record of the block
+// MaxRollbackBlocks below is deleted and kept in the undo record, so the rollback window stays
+// MaxRollbackBlocks deep once the block is rolled back
+func (ledger *Ledger) undoWriteBatchs(height uint32, writeBatchs []*db.WriteBatch) ([]*db.WriteBatch, error) {
+	var pruneWriteBatchs []*db.WriteBatch
+	if height > MaxRollbackBlocks {
+		pruneWriteBatchs = append(pruneWriteBatchs, db.NewWriteBatch(undoColumnFamily, db.OperationDelete, utils.Uint32ToBytes(height-MaxRollbackBlocks), nil))
+	}
+
+	var entries []*undoEntry
+	written := make(map[string]bool)
+	for _, wb := range append(pruneWriteBatchs, writeBatchs...) {
+		key := wb.CfName + "|" + string(wb.Key)
+		if written[key] {
+			continue
+		}
+		written[key] = true
+
+		value, err := ledger.dbHandler.Get(wb.CfName, wb.Key)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &undoEntry{ColumnFamily: wb.CfName, Key: wb.Key, Value: value, Exists: len(value) > 0})
+	}
+
+	undoWriteBatchs := []*db.WriteBatch{db.NewWriteBatch(undoColumnFamily, db.OperationPut, utils.Uint32ToBytes(height), utils.Serialize(entries))}
+	return append(undoWriteBatchs, pruneWriteBatchs...), nil
+}
+
+// Rollback reverts the blocks above height, including their state and contract writes and the transactions
+// of the merge storage, it returns the reverted blocks from the lowest
+func (ledger *Ledger) Rollback(height uint32) ([]*types.Block, error) {
+	current, err := ledger.Height()
+	if err != nil {
+		return nil, err
+	}
+	if height >= current {
+		return nil, nil
+	}
+	if current-height > MaxRollbackBlocks || height < ledger.block.GetBaseHeight() {
+		return nil, ErrRollbackTooDeep
+	}
+	for h := current; h > height; h-- {
+		if undoBytes, err := ledger.dbHandler.Get(undoColumnFamily, utils.Uint32ToBytes(h)); err != nil || len(undoBytes) == 0 {
+			return nil, ErrRollbackTooDeep
+		}
+	}
+
+	var blocks []*types.Block
+	for h := current; h > height; h-- {
+		header, err := ledger.GetBlockByNumber(h)
+		if err != nil {
+			return blocks, err
+		}
+		txs, err := ledger.GetTxsByBlockHash(header.Hash().Bytes(), 100)
+		if err != nil {
+			return blocks, err
+		}
+		undoBytes, err := ledger.dbHandler.Get(undoColumnFamily, utils.Uint32ToBytes(h))
+		if err != nil {
+			return blocks, err
+		}
+		var entries []*undoEntry
+		if err := utils.Deserialize(undoBytes, &entries); err != nil {
+			return blocks, err
+		}
+
+		var writeBatchs []*db.WriteBatch
+		for i := len(entries) - 1; i >= 0; i-- {
+			if entries[i].Exists {
+				writeBatchs = append(writeBatchs, db.NewWriteBatch(entries[i].ColumnFamily, db.OperationPut, entries[i].Key, entries[i].Value))
+			} else {
+				writeBatchs = append(writeBatchs, db.NewWriteBatch(entries[i].ColumnFamily, db.OperationDelete, entries[i].Key, nil))
+			}
+		}
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(undoColumnFamily, db.OperationDelete, utils.Uint32ToBytes(h), nil))
+		if err := ledger.state.AtomicWrite(writeBatchs); err != nil {
+			return blocks, err
+		}
+		ledger.validators.reset()
+		// the merge storage is written after the block, the transactions not merged yet are removed
+		if err := ledger.storage.RemoveTransactions(ledger.mergeTransactions(txs)); err != nil {
+			return blocks, err
+		}
+
+		blocks = append([]*types.Block{{Header: header, Transactions: txs}}, blocks...)
+		log.Warnf("rollback block %s(%d), transactions %d", header.Hash(), h, len(txs))
+	}
+	return blocks, nil
+}
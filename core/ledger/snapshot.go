@@ -0,0 +1,307 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package ledger
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/db"
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/ledger/block_storage"
+	"github.com/bocheninc/L0/core/ledger/merge"
+	"github.com/bocheninc/L0/core/types"
+)
+
+const (
+	// snapshotHeaders is the number of latest headers in the snapshot
+	snapshotHeaders = 128
+	// snapshotBatchEntries is the number of entries imported in one write
+	snapshotBatchEntries = 10000
+	// snapshotMaxEntrySize is the maximum size of a serialized entry read from the snapshot
+	snapshotMaxEntrySize = 16 * 1024 * 1024
+)
+
+const mergeColumnFamily = "storage"
+
+// snapshotColumnFamilies are the column families fully exported to the snapshot, the state committed by the state hash
+// and the merge storage of the transactions waiting to be merged, which the merged transactions are built from
+var snapshotColumnFamilies = append([]string{mergeColumnFamily}, stateColumnFamilies...)
+
+// SnapshotManifest describes the snapshot of the state at a block height,
+// BlockHash should be checked against a trusted block header before importing.
+// The merge storage isn't committed by the block header, StorageHash commits it,
+// so the manifest must come from a trusted node
+type SnapshotManifest struct {
+	Height      uint32      `json:"height"`
+	BlockHash   crypto.Hash `json:"blockHash"`
+	StateHash   crypto.Hash `json:"stateHash"`
+	StorageHash crypto.Hash `json:"storageHash"`
+	Entries     uint64      `json:"entries"`
+	DataHash    crypto.Hash `json:"dataHash"`
+}
+
+type snapshotEntry struct {
+	ColumnFamily string
+	Key          []byte
+	Value        []byte
+}
+
+// ExportSnapshot writes the state and the latest headers at the current height to w
+func (ledger *Ledger) ExportSnapshot(w io.Writer) (*SnapshotManifest, error) {
+	snapshot := ledger.dbHandler.NewSnapshot()
+	defer snapshot.Release()
+
+	height, err := ledger.Height()
+	if err != nil {
+		return nil, err
+	}
+	base := uint32(0)
+	if height > snapshotHeaders {
+		base = height - snapshotHeaders
+	}
+	height, headers, err := ledger.block.SnapshotHeaders(snapshot, base)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &SnapshotManifest{Height: height}
+	hasher, storageHasher := sha256.New(), sha256.New()
+	bw := bufio.NewWriter(io.MultiWriter(w, hasher))
+	write := func(cfName string, key, value []byte) error {
+		manifest.Entries++
+		entry := &snapshotEntry{ColumnFamily: cfName, Key: key, Value: value}
+		if cfName == mergeColumnFamily {
+			writeSnapshotEntry(storageHasher, entry)
+		}
+		return writeSnapshotEntry(bw, entry)
+	}
+
+	for _, wb := range headers {
+		if err := write(wb.CfName, wb.Key, wb.Value); err != nil {
+			return nil, err
+		}
+	}
+	for _, cfName := range snapshotColumnFamilies {
+		if err := snapshot.Iterate(cfName, func(key, value []byte) error {
+			return write(cfName, key, value)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+
+	header, err := ledger.GetBlockByNumber(height)
+	if err != nil {
+		return nil, err
+	}
+	manifest.BlockHash = header.Hash()
+	manifest.StateHash = header.StateHash
+	manifest.StorageHash = crypto.NewHash(storageHasher.Sum(nil))
+	manifest.DataHash = crypto.NewHash(hasher.Sum(nil))
+	log.Infof("export snapshot at height %d, block %s, entries %d", height, manifest.BlockHash, manifest.Entries)
+	return manifest, nil
+}
+
+// ImportSnapshot verifies the snapshot read from r by the manifest and the block header in it, then writes it to the empty ledger.
+// The index entries, which set the height of the ledger, are written last in one batch, so the ledger stays empty
+// and the snapshot can be imported again if the import is interrupted
+func (ledger *Ledger) ImportSnapshot(r io.ReadSeeker, manifest *SnapshotManifest) error {
+	if height, err := ledger.Height(); err != nil || height != 0 {
+		return fmt.Errorf("ledger is not empty, height %d, err %v", height, err)
+	}
+
+	if err := verifySnapshot(r, manifest); err != nil {
+		return err
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// the merge storage left by an interrupted import of another snapshot isn't checked by the state hash
+	var writeBatchs, indexWriteBatchs []*db.WriteBatch
+	ledger.dbHandler.Iterate(mergeColumnFamily, func(key, value []byte) {
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(mergeColumnFamily, db.OperationDelete, key, nil))
+	})
+	if _, err := readSnapshot(r, func(entry *snapshotEntry) error {
+		wb := db.NewWriteBatch(entry.ColumnFamily, db.OperationPut, entry.Key, entry.Value)
+		if entry.ColumnFamily == "index" {
+			// bounded by the headers of the snapshot
+			indexWriteBatchs = append(indexWriteBatchs, wb)
+			return nil
+		}
+		writeBatchs = append(writeBatchs, wb)
+		if len(writeBatchs) < snapshotBatchEntries {
+			return nil
+		}
+		err := ledger.dbHandler.AtomicWrite(writeBatchs)
+		writeBatchs = nil
+		return err
+	}); err != nil {
+		return err
+	}
+	if err := ledger.dbHandler.AtomicWrite(writeBatchs); err != nil {
+		return err
+	}
+	if err := ledger.rebuildStateTree(); err != nil {
+		return err
+	}
+	// the state left by an interrupted import of another snapshot is not committed by the block header
+	if stateHash, _ := ledger.stateHash(nil); !stateHash.Equal(manifest.StateHash) {
+		return fmt.Errorf("imported state hash %s mismatch the snapshot %s, the ledger has other state", stateHash, manifest.StateHash)
+	}
+	if err := ledger.dbHandler.AtomicWrite(indexWriteBatchs); err != nil {
+		return err
+	}
+	ledger.validators.reset()
+	log.Infof("import snapshot at height %d, block %s, entries %d", manifest.Height, manifest.BlockHash, manifest.Entries)
+	return nil
+}
+
+// verifySnapshot checks the data hash, the block headers linked to the trusted one, the index entries
+// of the headers, the state hash and the merge storage of the snapshot
+func verifySnapshot(r io.Reader, manifest *SnapshotManifest) error {
+	tree := newStateTreeBuilder(false)
+	headers := make(map[crypto.Hash]*types.BlockHeader)
+	index := make(map[string][]byte)
+	storage := make(map[string][]byte)
+	storageHasher := sha256.New()
+	isStateCf := make(map[string]bool)
+	for _, cfName := range stateColumnFamilies {
+		isStateCf[cfName] = true
+	}
+	hasher := sha256.New()
+	entries, err := readSnapshot(io.TeeReader(r, hasher), func(entry *snapshotEntry) error {
+		switch {
+		case isStateCf[entry.ColumnFamily]:
+			tree.add(&stateLeaf{entry.ColumnFamily, entry.Key, entry.Value})
+		case entry.ColumnFamily == "block":
+			header := new(types.BlockHeader)
+			if err := header.Deserialize(entry.Value); err != nil {
+				return err
+			}
+			if !header.Hash().Equal(crypto.NewHash(entry.Key)) {
+				return fmt.Errorf("snapshot block header mismatch the hash %x", entry.Key)
+			}
+			headers[header.Hash()] = header
+		case entry.ColumnFamily == "index":
+			index[string(entry.Key)] = entry.Value
+		case entry.ColumnFamily == mergeColumnFamily:
+			storage[string(entry.Key)] = entry.Value
+			writeSnapshotEntry(storageHasher, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if entries != manifest.Entries || !crypto.NewHash(hasher.Sum(nil)).Equal(manifest.DataHash) ||
+		!crypto.NewHash(storageHasher.Sum(nil)).Equal(manifest.StorageHash) {
+		return errors.New("snapshot data mismatch the manifest")
+	}
+	header, ok := headers[manifest.BlockHash]
+	if !ok || header.Height != manifest.Height {
+		return errors.New("snapshot block header mismatch the manifest")
+	}
+
+	// every header is an ancestor of the trusted one
+	hashs := make(map[uint32][]byte)
+	base := header.Height
+	for cur := header; ; {
+		hashs[cur.Height] = cur.Hash().Bytes()
+		base = cur.Height
+		previous, ok := headers[cur.PreviousHash]
+		if cur.Height == 0 || !ok {
+			break
+		}
+		if previous.Height+1 != cur.Height {
+			return fmt.Errorf("snapshot block header %d mismatch the previous height %d", cur.Height, previous.Height)
+		}
+		cur = previous
+	}
+	if len(hashs) != len(headers) {
+		return fmt.Errorf("%d snapshot block headers are not linked to the block", len(headers)-len(hashs))
+	}
+	if err := block_storage.CheckSnapshotIndex(index, base, header.Height, hashs); err != nil {
+		return err
+	}
+
+	if stateHash, _ := tree.root(); !stateHash.Equal(header.StateHash) {
+		return fmt.Errorf("snapshot state hash %s mismatch the block header %s", stateHash, header.StateHash)
+	}
+	return merge.CheckSnapshotStorage(storage)
+}
+
+func writeSnapshotEntry(w io.Writer, entry *snapshotEntry) error {
+	data := utils.Serialize(entry)
+	lenBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(lenBytes, uint32(len(data)))
+	if _, err := w.Write(lenBytes); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func readSnapshot(r io.Reader, fn func(entry *snapshotEntry) error) (uint64, error) {
+	var (
+		entries  uint64
+		lenBytes = make([]byte, 4)
+	)
+	allowed := map[string]bool{"block": true, "index": true}
+	for _, cfName := range snapshotColumnFamilies {
+		allowed[cfName] = true
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		if _, err := io.ReadFull(br, lenBytes); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return entries, err
+		}
+		size := binary.BigEndian.Uint32(lenBytes)
+		if size > snapshotMaxEntrySize {
+			return entries, fmt.Errorf("snapshot entry size %d exceeds %d", size, snapshotMaxEntrySize)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return entries, err
+		}
+		entry := new(snapshotEntry)
+		if err := utils.Deserialize(data, entry); err != nil {
+			return entries, err
+		}
+		if !allowed[entry.ColumnFamily] {
+			return entries, fmt.Errorf("unexpected column family %s in snapshot", entry.ColumnFamily)
+		}
+		if err := fn(entry); err != nil {
+			return entries, err
+		}
+		entries++
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/bocheninc/L0/components/db"
+	"github.com/bocheninc/L0/core/accounts"
+)
+
+// ErrHistoryNotFound is returned when the balance history of the height is not kept
+var ErrHistoryNotFound = errors.New("balance history not found")
+
+// balance history layout in the history column family:
+//   bh_ + address + height => balance of the address from the height
+//   bd_ + height => addresses changed at the height
+//   balanceHistoryStart => the first height recording balance history
+const (
+	historyColumnFamily = "history"
+	historyStartKey     = "balanceHistoryStart"
+)
+
+var (
+	historyPrefix = []byte("bh_")
+	diffPrefix    = []byte("bd_")
+)
+
+func historyKey(a accounts.Address, height uint32) []byte {
+	key := append(append([]byte{}, historyPrefix...), a.Bytes()...)
+	heightBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(heightBytes, height)
+	return append(key, heightBytes...)
+}
+
+func diffKey(height uint32) []byte {
+	heightBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(heightBytes, height)
+	return append(append([]byte{}, diffPrefix...), heightBytes...)
+}
+
+// HistoryWriteBatchs returns the balance history of the accounts changed by the block being executed,
+// history older than retention blocks is pruned, retention 0 keeps all
+func (state *State) HistoryWriteBatchs(height, retention uint32) ([]*db.WriteBatch, error) {
+	var (
+		writeBatchs []*db.WriteBatch
+		changed     []byte
+	)
+
+	start, err := state.dbHandler.Get(historyColumnFamily, []byte(historyStartKey))
+	if err != nil {
+		return nil, err
+	}
+	startHeight := height
+	if len(start) == 0 {
+		heightBytes := make([]byte, 4)
+		binary.BigEndian.PutUint32(heightBytes, height)
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(historyColumnFamily, db.OperationPut, []byte(historyStartKey), heightBytes))
+	} else {
+		startHeight = binary.BigEndian.Uint32(start)
+	}
+	// the balance an account has without history is kept since before the history start,
+	// e.g. the accounts funded before the history is recorded or imported by a snapshot
+	priorHeight := uint32(0)
+	if startHeight > 0 {
+		priorHeight = startHeight - 1
+	}
+
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	for addr, balance := range state.tmpBalance {
+		a := accounts.HexToAddress(addr)
+		amount, nonce, err := state.GetBalance(a)
+		if err != nil {
+			return nil, err
+		}
+		if amount.Cmp(balance.Amount) == 0 && nonce == balance.Nonce {
+			continue
+		}
+		if (amount.Sign() != 0 || nonce != 0) && priorHeight < height && !state.hasHistory(a) {
+			writeBatchs = append(writeBatchs, db.NewWriteBatch(historyColumnFamily, db.OperationPut, historyKey(a, priorHeight), NewBalance(amount, nonce).serialize()))
+		}
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(historyColumnFamily, db.OperationPut, historyKey(a, height), balance.serialize()))
+		changed = append(changed, a.Bytes()...)
+	}
+	if len(changed) > 0 {
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(historyColumnFamily, db.OperationPut, diffKey(height), changed))
+	}
+
+	if retention > 0 && height > retention {
+		pruned, err := state.pruneHistory(height - retention)
+		if err != nil {
+			return nil, err
+		}
+		writeBatchs = append(writeBatchs, pruned...)
+	}
+	return writeBatchs, nil
+}
+
+// pruneHistory drops the history superseded by the changes at the height
+func (state *State) pruneHistory(height uint32) ([]*db.WriteBatch, error) {
+	var writeBatchs []*db.WriteBatch
+	changed, err := state.dbHandler.Get(historyColumnFamily, diffKey(height))
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+accounts.AddressLength <= len(changed); i += accounts.AddressLength {
+		a := accounts.NewAddress(changed[i : i+accounts.AddressLength])
+		prefix := append(append([]byte{}, historyPrefix...), a.Bytes()...)
+		state.dbHandler.IteratePrefix(historyColumnFamily, prefix, false, func(key, value []byte) bool {
+			if binary.BigEndian.Uint32(key[len(prefix):]) >= height {
+				return false
+			}
+			writeBatchs = append(writeBatchs, db.NewWriteBatch(historyColumnFamily, db.OperationDelete, key, nil))
+			return true
+		})
+	}
+	if len(changed) > 0 {
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(historyColumnFamily, db.OperationDelete, diffKey(height), nil))
+	}
+	return writeBatchs, nil
+}
+
+func (state *State) hasHistory(a accounts.Address) bool {
+	found := false
+	prefix := append(append([]byte{}, historyPrefix...), a.Bytes()...)
+	state.dbHandler.IteratePrefix(historyColumnFamily, prefix, false, func(key, value []byte) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
+// GetBalanceAt returns balance and nonce of the account at the end of the block height
+func (state *State) GetBalanceAt(a accounts.Address, height uint32) (*big.Int, uint32, error) {
+	start, err := state.dbHandler.Get(historyColumnFamily, []byte(historyStartKey))
+	if err != nil {
+		return big.NewInt(0), 0, err
+	}
+	if len(start) == 0 || height < binary.BigEndian.Uint32(start) {
+		return big.NewInt(0), 0, ErrHistoryNotFound
+	}
+
+	var (
+		balance *Balance
+		found   bool
+	)
+	prefix := append(append([]byte{}, historyPrefix...), a.Bytes()...)
+	state.dbHandler.IteratePrefix(historyColumnFamily, prefix, true, func(key, value []byte) bool {
+		found = true
+		if binary.BigEndian.Uint32(key[len(prefix):]) > height {
+			return true
+		}
+		balance = new(Balance)
+		balance.deserialize(value)
+		return false
+	})
+
+	if balance != nil {
+		return balance.Amount, balance.Nonce, nil
+	}
+	if found {
+		// all changes are after the height and the first one is not from a prior balance, the account is empty before
+		return big.NewInt(0), 0, nil
+	}
+	// never changed since the history is recorded
+	return state.GetBalance(a)
+}
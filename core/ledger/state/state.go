@@ -36,6 +36,7 @@ type State struct {
 	balancePrefix []byte
 	columnFamily  string
 	tmpBalance    map[string]*Balance
+	fees          *big.Int
 	mu            sync.RWMutex
 }
 
@@ -53,6 +54,7 @@ func NewState(db *db.BlockchainDB) *State {
 		balancePrefix: []byte("bl_"),
 		columnFamily:  "balance",
 		tmpBalance:    make(map[string]*Balance),
+		fees:          big.NewInt(0),
 	}
 }
 
@@ -77,6 +79,7 @@ func (state *State) UpdateBalance(a accounts.Address, balance *Balance, fee *big
 		}
 		tmpBalance.Amount.Sub(tmpBalance.Amount.Sub(tmpBalance.Amount, fee), balance.Amount)
 		tmpBalance.Nonce = balance.Nonce
+		state.addFee(fee)
 	default:
 		return nil, errors.New("unknown operation")
 	}
@@ -128,6 +131,7 @@ func (state *State) Transfer(sender, recipient accounts.Address, fee *big.Int, b
 		}
 		senderBalance.Amount.Sub(senderBalance.Amount, fee)
 		senderBalance.Nonce = balance.Nonce
+		state.addFee(fee)
 		writeBatchs = append(writeBatchs, db.NewWriteBatch(state.columnFamily, db.OperationPut, append(state.balancePrefix, sender.Bytes()...),
 			senderBalance.serialize()))
 		return writeBatchs, nil
@@ -139,6 +143,7 @@ func (state *State) Transfer(sender, recipient accounts.Address, fee *big.Int, b
 	senderBalance.Amount.Sub(senderBalance.Amount.Sub(senderBalance.Amount, fee), balance.Amount)
 
 	senderBalance.Nonce = balance.Nonce
+	state.addFee(fee)
 
 	recipientBalance, err := state.GetTmpBalance(recipient)
 	if err != nil {
@@ -179,11 +184,31 @@ func (state *State) AtomicWrite(writeBatchs []*db.WriteBatch) error {
 	if err := state.dbHandler.AtomicWrite(writeBatchs); err != nil {
 		return err
 	}
-	//clear map
+	state.ClearTmpBalance()
+	return nil
+}
+
+//ClearTmpBalance drops the balances and the fees cached for the block being executed
+func (state *State) ClearTmpBalance() {
 	state.mu.Lock()
 	state.tmpBalance = make(map[string]*Balance)
+	state.fees = big.NewInt(0)
 	state.mu.Unlock()
-	return nil
+}
+
+func (state *State) addFee(fee *big.Int) {
+	state.mu.Lock()
+	state.fees.Add(state.fees, fee)
+	state.mu.Unlock()
+}
+
+//TakeFees returns the fees deducted from the senders since the last call and resets them
+func (state *State) TakeFees() *big.Int {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	fees := state.fees
+	state.fees = big.NewInt(0)
+	return fees
 }
 
 //checkBalance check negative Balance,flag = 1 add, flag = 2 sub
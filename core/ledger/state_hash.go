@@ -0,0 +1,296 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package ledger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/db"
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/components/utils"
+)
+
+const (
+	// stateTreeColumnFamily keeps the leaf and the node hashes of the state tree
+	stateTreeColumnFamily = "statetree"
+	// stateTreeDepth is the depth of the binary tree over the 1<<stateTreeDepth leaf buckets
+	stateTreeDepth = 16
+)
+
+var (
+	// ErrStateHashMismatch is returned when the state hash of a synced block differs from the local one
+	ErrStateHashMismatch = errors.New("state hash mismatch")
+
+	// stateColumnFamilies are the column families committed by the block state hash
+	stateColumnFamilies = []string{"balance", "scontract", validatorColumnFamily}
+
+	stateTreeVersionKey = []byte("v")
+	stateTreeLeafPrefix = []byte("l")
+	stateTreeNodePrefix = []byte("n")
+)
+
+type stateLeaf struct {
+	ColumnFamily string
+	Key          []byte
+	Value        []byte
+}
+
+// The state tree hashes every state key into one of the 1<<stateTreeDepth buckets, a bucket
+// hash is the merkle root of its sorted leaf hashes and the root is the binary tree over the
+// bucket hashes, so appending a block only rehashes the touched buckets and their paths.
+
+func stateBucket(cfName string, key []byte) uint32 {
+	h := crypto.Sha256(append([]byte(cfName+"|"), key...))
+	return uint32(binary.BigEndian.Uint16(h[:2]))
+}
+
+func stateLeafKey(bucket uint32, cfName string, key []byte) []byte {
+	k := append([]byte{}, stateTreeLeafPrefix...)
+	k = append(k, byte(bucket>>8), byte(bucket))
+	k = append(k, cfName+"|"...)
+	return append(k, key...)
+}
+
+func stateNodeKey(level int, index uint32) []byte {
+	k := append([]byte{}, stateTreeNodePrefix...)
+	return append(k, byte(level), byte(index>>8), byte(index))
+}
+
+func stateLeafHash(leaf *stateLeaf) crypto.Hash {
+	return crypto.DoubleSha256(utils.Serialize(leaf))
+}
+
+// stateNodeParent returns the parent hash, the parent of empty subtrees is empty
+func stateNodeParent(left, right crypto.Hash) crypto.Hash {
+	if left.Equal(crypto.Hash{}) && right.Equal(crypto.Hash{}) {
+		return crypto.Hash{}
+	}
+	return crypto.DoubleSha256(append(left.Bytes(), right.Bytes()...))
+}
+
+func stateBucketHash(leafs map[string]crypto.Hash) crypto.Hash {
+	if len(leafs) == 0 {
+		return crypto.Hash{}
+	}
+	keys := make([]string, 0, len(leafs))
+	for k := range leafs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	hashs := make([]crypto.Hash, 0, len(keys))
+	for _, k := range keys {
+		hashs = append(hashs, leafs[k])
+	}
+	return crypto.GetMerkleHash(hashs)
+}
+
+func stateTreeVersion() []byte {
+	return []byte(strings.Join(stateColumnFamilies, ","))
+}
+
+// stateHash returns the root of the state tree after applying writeBatchs and the writes of the tree
+func (ledger *Ledger) stateHash(writeBatchs []*db.WriteBatch) (crypto.Hash, []*db.WriteBatch) {
+	isStateCf := make(map[string]bool)
+	for _, cfName := range stateColumnFamilies {
+		isStateCf[cfName] = true
+	}
+
+	changes := make(map[uint32]map[string]*crypto.Hash)
+	for _, wb := range writeBatchs {
+		if !isStateCf[wb.CfName] {
+			continue
+		}
+		bucket := stateBucket(wb.CfName, wb.Key)
+		if changes[bucket] == nil {
+			changes[bucket] = make(map[string]*crypto.Hash)
+		}
+		k := string(stateLeafKey(bucket, wb.CfName, wb.Key))
+		switch wb.Operation {
+		case db.OperationPut:
+			h := stateLeafHash(&stateLeaf{wb.CfName, wb.Key, wb.Value})
+			changes[bucket][k] = &h
+		case db.OperationDelete:
+			changes[bucket][k] = nil
+		}
+	}
+
+	var treeWriteBatchs []*db.WriteBatch
+	nodes := make(map[uint32]crypto.Hash)
+	for bucket, leafChanges := range changes {
+		prefix := stateLeafKey(bucket, "", nil)
+		prefix = prefix[:len(prefix)-1]
+		leafs := make(map[string]crypto.Hash)
+		ledger.dbHandler.IteratePrefix(stateTreeColumnFamily, prefix, false, func(key, value []byte) bool {
+			var h crypto.Hash
+			h.SetBytes(value)
+			leafs[string(key)] = h
+			return true
+		})
+		for k, h := range leafChanges {
+			if h == nil {
+				delete(leafs, k)
+				treeWriteBatchs = append(treeWriteBatchs, db.NewWriteBatch(stateTreeColumnFamily, db.OperationDelete, []byte(k), nil))
+			} else {
+				leafs[k] = *h
+				treeWriteBatchs = append(treeWriteBatchs, db.NewWriteBatch(stateTreeColumnFamily, db.OperationPut, []byte(k), h.Bytes()))
+			}
+		}
+		nodes[bucket] = stateBucketHash(leafs)
+	}
+
+	for level := 0; ; level++ {
+		indexes := make([]uint32, 0, len(nodes))
+		for index := range nodes {
+			indexes = append(indexes, index)
+		}
+		sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+		for _, index := range indexes {
+			treeWriteBatchs = append(treeWriteBatchs, stateNodeWriteBatch(level, index, nodes[index]))
+		}
+		if level == stateTreeDepth {
+			break
+		}
+
+		parents := make(map[uint32]crypto.Hash)
+		for _, index := range indexes {
+			parent := index >> 1
+			if _, ok := parents[parent]; ok {
+				continue
+			}
+			left, ok := nodes[parent<<1]
+			if !ok {
+				left = ledger.stateNode(level, parent<<1)
+			}
+			right, ok := nodes[parent<<1|1]
+			if !ok {
+				right = ledger.stateNode(level, parent<<1|1)
+			}
+			parents[parent] = stateNodeParent(left, right)
+		}
+		nodes = parents
+	}
+
+	if root, ok := nodes[0]; ok {
+		return root, treeWriteBatchs
+	}
+	return ledger.stateNode(stateTreeDepth, 0), treeWriteBatchs
+}
+
+func (ledger *Ledger) stateNode(level int, index uint32) crypto.Hash {
+	var h crypto.Hash
+	if value, err := ledger.dbHandler.Get(stateTreeColumnFamily, stateNodeKey(level, index)); err == nil && len(value) > 0 {
+		h.SetBytes(value)
+	}
+	return h
+}
+
+func stateNodeWriteBatch(level int, index uint32, h crypto.Hash) *db.WriteBatch {
+	if h.Equal(crypto.Hash{}) {
+		return db.NewWriteBatch(stateTreeColumnFamily, db.OperationDelete, stateNodeKey(level, index), nil)
+	}
+	return db.NewWriteBatch(stateTreeColumnFamily, db.OperationPut, stateNodeKey(level, index), h.Bytes())
+}
+
+// stateTreeBuilder builds the whole state tree from the leafs streamed into their buckets,
+// only the leaf hashes are kept, the later leaf replaces the earlier one with the same key
+type stateTreeBuilder struct {
+	buckets map[uint32]map[string]crypto.Hash
+	leafs   int
+	writes  bool
+}
+
+// newStateTreeBuilder returns the builder, the writes of the tree are returned by root if writes is true
+func newStateTreeBuilder(writes bool) *stateTreeBuilder {
+	return &stateTreeBuilder{buckets: make(map[uint32]map[string]crypto.Hash), writes: writes}
+}
+
+func (builder *stateTreeBuilder) add(leaf *stateLeaf) {
+	bucket := stateBucket(leaf.ColumnFamily, leaf.Key)
+	if builder.buckets[bucket] == nil {
+		builder.buckets[bucket] = make(map[string]crypto.Hash)
+	}
+	k := string(stateLeafKey(bucket, leaf.ColumnFamily, leaf.Key))
+	if _, ok := builder.buckets[bucket][k]; !ok {
+		builder.leafs++
+	}
+	builder.buckets[bucket][k] = stateLeafHash(leaf)
+}
+
+// root returns the root of the state tree of the added leafs and the writes of the whole tree
+func (builder *stateTreeBuilder) root() (crypto.Hash, []*db.WriteBatch) {
+	var writeBatchs []*db.WriteBatch
+	nodes := make([]crypto.Hash, 1<<stateTreeDepth)
+	for bucket, bucketLeafs := range builder.buckets {
+		nodes[bucket] = stateBucketHash(bucketLeafs)
+		if builder.writes {
+			for k, h := range bucketLeafs {
+				writeBatchs = append(writeBatchs, db.NewWriteBatch(stateTreeColumnFamily, db.OperationPut, []byte(k), h.Bytes()))
+			}
+		}
+	}
+	for level := 0; ; level++ {
+		for index, h := range nodes {
+			if builder.writes && !h.Equal(crypto.Hash{}) {
+				writeBatchs = append(writeBatchs, stateNodeWriteBatch(level, uint32(index), h))
+			}
+		}
+		if level == stateTreeDepth {
+			break
+		}
+		parents := make([]crypto.Hash, len(nodes)/2)
+		for index := range parents {
+			parents[index] = stateNodeParent(nodes[index<<1], nodes[index<<1|1])
+		}
+		nodes = parents
+	}
+	return nodes[0], writeBatchs
+}
+
+// loadStateTree rebuilds the state tree if it is missing or was built for other column families
+func (ledger *Ledger) loadStateTree() error {
+	if version, err := ledger.dbHandler.Get(stateTreeColumnFamily, stateTreeVersionKey); err == nil && bytes.Equal(version, stateTreeVersion()) {
+		return nil
+	}
+	return ledger.rebuildStateTree()
+}
+
+// rebuildStateTree builds the state tree from the state column families
+func (ledger *Ledger) rebuildStateTree() error {
+	var writeBatchs []*db.WriteBatch
+	ledger.dbHandler.Iterate(stateTreeColumnFamily, func(key, value []byte) {
+		writeBatchs = append(writeBatchs, db.NewWriteBatch(stateTreeColumnFamily, db.OperationDelete, key, nil))
+	})
+	builder := newStateTreeBuilder(true)
+	for _, cfName := range stateColumnFamilies {
+		cfName := cfName
+		ledger.dbHandler.Iterate(cfName, func(key, value []byte) {
+			builder.add(&stateLeaf{cfName, key, value})
+		})
+	}
+	root, treeWriteBatchs := builder.root()
+	writeBatchs = append(writeBatchs, treeWriteBatchs...)
+	writeBatchs = append(writeBatchs, db.NewWriteBatch(stateTreeColumnFamily, db.OperationPut, stateTreeVersionKey, stateTreeVersion()))
+	log.Infof("rebuild state tree, leafs %d, root %s", builder.leafs, root)
+	return ledger.dbHandler.AtomicWrite(writeBatchs)
+}
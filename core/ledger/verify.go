@@ -0,0 +1,131 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/bocheninc/L0/components/db"
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/core/types"
+)
+
+// VerifyReport is the result of the ledger verification, DivergentHeight is the first height
+// whose block or state does not match the re-execution if Divergent is true
+type VerifyReport struct {
+	Height          uint32 `json:"height"`
+	Verified        uint32 `json:"verified"`
+	Divergent       bool   `json:"divergent"`
+	DivergentHeight uint32 `json:"divergentHeight"`
+	Reason          string `json:"reason"`
+}
+
+func (report *VerifyReport) diverge(height uint32, format string, args ...interface{}) *VerifyReport {
+	report.Divergent = true
+	report.DivergentHeight = height
+	report.Reason = fmt.Sprintf(format, args...)
+	return report
+}
+
+// Verify checks the header links and the transactions merkle hash of every block, re-executes the
+// transactions into the empty scratch database and compares the balances and the contract state
+// with the ledger, it stops at the first divergent height
+func (ledger *Ledger) Verify(scratch *db.BlockchainDB) (*VerifyReport, error) {
+	height, err := ledger.Height()
+	if err != nil {
+		return nil, err
+	}
+	if base := ledger.block.GetBaseHeight(); base > 0 {
+		return nil, fmt.Errorf("ledger is bootstrapped from the snapshot at height %d, no blocks to re-execute", base)
+	}
+	if prunedHeight, ok := ledger.block.GetPrunedHeight(); ok {
+		return nil, fmt.Errorf("transactions up to height %d are pruned, no blocks to re-execute", prunedHeight)
+	}
+
+	replay := newLedger(scratch)
+	if h, err := replay.Height(); err != nil || h != 0 {
+		return nil, fmt.Errorf("scratch database is not empty, height %d, err %v", h, err)
+	}
+
+	report := &VerifyReport{Height: height}
+	previous, err := ledger.GetBlockByNumber(0)
+	if err != nil {
+		return nil, err
+	}
+	if genesis := replay.GetGenesisBlock(); !genesis.Hash().Equal(previous.Hash()) {
+		return report.diverge(0, "genesis block %s, expected %s", previous.Hash(), genesis.Hash()), nil
+	}
+
+	for h := uint32(1); h <= height; h++ {
+		header, err := ledger.GetBlockByNumber(h)
+		if err != nil {
+			return report.diverge(h, "block header not found, %v", err), nil
+		}
+		if header.Height != h || !header.PreviousHash.Equal(previous.Hash()) {
+			return report.diverge(h, "block %s height %d previous hash %s, expected %s", header.Hash(), header.Height, header.PreviousHash, previous.Hash()), nil
+		}
+		txs, err := ledger.GetTxsByBlockHash(header.Hash().Bytes(), 100)
+		if err != nil {
+			return report.diverge(h, "block %s transactions not found, %v", header.Hash(), err), nil
+		}
+		if hash := merkleRootHash(txs); !hash.Equal(header.TxsMerkleHash) {
+			return report.diverge(h, "block %s transactions merkle hash %s, expected %s", header.Hash(), hash, header.TxsMerkleHash), nil
+		}
+
+		replayHeader := *header
+		if err := replay.AppendBlock(&types.Block{Header: &replayHeader, Transactions: txs}, false); err != nil {
+			return report.diverge(h, "block %s re-execution error %v", header.Hash(), err), nil
+		}
+
+		previous = header
+		report.Verified = h
+		if h%1000 == 0 {
+			log.Infof("verified blocks up to height %d of %d", h, height)
+		}
+	}
+
+	for _, cfName := range stateColumnFamilies {
+		if reason := compareColumnFamily(ledger.dbHandler, replay.dbHandler, cfName); reason != "" {
+			return report.diverge(height, "%s", reason), nil
+		}
+	}
+	return report, nil
+}
+
+// compareColumnFamily returns the first difference of the column family between the databases
+func compareColumnFamily(local, replay *db.BlockchainDB, cfName string) string {
+	var reason string
+	local.IteratePrefix(cfName, nil, false, func(key, value []byte) bool {
+		if replayValue, _ := replay.Get(cfName, key); !bytes.Equal(value, replayValue) {
+			reason = fmt.Sprintf("%s key %x value %x, re-executed value %x", cfName, key, value, replayValue)
+		}
+		return reason == ""
+	})
+	if reason != "" {
+		return reason
+	}
+	replay.IteratePrefix(cfName, nil, false, func(key, value []byte) bool {
+		if localValue, _ := local.Get(cfName, key); len(localValue) == 0 {
+			reason = fmt.Sprintf("%s key %x missing, re-executed value %x", cfName, key, value)
+		}
+		return reason == ""
+	})
+	return reason
+}
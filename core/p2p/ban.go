@@ -0,0 +1,178 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bocheninc/L0/components/log"
+)
+
+// banPrefix is the key prefix of the bans in the peer column family
+const banPrefix = "ban:"
+
+// maxTempBans is the number of temporary bans after which a peer is banned persistently
+var maxTempBans = 3
+
+// Ban is a banned peer, Until is zero if the ban is persistent
+type Ban struct {
+	ID     string `json:"id"`
+	IP     string `json:"ip"`
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+	Until  int64  `json:"until"`
+}
+
+func (b *Ban) active(now time.Time) bool {
+	return b.Until == 0 || now.Unix() < b.Until
+}
+
+// banList holds the bans by peer id if the ids are bound to the keys by certificates, or else by peer ip,
+// the expired temporary bans are kept to count the repeated offences
+type banList struct {
+	sync.RWMutex
+	byID bool
+	bans map[string]*Ban
+}
+
+func newBanList(byID bool) *banList {
+	return &banList{byID: byID, bans: make(map[string]*Ban)}
+}
+
+func (bl *banList) key(id, ip string) string {
+	if bl.byID {
+		return id
+	}
+	return ip
+}
+
+// peerIP returns the ip of the connection of the peer, or of its address if it is not connected
+func peerIP(peer *Peer) string {
+	addr := peer.Address
+	if peer.Conn != nil {
+		addr = peer.Conn.RemoteAddr().String()
+	}
+	ip, _, _ := net.SplitHostPort(addr)
+	return ip
+}
+
+// load reads the bans from database
+func (bl *banList) load() {
+	bl.Lock()
+	defer bl.Unlock()
+	dbInstance.IteratePrefix(columnFamily, []byte(banPrefix), false, func(key, value []byte) bool {
+		b := new(Ban)
+		if err := json.Unmarshal(value, b); err != nil {
+			log.Errorf("Database ban %s error %v", key, err)
+			return true
+		}
+		if key := bl.key(b.ID, b.IP); key != "" {
+			bl.bans[key] = b
+		}
+		return true
+	})
+}
+
+func (bl *banList) banned(id PeerID, ip string, now time.Time) bool {
+	bl.RLock()
+	defer bl.RUnlock()
+	b, ok := bl.bans[bl.key(id.String(), ip)]
+	return ok && b.active(now)
+}
+
+// add bans the peer for the duration, or persistently after maxTempBans temporary bans
+func (bl *banList) add(peer *Peer, reason string, duration time.Duration, now time.Time) *Ban {
+	bl.Lock()
+	defer bl.Unlock()
+	ip := peerIP(peer)
+	key := bl.key(peer.ID.String(), ip)
+	b, ok := bl.bans[key]
+	if !ok {
+		b = &Ban{}
+		bl.bans[key] = b
+	}
+	b.ID, b.IP = peer.ID.String(), ip
+	b.Reason = reason
+	b.Count++
+	if b.Count >= maxTempBans {
+		b.Until = 0
+	} else {
+		b.Until = now.Add(duration).Unix()
+	}
+
+	data, _ := json.Marshal(b)
+	if err := dbInstance.Put(columnFamily, []byte(banPrefix+key), data); err != nil {
+		log.Errorf("Database put ban of peer [%s] error %v", peer, err)
+	}
+	ban := *b
+	return &ban
+}
+
+// remove removes the ban and the offences of the peer id in hex, or of the peer ip if bans are by ip
+func (bl *banList) remove(key string) error {
+	bl.Lock()
+	defer bl.Unlock()
+	if _, ok := bl.bans[key]; !ok {
+		return fmt.Errorf("peer %s is not banned", key)
+	}
+	if err := dbInstance.Delete(columnFamily, []byte(banPrefix+key)); err != nil {
+		return err
+	}
+	delete(bl.bans, key)
+	return nil
+}
+
+// list returns the active bans ordered by id and ip
+func (bl *banList) list(now time.Time) []*Ban {
+	bl.RLock()
+	defer bl.RUnlock()
+	var bans []*Ban
+	for _, b := range bl.bans {
+		if b.active(now) {
+			ban := *b
+			bans = append(bans, &ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		if bans[i].ID != bans[j].ID {
+			return bans[i].ID < bans[j].ID
+		}
+		return bans[i].IP < bans[j].IP
+	})
+	return bans
+}
+
+// BannedPeers returns the peers banned now
+func (srv *Server) BannedPeers() []*Ban {
+	return srv.peerManager.bans.list(time.Now())
+}
+
+// Unban removes the ban and the offences of the peer id in hex, or of the peer ip if CA is disabled
+func (srv *Server) Unban(key string) error {
+	if err := srv.peerManager.bans.remove(key); err != nil {
+		return err
+	}
+	log.Infof("Peer %s unbanned", key)
+	return nil
+}
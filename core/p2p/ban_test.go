@@ -0,0 +1,152 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bocheninc/L0/components/db"
+)
+
+func TestPeerScore(t *testing.T) {
+	now := time.Now()
+	s := new(peerScore)
+	if score, ban := s.add(PenaltyInvalidBlock, 100, now); score != 50 || ban {
+		t.Errorf("score %d ban %v", score, ban)
+	}
+	// 10 minutes recover 10 points
+	if score, ban := s.add(PenaltyInvalidBlock, 100, now.Add(10*time.Minute)); score != 90 || ban {
+		t.Errorf("score %d ban %v", score, ban)
+	}
+	if score, ban := s.add(PenaltyInvalidTx, 100, now.Add(10*time.Minute)); score != 100 || !ban {
+		t.Errorf("score %d ban %v", score, ban)
+	}
+	if _, ban := s.add(PenaltyInvalidTx, 100, now.Add(10*time.Minute)); ban {
+		t.Error("peer banned twice")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := new(rateLimiter)
+	for i := 0; i < 10; i++ {
+		if !l.allow(10, now) {
+			t.Fatalf("message %d over the burst", i)
+		}
+	}
+	if l.allow(10, now) {
+		t.Error("message over the rate allowed")
+	}
+	if !l.allow(10, now.Add(100*time.Millisecond)) || l.allow(10, now.Add(100*time.Millisecond)) {
+		t.Error("bucket refill error")
+	}
+	if !l.allow(0, now) {
+		t.Error("message limited with rate 0")
+	}
+}
+
+func TestBanList(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "p2p-bans")
+	defer os.RemoveAll(dir)
+	cfg := db.DefaultConfig()
+	cfg.DbPath = dir
+	dbInstance = db.OpenDB(cfg)
+	defer func() {
+		dbInstance.Close()
+		dbInstance = nil
+	}()
+
+	now := time.Now()
+	peer := NewPeer([]byte("0001_abc"), nil, "127.0.0.1:20166", nil)
+	bl := newBanList(true)
+	for i := 1; i < maxTempBans; i++ {
+		b := bl.add(peer, "test", time.Hour, now)
+		if b.Count != i || b.Until != now.Add(time.Hour).Unix() {
+			t.Fatalf("temporary ban %v", b)
+		}
+	}
+	if !bl.banned(peer.ID, "", now) || bl.banned(peer.ID, "", now.Add(2*time.Hour)) {
+		t.Error("temporary ban error")
+	}
+	if len(bl.list(now.Add(2*time.Hour))) != 0 {
+		t.Error("expired ban listed")
+	}
+
+	if b := bl.add(peer, "test", time.Hour, now); b.Until != 0 {
+		t.Errorf("ban %v is not persistent", b)
+	}
+
+	// bans are reloaded from database
+	bl = newBanList(true)
+	bl.load()
+	if !bl.banned(peer.ID, "", now.Add(24*time.Hour)) {
+		t.Error("persistent ban not loaded")
+	}
+	if bans := bl.list(now); len(bans) != 1 || bans[0].ID != peer.ID.String() || bans[0].Count != maxTempBans {
+		t.Errorf("bans %v", bans)
+	}
+
+	if err := bl.remove(peer.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := bl.remove(peer.ID.String()); err == nil {
+		t.Error("peer unbanned twice")
+	}
+	bl = newBanList(true)
+	bl.load()
+	if bl.banned(peer.ID, "", now) {
+		t.Error("removed ban loaded")
+	}
+}
+
+func TestBanListByIP(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "p2p-bans")
+	defer os.RemoveAll(dir)
+	cfg := db.DefaultConfig()
+	cfg.DbPath = dir
+	dbInstance = db.OpenDB(cfg)
+	defer func() {
+		dbInstance.Close()
+		dbInstance = nil
+	}()
+
+	// without certificates a banned peer can't come back under another id
+	now := time.Now()
+	peer := NewPeer([]byte("0001_abc"), nil, "127.0.0.1:20166", nil)
+	bl := newBanList(false)
+	bl.add(peer, "test", time.Hour, now)
+	if !bl.banned(PeerID("0002_abc"), "127.0.0.1", now) || bl.banned(peer.ID, "127.0.0.2", now) {
+		t.Error("ban by ip error")
+	}
+
+	bl = newBanList(false)
+	bl.load()
+	if bans := bl.list(now); len(bans) != 1 || bans[0].IP != "127.0.0.1" {
+		t.Errorf("bans %v", bans)
+	}
+	if err := bl.remove("127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if bl.banned(peer.ID, "127.0.0.1", now) {
+		t.Error("removed ban by ip")
+	}
+}
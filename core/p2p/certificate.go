@@ -0,0 +1,240 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/log"
+)
+
+// certCheckInterval is the interval to disconnect the peers whose certificates expire
+var certCheckInterval = time.Minute
+
+// credentials are the private key and the certificates used in the handshakes, with the serial numbers revoked by the CA
+type credentials struct {
+	caEnabled       bool
+	privateKey      []byte
+	certificate     []byte
+	rootCertificate []byte
+	root            *x509.Certificate
+	revoked         map[string]bool
+	// crlPath and crlNextUpdate are the path and the next update of the revocation list, zero if it has none
+	crlPath       string
+	crlNextUpdate time.Time
+}
+
+// loadCredentials reads the key, the certificate, the CA certificate and the revocation list of the node,
+// the certificate must match the key and be issued by the CA
+func loadCredentials(cfg *Config) (*credentials, error) {
+	privateKeyBytes, err := ioutil.ReadFile(cfg.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("read file %s error: %s", cfg.KeyPath, err)
+	}
+	certificateBytes, err := ioutil.ReadFile(cfg.CrtPath)
+	if err != nil {
+		return nil, fmt.Errorf("read file %s error: %s", cfg.CrtPath, err)
+	}
+	rootCertificateBytes, err := ioutil.ReadFile(cfg.CAPath)
+	if err != nil {
+		return nil, fmt.Errorf("read file %s error: %s", cfg.CAPath, err)
+	}
+
+	privateKey, err := crypto.ParseSigner(privateKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse key %s error: %s", cfg.KeyPath, err)
+	}
+	cert, err := crypto.ParseCrt(certificateBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate %s error: %s", cfg.CrtPath, err)
+	}
+	root, err := crypto.ParseCrt(rootCertificateBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate %s error: %s", cfg.CAPath, err)
+	}
+	if !crypto.MatchSigner(cert, privateKey) {
+		return nil, fmt.Errorf("certificate %s doesn't match key %s", cfg.CrtPath, cfg.KeyPath)
+	}
+	if err := crypto.VerifyCertificate(root, cert); err != nil {
+		return nil, fmt.Errorf("certificate %s isn't issued by %s: %s", cfg.CrtPath, cfg.CAPath, err)
+	}
+
+	creds := &credentials{
+		caEnabled:       true,
+		privateKey:      privateKeyBytes,
+		certificate:     certificateBytes,
+		rootCertificate: rootCertificateBytes,
+		root:            root,
+		revoked:         make(map[string]bool),
+	}
+	if cfg.CRLPath != "" {
+		data, err := ioutil.ReadFile(cfg.CRLPath)
+		if err != nil {
+			return nil, fmt.Errorf("read file %s error: %s", cfg.CRLPath, err)
+		}
+		crl, err := crypto.ParseCRL(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse revocation list %s error: %s", cfg.CRLPath, err)
+		}
+		// the CA certificates issued before don't have the crlSign key usage, only the signature is checked
+		if err := root.CheckSignature(crl.SignatureAlgorithm, crl.RawTBSRevocationList, crl.Signature); err != nil {
+			return nil, fmt.Errorf("revocation list %s isn't signed by %s: %s", cfg.CRLPath, cfg.CAPath, err)
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			creds.revoked[entry.SerialNumber.String()] = true
+		}
+		creds.crlPath = cfg.CRLPath
+		creds.crlNextUpdate = crl.NextUpdate
+	}
+
+	if err := creds.checkCertificate(cert, time.Now()); err != nil {
+		log.Warnf("certificate %s of the node: %s", cfg.CrtPath, err)
+	}
+	if err := creds.checkRevocationList(time.Now()); err != nil {
+		log.Warnf("%s, the certificates revoked later are still trusted", err)
+	}
+	return creds, nil
+}
+
+// generateCredentials returns a self-signed certificate with a new key, used when CA is disabled
+func generateCredentials() (*credentials, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("generate privatekey err: %s", err)
+	}
+	privateKey, err := crypto.GeneratePrivateKeyBytes(key)
+	if err != nil {
+		return nil, fmt.Errorf("Generate private Key Bytes error: %s", err)
+	}
+	rootCertificate, err := crypto.GenerateRootCertificateBytes(crypto.NewCertificate(crypto.CertInformation{IsCA: true}), key)
+	if err != nil {
+		return nil, fmt.Errorf("Generate root Certificate  Bytes error: %s", err)
+	}
+
+	return &credentials{
+		privateKey:      privateKey,
+		certificate:     rootCertificate,
+		rootCertificate: rootCertificate,
+	}, nil
+}
+
+// checkCertificate returns an error if the certificate is expired or revoked
+func (creds *credentials) checkCertificate(cert *x509.Certificate, now time.Time) error {
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("certificate %s is only valid from %v to %v", cert.SerialNumber, cert.NotBefore, cert.NotAfter)
+	}
+	if creds.revoked[cert.SerialNumber.String()] {
+		return fmt.Errorf("certificate %s is revoked", cert.SerialNumber)
+	}
+	return nil
+}
+
+// checkRevocationList returns an error if the revocation list is out of date, it is still used
+func (creds *credentials) checkRevocationList(now time.Time) error {
+	if !creds.crlNextUpdate.IsZero() && now.After(creds.crlNextUpdate) {
+		return fmt.Errorf("revocation list %s expired at %v", creds.crlPath, creds.crlNextUpdate)
+	}
+	return nil
+}
+
+// verifyPeerCertificate returns an error if the certificate of a connected peer is no longer trusted
+func (creds *credentials) verifyPeerCertificate(cert *x509.Certificate, now time.Time) error {
+	if !creds.caEnabled {
+		return nil
+	}
+	if err := crypto.VerifyCertificate(creds.root, cert); err != nil {
+		return fmt.Errorf("certificate %s isn't issued by the CA: %s", cert.SerialNumber, err)
+	}
+	return creds.checkCertificate(cert, now)
+}
+
+// certStore holds the credentials of the server, they are replaced when reloaded
+type certStore struct {
+	sync.RWMutex
+	creds *credentials
+}
+
+func (store *certStore) get() *credentials {
+	store.RLock()
+	defer store.RUnlock()
+	return store.creds
+}
+
+func (store *certStore) set(creds *credentials) {
+	store.Lock()
+	defer store.Unlock()
+	store.creds = creds
+}
+
+// ReloadCertificates reloads the key, the certificates and the revocation list from the configured paths,
+// the connected peers stay connected unless their certificates are revoked, expired or not issued by the CA
+func (srv *Server) ReloadCertificates() error {
+	if !srv.CAEnabled {
+		return errors.New("CA is not enabled")
+	}
+
+	creds, err := loadCredentials(&srv.Config)
+	if err != nil {
+		return err
+	}
+	srv.certs.set(creds)
+	log.Infof("Certificates reloaded, %d revoked", len(creds.revoked))
+
+	srv.checkPeerCertificates()
+	return nil
+}
+
+// checkPeerCertificates disconnects the peers whose certificates are no longer trusted
+func (srv *Server) checkPeerCertificates() {
+	creds := srv.certs.get()
+	now := time.Now()
+	for _, peer := range srv.peerManager.GetPeers() {
+		if peer.cert == nil {
+			continue
+		}
+		if err := creds.verifyPeerCertificate(peer.cert, now); err != nil {
+			log.Warnf("Disconnect peer [%s], %s", peer, err)
+			srv.peerManager.delPeer <- peer.Conn
+		}
+	}
+}
+
+// watchCertificates disconnects the peers whose certificates expire and warns once the revocation list expires
+func (srv *Server) watchCertificates() {
+	ticker := time.NewTicker(certCheckInterval)
+	defer ticker.Stop()
+	var warned *credentials
+	for range ticker.C {
+		if creds := srv.certs.get(); creds != warned {
+			if err := creds.checkRevocationList(time.Now()); err != nil {
+				log.Warnf("%s, reload the certificates with an updated one", err)
+				warned = creds
+			}
+		}
+		srv.checkPeerCertificates()
+	}
+}
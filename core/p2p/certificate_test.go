@@ -0,0 +1,106 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bocheninc/L0/components/crypto"
+)
+
+func TestLoadCredentialsRevoked(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "p2p-certs")
+	defer os.RemoveAll(dir)
+
+	ca, caKey, creds := newTestCA(t)
+	a := newTestNode(t, "a", "a", ca, caKey)
+	b := newTestNode(t, "b", "b", ca, caKey)
+	aCert, _ := crypto.ParseCrt(a.cert)
+
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(1),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().AddDate(0, 0, 1),
+		RevokedCertificateEntries: []x509.RevocationListEntry{{SerialNumber: aCert.SerialNumber, RevocationTime: time.Now()}},
+	}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{
+		KeyPath: filepath.Join(dir, "b.key"),
+		CrtPath: filepath.Join(dir, "b.crt"),
+		CAPath:  filepath.Join(dir, "ca.crt"),
+		CRLPath: filepath.Join(dir, "ca.crl"),
+	}
+	ioutil.WriteFile(cfg.KeyPath, b.key, 0600)
+	ioutil.WriteFile(cfg.CrtPath, b.cert, 0644)
+	ioutil.WriteFile(cfg.CAPath, creds.rootCertificate, 0644)
+	ioutil.WriteFile(cfg.CRLPath, pem.EncodeToMemory(&pem.Block{Bytes: crl, Type: "X509 CRL"}), 0644)
+
+	loaded, err := loadCredentials(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := newTestNonce()
+	enc, _ := NewEncHandshake(a.id, b.id, nonce, a.cert, a.key)
+	if _, err := enc.verify(loaded, b.id, nonce); err == nil {
+		t.Error("revoked certificate accepted")
+	}
+	if err := loaded.verifyPeerCertificate(aCert, time.Now()); err == nil {
+		t.Error("revoked peer certificate still trusted")
+	}
+	if err := loaded.checkRevocationList(time.Now()); err != nil {
+		t.Error(err)
+	}
+	if err := loaded.checkRevocationList(time.Now().AddDate(0, 0, 2)); err == nil {
+		t.Error("expired revocation list not reported")
+	}
+	bCert, _ := crypto.ParseCrt(b.cert)
+	if err := loaded.verifyPeerCertificate(bCert, time.Now()); err != nil {
+		t.Errorf("peer certificate error %v", err)
+	}
+	if err := loaded.verifyPeerCertificate(bCert, bCert.NotAfter.Add(time.Second)); err == nil {
+		t.Error("expired peer certificate still trusted")
+	}
+
+	// a revocation list of another CA is rejected
+	other, otherKey, _ := newTestCA(t)
+	crl, _ = x509.CreateRevocationList(rand.Reader, &x509.RevocationList{Number: big.NewInt(1), ThisUpdate: time.Now()}, other, otherKey)
+	ioutil.WriteFile(cfg.CRLPath, crl, 0644)
+	if _, err := loadCredentials(cfg); err == nil {
+		t.Error("revocation list of another CA accepted")
+	}
+
+	// the key must match the certificate
+	ioutil.WriteFile(cfg.KeyPath, a.key, 0600)
+	cfg.CRLPath = ""
+	if _, err := loadCredentials(cfg); err == nil {
+		t.Error("certificate of another key accepted")
+	}
+}
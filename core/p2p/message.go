@@ -19,6 +19,7 @@
 package p2p
 
 import (
+	"errors"
 	"fmt"
 	"io"
 
@@ -53,6 +54,8 @@ var (
 
 	maxMsgSize  uint64 = 1024 * 1024 * 100
 	nilCheckSum        = crypto.Sha256(nil)
+
+	errChecksum = errors.New("message checksum error")
 )
 
 // MsgReadWriter is the interface that groups the p2p message Read and Write methods.
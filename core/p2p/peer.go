@@ -20,6 +20,7 @@ package p2p
 
 import (
 	"bytes"
+	"crypto/x509"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -138,6 +139,10 @@ type Peer struct {
 	Conn           net.Conn
 
 	running map[string]*protoRW
+	// cert is the certificate verified in the handshake
+	cert    *x509.Certificate
+	score   *peerScore
+	limiter *rateLimiter
 }
 
 // NewPeer returns a new Peer with input id
@@ -153,6 +158,16 @@ func NewPeer(id []byte, conn net.Conn, addr string, protocols []Protocol) *Peer
 		Conn:           conn,
 		Address:        addr,
 		running:        protoMap,
+		score:          new(peerScore),
+		limiter:        new(rateLimiter),
+	}
+}
+
+// withConn replaces the connection of the peer and its protocols, e.g. by the encrypted one
+func (peer *Peer) withConn(conn net.Conn) {
+	peer.Conn = conn
+	for _, rw := range peer.running {
+		rw.w = conn
 	}
 }
 
@@ -204,6 +219,10 @@ func (peer *Peer) run() {
 	peerManager := getPeerManager()
 	for {
 		m, err := readMsg(conn)
+		if err == errChecksum {
+			peerManager.misbehave(peer, PenaltyBadChecksum, "message checksum error")
+			continue
+		}
 		if m == nil || err != nil {
 			log.Errorf("peer read msg error %s", err)
 			peerManager.delPeer <- conn
@@ -217,6 +236,11 @@ func (peer *Peer) run() {
 		// Update the ActiveTime when message reached
 		peerManager.alivePeer <- conn
 
+		if !peer.limiter.allow(config.MaxMsgRate, time.Now()) {
+			peerManager.misbehave(peer, PenaltyRateLimit, fmt.Sprintf("message rate over %d/s", config.MaxMsgRate))
+			continue
+		}
+
 		switch m.Cmd {
 		case pingMsg:
 			respMsg := NewMsg(pongMsg, nil)
@@ -235,6 +259,9 @@ func (peer *Peer) run() {
 				proto := p.getProto(m.Cmd)
 				if proto != nil {
 					proto.in <- *m
+				} else {
+					// messages of newer protocol versions are dropped
+					log.Warnf("Unknown message %d from peer [%s]", m.Cmd, peer)
 				}
 			} else {
 				log.Error("unknown message", p)
@@ -52,6 +52,7 @@ type peerManager struct {
 	broadcastCh  chan *Msg
 	clientConn   chan net.Conn
 	dialTask     chan *Peer
+	bans         *banList
 }
 
 // getPeerManager returns a peerManager
@@ -74,6 +75,7 @@ func getPeerManager() *peerManager {
 			clientConn:   make(chan net.Conn, 8),
 			dialTask:     make(chan *Peer, 8),
 			dialTaskDone: make(chan string),
+			bans:         newBanList(config.CAEnabled),
 		}
 		// log.Debugf("local peerinfo %s", pm.localPeer)
 	}
@@ -119,6 +121,12 @@ func (pm *peerManager) add(peer *Peer) {
 		return
 	}
 
+	if pm.bans.banned(peer.ID, peerIP(peer), time.Now()) {
+		log.Debugf("Peer [%s] is banned", peer.ID)
+		peer.Conn.Close()
+		return
+	}
+
 	peer.LastActiveTime = time.Now()
 	pm.peers.set(peer.Conn, peer)
 	log.Infof("Add Peer [%s] Success.", peer)
@@ -186,6 +194,7 @@ func (pm *peerManager) init() {
 	if dbInstance == nil {
 		log.Fatalln("Error,the database is not initialized.")
 	}
+	pm.bans.load()
 	list, err := dbInstance.Get(columnFamily, []byte("peerList"))
 	if err != nil {
 		log.Errorln("Database get peers error :", err.Error())
@@ -237,7 +246,8 @@ func (pm *peerManager) connect(peer *Peer) {
 
 	if _, ok := pm.dialings[peer.String()]; ok ||
 		pm.peers.contains(peer.ID) ||
-		pm.handshakings.contains(peer.ID) {
+		pm.handshakings.contains(peer.ID) ||
+		pm.bans.banned(peer.ID, peerIP(peer), time.Now()) {
 		// log.Debugf("peer [%s] already connected", peer.ID)
 		// log.Debugf("%s - %s - %s - %s", ok, pm.peers.contains(peer.ID), pm.handshakings.contains(peer.ID), peer)
 		return
@@ -19,19 +19,25 @@
 package p2p
 
 import (
+	"crypto/ecdh"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"io"
+	"time"
 
 	"github.com/bocheninc/L0/components/crypto"
-	"github.com/bocheninc/L0/components/log"
 	"github.com/bocheninc/L0/components/utils"
 )
 
 var (
 	baseProtocolName    = "l0-base-protocol"
-	baseProtocolVersion = "0.0.1"
+	baseProtocolVersion = "0.0.2"
+	maxProtocolVersion  = "0.0.3"
+	handshakeNonceSize  = 32
 	protoHandshake      *ProtoHandshake
-	encHandshake        *EncHandshake
 )
 
 // Protocol raw structure
@@ -66,6 +72,11 @@ type ProtoHandshake struct {
 	Version    string
 	ID         []byte
 	SrvAddress string
+	// Nonce is the fresh challenge which the remote peer signs in its encryption handshake
+	Nonce      []byte
+	MaxVersion string
+	// SessionKey is the ephemeral public key of the key agreement for the encrypted transport
+	SessionKey []byte
 }
 
 // GetProtoHandshake returns protocol handshake
@@ -76,35 +87,63 @@ func GetProtoHandshake() *ProtoHandshake {
 			Version:    baseProtocolVersion,
 			ID:         getPeerID(),
 			SrvAddress: getPeerAddress(config.Address),
+			MaxVersion: maxProtocolVersion,
 		}
 	}
 	return protoHandshake
 }
 
-// GetEncHandshake returns enchandshake message
-func GetEncHandshake(cert, key []byte) *EncHandshake {
-	if encHandshake == nil {
-		privateKey, err := crypto.ParseKey(key)
-		if err != nil {
-			log.Errorf("parse key error: %s", err)
-			return nil
-		}
+// newProtoHandshake returns the protocol handshake with a fresh challenge nonce and session key for a connection
+func newProtoHandshake() (*ProtoHandshake, *ecdh.PrivateKey, error) {
+	nonce := make([]byte, handshakeNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	sessionKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	proto := *GetProtoHandshake()
+	proto.Nonce = nonce
+	proto.SessionKey = sessionKey.PublicKey().Bytes()
+	return &proto, sessionKey, nil
+}
 
-		// TODO　Generate random string
-		sign, err := crypto.SignRsa(privateKey, []byte("random string"))
-		if err != nil {
-			log.Errorf("sign rsa error: %s", err)
-			return nil
-		}
+// NewEncHandshake returns the encryption handshake answering the challenge nonce of the remote peer,
+// the signature is bound to both peer ids so that it can't be replayed or relayed to another peer
+func NewEncHandshake(localID, remoteID, nonce, cert, key []byte) (*EncHandshake, error) {
+	privateKey, err := crypto.ParseSigner(key)
+	if err != nil {
+		return nil, fmt.Errorf("parse key error: %s", err)
+	}
 
-		encHandshake = &EncHandshake{
-			Signature: sign,
-			Hashed:    sha256.Sum256([]byte("random string")),
-			ID:        getPeerID(),
-			Cert:      cert,
-		}
+	sign, err := crypto.SignData(privateKey, challengeData(localID, remoteID, nonce))
+	if err != nil {
+		return nil, fmt.Errorf("sign challenge error: %s", err)
 	}
-	return encHandshake
+
+	return &EncHandshake{
+		ID:        localID,
+		Signature: sign,
+		Cert:      cert,
+	}, nil
+}
+
+type handshakeChallenge struct {
+	Protocol string
+	Signer   []byte
+	Verifier []byte
+	Nonce    []byte
+}
+
+// challengeData returns the data which the signer signs to answer the challenge nonce of the verifier
+func challengeData(signer, verifier, nonce []byte) []byte {
+	return utils.Serialize(&handshakeChallenge{
+		Protocol: baseProtocolName,
+		Signer:   signer,
+		Verifier: verifier,
+		Nonce:    nonce,
+	})
 }
 
 // serialize ProtoHandshake instance to []byte
@@ -131,41 +170,44 @@ func (proto *ProtoHandshake) matchProtocol(i interface{}) bool {
 type EncHandshake struct {
 	ID        []byte
 	Signature []byte
-	Hashed    [sha256.Size]byte
 	Cert      []byte
 }
 
-// matchProtocol returns the result of handshake
-func (enc *EncHandshake) matchProtocol(i interface{}) bool {
-	if enc != nil && len(enc.Hashed) != 0 && enc.Cert != nil {
-		cert, err := crypto.ParseCrt(enc.Cert)
-		if err != nil {
-			log.Errorf("parseCrt error: %s", err)
-			return false
-		}
+// verify checks the certificate of the remote peer and its answer to the local challenge nonce, it returns the
+// certificate. self-signed certificates are only accepted when CA is disabled
+func (enc *EncHandshake) verify(creds *credentials, localID, nonce []byte) (*x509.Certificate, error) {
+	if len(enc.Cert) == 0 || len(enc.Signature) == 0 {
+		return nil, errors.New("certificate or signature is empty")
+	}
 
-		if cert.IsCA {
-			return true
+	cert, err := crypto.ParseCrt(enc.Cert)
+	if err != nil {
+		return nil, fmt.Errorf("parseCrt error: %s", err)
+	}
+
+	if creds.caEnabled {
+		if cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil {
+			return nil, errors.New("self-signed certificate")
 		}
 
-		rootCert, err := crypto.ParseCrt(i.([]byte))
-		if err != nil {
-			log.Errorf("parseCrt error: %s", err)
-			return false
+		if err := crypto.VerifyCertificate(creds.root, cert); err != nil {
+			return nil, fmt.Errorf("Verify Certificate error: %s", err)
 		}
 
-		if err := crypto.VerifyCertificate(rootCert, cert); err != nil {
-			log.Errorf("Verify Certificate error: %s", err)
-			return false
+		if err := creds.checkCertificate(cert, time.Now()); err != nil {
+			return nil, err
 		}
 
-		if err := crypto.VerifySign(enc.Hashed, enc.Signature, cert); err != nil {
-			log.Errorf("enc handshake error %s", err)
-			return false
+		// the certificate binds the nodeId to the key, it is not bound at all without CA
+		if cert.Subject.CommonName != string(enc.ID) {
+			return nil, fmt.Errorf("certificate of %s presented by %s", cert.Subject.CommonName, string(enc.ID))
 		}
-		return true
 	}
-	return false
+
+	if err := crypto.VerifySign(sha256.Sum256(challengeData(enc.ID, localID, nonce)), enc.Signature, cert); err != nil {
+		return nil, fmt.Errorf("challenge signature error: %s", err)
+	}
+	return cert, nil
 }
 
 // serialize EncHandshake instance to []byte
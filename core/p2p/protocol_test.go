@@ -20,7 +20,13 @@ package p2p
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"testing"
+
+	"github.com/bocheninc/L0/components/crypto"
 )
 
 func TestProtocolHandshake(t *testing.T) {
@@ -74,3 +80,136 @@ func TestProtocolHandshake(t *testing.T) {
 // 		t.Error("error")
 // 	}
 // }
+
+type testNode struct {
+	id   []byte
+	key  []byte
+	cert []byte
+}
+
+func newTestCA(t *testing.T) (*x509.Certificate, *rsa.PrivateKey, *credentials) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	certBytes, err := crypto.GenerateRootCertificateBytes(crypto.NewCertificate(crypto.CertInformation{IsCA: true}), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := crypto.ParseCrt(certBytes)
+	return cert, key, &credentials{caEnabled: true, rootCertificate: certBytes, root: cert, revoked: make(map[string]bool)}
+}
+
+func newTestNode(t *testing.T, id, commonName string, ca *x509.Certificate, caKey *rsa.PrivateKey) *testNode {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	keyBytes, _ := crypto.GeneratePrivateKeyBytes(key)
+	var certBytes []byte
+	if ca == nil {
+		certBytes, _ = crypto.GenerateRootCertificateBytes(crypto.NewCertificate(crypto.CertInformation{IsCA: true}), key)
+	} else {
+		der, err := x509.CreateCertificate(rand.Reader, crypto.NewCertificate(crypto.CertInformation{CommonName: commonName}), ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certBytes = pem.EncodeToMemory(&pem.Block{Bytes: der, Type: "CERTIFICATE"})
+	}
+	return &testNode{id: []byte(id), key: keyBytes, cert: certBytes}
+}
+
+func newTestNonce() []byte {
+	nonce := make([]byte, handshakeNonceSize)
+	rand.Read(nonce)
+	return nonce
+}
+
+func TestEncHandshake(t *testing.T) {
+	ca, caKey, creds := newTestCA(t)
+	a := newTestNode(t, "a", "a", ca, caKey)
+	b := newTestNode(t, "b", "b", ca, caKey)
+	nonce := newTestNonce()
+
+	enc, err := NewEncHandshake(a.id, b.id, nonce, a.cert, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := enc.serialize()
+	enc = &EncHandshake{}
+	enc.deserialize(buf)
+	if _, err := enc.verify(creds, b.id, nonce); err != nil {
+		t.Fatalf("valid handshake error %v", err)
+	}
+
+	// a captured answer can't be replayed to a fresh challenge
+	if _, err := enc.verify(creds, b.id, newTestNonce()); err == nil {
+		t.Error("replayed handshake accepted")
+	}
+
+	// an answer to node c can't be relayed to node b
+	relayed, _ := NewEncHandshake(a.id, []byte("c"), nonce, a.cert, a.key)
+	if _, err := relayed.verify(creds, b.id, nonce); err == nil {
+		t.Error("relayed handshake accepted")
+	}
+}
+
+func TestEncHandshakeImpersonation(t *testing.T) {
+	ca, caKey, creds := newTestCA(t)
+	a := newTestNode(t, "a", "a", ca, caKey)
+	m := newTestNode(t, "m", "", ca, caKey)
+	nonce := newTestNonce()
+
+	// claims the id of a with the certificate of a but without its key
+	enc, _ := NewEncHandshake(a.id, []byte("b"), nonce, a.cert, m.key)
+	if _, err := enc.verify(creds, []byte("b"), nonce); err == nil {
+		t.Error("handshake signed by another key accepted")
+	}
+
+	// claims the id of a with the certificate issued to a
+	enc, _ = NewEncHandshake(a.id, []byte("b"), nonce, a.cert, a.key)
+	enc.ID = []byte("x")
+	if _, err := enc.verify(creds, []byte("b"), nonce); err == nil {
+		t.Error("handshake with another id accepted")
+	}
+
+	// a certificate without common name binds no id
+	enc, _ = NewEncHandshake(m.id, []byte("b"), nonce, m.cert, m.key)
+	if _, err := enc.verify(creds, []byte("b"), nonce); err == nil {
+		t.Error("certificate without common name accepted")
+	}
+
+	// self-signed certificates are only accepted without CA
+	self := newTestNode(t, "s", "", nil, nil)
+	enc, _ = NewEncHandshake(self.id, []byte("b"), nonce, self.cert, self.key)
+	if _, err := enc.verify(creds, []byte("b"), nonce); err == nil {
+		t.Error("self-signed certificate accepted with CA enabled")
+	}
+	if _, err := enc.verify(&credentials{}, []byte("b"), nonce); err != nil {
+		t.Errorf("self-signed certificate error %v with CA disabled", err)
+	}
+
+	// certificates issued by another CA are rejected
+	other, otherKey, _ := newTestCA(t)
+	o := newTestNode(t, "o", "o", other, otherKey)
+	enc, _ = NewEncHandshake(o.id, []byte("b"), nonce, o.cert, o.key)
+	if _, err := enc.verify(creds, []byte("b"), nonce); err == nil {
+		t.Error("certificate of another CA accepted")
+	}
+}
+
+func TestEncHandshakeECDSA(t *testing.T) {
+	ca, caKey, creds := newTestCA(t)
+	key, _ := crypto.GenerateSigner("ecdsa")
+	keyBytes, _ := crypto.GenerateSignerBytes(key)
+	cert, err := crypto.GenerateCertificateBytes(crypto.NewCertificate(crypto.CertInformation{CommonName: "e"}), ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := newTestNonce()
+
+	enc, err := NewEncHandshake([]byte("e"), []byte("b"), nonce, cert, keyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enc.verify(creds, []byte("b"), nonce); err != nil {
+		t.Errorf("ecdsa handshake error %v", err)
+	}
+	if _, err := enc.verify(creds, []byte("b"), newTestNonce()); err == nil {
+		t.Error("replayed ecdsa handshake accepted")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bocheninc/L0/components/log"
+)
+
+// penalties added to the score of a misbehaving peer, it is disconnected and banned once the score reaches BanScore
+const (
+	PenaltyInvalidTx    = 10
+	PenaltyInvalidBlock = 50
+	PenaltyBadChecksum  = 20
+	PenaltyRateLimit    = 5
+	// PenaltyUncertifiedBlock is added for a block competing with the main chain without a quorum certificate
+	PenaltyUncertifiedBlock = 20
+)
+
+// scoreDecay is the score a peer recovers per minute
+var scoreDecay = 1.0
+
+// peerScore is the misbehaviour score of a peer connection, it decays over time
+type peerScore struct {
+	sync.Mutex
+	score   float64
+	updated time.Time
+	banned  bool
+}
+
+func (s *peerScore) decay(now time.Time) {
+	if !s.updated.IsZero() {
+		s.score -= now.Sub(s.updated).Minutes() * scoreDecay
+		if s.score < 0 {
+			s.score = 0
+		}
+	}
+	s.updated = now
+}
+
+// add adds the penalty and returns the score, and whether it reaches the ban score for the first time
+func (s *peerScore) add(penalty int, banScore int, now time.Time) (int, bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.decay(now)
+	s.score += float64(penalty)
+	if s.banned || int(s.score) < banScore {
+		return int(s.score), false
+	}
+	s.banned = true
+	return int(s.score), true
+}
+
+func (s *peerScore) get(now time.Time) int {
+	s.Lock()
+	defer s.Unlock()
+	s.decay(now)
+	return int(s.score)
+}
+
+// rateLimiter is a token bucket of the messages received from a peer, refilled with rate tokens per second up to rate
+type rateLimiter struct {
+	sync.Mutex
+	tokens  float64
+	updated time.Time
+}
+
+// allow takes a token, it returns false if the bucket is empty. a rate not greater than zero disables the limit
+func (l *rateLimiter) allow(rate int, now time.Time) bool {
+	if rate <= 0 {
+		return true
+	}
+	l.Lock()
+	defer l.Unlock()
+	if l.updated.IsZero() {
+		l.tokens = float64(rate)
+	} else {
+		l.tokens += now.Sub(l.updated).Seconds() * float64(rate)
+		if l.tokens > float64(rate) {
+			l.tokens = float64(rate)
+		}
+	}
+	l.updated = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// Score returns the misbehaviour score of the peer
+func (peer *Peer) Score() int {
+	return peer.score.get(time.Now())
+}
+
+// Misbehave adds the penalty to the score of the peer, the peer is disconnected and banned once the score reaches BanScore
+func (srv *Server) Misbehave(peer *Peer, penalty int, reason string) {
+	srv.peerManager.misbehave(peer, penalty, reason)
+}
+
+func (pm *peerManager) misbehave(peer *Peer, penalty int, reason string) {
+	score, ban := peer.score.add(penalty, config.BanScore, time.Now())
+	log.Warnf("Peer [%s] misbehaves: %s, score %d", peer, reason, score)
+	if !ban {
+		return
+	}
+
+	b := pm.bans.add(peer, reason, time.Duration(int64(config.BanDuration)), time.Now())
+	if b.Until == 0 {
+		log.Warnf("Peer [%s] banned persistently: %s", peer, reason)
+	} else {
+		log.Warnf("Peer [%s] banned until %v: %s", peer, time.Unix(b.Until, 0), reason)
+	}
+	pm.delPeer <- peer.Conn
+}
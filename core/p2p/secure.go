@@ -0,0 +1,207 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bocheninc/L0/components/utils"
+)
+
+var (
+	// secureProtocolVersion is the first protocol version whose connections are encrypted after the handshake
+	secureProtocolVersion = "0.0.3"
+
+	errFrameTooBig = errors.New("secure frame too big")
+)
+
+// versionAtLeast reports whether the dotted version v is not lower than min
+func versionAtLeast(v, min string) bool {
+	vs, ms := strings.Split(v, "."), strings.Split(min, ".")
+	for i := range ms {
+		var a int
+		if i < len(vs) {
+			a, _ = strconv.Atoi(vs[i])
+		}
+		b, _ := strconv.Atoi(ms[i])
+		if a != b {
+			return a > b
+		}
+	}
+	return true
+}
+
+// negotiateVersion returns the highest protocol version spoken by both peers
+func negotiateVersion(local, remote *ProtoHandshake) string {
+	localMax, remoteMax := local.MaxVersion, remote.MaxVersion
+	if localMax == "" {
+		localMax = local.Version
+	}
+	if remoteMax == "" {
+		remoteMax = remote.Version
+	}
+	if versionAtLeast(remoteMax, localMax) {
+		return localMax
+	}
+	return remoteMax
+}
+
+// secureSession reports whether the connection between the peers is encrypted
+func secureSession(local, remote *ProtoHandshake) bool {
+	return versionAtLeast(negotiateVersion(local, remote), secureProtocolVersion) &&
+		len(local.SessionKey) != 0 && len(remote.SessionKey) != 0
+}
+
+type sessionChallenge struct {
+	Nonce           []byte
+	VerifierVersion string
+	VerifierKey     []byte
+	SignerVersion   string
+	SignerKey       []byte
+}
+
+// sessionNonce returns the challenge nonce of the verifier which the signer signs, the versions and session keys
+// offered by both peers are bound into it so that neither the version negotiation nor the key agreement can be
+// tampered with, a peer stripping them to downgrade the connection breaks the handshake
+func sessionNonce(verifier, signer *ProtoHandshake) []byte {
+	h := sha256.Sum256(utils.Serialize(&sessionChallenge{
+		Nonce:           verifier.Nonce,
+		VerifierVersion: verifier.MaxVersion,
+		VerifierKey:     verifier.SessionKey,
+		SignerVersion:   signer.MaxVersion,
+		SignerKey:       signer.SessionKey,
+	}))
+	return h[:]
+}
+
+type sessionSecret struct {
+	Secret        []byte
+	SenderNonce   []byte
+	ReceiverNonce []byte
+}
+
+// newSessionCipher returns the cipher of the frames sent by the sender to the receiver
+func newSessionCipher(secret []byte, sender, receiver *ProtoHandshake) (cipher.AEAD, error) {
+	key := sha256.Sum256(utils.Serialize(&sessionSecret{
+		Secret:        secret,
+		SenderNonce:   sender.Nonce,
+		ReceiverNonce: receiver.Nonce,
+	}))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// secureConn is the connection encrypting every write as a frame sealed with AES-GCM,
+// the frames in each direction are numbered by a counter used as the nonce
+type secureConn struct {
+	net.Conn
+
+	rmu        sync.Mutex
+	reader     cipher.AEAD
+	readCount  uint64
+	readBuf    []byte
+	wmu        sync.Mutex
+	writer     cipher.AEAD
+	writeCount uint64
+}
+
+// newSecureConn returns the encrypted connection with the keys agreed by the session keys of the handshakes
+func newSecureConn(conn net.Conn, sessionKey *ecdh.PrivateKey, local, remote *ProtoHandshake) (*secureConn, error) {
+	remoteKey, err := ecdh.X25519().NewPublicKey(remote.SessionKey)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := sessionKey.ECDH(remoteKey)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := newSessionCipher(secret, local, remote)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newSessionCipher(secret, remote, local)
+	if err != nil {
+		return nil, err
+	}
+	return &secureConn{Conn: conn, reader: reader, writer: writer}, nil
+}
+
+func frameNonce(count uint64, size int) []byte {
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint64(nonce[size-8:], count)
+	return nonce
+}
+
+// Write seals the data as a frame
+func (sc *secureConn) Write(data []byte) (int, error) {
+	sc.wmu.Lock()
+	defer sc.wmu.Unlock()
+
+	frame := sc.writer.Seal(nil, frameNonce(sc.writeCount, sc.writer.NonceSize()), data, nil)
+	sc.writeCount++
+	if _, err := sc.Conn.Write(append(utils.VarInt(uint64(len(frame))), frame...)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Read opens the frames and returns their data
+func (sc *secureConn) Read(data []byte) (int, error) {
+	sc.rmu.Lock()
+	defer sc.rmu.Unlock()
+
+	for len(sc.readBuf) == 0 {
+		l, err := utils.ReadVarInt(sc.Conn)
+		if err != nil {
+			return 0, err
+		}
+		if l > maxMsgSize+uint64(sc.reader.Overhead())+binary.MaxVarintLen64 {
+			return 0, errFrameTooBig
+		}
+
+		frame := make([]byte, l)
+		if _, err := io.ReadFull(sc.Conn, frame); err != nil {
+			return 0, err
+		}
+		plain, err := sc.reader.Open(frame[:0], frameNonce(sc.readCount, sc.reader.NonceSize()), frame, nil)
+		if err != nil {
+			return 0, err
+		}
+		sc.readCount++
+		sc.readBuf = plain
+	}
+
+	n := copy(data, sc.readBuf)
+	sc.readBuf = sc.readBuf[n:]
+	return n, nil
+}
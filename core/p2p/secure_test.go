@@ -0,0 +1,137 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/bocheninc/L0/components/utils"
+)
+
+func newTestProtoHandshake(t *testing.T, id, maxVersion string) (*ProtoHandshake, *ecdh.PrivateKey) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proto := &ProtoHandshake{
+		Name:       baseProtocolName,
+		Version:    baseProtocolVersion,
+		ID:         []byte(id),
+		Nonce:      newTestNonce(),
+		MaxVersion: maxVersion,
+	}
+	if maxVersion != "" {
+		proto.SessionKey = key.PublicKey().Bytes()
+	}
+	return proto, key
+}
+
+func readFrame(t *testing.T, r io.Reader) []byte {
+	l, err := utils.ReadVarInt(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]byte, l)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		t.Fatal(err)
+	}
+	return append(utils.VarInt(l), frame...)
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	a, _ := newTestProtoHandshake(t, "a", maxProtocolVersion)
+	b, _ := newTestProtoHandshake(t, "b", maxProtocolVersion)
+	old, _ := newTestProtoHandshake(t, "old", "")
+
+	if v := negotiateVersion(a, b); v != maxProtocolVersion || !secureSession(a, b) || !secureSession(b, a) {
+		t.Errorf("negotiate version %s between new peers, encrypted %v", v, secureSession(a, b))
+	}
+	if v := negotiateVersion(a, old); v != baseProtocolVersion || secureSession(a, old) || secureSession(old, a) {
+		t.Errorf("negotiate version %s with old peer, encrypted %v", v, secureSession(a, old))
+	}
+
+	// the challenge binds the offered versions and session keys, a tampered offer breaks the handshake signature
+	nonce := sessionNonce(a, b)
+	m, _ := newTestProtoHandshake(t, "b", maxProtocolVersion)
+	b.SessionKey = m.SessionKey
+	if bytes.Equal(sessionNonce(a, b), nonce) {
+		t.Error("session key is not bound into the challenge nonce")
+	}
+	stripped := *b
+	stripped.MaxVersion, stripped.SessionKey = "", nil
+	if bytes.Equal(sessionNonce(a, &stripped), sessionNonce(a, b)) {
+		t.Error("offered version is not bound into the challenge nonce")
+	}
+}
+
+func TestSecureConn(t *testing.T) {
+	a, aKey := newTestProtoHandshake(t, "a", maxProtocolVersion)
+	b, bKey := newTestProtoHandshake(t, "b", maxProtocolVersion)
+
+	aConn, wire := net.Pipe()
+	sa, err := newSecureConn(aConn, aKey, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("lbft consensus payload")
+	go func() {
+		SendMessage(sa, NewMsg(pingMsg+100, payload))
+		SendMessage(sa, NewMsg(pingMsg+101, payload))
+	}()
+	frames := [][]byte{readFrame(t, wire), readFrame(t, wire)}
+	for _, frame := range frames {
+		if bytes.Contains(frame, payload) {
+			t.Fatal("payload is sent in plaintext")
+		}
+	}
+
+	// deliver the frames, then replay the first one and tamper the second one
+	tampered := append([]byte{}, frames[1]...)
+	tampered[len(tampered)-1] ^= 0xff
+	for _, delivery := range [][][]byte{{frames[0], frames[1]}, {frames[0], frames[0]}, {frames[0], tampered}} {
+		bConn, feed := net.Pipe()
+		sb, err := newSecureConn(bConn, bKey, b, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func(delivery [][]byte) {
+			for _, frame := range delivery {
+				feed.Write(frame)
+			}
+		}(delivery)
+
+		if m, err := readMsg(sb); err != nil || m.Cmd != pingMsg+100 || !bytes.Equal(m.Payload, payload) {
+			t.Fatalf("read first message %v, err %v", m, err)
+		}
+		m, err := readMsg(sb)
+		if bytes.Equal(delivery[1], frames[1]) {
+			if err != nil || m.Cmd != pingMsg+101 {
+				t.Errorf("read second message %v, err %v", m, err)
+			}
+		} else if err == nil {
+			t.Error("replayed or tampered frame accepted")
+		}
+		feed.Close()
+	}
+}
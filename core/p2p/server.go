@@ -20,11 +20,9 @@ package p2p
 
 import (
 	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
+	"crypto/ecdh"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"time"
 
 	"github.com/bocheninc/L0/components/crypto"
@@ -44,13 +42,20 @@ type Config struct {
 	KeepAliveInterval   int
 	KeepAliveTimes      int
 	MinPeers            int
+	BanScore            int
+	BanDuration         int
+	MaxMsgRate          int
 	Protocols           []Protocol
 	RouteAddress        []string
 
+	// RequireEncryption refuses the peers whose connections are not encrypted
+	RequireEncryption bool
+
 	CAEnabled bool
 	KeyPath   string
 	CrtPath   string
 	CAPath    string
+	CRLPath   string
 	NodeID    string
 }
 
@@ -69,6 +74,9 @@ func DefaultConfig() *Config {
 		KeepAliveInterval:   int(15 * time.Second),
 		KeepAliveTimes:      30,
 		MinPeers:            3,
+		BanScore:            100,
+		BanDuration:         int(24 * time.Hour),
+		MaxMsgRate:          500,
 	}
 }
 
@@ -80,9 +88,7 @@ type Server struct {
 	tcpServer *TCPServer
 	quit      chan struct{}
 
-	PrivateKey      []byte
-	RootCertificate []byte
-	Certificate     []byte
+	certs *certStore
 }
 
 // NewServer returns a new p2p server
@@ -108,49 +114,19 @@ func NewServer(db *db.BlockchainDB, cfg *Config) *Server {
 		srv.CAEnabled = false
 	}
 
-	var privateKey, rootCertificate, certificate []byte
+	var creds *credentials
 	var err error
 
 	if srv.CAEnabled {
-		privateKey, err = ioutil.ReadFile(cfg.KeyPath)
-		if err != nil {
-			log.Errorf("read file %s error: %s ", cfg.KeyPath, err)
-			return nil
-		}
-		certificate, err = ioutil.ReadFile(cfg.CrtPath)
-		if err != nil {
-			log.Errorf("read file %s error: %s ", cfg.CrtPath, err)
-			return nil
-		}
-		rootCertificate, err = ioutil.ReadFile(cfg.CAPath)
-		if err != nil {
-			log.Errorf("read file %s error: %s ", cfg.CAPath, err)
-			return nil
-		}
+		creds, err = loadCredentials(cfg)
 	} else {
-		key, err := rsa.GenerateKey(rand.Reader, 2048)
-		if err != nil {
-			log.Errorf("generate privatekey err: %s", err)
-			return nil
-		}
-		privateKey, err = crypto.GeneratePrivateKeyBytes(key)
-		if err != nil {
-			log.Errorf("Generate private Key Bytes error: %s", err)
-			return nil
-		}
-
-		rootCertificate, err = crypto.GenerateRootCertificateBytes(crypto.NewCertificate(crypto.CertInformation{IsCA: true}), key)
-		if err != nil {
-			log.Errorf("Generate root Certificate  Bytes error: %s", err)
-			return nil
-		}
-
-		certificate = nil
+		creds, err = generateCredentials()
 	}
-
-	srv.PrivateKey = privateKey
-	srv.RootCertificate = rootCertificate
-	srv.Certificate = certificate
+	if err != nil {
+		log.Errorf("load certificates error: %s", err)
+		return nil
+	}
+	srv.certs = &certStore{creds: creds}
 
 	log.Debugf("P2P Network Server database instance %v", db)
 	log.Debugf("P2P Network Server config instance %v", cfg)
@@ -166,6 +142,9 @@ func (srv *Server) Start() {
 	go srv.run()
 	srv.tcpServer.listen()
 	go srv.peerManager.run()
+	if srv.CAEnabled {
+		go srv.watchCertificates()
+	}
 }
 
 // Sign signs data with node key
@@ -179,6 +158,14 @@ func (srv *Server) Sign(data []byte) (*crypto.Signature, error) {
 	return nil, fmt.Errorf("Node private key not config")
 }
 
+// NodePublicKey returns the public key of the nodekey
+func (srv *Server) NodePublicKey() *crypto.PublicKey {
+	if config.PrivateKey != nil {
+		return config.PrivateKey.Public()
+	}
+	return nil
+}
+
 // Broadcast broadcasts message to remote peers
 func (srv *Server) Broadcast(msg *Msg) {
 	srv.peerManager.broadcastCh <- msg
@@ -232,100 +219,128 @@ func (srv *Server) GetLocalPeer() *Peer {
 }
 
 func (srv *Server) doHandshake(c *Connection) error {
-	if err := srv.doProtoHandshake(c); err != nil {
+	local, remote, sessionKey, err := srv.doProtoHandshake(c)
+	if err != nil {
 		return err
 	}
 
-	if err := srv.doEncHandshake(c); err != nil {
+	if config.RequireEncryption && !secureSession(local, remote) {
+		srv.onPeerClose(c)
+		return fmt.Errorf("peer[%v] doesn't support encryption", string(remote.ID))
+	}
+
+	if err := srv.doEncHandshake(c, local, remote, sessionKey); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (srv Server) doProtoHandshake(c *Connection) error {
-	n, err := SendMessage(c.conn, NewMsg(handshakeMsg, GetProtoHandshake().serialize()))
+func (srv Server) doProtoHandshake(c *Connection) (*ProtoHandshake, *ProtoHandshake, *ecdh.PrivateKey, error) {
+	local, sessionKey, err := newProtoHandshake()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	n, err := SendMessage(c.conn, NewMsg(handshakeMsg, local.serialize()))
 	if n <= 0 || err != nil {
-		return err
+		return nil, nil, nil, fmt.Errorf("send protocol handshake error %v", err)
 	}
 
-	if err := srv.readProtoHandshake(c); err != nil {
-		return err
+	remote, err := srv.readProtoHandshake(c)
+	if err != nil {
+		return nil, nil, nil, err
 	}
-	return nil
+	return local, remote, sessionKey, nil
 }
 
-func (srv Server) doEncHandshake(c *Connection) error {
-	var cert []byte
-
-	if srv.CAEnabled {
-		cert = srv.Certificate
-	} else {
-		cert = srv.RootCertificate
+func (srv Server) doEncHandshake(c *Connection, local, remote *ProtoHandshake, sessionKey *ecdh.PrivateKey) error {
+	creds := srv.certs.get()
+	enc, err := NewEncHandshake(local.ID, remote.ID, sessionNonce(remote, local), creds.certificate, creds.privateKey)
+	if err != nil {
+		return err
 	}
-
-	respMsg := NewMsg(handshakeAckMsg, GetEncHandshake(cert, srv.PrivateKey).serialize())
-	n, err := SendMessage(c.conn, respMsg)
+	n, err := SendMessage(c.conn, NewMsg(handshakeAckMsg, enc.serialize()))
 	if n <= 0 || err != nil {
-		return err
+		return fmt.Errorf("send encryption handshake error %v", err)
 	}
 
-	if err := srv.readEncHandshake(c, cert); err != nil {
+	if err := srv.readEncHandshake(c, local, remote, sessionKey); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (srv Server) readProtoHandshake(c *Connection) error {
+func (srv Server) readProtoHandshake(c *Connection) (*ProtoHandshake, error) {
 	log.Debugln("readProtoHandshake")
 	m, err := readMsg(c.conn)
 	if m == nil && err != nil {
-		return err
+		return nil, err
 	}
 
 	proto := &ProtoHandshake{}
 	proto.deserialize(m.Payload)
-	if !proto.matchProtocol(GetProtoHandshake()) {
+	if m.Cmd != handshakeMsg || !proto.matchProtocol(GetProtoHandshake()) {
 		srv.onPeerClose(c)
-		return fmt.Errorf("protocol handshake error")
+		return nil, fmt.Errorf("protocol handshake error")
+	}
+
+	if len(proto.Nonce) != handshakeNonceSize {
+		srv.onPeerClose(c)
+		return nil, fmt.Errorf("protocol handshake nonce size %d error", len(proto.Nonce))
 	}
 
 	if srv.peers.contains(proto.ID) {
 		log.Debugf("peer[%v] is already connected", string(proto.ID))
 		srv.onPeerClose(c)
-		return fmt.Errorf("peer[%v] is already connected", string(proto.ID))
+		return nil, fmt.Errorf("peer[%v] is already connected", string(proto.ID))
 	}
+
 	peer := NewPeer(proto.ID, c.conn, proto.SrvAddress, srv.Protocols)
+	if srv.bans.banned(peer.ID, peerIP(peer), time.Now()) {
+		srv.onPeerClose(c)
+		return nil, fmt.Errorf("peer[%v] is banned", string(proto.ID))
+	}
 	if !bytes.Equal(proto.ID, peer.ID) {
 		log.Errorf("PeerID not match %v != %v", string(proto.ID), string(peer.ID))
-		return fmt.Errorf("PeerID not match %v != %v", string(proto.ID), string(peer.ID))
+		return nil, fmt.Errorf("PeerID not match %v != %v", string(proto.ID), string(peer.ID))
 	}
 	srv.handshakings.set(c.conn, peer)
-	return nil
+	return proto, nil
 }
 
-func (srv Server) readEncHandshake(c *Connection, cert []byte) error {
+func (srv Server) readEncHandshake(c *Connection, local, remote *ProtoHandshake, sessionKey *ecdh.PrivateKey) error {
 	log.Debugln("readEncHandshake")
 	m, err := readMsg(c.conn)
 	if m == nil && err != nil {
 		return err
 	}
 
-	respMsg := &Msg{}
 	enc := &EncHandshake{}
 	enc.deserialize(m.Payload)
-	if !enc.matchProtocol(srv.RootCertificate) {
+	if m.Cmd != handshakeAckMsg || !bytes.Equal(enc.ID, remote.ID) {
 		srv.onPeerClose(c)
-		return fmt.Errorf("Encryption Verify Error")
+		return fmt.Errorf("Encryption handshake of peer[%v] error", string(remote.ID))
+	}
+	cert, err := enc.verify(srv.certs.get(), local.ID, sessionNonce(local, remote))
+	if err != nil {
+		srv.onPeerClose(c)
+		return fmt.Errorf("Encryption Verify Error: %s", err)
 	}
 	if p, ok := srv.handshakings.get(c.conn); ok {
 		srv.handshakings.remove(c.conn)
+		p.cert = cert
+		if secureSession(local, remote) {
+			conn, err := newSecureConn(c.conn, sessionKey, local, remote)
+			if err != nil {
+				srv.onPeerClose(c)
+				return fmt.Errorf("secure session of peer[%v] error: %s", string(remote.ID), err)
+			}
+			p.withConn(conn)
+		}
+		log.Debugf("peer[%v] connected, protocol version %s, encrypted %v", string(remote.ID), negotiateVersion(local, remote), secureSession(local, remote))
 		srv.peerManager.addPeer <- p
-
-		respMsg = NewMsg(handshakeAckMsg, GetEncHandshake(srv.PrivateKey, cert).serialize())
-		respMsg.write(c.conn)
 		return nil
-
 	}
 	return fmt.Errorf("handshaking can't find this connection")
 }
@@ -340,7 +355,7 @@ func readMsg(r io.Reader) (*Msg, error) {
 
 	h := crypto.Sha256(msg.Payload)
 	if !bytes.Equal(msg.CheckSum[:], h[0:4]) {
-		return nil, fmt.Errorf("message checksum error")
+		return nil, errChecksum
 	}
 
 	return msg, nil
@@ -23,8 +23,9 @@ import "github.com/bocheninc/L0/core/coordinate"
 const (
 	// ProtocolName represents the name of the p2p protocol
 	ProtocolName = "L0-NETWORK"
-	// ProtocolVersion represents the version of the p2p protocol
-	ProtocolVersion = "0.0.1"
+	// ProtocolVersion represents the version of the p2p protocol, 0.0.2 adds the valid until of the transactions
+	// and the network id of their signatures, so the peers of 0.0.1 are refused
+	ProtocolVersion = "0.0.2"
 )
 
 // ChainID  chain ID
@@ -35,4 +36,19 @@ var (
 	ConnNums      int
 	LocalIp       string
 	Validator     bool
+	// Validators are the genesis validators of the chain, nodeId:publicKey
+	Validators []string
+	// BalanceHistory is the number of recent blocks whose balances can be queried, 0 keeps all
+	BalanceHistory uint32
+	// Pruning is the number of recent blocks whose transactions are kept, 0 keeps all
+	Pruning uint32
+	// NetworkID identifies the network in the signature of transactions together with GenesisHash
+	NetworkID = "L0"
+	// GenesisHash is the hash of the genesis block of the ledger, set when the ledger is opened
+	GenesisHash []byte
+	// FeeAccount receives the transaction fees of the chain instead of the validators, it is committed by the genesis
+	// block, so it takes effect only for a new chain and the nodes configured with another one can't join the chain
+	FeeAccount string
+	// MinFee is the minimum fee of the transactions accepted by txpool
+	MinFee int64
 )
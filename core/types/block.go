@@ -26,6 +26,7 @@ import (
 
 	"github.com/bocheninc/L0/components/crypto"
 	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/accounts"
 )
 
 // IInventory defines interface that broadcast data should implements
@@ -49,17 +50,22 @@ type BlockHeader struct {
 	TimeStamp     uint32      `json:"timeStamp"`
 	Nonce         uint32      `json:"nonce" `
 	TxsMerkleHash crypto.Hash `json:"transactionsMerkleHash" `
+	StateHash     crypto.Hash `json:"stateHash" `
 	Height        uint32      `json:"height" `
+	Proposer      string      `json:"proposer" `
+
+	// Signatures of validators, not included in hash
+	Signatures []crypto.Signature `json:"signatures" `
 }
 
 // NewBlockHeader returns a blockheader
 func NewBlockHeader(prvHash crypto.Hash, timeStamp, height, nonce uint32, txsHash crypto.Hash) *BlockHeader {
 	return &BlockHeader{
-		prvHash,
-		timeStamp,
-		nonce,
-		txsHash,
-		height,
+		PreviousHash:  prvHash,
+		TimeStamp:     timeStamp,
+		Nonce:         nonce,
+		TxsMerkleHash: txsHash,
+		Height:        height,
 	}
 }
 
@@ -93,7 +99,28 @@ func (h *BlockHeader) Deserialize(data []byte) error {
 
 // Hash returns the hash of the blockheader
 func (h *BlockHeader) Hash() crypto.Hash {
-	return crypto.DoubleSha256(h.Serialize())
+	header := *h
+	header.Signatures = nil
+	return crypto.DoubleSha256(header.Serialize())
+}
+
+// SignHash returns the hash signed by the validators
+func (h *BlockHeader) SignHash() crypto.Hash {
+	return crypto.Sha256(h.Hash().Bytes())
+}
+
+// Signers returns the addresses recovered from the signatures of the blockheader
+func (h *BlockHeader) Signers() []accounts.Address {
+	var signers []accounts.Address
+	signHash := h.SignHash()
+	for _, sig := range h.Signatures {
+		pub, err := sig.RecoverPublicKey(signHash[:])
+		if pub == nil || err != nil {
+			continue
+		}
+		signers = append(signers, accounts.PublicKeyToAddress(*pub))
+	}
+	return signers
 }
 
 // PreviousHash returns the previous hash of the block
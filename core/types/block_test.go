@@ -93,3 +93,35 @@ func TestBlockDeserialize(t *testing.T) {
 	}
 
 }
+
+func TestBlockHeaderSignatures(t *testing.T) {
+	header := &BlockHeader{
+		PreviousHash: crypto.DoubleSha256([]byte("xxxx")),
+		TimeStamp:    uint32(time.Now().Unix()),
+		Height:       1,
+		Proposer:     "00:0001",
+	}
+	hash := header.Hash()
+
+	priv, _ := crypto.GenerateKey()
+	signHash := header.SignHash()
+	sig, err := priv.Sign(signHash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	header.Signatures = append(header.Signatures, *sig)
+
+	if !hash.Equal(header.Hash()) {
+		t.Errorf("BlockHeader.Hash changed by signatures, %s != %s", hash, header.Hash())
+	}
+
+	signers := header.Signers()
+	if len(signers) != 1 || signers[0] != accounts.PublicKeyToAddress(*priv.Public()) {
+		t.Errorf("BlockHeader.Signers error, %v", signers)
+	}
+
+	header.Proposer = "00:0002"
+	if hash.Equal(header.Hash()) {
+		t.Error("BlockHeader.Hash not changed by proposer")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"math/big"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/accounts"
+)
+
+// Receipt status
+const (
+	ReceiptFailed uint32 = iota
+	ReceiptSuccessful
+)
+
+// Receipt represents the execution result of the transaction in the block
+type Receipt struct {
+	TxHash      crypto.Hash `json:"txHash"`
+	BlockHeight uint32      `json:"blockHeight"`
+	Status      uint32      `json:"status"`
+	Error       string      `json:"error"`
+	Fee         *big.Int    `json:"fee"`
+	// ContractTxs transfers generated by the contract
+	ContractTxs []crypto.Hash `json:"contractTxs"`
+	Events      []*Event      `json:"events"`
+}
+
+// Event represents the event emitted by the contract
+type Event struct {
+	ContractAddr accounts.Address `json:"contractAddr"`
+	TxHash       crypto.Hash      `json:"txHash"`
+	BlockHeight  uint32           `json:"blockHeight"`
+	Name         string           `json:"name"`
+	Data         []byte           `json:"data"`
+}
+
+// NewReceipt returns the successful receipt of the transaction
+func NewReceipt(txHash crypto.Hash, height uint32, fee *big.Int) *Receipt {
+	if fee == nil {
+		fee = big.NewInt(0)
+	}
+	return &Receipt{TxHash: txHash, BlockHeight: height, Status: ReceiptSuccessful, Fee: fee}
+}
+
+// Fail marks the receipt failed by err, no fee is charged
+func (r *Receipt) Fail(err error) {
+	if r.Status == ReceiptFailed {
+		return
+	}
+	r.Status = ReceiptFailed
+	r.Error = err.Error()
+	r.Fee = big.NewInt(0)
+}
+
+// Serialize returns the serialized bytes of a receipt
+func (r *Receipt) Serialize() []byte {
+	return utils.Serialize(r)
+}
+
+// Deserialize deserializes bytes to a receipt
+func (r *Receipt) Deserialize(data []byte) error {
+	return utils.Deserialize(data, r)
+}
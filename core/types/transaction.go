@@ -28,6 +28,7 @@ import (
 	"github.com/bocheninc/L0/components/utils"
 	"github.com/bocheninc/L0/core/accounts"
 	"github.com/bocheninc/L0/core/coordinate"
+	"github.com/bocheninc/L0/core/params"
 )
 
 var (
@@ -35,6 +36,9 @@ var (
 	ErrEmptySignature = errors.New("Signature Empty Error")
 )
 
+// ValidUntilTimeThreshold separates the valid until values, values below it are block heights and the others are unix timestamps
+const ValidUntilTimeThreshold uint32 = 500000000
+
 // Transaction represents the basic transaction that contained in blocks
 type Transaction struct {
 	Data    txdata `json:"data"`
@@ -61,6 +65,7 @@ type txdata struct {
 	Fee        *big.Int                   `json:"fee"`
 	Signature  *crypto.Signature          `json:"signature"`
 	CreateTime uint32                     `json:"createTime"`
+	ValidUntil uint32                     `json:"validUntil"`
 }
 
 // Transaction type
@@ -75,6 +80,7 @@ const (
 	TypeLuaContractInit               // lua contract_Init
 	TypeContractInvoke                // contract_Invoke
 	TypeContractQuery                 // contract_Query
+	TypeValidatorChange               // 共识节点变更交易
 )
 
 // NewTransaction creates an new transaction with the parameters
@@ -111,7 +117,9 @@ func (tx *Transaction) Hash() crypto.Hash {
 	return v
 }
 
-// SignHash returns the hash of a raw transaction before sign
+// SignHash returns the hash of a raw transaction before sign, it is bound to the network id and the genesis
+// block so that the transaction can not be replayed on another network, even one sharing the network id,
+// both are returned by the Net.GetInfo RPC for the wallets signing transactions
 func (tx *Transaction) SignHash() crypto.Hash {
 	rawTx := NewTransaction(
 		tx.Data.FromChain,
@@ -124,8 +132,10 @@ func (tx *Transaction) SignHash() crypto.Hash {
 		tx.Data.Fee,
 		tx.Data.CreateTime,
 	)
+	rawTx.Data.ValidUntil = tx.Data.ValidUntil
 	rawTx.Payload = tx.Payload
-	return rawTx.Hash()
+	data := append(rawTx.Serialize(), params.NetworkID...)
+	return crypto.DoubleSha256(append(data, params.GenesisHash...))
 }
 
 // Serialize returns the serialized bytes of a transaction
@@ -160,6 +170,8 @@ func (tx *Transaction) Verfiy() (accounts.Address, error) {
 		fallthrough
 	case TypeContractInvoke:
 		fallthrough
+	case TypeValidatorChange:
+		fallthrough
 	case TypeIssue:
 		if tx.Data.Signature != nil {
 			if sender := tx.sender.Load(); sender != nil {
@@ -226,6 +238,28 @@ func (tx *Transaction) CreateTime() uint32 {
 	return tx.Data.CreateTime
 }
 
+// WithValidUntil sets the block height or the unix timestamp after which the transaction expires, 0 never expires
+func (tx *Transaction) WithValidUntil(validUntil uint32) {
+	tx.Data.ValidUntil = validUntil
+}
+
+// ValidUntil returns the block height or the unix timestamp after which the transaction expires
+func (tx *Transaction) ValidUntil() uint32 {
+	return tx.Data.ValidUntil
+}
+
+// Expired reports whether the transaction expires in the block of the height and the timestamp
+func (tx *Transaction) Expired(height, timestamp uint32) bool {
+	switch {
+	case tx.Data.ValidUntil == 0:
+		return false
+	case tx.Data.ValidUntil < ValidUntilTimeThreshold:
+		return height > tx.Data.ValidUntil
+	default:
+		return timestamp > tx.Data.ValidUntil
+	}
+}
+
 // Compare implements interface consensus need
 func (tx *Transaction) Compare(v interface{}) int {
 	return 0
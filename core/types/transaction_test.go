@@ -28,6 +28,7 @@ import (
 	"github.com/bocheninc/L0/components/utils"
 	"github.com/bocheninc/L0/core/accounts"
 	"github.com/bocheninc/L0/core/coordinate"
+	"github.com/bocheninc/L0/core/params"
 )
 
 var testTx = getTestTransaction()
@@ -92,3 +93,43 @@ func TestTxSender(t *testing.T) {
 		t.Errorf("Deserialize error with Signature, %0x != %0x", tx.Serialize(), tx2.Serialize())
 	}
 }
+
+func TestTxValidUntil(t *testing.T) {
+	tx := getTestTransaction()
+	if tx.Expired(1<<20, utils.CurrentTimestamp()) {
+		t.Error("tx without valid until expired")
+	}
+
+	tx.WithValidUntil(100)
+	if tx.Expired(100, 0) || !tx.Expired(101, 0) {
+		t.Error("tx valid until height 100 expired wrongly")
+	}
+
+	tx.WithValidUntil(ValidUntilTimeThreshold + 100)
+	if tx.Expired(1<<20, ValidUntilTimeThreshold+100) || !tx.Expired(0, ValidUntilTimeThreshold+101) {
+		t.Error("tx valid until timestamp expired wrongly")
+	}
+
+	signHash := tx.SignHash()
+	tx.WithValidUntil(0)
+	if tx.SignHash() == signHash {
+		t.Error("valid until is not bound into sign hash")
+	}
+}
+
+func TestTxSignHashNetworkID(t *testing.T) {
+	tx := getTestTransaction()
+	signHash := tx.SignHash()
+
+	networkID, genesisHash := params.NetworkID, params.GenesisHash
+	defer func() { params.NetworkID, params.GenesisHash = networkID, genesisHash }()
+	params.NetworkID = "L0-test"
+	if tx.SignHash() == signHash {
+		t.Error("network id is not bound into sign hash")
+	}
+	params.NetworkID = networkID
+	params.GenesisHash = crypto.Sha256([]byte("genesis")).Bytes()
+	if tx.SignHash() == signHash {
+		t.Error("genesis hash is not bound into sign hash")
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"crypto/elliptic"
+	"errors"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/utils"
+)
+
+// Validator change operations
+const (
+	ValidatorAdd uint32 = iota
+	ValidatorRemove
+)
+
+// ValidatorChange represents the payload of the validator change transaction,
+// the replica of NodeID is added to or removed from the validator set at Height
+type ValidatorChange struct {
+	Op        uint32 `json:"op"`
+	NodeID    string `json:"nodeId"`
+	PublicKey []byte `json:"publicKey"`
+	Height    uint32 `json:"height"`
+}
+
+// Serialize returns the serialized bytes of a validator change
+func (vc *ValidatorChange) Serialize() []byte {
+	return utils.Serialize(vc)
+}
+
+// Deserialize deserializes bytes to a validator change
+func (vc *ValidatorChange) Deserialize(data []byte) error {
+	return utils.Deserialize(data, vc)
+}
+
+// Validate checks the fields of the validator change
+func (vc *ValidatorChange) Validate() error {
+	if vc.Op != ValidatorAdd && vc.Op != ValidatorRemove {
+		return errors.New("unknown validator change operation")
+	}
+	if vc.NodeID == "" {
+		return errors.New("empty validator node id")
+	}
+	if len(vc.PublicKey) > 0 {
+		if x, _ := elliptic.Unmarshal(crypto.S256(), vc.PublicKey); x == nil {
+			return errors.New("illegal validator public key")
+		}
+	}
+	return nil
+}
+
+// ValidatorChangeOf returns the validator change carried by the transaction
+func ValidatorChangeOf(tx *Transaction) (*ValidatorChange, error) {
+	if tx.GetType() != TypeValidatorChange {
+		return nil, errors.New("not validator change transaction")
+	}
+	vc := new(ValidatorChange)
+	if err := vc.Deserialize(tx.Payload); err != nil {
+		return nil, err
+	}
+	return vc, vc.Validate()
+}
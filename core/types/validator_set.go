@@ -0,0 +1,169 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/accounts"
+	"github.com/bocheninc/L0/core/params"
+)
+
+// MinValidators is the least number of validators tolerating one faulty replica
+const MinValidators = 4
+
+// ValidatorSet is the set of validator public keys by id
+type ValidatorSet struct {
+	publicKeys map[string][]byte
+	addresses  map[accounts.Address]string
+}
+
+// NewValidatorSet returns an empty validator set
+func NewValidatorSet() *ValidatorSet {
+	return &ValidatorSet{
+		publicKeys: make(map[string][]byte),
+		addresses:  make(map[accounts.Address]string),
+	}
+}
+
+// GenesisValidatorSet returns the validators of the chain configured in params.Validators, nodeId:publicKey
+func GenesisValidatorSet() (*ValidatorSet, error) {
+	return ParseValidatorSet(params.Validators)
+}
+
+// ParseValidatorSet returns the validators of nodeId:publicKey
+func ParseValidatorSet(validators []string) (*ValidatorSet, error) {
+	vs := NewValidatorSet()
+	for _, validator := range validators {
+		i := strings.LastIndex(validator, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("illegal validator %s", validator)
+		}
+		if err := vs.Add(validator[:i], utils.HexToBytes(validator[i+1:])); err != nil {
+			return nil, err
+		}
+	}
+	return vs, nil
+}
+
+// Add adds or replaces the validator
+func (vs *ValidatorSet) Add(id string, publicKey []byte) error {
+	if x, _ := elliptic.Unmarshal(crypto.S256(), publicKey); x == nil {
+		return fmt.Errorf("illegal public key of validator %s", id)
+	}
+	vs.remove(id)
+	vs.publicKeys[id] = publicKey
+	vs.addresses[accounts.PublicKeyToAddress(*crypto.ToECDSAPub(publicKey))] = id
+	return nil
+}
+
+// Remove removes the validator, the set keeps at least MinValidators
+func (vs *ValidatorSet) Remove(id string) error {
+	if _, ok := vs.publicKeys[id]; !ok {
+		return fmt.Errorf("unknown validator %s", id)
+	}
+	if len(vs.publicKeys) <= MinValidators {
+		return fmt.Errorf("validators should be more than %d", MinValidators-1)
+	}
+	vs.remove(id)
+	return nil
+}
+
+func (vs *ValidatorSet) remove(id string) {
+	if publicKey, ok := vs.publicKeys[id]; ok {
+		delete(vs.addresses, accounts.PublicKeyToAddress(*crypto.ToECDSAPub(publicKey)))
+		delete(vs.publicKeys, id)
+	}
+}
+
+// Apply applies the validator change to the validator keyed by id
+func (vs *ValidatorSet) Apply(id string, change *ValidatorChange) error {
+	switch change.Op {
+	case ValidatorAdd:
+		if len(change.PublicKey) == 0 {
+			return errors.New("validator public key required")
+		}
+		return vs.Add(id, change.PublicKey)
+	case ValidatorRemove:
+		return vs.Remove(id)
+	}
+	return errors.New("unknown validator change operation")
+}
+
+// Len returns the number of validators
+func (vs *ValidatorSet) Len() int {
+	return len(vs.publicKeys)
+}
+
+// Quorum returns the number of validators of a byzantine quorum, 2f+1 of 3f+1
+func (vs *ValidatorSet) Quorum() int {
+	if len(vs.publicKeys) == 0 {
+		return 0
+	}
+	return (len(vs.publicKeys)*2-1)/3 + 1
+}
+
+// PublicKey returns the public key of the validator
+func (vs *ValidatorSet) PublicKey(id string) ([]byte, bool) {
+	publicKey, ok := vs.publicKeys[id]
+	return publicKey, ok
+}
+
+// Contains reports whether the address is the account of a validator
+func (vs *ValidatorSet) Contains(addr accounts.Address) bool {
+	_, ok := vs.addresses[addr]
+	return ok
+}
+
+// IDs returns the sorted ids of the validators
+func (vs *ValidatorSet) IDs() []string {
+	ids := make([]string, 0, len(vs.publicKeys))
+	for id := range vs.publicKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Addresses returns the accounts of the validators in the order of their ids
+func (vs *ValidatorSet) Addresses() []accounts.Address {
+	var addresses []accounts.Address
+	for _, id := range vs.IDs() {
+		addresses = append(addresses, accounts.PublicKeyToAddress(*crypto.ToECDSAPub(vs.publicKeys[id])))
+	}
+	return addresses
+}
+
+// Copy returns a copy of the validator set
+func (vs *ValidatorSet) Copy() *ValidatorSet {
+	c := NewValidatorSet()
+	for id, publicKey := range vs.publicKeys {
+		c.publicKeys[id] = publicKey
+	}
+	for addr, id := range vs.addresses {
+		c.addresses[addr] = id
+	}
+	return c
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/accounts"
+	"github.com/bocheninc/L0/core/params"
+)
+
+func TestValidatorSet(t *testing.T) {
+	defer func(v []string) { params.Validators = v }(params.Validators)
+	params.Validators = nil
+	var keys []*crypto.PrivateKey
+	for i := 0; i < 5; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+		params.Validators = append(params.Validators, fmt.Sprintf("node%d:%s", i, utils.BytesToHex(key.Public().Bytes())))
+	}
+
+	vs, err := GenesisValidatorSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vs.Len() != 5 || vs.Quorum() != 4 {
+		t.Errorf("validators %d, quorum %d", vs.Len(), vs.Quorum())
+	}
+	if !vs.Contains(accounts.PublicKeyToAddress(*keys[0].Public())) {
+		t.Error("validator account not contained")
+	}
+
+	if err := vs.Apply("node0", &ValidatorChange{Op: ValidatorRemove, NodeID: "node0"}); err != nil {
+		t.Fatal(err)
+	}
+	if vs.Contains(accounts.PublicKeyToAddress(*keys[0].Public())) || vs.Quorum() != 3 {
+		t.Errorf("removed validator contained, quorum %d", vs.Quorum())
+	}
+	if err := vs.Apply("node1", &ValidatorChange{Op: ValidatorRemove, NodeID: "node1"}); err == nil {
+		t.Error("remove validator below the minimum")
+	}
+	if err := vs.Apply("node5", &ValidatorChange{Op: ValidatorAdd, NodeID: "node5"}); err == nil {
+		t.Error("add validator without public key")
+	}
+	if err := vs.Apply("node0", &ValidatorChange{Op: ValidatorAdd, NodeID: "node0", PublicKey: keys[0].Public().Bytes()}); err != nil || vs.Len() != 5 {
+		t.Errorf("add validator err %v, validators %d", err, vs.Len())
+	}
+
+	params.Validators = []string{"node0"}
+	if _, err := GenesisValidatorSet(); err == nil {
+		t.Error("illegal genesis validator accepted")
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"os/signal"
 	"runtime"
 	"runtime/pprof"
+	"strings"
 	"sync"
 
 	"syscall"
@@ -39,6 +40,7 @@ import (
 	"github.com/bocheninc/L0/core/ledger"
 	"github.com/bocheninc/L0/core/merge"
 	"github.com/bocheninc/L0/core/p2p"
+	"github.com/bocheninc/L0/core/params"
 	"github.com/bocheninc/L0/node"
 )
 
@@ -84,7 +86,22 @@ func NewLcnd(cfgFile string) *Lcnd {
 
 	newLedger = ledger.NewLedger(chainDb)
 	bc = blockchain.NewBlockchain(newLedger)
-	consenter := consenter.NewConsenter(config.ConsenterOptions(), bc)
+	consenterOptions := config.ConsenterOptions()
+	consenterOptions.Lbft.PrivateKey = netConfig.PrivateKey
+	consenterOptions.Raft.PrivateKey = netConfig.PrivateKey
+	// lbft and raft certify the blocks by the validators, the blocks without quorum certificate are rejected
+	switch plugin := strings.ToLower(consenterOptions.Plugin); plugin {
+	case "lbft", "raft":
+		if len(params.Validators) == 0 {
+			log.Panicf("blockchain.validators should be configured to certify the blocks of consensus plugin %s", plugin)
+		}
+		bc.RequireValidators(true)
+	default:
+		if len(params.Validators) == 0 {
+			log.Warn("blockchain.validators is not configured, the blocks are accepted without quorum certificate")
+		}
+	}
+	consenter := consenter.NewConsenter(consenterOptions, bc)
 	ks = keystore.NewKeyStore(chainDb, cfg.KeyStoreDir, keystore.ScryptN, keystore.ScryptP)
 	lcnd.protocolManager = node.NewProtocolManager(chainDb, netConfig, bc, consenter, newLedger, ks, mergeConfig, cfg.LogDir)
 
@@ -117,6 +134,7 @@ func (l *Lcnd) Start() {
 
 	//l.bc.Start()
 	l.protocolManager.Start()
+	go l.reloadCertificates()
 
 	// TODO: every service start here, and make waitgroup usefull
 	l.wg.Add(1)
@@ -129,7 +147,7 @@ func startPProf(cpuFile, memFile string) {
 	pprof.StartCPUProfile(cpuProfile)
 
 	abort := make(chan os.Signal, 1)
-	signal.Notify(abort, os.Interrupt, os.Kill, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGKILL)
+	signal.Notify(abort, os.Interrupt, os.Kill, syscall.SIGTERM, syscall.SIGKILL)
 	go func() {
 		<-abort
 		pprof.StopCPUProfile()
@@ -143,6 +161,17 @@ func startPProf(cpuFile, memFile string) {
 
 }
 
+// reloadCertificates reloads the certificates of the p2p server on SIGHUP
+func (l *Lcnd) reloadCertificates() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := l.protocolManager.ReloadCertificates(); err != nil {
+			log.Errorf("Reload certificates error: %s", err)
+		}
+	}
+}
+
 func (l *Lcnd) initLog() {
 	log.New(l.Config.LogFile)
 	log.SetLevel(l.Config.LogLevel)
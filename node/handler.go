@@ -36,6 +36,7 @@ import (
 	"github.com/bocheninc/L0/components/log"
 	"github.com/bocheninc/L0/components/utils"
 	"github.com/bocheninc/L0/config"
+	"github.com/bocheninc/L0/core/accounts"
 	"github.com/bocheninc/L0/core/accounts/keystore"
 	"github.com/bocheninc/L0/core/blockchain"
 	"github.com/bocheninc/L0/core/consensus"
@@ -65,6 +66,8 @@ type ProtocolManager struct {
 	highest    uint32
 	jrpcServer *rpc.Server
 
+	synchronizer *synchronizer
+
 	filter *bloom.BloomFilter
 }
 
@@ -97,8 +100,11 @@ func NewProtocolManager(db *db.BlockchainDB, netConfig *p2p.Config,
 		BaseCmd: baseMsg,
 	})
 	manager.msgnet = msgnet.NewMsgnet(manager.peerAddress(), netConfig.RouteAddress, manager.handleMsgnetMessage, logDir)
+	manager.synchronizer = newSynchronizer(manager, func(p *p2p.Peer, msg *p2p.Msg) {
+		p2p.SendMessage(p.Conn, msg)
+	}, manager.startIfSynced)
 	manager.merger = merge.NewHelper(ledger, blockchain, manager, mergeConfig)
-	manager.jrpcServer = jrpc.NewServer(manager)
+	manager.jrpcServer = jrpc.NewServer(manager, config.JrpcConfig())
 
 	//manager.msgrpc = msgnet.NewRpcHelper(manager)
 	return manager
@@ -138,6 +144,7 @@ func (pm *ProtocolManager) handle(p *p2p.Peer, rw p2p.MsgReadWriter) error {
 		} else {
 			return fmt.Errorf("handshake error ")
 		}
+		defer pm.synchronizer.removePeer(p)
 		return pm.handleMsg(p, rw)
 	}
 	return fmt.Errorf("handshake error ")
@@ -170,8 +177,19 @@ func (pm *ProtocolManager) handleMsg(p *p2p.Peer, rw p2p.MsgReadWriter) error {
 			}
 		case broadcastAckMergeTxsMsg:
 			pm.merger.HandleLocalMsg(m)
+		case blockSignatureMsg:
+			pm.OnBlockSignature(m, p)
+		case getHeadersMsg:
+			pm.OnGetHeaders(m, p)
+		case headersMsg:
+			pm.OnHeaders(m, p)
+		case getBodiesMsg:
+			pm.OnGetBodies(m, p)
+		case bodiesMsg:
+			pm.OnBodies(m, p)
 		default:
-			log.Error("Unknown message")
+			// messages of newer protocol versions are dropped
+			log.Warnf("Unknown message %d from peer [%s]", m.Cmd, p)
 		}
 	}
 }
@@ -213,6 +231,7 @@ func (pm *ProtocolManager) Relay(inv types.IInventory) {
 			inventory.Hashes = []crypto.Hash{inv.Hash()}
 			log.Debugf("Relay inventory %v", inventory)
 			msg = p2p.NewMsg(invMsg, utils.Serialize(inventory))
+			pm.signBlock(inv.(*types.Block).Header)
 		}
 	}
 	if msg != nil {
@@ -220,6 +239,48 @@ func (pm *ProtocolManager) Relay(inv types.IInventory) {
 	}
 }
 
+// signBlock signs the block header produced by consensus with nodekey, which is also the key signing
+// the consensus messages, and broadcasts the signature if the node is a validator of the block
+func (pm *ProtocolManager) signBlock(header *types.BlockHeader) {
+	pub := pm.NodePublicKey()
+	if pub == nil || !pm.Blockchain.IsValidator(header.Height, accounts.PublicKeyToAddress(*pub)) {
+		return
+	}
+	blockHash := header.Hash()
+
+	sig, err := pm.Sign(blockHash.Bytes())
+	if err != nil {
+		log.Errorf("Sign block %s error %v", blockHash, err)
+		return
+	}
+
+	if pm.Blockchain.ProcessBlockSignature(blockHash, *sig) {
+		pm.msgCh <- p2p.NewMsg(blockSignatureMsg, utils.Serialize(&BlockSignature{Hash: blockHash, Signature: *sig}))
+	}
+}
+
+// SyncBlocks requests the next header from remote peers, the synchronization starts once a peer replies with a higher height
+func (pm *ProtocolManager) SyncBlocks() {
+	getHeaders := GetHeaders{
+		From:  pm.CurrentHeight() + 1,
+		Count: 1,
+	}
+	pm.msgCh <- p2p.NewMsg(getHeadersMsg, utils.Serialize(getHeaders))
+}
+
+// SyncStatus returns the progress of the block synchronization
+func (pm *ProtocolManager) SyncStatus() *blockchain.SyncStatus {
+	return pm.synchronizer.status()
+}
+
+// startIfSynced starts the blockchain services once the chain reaches the highest known height
+func (pm *ProtocolManager) startIfSynced() {
+	if !pm.isStarted && pm.CurrentHeight() >= pm.highest {
+		pm.isStarted = true
+		pm.Blockchain.Start()
+	}
+}
+
 func (pm *ProtocolManager) consensusReadLoop() {
 	for {
 		select {
@@ -270,19 +331,13 @@ func (pm *ProtocolManager) OnStatus(m p2p.Msg, p *p2p.Peer) {
 		return
 	}
 	log.Debugln("-----sync----- OnStatus", "---- From ", pm.CurrentHeight(), " To ", remote.StartHeight, " Size ", remote.StartHeight-pm.CurrentHeight())
-	if pm.CurrentHeight() < remote.StartHeight {
+	if pm.synchronizer.updatePeer(p, remote.StartHeight) {
 		if remote.StartHeight > pm.highest {
 			pm.highest = remote.StartHeight
 		}
-		getBlocks := GetBlocks{
-			Version:       params.VersionMajor,
-			LocatorHashes: []crypto.Hash{pm.Blockchain.CurrentBlockHash()},
-			HashStop:      crypto.Hash{},
-		}
-		p2p.SendMessage(p.Conn, p2p.NewMsg(getBlocksMsg, utils.Serialize(getBlocks)))
-	} else if !pm.isStarted {
-		pm.isStarted = true
-		pm.Blockchain.Start()
+		pm.synchronizer.start()
+	} else if !pm.synchronizer.isSyncing() {
+		pm.startIfSynced()
 	}
 }
 
@@ -296,6 +351,7 @@ func (pm *ProtocolManager) OnTx(m p2p.Msg, p *p2p.Peer) {
 	tx := new(types.Transaction)
 	if err := tx.Deserialize(m.Payload); err != nil {
 		log.Errorln("OnTx deserialize error ", err)
+		pm.Misbehave(p, p2p.PenaltyInvalidTx, "transaction deserialize error")
 		return
 	}
 
@@ -303,6 +359,9 @@ func (pm *ProtocolManager) OnTx(m p2p.Msg, p *p2p.Peer) {
 
 	if pm.Blockchain.ProcessTransaction(tx) {
 		pm.msgCh <- &m
+	} else if address, err := tx.Verfiy(); err != nil || !bytes.Equal(address.Bytes(), tx.Sender().Bytes()) {
+		// the transactions rejected for the pool state, e.g. a full pool, are not the fault of the peer
+		pm.Misbehave(p, p2p.PenaltyInvalidTx, fmt.Sprintf("invalid transaction signature %s", tx.Hash()))
 	}
 }
 
@@ -347,23 +406,25 @@ func (pm *ProtocolManager) OnBlock(m p2p.Msg, peer *p2p.Peer) {
 	blk := new(types.Block)
 	if err := blk.Deserialize(m.Payload); err != nil {
 		log.Errorln("-----sync----- OnBlock  deserialize ", err)
+		pm.Misbehave(peer, p2p.PenaltyInvalidBlock, "block deserialize error")
 		return
 	}
 
 	log.Debugf("-----sync----- OnBlock %s(%d)", blk.Hash(), blk.Height())
 	// p.AddFilter(m.CheckSum[:])
 	if pm.CurrentHeight()+1 < blk.Height() {
-		getBlocks := GetBlocks{
-			Version:       params.VersionMajor,
-			LocatorHashes: []crypto.Hash{pm.Blockchain.CurrentBlockHash()},
-			HashStop:      crypto.Hash{},
+		if pm.synchronizer.updatePeer(peer, blk.Height()-1) {
+			pm.synchronizer.start()
 		}
-		p2p.SendMessage(peer.Conn, p2p.NewMsg(getBlocksMsg, utils.Serialize(getBlocks)))
-	} else if pm.Blockchain.ProcessBlock(blk, false) {
-		if !pm.isStarted && pm.CurrentHeight() == pm.highest {
-			pm.isStarted = true
-			pm.Blockchain.Start()
+	} else if ok, err := pm.Blockchain.ProcessPeerBlock(blk); ok {
+		if !pm.synchronizer.isSyncing() {
+			pm.startIfSynced()
 		}
+	} else if errors.Is(err, blockchain.ErrNoQuorumCertificate) {
+		pm.Misbehave(peer, p2p.PenaltyUncertifiedBlock, fmt.Sprintf("uncertified side block %s(%d)", blk.Hash(), blk.Height()))
+	} else if pm.CurrentHeight()+1 == blk.Height() {
+		log.Errorf("-----sync----- OnBlock reject %s(%d) from peer %s, state diverged or chain broken", blk.Hash(), blk.Height(), peer.Address)
+		pm.Misbehave(peer, p2p.PenaltyInvalidBlock, fmt.Sprintf("invalid block %s(%d)", blk.Hash(), blk.Height()))
 	}
 }
 
@@ -464,6 +525,98 @@ func (pm *ProtocolManager) OnGetData(m p2p.Msg, peer *p2p.Peer) {
 	}
 }
 
+// OnGetHeaders processes getheaders message
+func (pm *ProtocolManager) OnGetHeaders(m p2p.Msg, peer *p2p.Peer) {
+	var getHeaders GetHeaders
+	if err := utils.Deserialize(m.Payload, &getHeaders); err != nil {
+		log.Errorln("-----sync----- OnGetHeaders deserialize error", err)
+		return
+	}
+
+	headers := Headers{Height: pm.CurrentHeight()}
+	if getHeaders.Count > maxHeadersFetch {
+		getHeaders.Count = maxHeadersFetch
+	}
+	for i := uint32(0); i < getHeaders.Count; i++ {
+		// From+i wraps around at the max height
+		h := getHeaders.From + i
+		if h < getHeaders.From || h > headers.Height {
+			break
+		}
+		header, err := pm.GetBlockByNumber(h)
+		if err != nil || header == nil {
+			break
+		}
+		headers.Headers = append(headers.Headers, header)
+	}
+	p2p.SendMessage(peer.Conn, p2p.NewMsg(headersMsg, utils.Serialize(headers)))
+}
+
+// OnHeaders processes headers message
+func (pm *ProtocolManager) OnHeaders(m p2p.Msg, peer *p2p.Peer) {
+	var headers Headers
+	if err := utils.Deserialize(m.Payload, &headers); err != nil {
+		log.Errorln("-----sync----- OnHeaders deserialize error", err)
+		return
+	}
+
+	higher := pm.synchronizer.updatePeer(peer, headers.Height)
+	if pm.synchronizer.isSyncing() {
+		pm.synchronizer.deliverHeaders(peer, headers.Headers)
+	} else if higher {
+		if headers.Height > pm.highest {
+			pm.highest = headers.Height
+		}
+		pm.synchronizer.start()
+	}
+}
+
+// OnGetBodies processes getbodies message, the bodies not found or pruned are left out
+func (pm *ProtocolManager) OnGetBodies(m p2p.Msg, peer *p2p.Peer) {
+	var getBodies GetBodies
+	if err := utils.Deserialize(m.Payload, &getBodies); err != nil {
+		log.Errorln("-----sync----- OnGetBodies deserialize error", err)
+		return
+	}
+
+	var bodies Bodies
+	for i, h := range getBodies.Hashes {
+		if i >= maxBodiesFetch {
+			break
+		}
+		txs, err := pm.GetTxsByBlockHash(h.Bytes(), 100)
+		if err != nil {
+			log.Debugf("-----sync----- OnGetBodies block %s error %v", h, err)
+			continue
+		}
+		bodies.Bodies = append(bodies.Bodies, &BlockBody{Hash: h, Transactions: txs})
+	}
+	p2p.SendMessage(peer.Conn, p2p.NewMsg(bodiesMsg, utils.Serialize(bodies)))
+}
+
+// OnBodies processes bodies message
+func (pm *ProtocolManager) OnBodies(m p2p.Msg, peer *p2p.Peer) {
+	var bodies Bodies
+	if err := utils.Deserialize(m.Payload, &bodies); err != nil {
+		log.Errorln("-----sync----- OnBodies deserialize error", err)
+		return
+	}
+	pm.synchronizer.deliverBodies(peer, bodies.Bodies)
+}
+
+// OnBlockSignature processes block signature message
+func (pm *ProtocolManager) OnBlockSignature(m p2p.Msg, peer *p2p.Peer) {
+	var blockSignature BlockSignature
+	if err := utils.Deserialize(m.Payload, &blockSignature); err != nil {
+		log.Errorln("OnBlockSignature deserialize error", err)
+		return
+	}
+
+	if pm.Blockchain.ProcessBlockSignature(blockSignature.Hash, blockSignature.Signature) {
+		pm.msgCh <- &m
+	}
+}
+
 // OnConsensus processes consensus message
 func (pm *ProtocolManager) OnConsensus(m p2p.Msg, peer *p2p.Peer) {
 	log.Debugf("Req receive consensus message %v", m.Cmd)
@@ -537,7 +690,7 @@ func (pm *ProtocolManager) handleMsgnetMessage(src, dst string, payload, signatu
 		in := new(bytes.Buffer)
 		out := new(bytes.Buffer)
 		in.Write(msg.Payload)
-		pm.jrpcServer.ServeRequest(jsonrpc.NewServerCodec(jrpc.NewHttConn(in, out)))
+		pm.jrpcServer.ServeRequest(jrpc.NewClientCodec(jsonrpc.NewServerCodec(jrpc.NewHttConn(in, out)), src))
 		log.Debugf("remote rpc cmd : %v rpc msg rom message net %v:%v, src: %v\n", msg.Cmd, chainID, peerID, src)
 		pm.SendMsgnetMessage(pm.peerAddress(), src, msgnet.Message{Cmd: msg.Cmd, Payload: out.Bytes()})
 		log.Debugf("Broadcast consensus message to msg-net, result: %s", string(out.Bytes()))
@@ -20,6 +20,7 @@ package node
 
 import (
 	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/core/types"
 )
 
 // InvType represents the allowed types of inventory vectors
@@ -57,3 +58,37 @@ type InvVect struct {
 type GetData struct {
 	InvList []InvVect
 }
+
+// BlockSignature represents a validator signature of the block header
+type BlockSignature struct {
+	Hash      crypto.Hash
+	Signature crypto.Signature
+}
+
+// GetHeaders represents a getheaders message requesting Count headers from height From
+type GetHeaders struct {
+	From  uint32
+	Count uint32
+}
+
+// Headers represents a headers message, Height is the current height of the sender
+type Headers struct {
+	Height  uint32
+	Headers []*types.BlockHeader
+}
+
+// GetBodies represents a getbodies message
+type GetBodies struct {
+	Hashes []crypto.Hash
+}
+
+// BlockBody represents the transactions of the block
+type BlockBody struct {
+	Hash         crypto.Hash
+	Transactions types.Transactions
+}
+
+// Bodies represents a bodies message
+type Bodies struct {
+	Bodies []*BlockBody
+}
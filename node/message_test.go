@@ -26,6 +26,7 @@ import (
 	"github.com/bocheninc/L0/components/crypto"
 
 	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/types"
 )
 
 func TestStatusPayload(t *testing.T) {
@@ -65,3 +66,30 @@ func TestInvVectPayload(t *testing.T) {
 		t.Errorf("Deserialize error")
 	}
 }
+
+func TestHeadersPayload(t *testing.T) {
+	var (
+		header  = types.NewBlockHeader(crypto.Sha256([]byte("1")), 100, 2, 100, crypto.Hash{})
+		headers = Headers{
+			Height:  10,
+			Headers: []*types.BlockHeader{header},
+		}
+	)
+
+	headers2 := Headers{}
+	if err := utils.Deserialize(utils.Serialize(headers), &headers2); err != nil {
+		t.Fatal(err)
+	}
+	if headers2.Height != headers.Height || len(headers2.Headers) != 1 || !headers2.Headers[0].Hash().Equal(header.Hash()) {
+		t.Errorf("headers not equal")
+	}
+
+	bodies := Bodies{Bodies: []*BlockBody{{Hash: header.Hash()}}}
+	bodies2 := Bodies{}
+	if err := utils.Deserialize(utils.Serialize(bodies), &bodies2); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies2.Bodies) != 1 || !bodies2.Bodies[0].Hash.Equal(header.Hash()) {
+		t.Errorf("bodies not equal")
+	}
+}
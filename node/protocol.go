@@ -28,6 +28,11 @@ const (
 	getdataMsg
 	consensusMsg
 	broadcastAckMergeTxsMsg
+	blockSignatureMsg
+	getHeadersMsg
+	headersMsg
+	getBodiesMsg
+	bodiesMsg
 )
 
 //var (
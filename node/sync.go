@@ -0,0 +1,468 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/log"
+	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/blockchain"
+	"github.com/bocheninc/L0/core/p2p"
+	"github.com/bocheninc/L0/core/types"
+)
+
+const (
+	// maxHeadersFetch is the number of headers requested in one getheaders message
+	maxHeadersFetch = 192
+	// maxHeadersRound is the number of headers fetched before downloading their bodies
+	maxHeadersRound = 2048
+	// maxBodiesFetch is the number of block bodies in one download window
+	maxBodiesFetch = 16
+	// maxSyncRetries is the number of retries of a request or a sync round
+	maxSyncRetries = 5
+)
+
+var (
+	syncRequestTimeout = 10 * time.Second
+
+	errNoSyncPeer = errors.New("no peer to synchronize from")
+)
+
+type syncPeer struct {
+	peer   *p2p.Peer
+	height uint32
+}
+
+type syncResponse struct {
+	peer    *p2p.Peer
+	headers []*types.BlockHeader
+	bodies  []*BlockBody
+}
+
+type bodyWindow struct {
+	start, end int
+	retries    int
+	peer       string
+	deadline   time.Time
+	failed     map[string]bool
+}
+
+// syncChain is the local chain the synchronizer validates and appends the blocks to
+type syncChain interface {
+	CurrentHeight() uint32
+	GetBlockByNumber(number uint32) (*types.BlockHeader, error)
+	GetBlockHashByNumber(number uint32) (crypto.Hash, error)
+	VerifyBlockHeader(previous, header *types.BlockHeader) error
+	VerifyBlockBody(header *types.BlockHeader, txs types.Transactions) error
+	ProcessBlock(blk *types.Block, flag bool) bool
+}
+
+// synchronizer fetches and validates the header chain first, then downloads
+// the block bodies in parallel windows from different peers and applies them in order
+type synchronizer struct {
+	chain syncChain
+	send  func(p *p2p.Peer, msg *p2p.Msg)
+	done  func()
+
+	mu       sync.Mutex
+	peers    map[string]*syncPeer
+	syncing  bool
+	starting uint32
+	headers  uint32
+	highest  uint32
+
+	headerCh chan *syncResponse
+	bodyCh   chan *syncResponse
+}
+
+func newSynchronizer(chain syncChain, send func(p *p2p.Peer, msg *p2p.Msg), done func()) *synchronizer {
+	return &synchronizer{
+		chain:    chain,
+		send:     send,
+		done:     done,
+		peers:    make(map[string]*syncPeer),
+		headerCh: make(chan *syncResponse, 16),
+		bodyCh:   make(chan *syncResponse, 16),
+	}
+}
+
+// updatePeer records the height of the peer, returns true if it is higher than the local chain
+func (s *synchronizer) updatePeer(p *p2p.Peer, height uint32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sp, ok := s.peers[p.ID.String()]
+	if !ok {
+		sp = &syncPeer{peer: p}
+		s.peers[p.ID.String()] = sp
+	}
+	if height > sp.height {
+		sp.height = height
+	}
+	if height > s.highest {
+		s.highest = height
+	}
+	return height > s.chain.CurrentHeight()
+}
+
+func (s *synchronizer) removePeer(p *p2p.Peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.peers, p.ID.String())
+}
+
+// start starts a synchronization if it is not running
+func (s *synchronizer) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.syncing {
+		return
+	}
+	s.syncing = true
+	s.starting = s.chain.CurrentHeight()
+	s.headers = s.starting
+	go s.run()
+}
+
+func (s *synchronizer) isSyncing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.syncing
+}
+
+func (s *synchronizer) status() *blockchain.SyncStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := &blockchain.SyncStatus{
+		Syncing:       s.syncing,
+		CurrentHeight: s.chain.CurrentHeight(),
+		HighestHeight: s.highest,
+		Peers:         len(s.peers),
+	}
+	if s.syncing {
+		status.StartingHeight = s.starting
+		status.HeadersHeight = s.headers
+	}
+	if status.HighestHeight < status.CurrentHeight {
+		status.HighestHeight = status.CurrentHeight
+	}
+	return status
+}
+
+func (s *synchronizer) deliverHeaders(p *p2p.Peer, headers []*types.BlockHeader) {
+	select {
+	case s.headerCh <- &syncResponse{peer: p, headers: headers}:
+	default:
+	}
+}
+
+func (s *synchronizer) deliverBodies(p *p2p.Peer, bodies []*BlockBody) {
+	select {
+	case s.bodyCh <- &syncResponse{peer: p, bodies: bodies}:
+	default:
+	}
+}
+
+// pickPeer returns a random peer reaching the height and not in the excluded set
+func (s *synchronizer) pickPeer(height uint32, excluded map[string]bool) *syncPeer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var candidates []*syncPeer
+	for id, sp := range s.peers {
+		if sp.height >= height && !excluded[id] {
+			candidates = append(candidates, sp)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+func (s *synchronizer) target() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var height uint32
+	for _, sp := range s.peers {
+		if sp.height > height {
+			height = sp.height
+		}
+	}
+	return height
+}
+
+func (s *synchronizer) run() {
+	defer func() {
+		s.mu.Lock()
+		s.syncing = false
+		s.mu.Unlock()
+		s.done()
+	}()
+
+	for retries := 0; retries < maxSyncRetries; {
+		current := s.chain.CurrentHeight()
+		target := s.target()
+		if current >= target {
+			log.Infof("-----sync----- done at height %d", current)
+			return
+		}
+		if target-current > maxHeadersRound {
+			target = current + maxHeadersRound
+		}
+
+		log.Infof("-----sync----- from %d to %d", current, target)
+		headers, err := s.fetchHeaders(current, target)
+		if err == nil {
+			err = s.fetchBodies(headers)
+		}
+		if err != nil {
+			retries++
+			log.Errorf("-----sync----- round from %d failed, retries %d, err %v", current, retries, err)
+		}
+	}
+}
+
+// fetchHeaders fetches the headers after height current to target, each batch is requested from a random peer.
+// If the headers can't be fetched further, the verified ones are returned to be applied first, since the headers
+// after them may be signed by the validators changed by their blocks, which are loaded once they are appended
+func (s *synchronizer) fetchHeaders(current, target uint32) ([]*types.BlockHeader, error) {
+	previous, err := s.chain.GetBlockByNumber(current)
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []*types.BlockHeader
+	failed := make(map[string]bool)
+	for retries := 0; previous.Height < target; {
+		if retries >= maxSyncRetries {
+			err = fmt.Errorf("fetch headers from %d failed", previous.Height+1)
+			break
+		}
+		count := target - previous.Height
+		if count > maxHeadersFetch {
+			count = maxHeadersFetch
+		}
+		sp := s.pickPeer(previous.Height+count, failed)
+		if sp == nil {
+			if len(failed) == 0 {
+				err = errNoSyncPeer
+				break
+			}
+			failed = make(map[string]bool)
+			retries++
+			continue
+		}
+
+		getHeaders := GetHeaders{From: previous.Height + 1, Count: count}
+		s.send(sp.peer, p2p.NewMsg(getHeadersMsg, utils.Serialize(getHeaders)))
+		resp := s.waitResponse(s.headerCh, sp.peer)
+		if resp == nil || len(resp.headers) == 0 {
+			log.Warnf("-----sync----- headers from %d timeout or empty, peer %s", getHeaders.From, sp.peer)
+			failed[sp.peer.ID.String()] = true
+			retries++
+			continue
+		}
+
+		valid := 0
+		for _, header := range resp.headers {
+			if err := s.chain.VerifyBlockHeader(previous, header); err != nil {
+				log.Warnf("-----sync----- invalid header from peer %s, %v", sp.peer, err)
+				break
+			}
+			headers = append(headers, header)
+			previous = header
+			valid++
+		}
+		if valid < len(resp.headers) {
+			failed[sp.peer.ID.String()] = true
+			retries++
+		}
+
+		s.mu.Lock()
+		s.headers = previous.Height
+		s.mu.Unlock()
+	}
+	if err != nil {
+		if len(headers) == 0 {
+			return nil, err
+		}
+		log.Warnf("-----sync----- %v, apply the headers verified to %d first", err, previous.Height)
+	}
+	return headers, nil
+}
+
+func (s *synchronizer) waitResponse(ch chan *syncResponse, p *p2p.Peer) *syncResponse {
+	timer := time.NewTimer(syncRequestTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case resp := <-ch:
+			if resp.peer.ID.String() == p.ID.String() {
+				return resp
+			}
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+// fetchBodies downloads the bodies of the headers in windows from idle peers and applies the blocks in order
+func (s *synchronizer) fetchBodies(headers []*types.BlockHeader) error {
+	var (
+		queue    []*bodyWindow
+		inflight = make(map[string]*bodyWindow)
+		blocks   = make([]*types.Block, len(headers))
+		next     = 0
+		ticker   = time.NewTicker(syncRequestTimeout / 10)
+	)
+	defer ticker.Stop()
+
+	for start := 0; start < len(headers); start += maxBodiesFetch {
+		end := start + maxBodiesFetch
+		if end > len(headers) {
+			end = len(headers)
+		}
+		queue = append(queue, &bodyWindow{start: start, end: end, failed: make(map[string]bool)})
+	}
+	requeue := func(w *bodyWindow) error {
+		w.failed[w.peer] = true
+		w.retries++
+		if w.retries >= maxSyncRetries {
+			return fmt.Errorf("fetch bodies from %d failed", headers[w.start].Height)
+		}
+		queue = append([]*bodyWindow{w}, queue...)
+		return nil
+	}
+
+	for next < len(headers) {
+		var pending []*bodyWindow
+		for _, w := range queue {
+			excluded := make(map[string]bool)
+			for id := range inflight {
+				excluded[id] = true
+			}
+			height := headers[w.end-1].Height
+			sp := s.pickPeer(height, mergeExcluded(excluded, w.failed))
+			if sp == nil && s.pickPeer(height, w.failed) == nil {
+				// every peer failed the window, it is retried from any idle peer
+				sp = s.pickPeer(height, excluded)
+			}
+			if sp == nil {
+				// waits for a peer not failed the window
+				pending = append(pending, w)
+				continue
+			}
+
+			getBodies := GetBodies{}
+			for _, header := range headers[w.start:w.end] {
+				getBodies.Hashes = append(getBodies.Hashes, header.Hash())
+			}
+			s.send(sp.peer, p2p.NewMsg(getBodiesMsg, utils.Serialize(getBodies)))
+			w.peer = sp.peer.ID.String()
+			w.deadline = time.Now().Add(syncRequestTimeout)
+			inflight[w.peer] = w
+		}
+		queue = pending
+		if len(inflight) == 0 {
+			return errNoSyncPeer
+		}
+
+		select {
+		case resp := <-s.bodyCh:
+			w, ok := inflight[resp.peer.ID.String()]
+			if !ok {
+				continue
+			}
+			delete(inflight, w.peer)
+
+			bodies := make(map[crypto.Hash]*BlockBody)
+			for _, body := range resp.bodies {
+				bodies[body.Hash] = body
+			}
+			complete := true
+			for i := w.start; i < w.end; i++ {
+				body, ok := bodies[headers[i].Hash()]
+				if !ok {
+					complete = false
+					continue
+				}
+				if err := s.chain.VerifyBlockBody(headers[i], body.Transactions); err != nil {
+					log.Warnf("-----sync----- invalid body from peer %s, %v", resp.peer, err)
+					complete = false
+					continue
+				}
+				blocks[i] = &types.Block{Header: headers[i], Transactions: body.Transactions}
+			}
+			if !complete {
+				if err := requeue(w); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			for id, w := range inflight {
+				if time.Now().After(w.deadline) {
+					log.Warnf("-----sync----- bodies from %d timeout, peer %s", headers[w.start].Height, id)
+					delete(inflight, id)
+					if err := requeue(w); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		for ; next < len(headers) && blocks[next] != nil; next++ {
+			if err := s.applyBlock(blocks[next]); err != nil {
+				return err
+			}
+			blocks[next] = nil
+		}
+	}
+	return nil
+}
+
+// applyBlock appends the block, it is skipped if the block was appended by the block relay meanwhile
+func (s *synchronizer) applyBlock(blk *types.Block) error {
+	if s.chain.CurrentHeight() >= blk.Height() {
+		hash, err := s.chain.GetBlockHashByNumber(blk.Height())
+		if err != nil || !hash.Equal(blk.Hash()) {
+			return fmt.Errorf("block %s(%d) mismatch local block %s", blk.Hash(), blk.Height(), hash)
+		}
+		return nil
+	}
+	if !s.chain.ProcessBlock(blk, false) {
+		return fmt.Errorf("block %s(%d) rejected", blk.Hash(), blk.Height())
+	}
+	return nil
+}
+
+func mergeExcluded(a, b map[string]bool) map[string]bool {
+	m := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		m[k] = true
+	}
+	for k := range b {
+		m[k] = true
+	}
+	return m
+}
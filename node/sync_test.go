@@ -0,0 +1,297 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/core/accounts"
+	"github.com/bocheninc/L0/core/blockchain"
+	"github.com/bocheninc/L0/core/p2p"
+	"github.com/bocheninc/L0/core/types"
+)
+
+type fakeChain struct {
+	sync.Mutex
+	headers []*types.BlockHeader
+	applied []uint32
+	// certified are the hashs of the blocks with a valid quorum certificate
+	certified map[crypto.Hash]bool
+	// validatorChange is the height of the block changing the validators, the blocks after are
+	// verified only once it is appended
+	validatorChange uint32
+}
+
+func (c *fakeChain) CurrentHeight() uint32 {
+	c.Lock()
+	defer c.Unlock()
+	return c.headers[len(c.headers)-1].Height
+}
+
+func (c *fakeChain) GetBlockByNumber(number uint32) (*types.BlockHeader, error) {
+	c.Lock()
+	defer c.Unlock()
+	if int(number) >= len(c.headers) {
+		return nil, errors.New("not found block")
+	}
+	return c.headers[number], nil
+}
+
+func (c *fakeChain) GetBlockHashByNumber(number uint32) (crypto.Hash, error) {
+	header, err := c.GetBlockByNumber(number)
+	if err != nil {
+		return crypto.Hash{}, err
+	}
+	return header.Hash(), nil
+}
+
+func (c *fakeChain) VerifyBlockHeader(previous, header *types.BlockHeader) error {
+	if header.Height != previous.Height+1 || !header.PreviousHash.Equal(previous.Hash()) {
+		return fmt.Errorf("block %s(%d) not linked to %s", header.Hash(), header.Height, previous.Hash())
+	}
+	if !c.certified[header.Hash()] {
+		return fmt.Errorf("block %s(%d) not certified", header.Hash(), header.Height)
+	}
+	if c.validatorChange > 0 && header.Height > c.validatorChange && c.CurrentHeight() < c.validatorChange {
+		return fmt.Errorf("block %s(%d) signed by unknown validators", header.Hash(), header.Height)
+	}
+	return nil
+}
+
+func (c *fakeChain) VerifyBlockBody(header *types.BlockHeader, txs types.Transactions) error {
+	return new(blockchain.Blockchain).VerifyBlockBody(header, txs)
+}
+
+func (c *fakeChain) ProcessBlock(blk *types.Block, flag bool) bool {
+	c.Lock()
+	defer c.Unlock()
+	current := c.headers[len(c.headers)-1]
+	if blk.Height() != current.Height+1 || !blk.Header.PreviousHash.Equal(current.Hash()) {
+		return false
+	}
+	c.headers = append(c.headers, blk.Header)
+	c.applied = append(c.applied, blk.Height())
+	return true
+}
+
+const (
+	peerHonest = iota
+	peerSilent
+	peerForging
+)
+
+type fakePeer struct {
+	peer      *p2p.Peer
+	mode      int
+	getHeader int
+	getBodies []int
+}
+
+// fakeNetwork answers the requests of the synchronizer from the remote blocks by the mode of each peer
+type fakeNetwork struct {
+	sync.Mutex
+	s      *synchronizer
+	blocks []*types.Block
+	peers  map[string]*fakePeer
+}
+
+func newFakeBlocks(n int) []*types.Block {
+	blocks := []*types.Block{types.NewBlock(crypto.Hash{}, 0, 0, 0, crypto.Hash{}, nil)}
+	for i := 1; i <= n; i++ {
+		var (
+			txs    types.Transactions
+			hashs  []crypto.Hash
+			merkle crypto.Hash
+		)
+		for j := 0; j < i%3; j++ {
+			tx := types.NewTransaction(nil, nil, types.TypeAtomic, uint32(i*3+j), accounts.Address{}, accounts.Address{}, big.NewInt(1), big.NewInt(1), uint32(i))
+			txs = append(txs, tx)
+			hashs = append(hashs, tx.Hash())
+		}
+		if len(hashs) > 0 {
+			merkle = crypto.ComputeMerkleHash(hashs)[0]
+		}
+		blocks = append(blocks, types.NewBlock(blocks[i-1].Hash(), uint32(i), uint32(i), 0, merkle, txs))
+	}
+	return blocks
+}
+
+func newFakeNetwork(blocks []*types.Block, modes ...int) (*fakeNetwork, *fakeChain) {
+	chain := &fakeChain{headers: []*types.BlockHeader{blocks[0].Header}, certified: make(map[crypto.Hash]bool)}
+	for _, blk := range blocks {
+		chain.certified[blk.Hash()] = true
+	}
+	net := &fakeNetwork{blocks: blocks, peers: make(map[string]*fakePeer)}
+	net.s = newSynchronizer(chain, net.send, func() {})
+	for i, mode := range modes {
+		p := &fakePeer{peer: p2p.NewPeer([]byte{byte(i + 1)}, nil, "", nil), mode: mode}
+		net.peers[p.peer.ID.String()] = p
+		net.s.updatePeer(p.peer, uint32(len(blocks)-1))
+	}
+	return net, chain
+}
+
+func (net *fakeNetwork) send(peer *p2p.Peer, msg *p2p.Msg) {
+	net.Lock()
+	defer net.Unlock()
+	p := net.peers[peer.ID.String()]
+	switch msg.Cmd {
+	case getHeadersMsg:
+		p.getHeader++
+		var getHeaders GetHeaders
+		utils.Deserialize(msg.Payload, &getHeaders)
+		if p.mode == peerSilent {
+			return
+		}
+		var headers []*types.BlockHeader
+		for h := getHeaders.From; h < getHeaders.From+getHeaders.Count && int(h) < len(net.blocks); h++ {
+			header := *net.blocks[h].Header
+			if p.mode == peerForging {
+				header.Nonce++
+			}
+			headers = append(headers, &header)
+		}
+		net.s.deliverHeaders(peer, headers)
+	case getBodiesMsg:
+		var getBodies GetBodies
+		utils.Deserialize(msg.Payload, &getBodies)
+		p.getBodies = append(p.getBodies, len(getBodies.Hashes))
+		if p.mode == peerSilent {
+			return
+		}
+		var bodies []*BlockBody
+		for _, hash := range getBodies.Hashes {
+			for _, blk := range net.blocks {
+				if !blk.Hash().Equal(hash) {
+					continue
+				}
+				txs := blk.Transactions
+				if p.mode == peerForging {
+					// drops the transactions or adds one to a block without transactions
+					txs = nil
+					if len(blk.Transactions) == 0 {
+						txs = types.Transactions{types.NewTransaction(nil, nil, types.TypeAtomic, 0, accounts.Address{}, accounts.Address{}, big.NewInt(1), big.NewInt(1), 0)}
+					}
+				}
+				bodies = append(bodies, &BlockBody{Hash: hash, Transactions: txs})
+			}
+		}
+		net.s.deliverBodies(peer, bodies)
+	}
+}
+
+func (net *fakeNetwork) sync(t *testing.T, timeout time.Duration) {
+	done := make(chan struct{})
+	net.s.done = func() { close(done) }
+	net.s.start()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatal("synchronization timeout")
+	}
+}
+
+func (net *fakeNetwork) checkChain(t *testing.T, chain *fakeChain) {
+	if height := chain.CurrentHeight(); int(height) != len(net.blocks)-1 {
+		t.Fatalf("height %d, expected %d", height, len(net.blocks)-1)
+	}
+	for i, blk := range net.blocks {
+		if !chain.headers[i].Hash().Equal(blk.Hash()) {
+			t.Fatalf("block %d mismatch", i)
+		}
+	}
+	for i, h := range chain.applied {
+		if h != uint32(i+1) {
+			t.Fatalf("block %d applied at %d", h, i)
+		}
+	}
+}
+
+func TestSynchronizer(t *testing.T) {
+	net, chain := newFakeNetwork(newFakeBlocks(100), peerHonest, peerHonest, peerHonest)
+	net.sync(t, 10*time.Second)
+	net.checkChain(t, chain)
+	if net.s.isSyncing() {
+		t.Error("synchronizer is running")
+	}
+
+	for id, p := range net.peers {
+		// the first windows are downloaded from all the idle peers
+		if len(p.getBodies) == 0 {
+			t.Errorf("peer %s not requested", id)
+		}
+		for _, n := range p.getBodies {
+			if n == 0 || n > maxBodiesFetch {
+				t.Errorf("peer %s requested %d bodies", id, n)
+			}
+		}
+	}
+}
+
+func TestSynchronizerFaultyPeers(t *testing.T) {
+	defer func(timeout time.Duration) { syncRequestTimeout = timeout }(syncRequestTimeout)
+	syncRequestTimeout = 50 * time.Millisecond
+
+	net, chain := newFakeNetwork(newFakeBlocks(100), peerHonest, peerSilent, peerForging)
+	net.sync(t, 10*time.Second)
+	net.checkChain(t, chain)
+
+	for id, p := range net.peers {
+		if len(p.getBodies) == 0 {
+			t.Errorf("peer %s not requested", id)
+		}
+	}
+}
+
+func TestSynchronizerValidatorChange(t *testing.T) {
+	net, chain := newFakeNetwork(newFakeBlocks(100), peerHonest, peerHonest)
+	chain.validatorChange = 40
+	net.sync(t, 10*time.Second)
+	net.checkChain(t, chain)
+}
+
+func TestSynchronizerRetries(t *testing.T) {
+	defer func(timeout time.Duration) { syncRequestTimeout = timeout }(syncRequestTimeout)
+	syncRequestTimeout = 10 * time.Millisecond
+
+	net, chain := newFakeNetwork(newFakeBlocks(10), peerSilent, peerForging)
+	net.sync(t, 10*time.Second)
+	if height := chain.CurrentHeight(); height != 0 {
+		t.Errorf("height %d, expected 0", height)
+	}
+
+	// each failed peer is excluded until all peers failed, the rounds stop after the retries
+	var requests int
+	for _, p := range net.peers {
+		requests += p.getHeader
+	}
+	if requests == 0 || requests > maxSyncRetries*maxSyncRetries {
+		t.Errorf("%d getheaders requests", requests)
+	}
+	if status := net.s.status(); status.Syncing || status.HighestHeight != 10 {
+		t.Errorf("sync status %v", status)
+	}
+}
@@ -23,12 +23,17 @@ type Option struct {
 	Port     string
 	User     string
 	PassWord string
+	// MaxSubscriptions the subscriptions kept by the node, MaxClientSubscriptions the subscriptions kept for one client
+	MaxSubscriptions       int
+	MaxClientSubscriptions int
 }
 
 func NewDefaultOption() *Option {
 	option := &Option{
-		Enabled: true,
-		Port:    "8000",
+		Enabled:                true,
+		Port:                   "8000",
+		MaxSubscriptions:       1000,
+		MaxClientSubscriptions: 16,
 	}
 
 	return option
@@ -19,15 +19,24 @@
 package rpc
 
 import (
+	"errors"
+	"fmt"
 	"math/big"
 
 	"github.com/bocheninc/L0/components/crypto"
 	"github.com/bocheninc/L0/components/utils"
 	"github.com/bocheninc/L0/core/accounts"
+	"github.com/bocheninc/L0/core/ledger/block_storage"
 	"github.com/bocheninc/L0/core/ledger/state"
 	"github.com/bocheninc/L0/core/types"
 )
 
+const (
+	maxEventsBlockRange = 1000
+	defaultTxsPageSize  = 20
+	maxTxsPageSize      = 100
+)
+
 //LedgerInterface ledger interface
 type LedgerInterface interface {
 	Height() (uint32, error)
@@ -41,6 +50,11 @@ type LedgerInterface interface {
 	GetTxsByBlockNumber(blockNumber uint32, transactionType uint32) (types.Transactions, error)
 	GetTxsByMergeTxHash(mergeTxHash crypto.Hash) (types.Transactions, error)
 	GetTransactionHashList(number uint32) ([]crypto.Hash, error)
+	GetBlockHeightByTxHash(txHash crypto.Hash) (uint32, error)
+	GetReceipt(txHash crypto.Hash) (*types.Receipt, error)
+	GetEvents(contractAddr accounts.Address, name string, from, to uint32) ([]*types.Event, error)
+	GetTxsByAddress(addr accounts.Address, before *block_storage.TxPosition, limit uint32) (types.Transactions, *block_storage.TxPosition, error)
+	GetBalanceAt(addr accounts.Address, height uint32) (*big.Int, uint32, error)
 }
 
 //Ledger ledger rpc api
@@ -65,12 +79,49 @@ type GetTxsByBlockHashArgs struct {
 	TxType    uint32
 }
 
+//GetEventsArgs get contract events args, empty ContractAddr or Name matches all
+type GetEventsArgs struct {
+	ContractAddr string
+	Name         string
+	FromHeight   uint32
+	ToHeight     uint32
+}
+
+//GetBalanceAtArgs get balance at block height args
+type GetBalanceAtArgs struct {
+	Addr   string
+	Height uint32
+}
+
+//GetTxsByAddressArgs get txs by address args, Cursor is the Next of the previous page, nil for the first page,
+//Limit defaults to 20 and at most 100
+type GetTxsByAddressArgs struct {
+	Address string
+	Cursor  *block_storage.TxPosition
+	Limit   uint32
+}
+
+//TxsPage json rpc return a page of transactions, Next is the cursor of the next page, nil on the last page
+type TxsPage struct {
+	Txs  types.Transactions        `json:"txs"`
+	Next *block_storage.TxPosition `json:"next"`
+}
+
 //Block json rpc return block
 type Block struct {
 	BlockHeader types.BlockHeader `json:"header"`
 	TxHashList  []crypto.Hash      `json:"txHashList"`
 }
 
+//TxProof json rpc return merkle inclusion proof of transaction
+type TxProof struct {
+	BlockHeader types.BlockHeader `json:"header"`
+	TxHash      crypto.Hash       `json:"txHash"`
+	Index       uint32            `json:"index"`
+	Count       uint32            `json:"count"`
+	Siblings    []crypto.Hash     `json:"siblings"`
+}
+
 //Height get blockchain height
 func (l *Ledger) Height(ignore string, reply *uint32) error {
 	height, err := l.ledger.Height()
@@ -89,6 +140,16 @@ func (l *Ledger) GetBalance(addr string, reply *state.Balance) error {
 	return nil
 }
 
+//GetBalanceAt returns balance by account address at the end of the block height
+func (l *Ledger) GetBalanceAt(args GetBalanceAtArgs, reply *state.Balance) error {
+	amount, nonce, err := l.ledger.GetBalanceAt(accounts.HexToAddress(args.Addr), args.Height)
+	if err != nil {
+		return err
+	}
+	*reply = state.Balance{Amount: amount, Nonce: nonce}
+	return nil
+}
+
 //GetTxByHash returns transaction by tx hash []byte
 func (l *Ledger) GetTxByHash(txHashBytes string, reply *types.Transaction) error {
 	tx, err := l.ledger.GetTransaction(crypto.HexToHash(txHashBytes))
@@ -143,6 +204,93 @@ func (l *Ledger) GetBlockByNumber(number uint32, reply *Block) error {
 	return nil
 }
 
+//GetTxProof returns the block header and sibling hashes proving the transaction is included in the block
+func (l *Ledger) GetTxProof(txHashBytes string, reply *TxProof) error {
+	txHash := crypto.HexToHash(txHashBytes)
+	height, err := l.ledger.GetBlockHeightByTxHash(txHash)
+	if err != nil {
+		return err
+	}
+
+	blockHeader, err := l.ledger.GetBlockByNumber(height)
+	if err != nil {
+		return err
+	}
+
+	txHashList, err := l.ledger.GetTransactionHashList(height)
+	if err != nil {
+		return err
+	}
+
+	for i, h := range txHashList {
+		if h.Equal(txHash) {
+			*reply = TxProof{
+				BlockHeader: *blockHeader,
+				TxHash:      txHash,
+				Index:       uint32(i),
+				Count:       uint32(len(txHashList)),
+				Siblings:    crypto.ComputeMerkleProof(txHashList, i),
+			}
+			return nil
+		}
+	}
+	return errors.New("not found transaction in block")
+}
+
+//GetReceipt returns the execution result of the transaction
+func (l *Ledger) GetReceipt(txHashBytes string, reply *types.Receipt) error {
+	receipt, err := l.ledger.GetReceipt(crypto.HexToHash(txHashBytes))
+	if err != nil {
+		return err
+	}
+	*reply = *receipt
+	return nil
+}
+
+//GetEvents returns the contract events emitted in the block range, ToHeight 0 means the current height
+func (l *Ledger) GetEvents(args GetEventsArgs, reply *[]*types.Event) error {
+	height, err := l.ledger.Height()
+	if err != nil {
+		return err
+	}
+	if args.ToHeight == 0 || args.ToHeight > height {
+		args.ToHeight = height
+	}
+	if args.FromHeight > args.ToHeight {
+		return errors.New("illegal block range")
+	}
+	if args.ToHeight-args.FromHeight >= maxEventsBlockRange {
+		return fmt.Errorf("block range exceeds %d blocks", maxEventsBlockRange)
+	}
+
+	var contractAddr accounts.Address
+	if len(args.ContractAddr) > 0 {
+		contractAddr = accounts.HexToAddress(args.ContractAddr)
+	}
+	events, err := l.ledger.GetEvents(contractAddr, args.Name, args.FromHeight, args.ToHeight)
+	if err != nil {
+		return err
+	}
+	*reply = events
+	return nil
+}
+
+//GetTxsByAddress returns a page of transactions sent or received by the address, newest first
+func (l *Ledger) GetTxsByAddress(args GetTxsByAddressArgs, reply *TxsPage) error {
+	limit := args.Limit
+	if limit == 0 {
+		limit = defaultTxsPageSize
+	} else if limit > maxTxsPageSize {
+		limit = maxTxsPageSize
+	}
+	txs, next, err := l.ledger.GetTxsByAddress(accounts.HexToAddress(args.Address), args.Cursor, limit)
+	if err != nil {
+		return err
+	}
+	*reply = TxsPage{Txs: txs, Next: next}
+	return nil
+}
+
 //GetLastBlockHash returns the last Block hash
 func (l *Ledger) GetLastBlockHash(ignore string, reply *crypto.Hash) error {
 	blockHash, err := l.ledger.GetLastBlockHash()
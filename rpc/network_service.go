@@ -19,12 +19,18 @@
 package rpc
 
 import (
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/core/blockchain"
 	"github.com/bocheninc/L0/core/p2p"
+	"github.com/bocheninc/L0/core/params"
 )
 
 type INetWorkInfo interface {
 	GetPeers() []*p2p.Peer
 	GetLocalPeer() *p2p.Peer
+	SyncStatus() *blockchain.SyncStatus
+	BannedPeers() []*p2p.Ban
+	Unban(id string) error
 }
 
 type Net struct {
@@ -53,3 +59,43 @@ func (n *Net) GetLocalPeer(req string, reply *string) error {
 	*reply = localPeer.String()
 	return nil
 }
+
+//NetInfo identifies the network, the transaction signatures are bound to NetworkID and GenesisHash
+type NetInfo struct {
+	NetworkID       string      `json:"networkId"`
+	ChainID         string      `json:"chainId"`
+	GenesisHash     crypto.Hash `json:"genesisHash"`
+	ProtocolVersion string      `json:"protocolVersion"`
+}
+
+//GetInfo returns the identifiers of the network needed to sign its transactions
+func (n *Net) GetInfo(req string, reply *NetInfo) error {
+	*reply = NetInfo{
+		NetworkID:       params.NetworkID,
+		ChainID:         params.ChainID.String(),
+		GenesisHash:     crypto.NewHash(params.GenesisHash),
+		ProtocolVersion: params.ProtocolVersion,
+	}
+	return nil
+}
+
+//SyncStatus returns the progress of the block synchronization
+func (n *Net) SyncStatus(req string, reply *blockchain.SyncStatus) error {
+	*reply = *n.netServer.SyncStatus()
+	return nil
+}
+
+//GetBannedPeers returns the banned peers, until is zero if the ban is persistent
+func (n *Net) GetBannedPeers(req string, reply *[]*p2p.Ban) error {
+	*reply = n.netServer.BannedPeers()
+	return nil
+}
+
+//UnbanPeer removes the ban of the peer id in hex, or of the peer ip if CA is disabled
+func (n *Net) UnbanPeer(id string, reply *bool) error {
+	if err := n.netServer.Unban(id); err != nil {
+		return err
+	}
+	*reply = true
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/core/accounts"
+	"github.com/bocheninc/L0/core/coordinate"
+	"github.com/bocheninc/L0/core/params"
+	"github.com/bocheninc/L0/core/types"
+)
+
+func TestGetInfo(t *testing.T) {
+	defer func(genesis []byte) { params.GenesisHash = genesis }(params.GenesisHash)
+	params.GenesisHash = crypto.Sha256([]byte("genesis")).Bytes()
+
+	var info NetInfo
+	if err := NewNet(nil).GetInfo("", &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.NetworkID != params.NetworkID || info.ChainID != params.ChainID.String() || info.ProtocolVersion != params.ProtocolVersion {
+		t.Errorf("net info %v", info)
+	}
+
+	// a wallet signs the transaction without signature followed by the network id and the genesis hash
+	tx := types.NewTransaction(coordinate.NewChainCoordinate(params.ChainID), coordinate.NewChainCoordinate(params.ChainID),
+		types.TypeAtomic, 1, accounts.Address{}, accounts.Address{}, big.NewInt(1), big.NewInt(1), 1)
+	data := append(append(tx.Serialize(), info.NetworkID...), info.GenesisHash.Bytes()...)
+	if h := crypto.DoubleSha256(data); !h.Equal(tx.SignHash()) {
+		t.Errorf("sign hash %s, expected %s", h, tx.SignHash())
+	}
+}
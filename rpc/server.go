@@ -35,6 +35,7 @@ type pmHandler interface {
 	IBroadcast
 	LedgerInterface
 	AccountInterface
+	SubscriptionInterface
 }
 
 type HttpConn struct {
@@ -53,7 +54,7 @@ func (c *HttpConn) Read(p []byte) (n int, err error)  { return c.in.Read(p) }
 func (c *HttpConn) Write(d []byte) (n int, err error) { return c.out.Write(d) }
 func (c *HttpConn) Close() error                      { return nil }
 
-func NewServer(pmHandler pmHandler) *rpc.Server {
+func NewServer(pmHandler pmHandler, option *Option) *rpc.Server {
 
 	server := rpc.NewServer()
 
@@ -61,10 +62,30 @@ func NewServer(pmHandler pmHandler) *rpc.Server {
 	server.Register(NewTransaction(pmHandler))
 	server.Register(NewNet(pmHandler))
 	server.Register(NewLedger(pmHandler))
+	server.Register(NewSubscription(pmHandler, option))
 
 	return server
 }
 
+// clientCodec tags the subscribe requests with the client serving them
+type clientCodec struct {
+	rpc.ServerCodec
+	client string
+}
+
+// NewClientCodec returns the codec which counts the subscriptions of the requests against client
+func NewClientCodec(codec rpc.ServerCodec, client string) rpc.ServerCodec {
+	return &clientCodec{ServerCodec: codec, client: client}
+}
+
+func (c *clientCodec) ReadRequestBody(x interface{}) error {
+	err := c.ServerCodec.ReadRequestBody(x)
+	if args, ok := x.(*SubscribeArgs); ok {
+		args.client = c.client
+	}
+	return err
+}
+
 // StartServer with Test instance as a service
 func StartServer(server *rpc.Server, option *Option) {
 	if option.Enabled == false {
@@ -79,7 +100,8 @@ func StartServer(server *rpc.Server, option *Option) {
 
 	http.Serve(listener, http.HandlerFunc(BasicAuth(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/" {
-			serverCodec := jsonrpc.NewServerCodec(&HttpConn{in: r.Body, out: w})
+			host, _, _ := net.SplitHostPort(r.RemoteAddr)
+			serverCodec := NewClientCodec(jsonrpc.NewServerCodec(&HttpConn{in: r.Body, out: w}), host)
 			w.Header().Set("Content-type", "application/json")
 			w.WriteHeader(http.StatusOK)
 			err := server.ServeRequest(serverCodec)
@@ -0,0 +1,382 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/core/accounts"
+	"github.com/bocheninc/L0/core/blockchain"
+	"github.com/bocheninc/L0/core/types"
+)
+
+// subscription types
+const (
+	SubscribeNewBlocks      = "newBlocks"
+	SubscribePendingTxs     = "pendingTxs"
+	SubscribeTxConfirmation = "txConfirmation"
+	SubscribeEvents         = "events"
+	SubscribeForks          = "forks"
+)
+
+const (
+	subscriptionBufferSize  = 100
+	subscriptionQueueSize   = 1000
+	subscriptionIdleTimeout = 5 * time.Minute
+	maxPollTimeout          = 60
+)
+
+//SubscriptionInterface subscription interface
+type SubscriptionInterface interface {
+	Subscribe(size int) *blockchain.Subscription
+}
+
+type subscriptionHandler interface {
+	SubscriptionInterface
+	GetReceipt(txHash crypto.Hash) (*types.Receipt, error)
+	GetBlockHashByNumber(blockNum uint32) (crypto.Hash, error)
+}
+
+//SubscribeArgs subscribe args, TxHash is required by txConfirmation, ContractAddr and Name filter events
+type SubscribeArgs struct {
+	Type         string
+	TxHash       string
+	ContractAddr string
+	Name         string
+	// client set by the codec, the subscriptions are limited per client
+	client string
+}
+
+//PollArgs poll args, Timeout is the seconds waiting for notifications
+type PollArgs struct {
+	ID      string
+	Timeout uint32
+}
+
+//TxConfirmation json rpc return confirmation of transaction
+type TxConfirmation struct {
+	TxHash      crypto.Hash    `json:"txHash"`
+	BlockHash   crypto.Hash    `json:"blockHash"`
+	BlockHeight uint32         `json:"blockHeight"`
+	Receipt     *types.Receipt `json:"receipt"`
+}
+
+//Subscription long-poll subscription rpc api
+type Subscription struct {
+	handler     subscriptionHandler
+	option      *Option
+	mu          sync.Mutex
+	subscribers map[string]*subscriber
+	clients     map[string]int
+	total       int
+	quit        chan struct{}
+}
+
+//NewSubscription initialization, the subscriptions are limited by MaxSubscriptions and MaxClientSubscriptions of option
+func NewSubscription(handler subscriptionHandler, option *Option) *Subscription {
+	s := &Subscription{
+		handler:     handler,
+		option:      option,
+		subscribers: make(map[string]*subscriber),
+		clients:     make(map[string]int),
+		quit:        make(chan struct{}),
+	}
+	go s.expireLoop()
+	return s
+}
+
+//Stop stops expiring and removes all the subscriptions, no subscription is accepted after stopped
+func (s *Subscription) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.quit:
+		return
+	default:
+	}
+	close(s.quit)
+	for id, sub := range s.subscribers {
+		s.remove(id, sub)
+	}
+}
+
+//Subscribe creates a subscription and returns its id
+func (s *Subscription) Subscribe(args SubscribeArgs, reply *string) error {
+	sub := &subscriber{
+		handler:  s.handler,
+		client:   args.client,
+		typ:      args.Type,
+		notify:   make(chan struct{}, 1),
+		lastPoll: time.Now(),
+	}
+	switch args.Type {
+	case SubscribeNewBlocks, SubscribePendingTxs, SubscribeForks:
+	case SubscribeTxConfirmation:
+		if len(args.TxHash) == 0 {
+			return errors.New("tx hash is required")
+		}
+		sub.txHash = crypto.HexToHash(args.TxHash)
+	case SubscribeEvents:
+		if len(args.ContractAddr) > 0 {
+			sub.contractAddr = accounts.HexToAddress(args.ContractAddr)
+		}
+		sub.name = args.Name
+	default:
+		return errors.New("unknown subscription type " + args.Type)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	if err := s.reserve(sub.client); err != nil {
+		return err
+	}
+	sub.sub = s.handler.Subscribe(subscriptionBufferSize)
+	go sub.loop()
+	if sub.typ == SubscribeTxConfirmation {
+		// the transaction may be confirmed already
+		if receipt, err := s.handler.GetReceipt(sub.txHash); err == nil {
+			blockHash, _ := s.handler.GetBlockHashByNumber(receipt.BlockHeight)
+			sub.push(&TxConfirmation{TxHash: sub.txHash, BlockHash: blockHash, BlockHeight: receipt.BlockHeight, Receipt: receipt})
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.quit:
+		s.release(sub.client)
+		sub.sub.Unsubscribe()
+		return errors.New("subscription service stopped")
+	default:
+	}
+	s.subscribers[hex.EncodeToString(id)] = sub
+	*reply = hex.EncodeToString(id)
+	return nil
+}
+
+//Poll returns the pending notifications of the subscription, waits at most Timeout seconds if there is none
+func (s *Subscription) Poll(args PollArgs, reply *[]interface{}) error {
+	s.mu.Lock()
+	sub, ok := s.subscribers[args.ID]
+	s.mu.Unlock()
+	if !ok {
+		return errors.New("subscription not found")
+	}
+
+	timeout := args.Timeout
+	if timeout > maxPollTimeout {
+		timeout = maxPollTimeout
+	}
+	*reply = sub.poll(time.Duration(timeout) * time.Second)
+	return nil
+}
+
+//Unsubscribe removes the subscription
+func (s *Subscription) Unsubscribe(id string, reply *bool) error {
+	s.mu.Lock()
+	sub, ok := s.subscribers[id]
+	if ok {
+		s.remove(id, sub)
+	}
+	s.mu.Unlock()
+	*reply = ok
+	return nil
+}
+
+//reserve counts a new subscription of the client, returns error if the limits are reached
+func (s *Subscription) reserve(client string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.quit:
+		return errors.New("subscription service stopped")
+	default:
+	}
+	if s.option.MaxSubscriptions > 0 && s.total >= s.option.MaxSubscriptions {
+		return fmt.Errorf("too many subscriptions, limit %d", s.option.MaxSubscriptions)
+	}
+	if s.option.MaxClientSubscriptions > 0 && s.clients[client] >= s.option.MaxClientSubscriptions {
+		return fmt.Errorf("too many subscriptions of client, limit %d", s.option.MaxClientSubscriptions)
+	}
+	s.clients[client]++
+	s.total++
+	return nil
+}
+
+//release uncounts a subscription of the client, the caller holds mu
+func (s *Subscription) release(client string) {
+	s.total--
+	if s.clients[client]--; s.clients[client] <= 0 {
+		delete(s.clients, client)
+	}
+}
+
+//remove removes the subscription, the caller holds mu
+func (s *Subscription) remove(id string, sub *subscriber) {
+	delete(s.subscribers, id)
+	s.release(sub.client)
+	sub.sub.Unsubscribe()
+}
+
+func (s *Subscription) expireLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.expire()
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func (s *Subscription) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, sub := range s.subscribers {
+		if sub.idle() > subscriptionIdleTimeout {
+			s.remove(id, sub)
+		}
+	}
+}
+
+type subscriber struct {
+	handler      subscriptionHandler
+	client       string
+	sub          *blockchain.Subscription
+	typ          string
+	txHash       crypto.Hash
+	contractAddr accounts.Address
+	name         string
+
+	mu       sync.Mutex
+	queue    []interface{}
+	notify   chan struct{}
+	lastPoll time.Time
+}
+
+func (sub *subscriber) loop() {
+	for {
+		select {
+		case blk, ok := <-sub.sub.Blocks:
+			if !ok {
+				return
+			}
+			sub.processBlock(blk)
+		case tx, ok := <-sub.sub.Txs:
+			if !ok {
+				return
+			}
+			if sub.typ == SubscribePendingTxs {
+				sub.push(tx)
+			}
+		case event, ok := <-sub.sub.Forks:
+			if !ok {
+				return
+			}
+			if sub.typ == SubscribeForks {
+				sub.push(event)
+			}
+		}
+	}
+}
+
+func (sub *subscriber) processBlock(blk *types.Block) {
+	switch sub.typ {
+	case SubscribeNewBlocks:
+		sub.push(blk.Header)
+	case SubscribeTxConfirmation:
+		for _, tx := range blk.Transactions {
+			if tx.Hash().Equal(sub.txHash) {
+				receipt, _ := sub.handler.GetReceipt(sub.txHash)
+				sub.push(&TxConfirmation{TxHash: sub.txHash, BlockHash: blk.Hash(), BlockHeight: blk.Height(), Receipt: receipt})
+				return
+			}
+		}
+	case SubscribeEvents:
+		for _, tx := range blk.Transactions {
+			receipt, err := sub.handler.GetReceipt(tx.Hash())
+			if err != nil {
+				continue
+			}
+			for _, event := range receipt.Events {
+				if !sub.contractAddr.Equal(accounts.Address{}) && !sub.contractAddr.Equal(event.ContractAddr) {
+					continue
+				}
+				if sub.name != "" && sub.name != event.Name {
+					continue
+				}
+				sub.push(event)
+			}
+		}
+	}
+}
+
+func (sub *subscriber) push(notification interface{}) {
+	sub.mu.Lock()
+	if len(sub.queue) >= subscriptionQueueSize {
+		sub.queue = sub.queue[1:]
+	}
+	sub.queue = append(sub.queue, notification)
+	sub.mu.Unlock()
+
+	select {
+	case sub.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (sub *subscriber) poll(timeout time.Duration) []interface{} {
+	deadline := time.After(timeout)
+	for {
+		sub.mu.Lock()
+		sub.lastPoll = time.Now()
+		if len(sub.queue) > 0 || timeout == 0 {
+			notifications := sub.queue
+			sub.queue = nil
+			sub.mu.Unlock()
+			if notifications == nil {
+				notifications = make([]interface{}, 0)
+			}
+			return notifications
+		}
+		sub.mu.Unlock()
+
+		select {
+		case <-sub.notify:
+		case <-deadline:
+			timeout = 0
+		}
+	}
+}
+
+func (sub *subscriber) idle() time.Duration {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return time.Since(sub.lastPoll)
+}
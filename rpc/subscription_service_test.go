@@ -0,0 +1,203 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of L0
+//
+// The L0 is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The L0 is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/bocheninc/L0/components/crypto"
+	"github.com/bocheninc/L0/core/accounts"
+	"github.com/bocheninc/L0/core/blockchain"
+	"github.com/bocheninc/L0/core/types"
+)
+
+type testSubscriptionHandler struct {
+	subs     []*blockchain.Subscription
+	receipts map[crypto.Hash]*types.Receipt
+}
+
+func (h *testSubscriptionHandler) Subscribe(size int) *blockchain.Subscription {
+	sub := blockchain.NewSubscription(size)
+	h.subs = append(h.subs, sub)
+	return sub
+}
+
+func (h *testSubscriptionHandler) GetReceipt(txHash crypto.Hash) (*types.Receipt, error) {
+	if receipt, ok := h.receipts[txHash]; ok {
+		return receipt, nil
+	}
+	return nil, errors.New("receipt not found")
+}
+
+func (h *testSubscriptionHandler) GetBlockHashByNumber(blockNum uint32) (crypto.Hash, error) {
+	return crypto.Hash{}, nil
+}
+
+func TestSubscription(t *testing.T) {
+	tx := types.NewTransaction(nil, nil, types.TypeContractInvoke, 1, accounts.Address{}, accounts.Address{}, big.NewInt(1), big.NewInt(1), 0)
+	contractAddr := accounts.HexToAddress("0x01")
+	receipt := &types.Receipt{TxHash: tx.Hash(), BlockHeight: 1, Events: []*types.Event{
+		{ContractAddr: contractAddr, TxHash: tx.Hash(), BlockHeight: 1, Name: "a"},
+		{ContractAddr: contractAddr, TxHash: tx.Hash(), BlockHeight: 1, Name: "b"},
+	}}
+	handler := &testSubscriptionHandler{receipts: map[crypto.Hash]*types.Receipt{tx.Hash(): receipt}}
+	s := NewSubscription(handler, NewDefaultOption())
+	defer s.Stop()
+
+	var blocksID, eventsID string
+	if err := s.Subscribe(SubscribeArgs{Type: SubscribeNewBlocks}, &blocksID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Subscribe(SubscribeArgs{Type: SubscribeEvents, ContractAddr: "0x01", Name: "b"}, &eventsID); err != nil {
+		t.Fatal(err)
+	}
+	var id string
+	if err := s.Subscribe(SubscribeArgs{Type: SubscribeTxConfirmation}, &id); err == nil {
+		t.Error("subscribe tx confirmation without tx hash")
+	}
+	if err := s.Subscribe(SubscribeArgs{Type: "unknown"}, &id); err == nil {
+		t.Error("subscribe unknown type")
+	}
+
+	// the tx is confirmed already
+	var confirmationID string
+	if err := s.Subscribe(SubscribeArgs{Type: SubscribeTxConfirmation, TxHash: tx.Hash().String()}, &confirmationID); err != nil {
+		t.Fatal(err)
+	}
+	var notifications []interface{}
+	if err := s.Poll(PollArgs{ID: confirmationID}, &notifications); err != nil || len(notifications) != 1 {
+		t.Fatalf("poll confirmation %v %v", notifications, err)
+	}
+	if confirmation := notifications[0].(*TxConfirmation); confirmation.BlockHeight != 1 {
+		t.Errorf("confirmation height %d", confirmation.BlockHeight)
+	}
+
+	// nothing pending, poll returns after the timeout
+	start := time.Now()
+	if err := s.Poll(PollArgs{ID: blocksID, Timeout: 1}, &notifications); err != nil || len(notifications) != 0 {
+		t.Fatalf("poll empty %v %v", notifications, err)
+	}
+	if time.Since(start) < time.Second {
+		t.Error("poll returned before the timeout")
+	}
+
+	blk := types.NewBlock(crypto.Hash{}, 0, 1, 0, crypto.Hash{}, types.Transactions{tx})
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		time.Sleep(100 * time.Millisecond)
+		for _, sub := range handler.subs {
+			sub.Blocks <- blk
+		}
+	}()
+	if err := s.Poll(PollArgs{ID: blocksID, Timeout: 5}, &notifications); err != nil || len(notifications) != 1 {
+		t.Fatalf("poll block %v %v", notifications, err)
+	}
+	if header := notifications[0].(*types.BlockHeader); header.Height != 1 {
+		t.Errorf("block height %d", header.Height)
+	}
+	if err := s.Poll(PollArgs{ID: eventsID, Timeout: 5}, &notifications); err != nil || len(notifications) != 1 {
+		t.Fatalf("poll events %v %v", notifications, err)
+	}
+	if event := notifications[0].(*types.Event); event.Name != "b" {
+		t.Errorf("event %s not filtered", event.Name)
+	}
+	<-sent
+
+	var ok bool
+	if err := s.Unsubscribe(blocksID, &ok); err != nil || !ok {
+		t.Errorf("unsubscribe %v %v", ok, err)
+	}
+	if err := s.Unsubscribe(blocksID, &ok); err != nil || ok {
+		t.Errorf("unsubscribe twice %v %v", ok, err)
+	}
+	if err := s.Poll(PollArgs{ID: blocksID}, &notifications); err == nil {
+		t.Error("poll removed subscription")
+	}
+	if _, open := <-handler.subs[0].Blocks; open {
+		t.Error("subscription not closed after unsubscribed")
+	}
+}
+
+func TestSubscriptionExpire(t *testing.T) {
+	handler := &testSubscriptionHandler{}
+	s := NewSubscription(handler, NewDefaultOption())
+
+	var idle, active string
+	s.Subscribe(SubscribeArgs{Type: SubscribeNewBlocks}, &idle)
+	s.Subscribe(SubscribeArgs{Type: SubscribeNewBlocks}, &active)
+	s.subscribers[idle].lastPoll = time.Now().Add(-subscriptionIdleTimeout - time.Second)
+	s.expire()
+
+	var notifications []interface{}
+	if err := s.Poll(PollArgs{ID: idle}, &notifications); err == nil {
+		t.Error("poll expired subscription")
+	}
+	if err := s.Poll(PollArgs{ID: active}, &notifications); err != nil {
+		t.Error(err)
+	}
+
+	s.Stop()
+	s.Stop()
+	if len(s.subscribers) != 0 {
+		t.Errorf("%d subscriptions left after stopped", len(s.subscribers))
+	}
+	for _, sub := range handler.subs {
+		if _, open := <-sub.Blocks; open {
+			t.Error("subscription not closed after stopped")
+		}
+	}
+	if err := s.Subscribe(SubscribeArgs{Type: SubscribeNewBlocks}, &active); err == nil {
+		t.Error("subscribe after stopped")
+	}
+}
+
+func TestSubscriptionLimit(t *testing.T) {
+	option := NewDefaultOption()
+	option.MaxSubscriptions = 3
+	option.MaxClientSubscriptions = 2
+	s := NewSubscription(&testSubscriptionHandler{}, option)
+	defer s.Stop()
+
+	var a1, a2, id string
+	if err := s.Subscribe(SubscribeArgs{Type: SubscribeNewBlocks, client: "a"}, &a1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Subscribe(SubscribeArgs{Type: SubscribeNewBlocks, client: "a"}, &a2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Subscribe(SubscribeArgs{Type: SubscribeNewBlocks, client: "a"}, &id); err == nil {
+		t.Error("subscribe over the client limit")
+	}
+	if err := s.Subscribe(SubscribeArgs{Type: SubscribeNewBlocks, client: "b"}, &id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Subscribe(SubscribeArgs{Type: SubscribeNewBlocks, client: "c"}, &id); err == nil {
+		t.Error("subscribe over the node limit")
+	}
+
+	var ok bool
+	s.Unsubscribe(a1, &ok)
+	if err := s.Subscribe(SubscribeArgs{Type: SubscribeNewBlocks, client: "a"}, &id); err != nil {
+		t.Errorf("subscribe after unsubscribed, %v", err)
+	}
+}
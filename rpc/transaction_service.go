@@ -41,14 +41,15 @@ type Transaction struct {
 }
 
 type TransactionCreateArgs struct {
-	FromChain string
-	ToChain   string
-	Recipient string
-	Nonce     uint32
-	Amount    int64
-	Fee       int64
-	TxType    uint32
-	PayLoad   interface{}
+	FromChain  string
+	ToChain    string
+	Recipient  string
+	Nonce      uint32
+	Amount     int64
+	Fee        int64
+	TxType     uint32
+	ValidUntil uint32
+	PayLoad    interface{}
 }
 
 type PayLoad struct {
@@ -75,6 +76,7 @@ func (t *Transaction) Create(args *TransactionCreateArgs, reply *string) error {
 	amount := big.NewInt(args.Amount)
 	fee := big.NewInt(args.Fee)
 	tx := types.NewTransaction(fromChain, toChain, args.TxType, nonce, sender, recipient, amount, fee, utils.CurrentTimestamp())
+	tx.WithValidUntil(args.ValidUntil)
 
 	switch tx.GetType() {
 	case types.TypeJSContractInit:
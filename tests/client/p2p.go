@@ -20,7 +20,7 @@ package main
 
 import (
 	"bytes"
-	"crypto/sha256"
+	"crypto/rand"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -35,6 +35,7 @@ import (
 var (
 	conn                                                    []net.Conn
 	privateKeyBytes, certificateBytes, rootCertificatebytes []byte
+	remoteHandshakes                                        = make(map[net.Conn]*p2p.ProtoHandshake)
 )
 
 const (
@@ -107,32 +108,32 @@ func processMsg(m *Msg, c net.Conn) {
 	case pingMsg:
 		respMsg = NewMsg(pongMsg, nil)
 	case handshakeMsg:
+		remote := &p2p.ProtoHandshake{}
+		utils.Deserialize(m.Payload, remote)
+		remoteHandshakes[c] = remote
+
+		nonce := make([]byte, 32)
+		rand.Read(nonce)
 		proto := &p2p.ProtoHandshake{
 			Name:       "l0-base-protocol",
-			Version:    "0.0.1",
+			Version:    "0.0.2",
 			ID:         []byte(nodeID),
 			SrvAddress: "",
+			Nonce:      nonce,
 		}
 		respMsg = NewMsg(handshakeMsg, utils.Serialize(*proto))
 		fmt.Println("handshakeMsg")
 	case handshakeAckMsg:
-
-		privateKey, err := crypto.ParseKey(privateKeyBytes)
-		if err != nil {
-			fmt.Printf("parse key error: %s", err)
+		remote, ok := remoteHandshakes[c]
+		if !ok {
+			fmt.Println("handshakeAckMsg before handshakeMsg")
+			return
 		}
 
-		// TODO　Generate random string
-		sign, err := crypto.SignRsa(privateKey, []byte("random string"))
+		encHandshake, err := p2p.NewEncHandshake([]byte(nodeID), remote.ID, remote.Nonce, certificateBytes, privateKeyBytes)
 		if err != nil {
-			fmt.Printf("sign rsa error: %s", err)
-		}
-
-		encHandshake := &p2p.EncHandshake{
-			Signature: sign,
-			Hashed:    sha256.Sum256([]byte("random string")),
-			ID:        []byte(nodeID),
-			Cert:      certificateBytes,
+			fmt.Printf("enc handshake error: %s", err)
+			return
 		}
 
 		respMsg = NewMsg(handshakeAckMsg, utils.Serialize(*encHandshake))
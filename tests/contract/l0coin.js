@@ -58,6 +58,7 @@ function send(receiver, amount) {
     balances[receiver] = recvBalances + amount;
 
     L0.PutState("balances", balances);
+    L0.Emit("Sent", {from: sender, to: receiver, amount: amount});
     return true;
 }
 
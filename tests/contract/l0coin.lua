@@ -62,6 +62,7 @@ function send(receiver, amount)
     balances[receiver] = balances[receiver] + amount
 
     L0.PutState("balances", balances)
+    L0.Emit("Sent", {from=sender, to=receiver, amount=amount})
 end
 
 function transfer(receiver, amount)
@@ -87,3 +87,31 @@ func (tq *transferQueue) poll() *transferOpfunc {
 	}
 	return nil
 }
+
+type eventOpfunc struct {
+	name string
+	data []byte
+}
+
+type eventQueue struct {
+	lst  *list.List
+	size int
+}
+
+func NewEventQueue() *eventQueue {
+	return &eventQueue{lst: list.New()}
+}
+
+func (eq *eventQueue) offer(opfunc *eventOpfunc) {
+	eq.size += len(opfunc.name) + len(opfunc.data)
+	eq.lst.PushFront(opfunc)
+}
+
+func (eq *eventQueue) poll() *eventOpfunc {
+	e := eq.lst.Back()
+	if e != nil {
+		eq.lst.Remove(e)
+		return e.Value.(*eventOpfunc)
+	}
+	return nil
+}
@@ -65,6 +65,30 @@ func CheckStateKeyValue(key string, value []byte) error {
 	return nil
 }
 
+func CheckEvent(name string, data []byte) error {
+	if len(name) == 0 || len(name) > VMConf.ExecLimitMaxStateKeyLength {
+		return errors.New("event name length illegal, max length is:" + strconv.Itoa(VMConf.ExecLimitMaxStateKeyLength))
+	}
+
+	if len(data) > VMConf.ExecLimitMaxStateValueSize {
+		return errors.New("event data too long max size is:" + strconv.Itoa(VMConf.ExecLimitMaxStateValueSize))
+	}
+
+	return nil
+}
+
+func CheckEventQueue(eq *eventQueue, name string, data []byte) error {
+	if eq.lst.Len() >= VMConf.ExecLimitMaxEventCount {
+		return errors.New("too many events max count is:" + strconv.Itoa(VMConf.ExecLimitMaxEventCount))
+	}
+
+	if eq.size+len(name)+len(data) > VMConf.ExecLimitMaxEventSize {
+		return errors.New("events too long max size is:" + strconv.Itoa(VMConf.ExecLimitMaxEventSize))
+	}
+
+	return nil
+}
+
 func CheckAddr(addr string) error {
 	if addr[0:2] == "0x" {
 		addr = addr[2:]
@@ -36,6 +36,8 @@ type Config struct {
 	ExecLimitMaxStateValueSize int // the max state value size (byte)
 	ExecLimitMaxStateItemCount int // the max state count in one contract
 	ExecLimitMaxStateKeyLength int // max state key length
+	ExecLimitMaxEventCount     int // the max event count in one transaction
+	ExecLimitMaxEventSize      int // the max total event data size in one transaction (byte)
 	LuaVMExeFilePath           string
 	JSVMExeFilePath            string
 }
@@ -53,6 +55,8 @@ func DefaultConfig() *Config {
 		ExecLimitMaxStateValueSize: 5120,  //5K
 		ExecLimitMaxStateItemCount: 1000,
 		ExecLimitMaxStateKeyLength: 256,
+		ExecLimitMaxEventCount:     64,
+		ExecLimitMaxEventSize:      10240, //10K
 		LuaVMExeFilePath:           "bin/luavm",
 		JSVMExeFilePath:            "bin/jsvm",
 	}
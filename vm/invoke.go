@@ -189,6 +189,19 @@ func (p *VMProc) CCallTransfer(recipientAddr string, amount int64, txType uint32
 	return nil
 }
 
+func (p *VMProc) CCallEmit(name string, data []byte) error {
+	if err := CheckEvent(name, data); err != nil {
+		return err
+	}
+
+	if err := CheckEventQueue(p.EventQueue, name, data); err != nil {
+		return err
+	}
+
+	p.EventQueue.offer(&eventOpfunc{name, data})
+	return nil
+}
+
 func (p *VMProc) CCallSmartContractFailed() error {
 	return p.ccall("SmartContractFailed", nil)
 }
@@ -230,6 +243,17 @@ func (p *VMProc) CCallCommit() error {
 		}
 	}
 
+	for {
+		eventOP := p.EventQueue.poll()
+		if eventOP == nil {
+			break
+		}
+
+		if err := p.ccall("AddEvent", nil, eventOP.name, eventOP.data); err != nil {
+			return err
+		}
+	}
+
 	return p.CCallSmartContractCommitted()
 }
 
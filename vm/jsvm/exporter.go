@@ -20,6 +20,7 @@ package jsvm
 
 import (
 	"bytes"
+	"encoding/json"
 
 	"github.com/bocheninc/L0/components/log"
 	"github.com/robertkrimen/otto"
@@ -42,6 +43,7 @@ func exporter(ottoVM *otto.Otto) (*otto.Object, error) {
 	exporterFuncs.Set("GetState", getStateFunc)
 	exporterFuncs.Set("PutState", putStateFunc)
 	exporterFuncs.Set("DelState", delStateFunc)
+	exporterFuncs.Set("Emit", emitFunc)
 
 	return exporterFuncs, nil
 }
@@ -185,3 +187,38 @@ func delStateFunc(fc otto.FunctionCall) otto.Value {
 	val, _ := otto.ToValue(true)
 	return val
 }
+
+func emitFunc(fc otto.FunctionCall) otto.Value {
+	if len(fc.ArgumentList) < 1 || len(fc.ArgumentList) > 2 {
+		log.Error("param illegality when invoke Emit")
+		return fc.Otto.MakeCustomError("emitFunc", "param illegality when invoke Emit")
+	}
+
+	name, err := fc.Argument(0).ToString()
+	if err != nil {
+		log.Error("get string name error", err)
+		return fc.Otto.MakeCustomError("emitFunc", "get string name error"+err.Error())
+	}
+
+	var value interface{}
+	if arg := fc.Argument(1); arg.IsDefined() {
+		if value, err = jsvalueToInterface(arg); err != nil {
+			log.Errorf("export event data error name:%s  err:%s", name, err)
+			return fc.Otto.MakeCustomError("emitFunc", "export event data error:"+err.Error())
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Errorf("marshal event data error name:%s  err:%s", name, err)
+		return fc.Otto.MakeCustomError("emitFunc", "marshal event data error:"+err.Error())
+	}
+
+	err = vmproc.CCallEmit(name, data)
+	if err != nil {
+		log.Errorf("emit error name:%s  err:%s", name, err)
+		return fc.Otto.MakeCustomError("emitFunc", "emit error:"+err.Error())
+	}
+
+	val, _ := otto.ToValue(true)
+	return val
+}
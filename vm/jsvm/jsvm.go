@@ -104,6 +104,7 @@ func resetProc(cd *vm.ContractData) {
 	vmproc.ContractData = cd
 	vmproc.StateChangeQueue = vm.NewStateQueue()
 	vmproc.TransferQueue = vm.NewTransferQueue()
+	vmproc.EventQueue = vm.NewEventQueue()
 }
 
 // execContract start a js vm and execute smart contract script
@@ -21,8 +21,10 @@ package jsvm
 import (
 	"bytes"
 	"errors"
+	"strconv"
 
 	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/vm"
 	"github.com/robertkrimen/otto"
 )
 
@@ -162,3 +164,72 @@ func byteToJSvalue(buf *bytes.Buffer, ottoVM *otto.Otto) (otto.Value, error) {
 
 	return otto.NullValue(), nil
 }
+
+// maxInterfaceDepth the max nesting depth of objects converted to go value
+const maxInterfaceDepth = 32
+
+// jsvalueToInterface convert js value to go value which can be encoded as json,
+// cyclic or too deep objects and more values than the max event size are rejected
+func jsvalueToInterface(value otto.Value) (interface{}, error) {
+	count := 0
+	return toInterface(value, 0, &count)
+}
+
+func toInterface(value otto.Value, depth int, count *int) (interface{}, error) {
+	if *count++; *count > vm.VMConf.ExecLimitMaxEventSize {
+		return nil, errors.New("too many values")
+	}
+
+	if value.IsBoolean() {
+		return value.ToBoolean()
+	} else if value.IsNumber() {
+		return value.ToFloat()
+	} else if value.IsString() {
+		return value.ToString()
+	} else if value.IsObject() && value.Class() != "Function" {
+		if depth >= maxInterfaceDepth {
+			return nil, errors.New("object nested too deep or cyclic")
+		}
+
+		obj := value.Object()
+		if value.Class() == "Array" {
+			length, err := obj.Get("length")
+			if err != nil {
+				return nil, err
+			}
+			n, err := length.ToInteger()
+			if err != nil {
+				return nil, err
+			}
+			arr := make([]interface{}, 0)
+			for i := int64(0); i < n; i++ {
+				item, err := obj.Get(strconv.FormatInt(i, 10))
+				if err != nil {
+					return nil, err
+				}
+				v, err := toInterface(item, depth+1, count)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, v)
+			}
+			return arr, nil
+		}
+
+		mp := make(map[string]interface{})
+		for _, k := range obj.Keys() {
+			item, err := obj.Get(k)
+			if err != nil {
+				return nil, err
+			}
+			v, err := toInterface(item, depth+1, count)
+			if err != nil {
+				return nil, err
+			}
+			mp[k] = v
+		}
+		return mp, nil
+	}
+
+	return nil, nil
+}
@@ -20,8 +20,10 @@ package jsvm
 
 import (
 	"bytes"
+	"encoding/json"
 	"testing"
 
+	"github.com/bocheninc/L0/vm"
 	"github.com/robertkrimen/otto"
 )
 
@@ -68,3 +70,29 @@ func TestObject(t *testing.T) {
 		t.Error("age not equal")
 	}
 }
+
+func TestJSValueToInterface(t *testing.T) {
+	vm.VMConf = vm.DefaultConfig()
+	ottoVM := otto.New()
+
+	v, _ := ottoVM.Run(`({arr: [1, "two"], ok: true})`)
+	value, err := jsvalueToInterface(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(value)
+	if err != nil || string(data) != `{"arr":[1,"two"],"ok":true}` {
+		t.Errorf("convert object to json error %s %v", data, err)
+	}
+
+	v, _ = ottoVM.Run(`var a = {}; a.self = a; a`)
+	if _, err := jsvalueToInterface(v); err == nil {
+		t.Error("convert cyclic object")
+	}
+
+	// shared objects are converted for every reference
+	v, _ = ottoVM.Run(`var w = {}; for (var i = 0; i < 20; i++) { w = {a: w, b: w} }; w`)
+	if _, err := jsvalueToInterface(v); err == nil {
+		t.Error("convert too many values")
+	}
+}
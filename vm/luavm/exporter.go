@@ -22,6 +22,7 @@ package luavm
 
 import (
 	"bytes"
+	"encoding/json"
 
 	"github.com/yuin/gopher-lua"
 )
@@ -34,6 +35,7 @@ func exporter() map[string]lua.LGFunction {
 		"GetState":           getStateFunc,
 		"PutState":           putStateFunc,
 		"DelState":           delStateFunc,
+		"Emit":               emitFunc,
 	}
 }
 
@@ -154,3 +156,32 @@ func delStateFunc(l *lua.LState) int {
 
 	return 1
 }
+
+func emitFunc(l *lua.LState) int {
+	if l.GetTop() < 1 || l.GetTop() > 2 {
+		l.RaiseError("param illegality when invoke Emit")
+		return 1
+	}
+
+	name := l.CheckString(1)
+	value, err := lvalueToInterface(l.Get(2))
+	if err != nil {
+		l.RaiseError("emit error name:%s  err:%s", name, err)
+		return 1
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		l.RaiseError("emit error name:%s  err:%s", name, err)
+		return 1
+	}
+
+	err = vmproc.CCallEmit(name, data)
+	if err != nil {
+		l.RaiseError("emit error name:%s  err:%s", name, err)
+	} else {
+		l.Push(lua.LBool(true))
+	}
+
+	return 1
+}
@@ -114,6 +114,7 @@ func resetProc(cd *vm.ContractData) {
 	vmproc.ContractData = cd
 	vmproc.StateChangeQueue = vm.NewStateQueue()
 	vmproc.TransferQueue = vm.NewTransferQueue()
+	vmproc.EventQueue = vm.NewEventQueue()
 }
 
 // execContract start a lua vm and execute smart contract script
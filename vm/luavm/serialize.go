@@ -26,6 +26,7 @@ import (
 	"errors"
 
 	"github.com/bocheninc/L0/components/utils"
+	"github.com/bocheninc/L0/vm"
 	lua "github.com/yuin/gopher-lua"
 )
 
@@ -137,3 +138,65 @@ func byteToLValue(buf *bytes.Buffer) (lua.LValue, error) {
 
 	return nil, errors.New("not support data type")
 }
+
+// maxInterfaceDepth the max nesting depth of tables converted to go value
+const maxInterfaceDepth = 32
+
+// lvalueToInterface convert LValue to go value which can be encoded as json,
+// cyclic or too deep tables and more values than the max event size are rejected
+func lvalueToInterface(value lua.LValue) (interface{}, error) {
+	count := 0
+	return toInterface(value, make(map[*lua.LTable]bool), &count)
+}
+
+func toInterface(value lua.LValue, visited map[*lua.LTable]bool, count *int) (interface{}, error) {
+	if *count++; *count > vm.VMConf.ExecLimitMaxEventSize {
+		return nil, errors.New("too many values")
+	}
+
+	switch value.(type) {
+	case lua.LString:
+		return value.String(), nil
+	case lua.LBool:
+		return bool(value.(lua.LBool)), nil
+	case lua.LNumber:
+		return float64(value.(lua.LNumber)), nil
+	case *lua.LTable:
+		tb := value.(*lua.LTable)
+		if visited[tb] {
+			return nil, errors.New("cyclic table")
+		}
+		if len(visited) >= maxInterfaceDepth {
+			return nil, errors.New("table nested too deep")
+		}
+		visited[tb] = true
+		defer delete(visited, tb)
+
+		if n := tb.MaxN(); n > 0 && n == tb.ElementCount() {
+			arr := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				v, err := toInterface(tb.RawGetInt(i), visited, count)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, v)
+			}
+			return arr, nil
+		}
+
+		var err error
+		mp := make(map[string]interface{}, tb.ElementCount())
+		tb.ForEach(func(k lua.LValue, v lua.LValue) {
+			if err != nil {
+				return
+			}
+			mp[k.String()], err = toInterface(v, visited, count)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return mp, nil
+	}
+
+	return nil, nil
+}
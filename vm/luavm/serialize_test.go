@@ -19,12 +19,14 @@
 package luavm
 
 import (
+	"encoding/json"
 	"testing"
 
 	"bytes"
 
 	"fmt"
 
+	"github.com/bocheninc/L0/vm"
 	lua "github.com/yuin/gopher-lua"
 )
 
@@ -75,3 +77,53 @@ func TestLValueConvert(t *testing.T) {
 	})
 
 }
+
+func TestLValueToInterface(t *testing.T) {
+	vm.VMConf = vm.DefaultConfig()
+
+	arr := new(lua.LTable)
+	arr.Append(lua.LNumber(1))
+	arr.Append(lua.LString("two"))
+
+	tb := new(lua.LTable)
+	tb.RawSetString("arr", arr)
+	tb.RawSetString("ok", lua.LBool(true))
+	tb.RawSetString("again", arr)
+
+	value, err := lvalueToInterface(tb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(value)
+	if err != nil || string(data) != `{"again":[1,"two"],"arr":[1,"two"],"ok":true}` {
+		t.Errorf("convert table to json error %s %v", data, err)
+	}
+
+	cyclic := new(lua.LTable)
+	cyclic.RawSetString("self", cyclic)
+	if _, err := lvalueToInterface(cyclic); err == nil {
+		t.Error("convert cyclic table")
+	}
+
+	deep := new(lua.LTable)
+	for i := 0; i < maxInterfaceDepth; i++ {
+		parent := new(lua.LTable)
+		parent.RawSetString("child", deep)
+		deep = parent
+	}
+	if _, err := lvalueToInterface(deep); err == nil {
+		t.Error("convert too deep table")
+	}
+
+	// shared tables are converted for every reference
+	wide := new(lua.LTable)
+	for i := 0; i < 20; i++ {
+		parent := new(lua.LTable)
+		parent.RawSetString("a", wide)
+		parent.RawSetString("b", wide)
+		wide = parent
+	}
+	if _, err := lvalueToInterface(wide); err == nil {
+		t.Error("convert too many values")
+	}
+}
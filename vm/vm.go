@@ -233,6 +233,17 @@ func requestHandle(vmproc *VMProc, req *InvokeData) (interface{}, error) {
 		vmproc.L0Handler.AddTransfer(fromAddr, toAddr, big.NewInt(amount), txType)
 		return true, nil
 
+	case "AddEvent":
+		var (
+			name string
+			data []byte
+		)
+		if err := req.DecodeParams(&name, &data); err != nil {
+			return nil, err
+		}
+		vmproc.L0Handler.AddEvent(name, data)
+		return true, nil
+
 	case "SmartContractFailed":
 		vmproc.L0Handler.SmartContractFailed()
 		return true, nil
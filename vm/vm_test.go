@@ -109,6 +109,10 @@ func (hd *L0Handler) AddTransfer(fromAddr, toAddr string, amount *big.Int, txTyp
 	fmt.Printf("AddTransfer from:%s to:%s amount:%d txType:%d", fromAddr, toAddr, amount.Int64(), txType)
 }
 
+func (hd *L0Handler) AddEvent(name string, data []byte) {
+	fmt.Printf("AddEvent name:%s data:%s", name, data)
+}
+
 func (hd *L0Handler) SmartContractFailed() {
 
 }
@@ -46,6 +46,7 @@ type VMProc struct {
 	RequestMap       map[uint32]chan *InvokeData
 	StateChangeQueue *stateQueue
 	TransferQueue    *transferQueue
+	EventQueue       *eventQueue
 	SessionID        uint32
 	sendChan         chan []interface{}
 	receiveChan      chan *InvokeData